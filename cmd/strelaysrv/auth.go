@@ -0,0 +1,82 @@
+// Copyright (C) 2019 Audrius Butkevicius and Contributors.
+
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"golang.org/x/time/rate"
+
+	syncthingprotocol "github.com/syncthing/syncthing/lib/protocol"
+)
+
+var (
+	permittedTokens map[string]struct{}
+	permittedIDs    map[syncthingprotocol.DeviceID]struct{}
+
+	deviceLimitersMut = sync.Mutex{}
+	deviceLimiters    = make(map[syncthingprotocol.DeviceID]*rate.Limiter)
+)
+
+// parseAuthFlags populates the permitted token and device ID sets from the
+// comma separated flag values. A nil set means no restriction of that kind.
+func parseAuthFlags(tokens, allowedIDs string) {
+	if tokens != "" {
+		permittedTokens = make(map[string]struct{})
+		for _, token := range strings.Split(tokens, ",") {
+			token = strings.TrimSpace(token)
+			if token != "" {
+				permittedTokens[token] = struct{}{}
+			}
+		}
+	}
+	if allowedIDs != "" {
+		permittedIDs = make(map[syncthingprotocol.DeviceID]struct{})
+		for _, idStr := range strings.Split(allowedIDs, ",") {
+			idStr = strings.TrimSpace(idStr)
+			if idStr == "" {
+				continue
+			}
+			id, err := syncthingprotocol.DeviceIDFromString(idStr)
+			if err != nil {
+				log.Fatalf("Invalid device ID %q in -allowed-ids: %v", idStr, err)
+			}
+			permittedIDs[id] = struct{}{}
+		}
+	}
+}
+
+// deviceAuthorized checks a device against the configured access control.
+// With no tokens or device IDs configured the relay is open to everyone;
+// otherwise the device must either be in the ID allow list or present one
+// of the issued tokens.
+func deviceAuthorized(id syncthingprotocol.DeviceID, token string) bool {
+	if permittedTokens == nil && permittedIDs == nil {
+		return true
+	}
+	if _, ok := permittedIDs[id]; ok {
+		return true
+	}
+	if _, ok := permittedTokens[token]; ok {
+		return true
+	}
+	return false
+}
+
+// deviceLimiter returns the rate limiter shared by all sessions of the
+// given device, or nil when no per device rate limit is configured.
+func deviceLimiter(id syncthingprotocol.DeviceID) *rate.Limiter {
+	if deviceLimitBps <= 0 {
+		return nil
+	}
+	deviceLimitersMut.Lock()
+	defer deviceLimitersMut.Unlock()
+	limiter, ok := deviceLimiters[id]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(deviceLimitBps), 2*deviceLimitBps)
+		deviceLimiters[id] = limiter
+	}
+	return limiter
+}
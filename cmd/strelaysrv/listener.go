@@ -119,6 +119,15 @@ func protocolConnectionHandler(tcpConn net.Conn, config *tls.Config) {
 
 			switch msg := message.(type) {
 			case protocol.JoinRelayRequest:
+				if !deviceAuthorized(id, msg.Token) {
+					protocol.WriteMessage(conn, protocol.ResponsePermissionDenied)
+					if debug {
+						log.Println("Refusing join request from", id, "due to failed authorization")
+					}
+					conn.Close()
+					continue
+				}
+
 				if atomic.LoadInt32(&overLimit) > 0 {
 					protocol.WriteMessage(conn, protocol.RelayFull{})
 					if debug {
@@ -150,6 +159,25 @@ func protocolConnectionHandler(tcpConn net.Conn, config *tls.Config) {
 
 			case protocol.ConnectRequest:
 				requestedPeer := syncthingprotocol.DeviceIDFromBytes(msg.ID)
+
+				if !deviceAuthorized(id, msg.Token) {
+					protocol.WriteMessage(conn, protocol.ResponsePermissionDenied)
+					if debug {
+						log.Println("Refusing connect request from", id, "due to failed authorization")
+					}
+					conn.Close()
+					continue
+				}
+
+				if deviceSessionLimit > 0 && (numSessions(id) >= deviceSessionLimit || numSessions(requestedPeer) >= deviceSessionLimit) {
+					protocol.WriteMessage(conn, protocol.ResponsePermissionDenied)
+					if debug {
+						log.Println("Refusing connect request between", id, "and", requestedPeer, "due to the session quota")
+					}
+					conn.Close()
+					continue
+				}
+
 				outboxesMut.RLock()
 				peerOutbox, ok := outboxes[requestedPeer]
 				outboxesMut.RUnlock()
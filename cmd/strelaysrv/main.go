@@ -64,13 +64,15 @@ var (
 
 	limitCheckTimer *time.Timer
 
-	sessionLimitBps   int
-	globalLimitBps    int
-	overLimit         int32
-	descriptorLimit   int64
-	sessionLimiter    *rate.Limiter
-	globalLimiter     *rate.Limiter
-	networkBufferSize int
+	sessionLimitBps    int
+	globalLimitBps     int
+	deviceLimitBps     int
+	deviceSessionLimit int
+	overLimit          int32
+	descriptorLimit    int64
+	sessionLimiter     *rate.Limiter
+	globalLimiter      *rate.Limiter
+	networkBufferSize  int
 
 	statusAddr       string
 	poolAddrs        string
@@ -96,6 +98,7 @@ func main() {
 	log.SetFlags(log.Lshortfile | log.LstdFlags)
 
 	var dir, extAddress, proto string
+	var tokens, allowedIDs string
 
 	flag.StringVar(&listen, "listen", ":22067", "Protocol listen address")
 	flag.StringVar(&dir, "keys", ".", "Directory where cert.pem and key.pem is stored")
@@ -104,6 +107,10 @@ func main() {
 	flag.DurationVar(&messageTimeout, "message-timeout", messageTimeout, "Maximum amount of time we wait for relevant messages to arrive")
 	flag.IntVar(&sessionLimitBps, "per-session-rate", sessionLimitBps, "Per session rate limit, in bytes/s")
 	flag.IntVar(&globalLimitBps, "global-rate", globalLimitBps, "Global rate limit, in bytes/s")
+	flag.IntVar(&deviceLimitBps, "per-device-rate", deviceLimitBps, "Per device rate limit across all of its sessions, in bytes/s")
+	flag.IntVar(&deviceSessionLimit, "per-device-sessions", deviceSessionLimit, "Maximum number of concurrent sessions per device, 0 for unlimited")
+	flag.StringVar(&tokens, "tokens", "", "Comma separated list of access tokens.\n\tWhen set, clients must add ?token=... to the relay address to use the relay.")
+	flag.StringVar(&allowedIDs, "allowed-ids", "", "Comma separated list of device IDs allowed to use the relay without a token")
 	flag.BoolVar(&debug, "debug", debug, "Enable debug output")
 	flag.StringVar(&statusAddr, "status-srv", ":22070", "Listen address for status service (blank to disable)")
 	flag.StringVar(&poolAddrs, "pools", defaultPoolAddrs, "Comma separated list of relay pool addresses to join")
@@ -118,6 +125,8 @@ func main() {
 	flag.IntVar(&networkBufferSize, "network-buffer", 2048, "Network buffer size (two of these per proxied connection)")
 	flag.Parse()
 
+	parseAuthFlags(tokens, allowedIDs)
+
 	if extAddress == "" {
 		extAddress = listen
 	}
@@ -243,6 +252,10 @@ func main() {
 
 	log.Println("URI:", uri.String())
 
+	if (permittedTokens != nil || permittedIDs != nil) && poolAddrs == defaultPoolAddrs {
+		log.Println(`Authentication is enabled; use -pools="" to keep the relay out of the public pool.`)
+	}
+
 	if poolAddrs == defaultPoolAddrs {
 		log.Println("!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!")
 		log.Println("!!  Joining default relay pools, this relay will be available for public use. !!")
@@ -45,7 +45,7 @@ func newSession(serverid, clientid syncthingprotocol.DeviceID, sessionRateLimit,
 		serverid:  serverid,
 		clientkey: clientkey,
 		clientid:  clientid,
-		rateLimit: makeRateLimitFunc(sessionRateLimit, globalRateLimit),
+		rateLimit: makeRateLimitFunc(sessionRateLimit, globalRateLimit, deviceLimiter(serverid), deviceLimiter(clientid)),
 		connsChan: make(chan net.Conn),
 		conns:     make([]net.Conn, 0, 2),
 	}
@@ -87,6 +87,18 @@ func dropSessions(id syncthingprotocol.DeviceID) {
 	sessionMut.RUnlock()
 }
 
+func numSessions(id syncthingprotocol.DeviceID) int {
+	sessionMut.RLock()
+	num := 0
+	for _, session := range activeSessions {
+		if session.HasParticipant(id) {
+			num++
+		}
+	}
+	sessionMut.RUnlock()
+	return num
+}
+
 func hasSessions(id syncthingprotocol.DeviceID) bool {
 	sessionMut.RLock()
 	has := false
@@ -284,12 +296,16 @@ func (s *session) String() string {
 	return fmt.Sprintf("<%s/%s>", hex.EncodeToString(s.clientkey)[:5], hex.EncodeToString(s.serverkey)[:5])
 }
 
-func makeRateLimitFunc(sessionRateLimit, globalRateLimit *rate.Limiter) func(int) {
-	// This may be a case of super duper premature optimization... We build an
-	// optimized function to do the rate limiting here based on what we need
-	// to do and then use it in the loop.
+func makeRateLimitFunc(limiters ...*rate.Limiter) func(int) {
+	// Skip the limiters that are not configured.
+	ls := make([]*rate.Limiter, 0, len(limiters))
+	for _, limiter := range limiters {
+		if limiter != nil {
+			ls = append(ls, limiter)
+		}
+	}
 
-	if sessionRateLimit == nil && globalRateLimit == nil {
+	if len(ls) == 0 {
 		// No limiting needed. We could equally well return a func(int64){} and
 		// not do a nil check were we use it, but I think the nil check there
 		// makes it clear that there will be no limiting if none is
@@ -297,24 +313,9 @@ func makeRateLimitFunc(sessionRateLimit, globalRateLimit *rate.Limiter) func(int
 		return nil
 	}
 
-	if sessionRateLimit == nil {
-		// We only have a global limiter
-		return func(bytes int) {
-			take(bytes, globalRateLimit)
-		}
-	}
-
-	if globalRateLimit == nil {
-		// We only have a session limiter
-		return func(bytes int) {
-			take(bytes, sessionRateLimit)
-		}
-	}
-
-	// We have both. Queue the bytes on both the global and session specific
-	// rate limiters.
+	// Queue the bytes on all configured rate limiters.
 	return func(bytes int) {
-		take(bytes, sessionRateLimit, globalRateLimit)
+		take(bytes, ls...)
 	}
 }
 
@@ -0,0 +1,73 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/syncthing/syncthing/lib/db"
+	"github.com/syncthing/syncthing/lib/events"
+)
+
+// The eventLogService records events into the persistent event log in
+// the database, so that history survives restarts and can be queried
+// through /rest/events/stored. Download progress events are excluded;
+// they are frequent, transient and of no value after the fact.
+
+const eventLogMask = events.AllEvents &^ events.DownloadProgress
+
+type eventLogService struct {
+	log     *db.EventLog
+	stop    chan struct{}
+	started chan struct{}
+}
+
+func newEventLogService(log *db.EventLog) *eventLogService {
+	return &eventLogService{
+		log:     log,
+		stop:    make(chan struct{}),
+		started: make(chan struct{}),
+	}
+}
+
+func (s *eventLogService) Serve() {
+	sub := events.Default.Subscribe(eventLogMask)
+	defer events.Default.Unsubscribe(sub)
+	close(s.started)
+
+	for {
+		select {
+		case ev := <-sub.C():
+			data, err := json.Marshal(ev.Data)
+			if err != nil {
+				continue
+			}
+			s.log.Append(db.StoredEvent{
+				Time:   ev.Time,
+				Type:   ev.Type.String(),
+				Folder: eventDataString(ev.Data, "folder"),
+				Data:   data,
+			})
+
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *eventLogService) Stop() {
+	close(s.stop)
+}
+
+func (s *eventLogService) String() string {
+	return "eventLogService"
+}
+
+// WaitForStart returns once the service is subscribed to events.
+func (s *eventLogService) WaitForStart() {
+	<-s.started
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"time"
+
+	"github.com/syncthing/syncthing/lib/config"
+)
+
+// The folder scheduler service pauses and resumes folders that have a
+// sync schedule configured, going through the ordinary pause machinery
+// so the rest of the system (GUI, events, connections) sees a normal
+// pause. A folder without a schedule is never touched.
+type folderSchedulerService struct {
+	cfg  *config.Wrapper
+	stop chan struct{}
+}
+
+func newFolderSchedulerService(cfg *config.Wrapper) *folderSchedulerService {
+	return &folderSchedulerService{
+		cfg:  cfg,
+		stop: make(chan struct{}),
+	}
+}
+
+func (s *folderSchedulerService) Serve() {
+	s.applySchedules(time.Now())
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.applySchedules(now)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *folderSchedulerService) Stop() {
+	close(s.stop)
+}
+
+func (s *folderSchedulerService) applySchedules(now time.Time) {
+	for _, folderCfg := range s.cfg.Folders() {
+		if len(folderCfg.SyncSchedule) == 0 {
+			continue
+		}
+		paused := !config.AnyScheduleWindowMatches(folderCfg.SyncSchedule, now)
+		if folderCfg.Paused == paused {
+			continue
+		}
+		if paused {
+			l.Infof("Pausing folder %v (outside sync schedule)", folderCfg.Description())
+		} else {
+			l.Infof("Resuming folder %v (inside sync schedule)", folderCfg.Description())
+		}
+		folderCfg.Paused = paused
+		if _, err := s.cfg.SetFolder(folderCfg); err != nil {
+			l.Warnln("Folder scheduler:", err)
+		}
+	}
+}
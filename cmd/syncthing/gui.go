@@ -34,8 +34,11 @@ import (
 	"github.com/syncthing/syncthing/lib/discover"
 	"github.com/syncthing/syncthing/lib/events"
 	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/ignore"
 	"github.com/syncthing/syncthing/lib/logger"
 	"github.com/syncthing/syncthing/lib/model"
+	"github.com/syncthing/syncthing/lib/osutil"
+	"github.com/syncthing/syncthing/lib/pairing"
 	"github.com/syncthing/syncthing/lib/protocol"
 	"github.com/syncthing/syncthing/lib/rand"
 	"github.com/syncthing/syncthing/lib/stats"
@@ -78,6 +81,7 @@ type apiService struct {
 	started            chan string   // signals startup complete by sending the listener address, for testing only
 	startedOnce        chan struct{} // the service has started successfully at least once
 	cpu                rater
+	eventLog           *db.EventLog // persistent event log; nil when disabled
 
 	guiErrors logger.Recorder
 	systemLog logger.Recorder
@@ -85,8 +89,10 @@ type apiService struct {
 
 type modelIntf interface {
 	GlobalDirectoryTree(folder, prefix string, levels int, dirsonly bool) map[string]interface{}
+	GlobalDirectoryListing(folder, prefix string, page, perpage int) ([]model.GlobalListItem, error)
 	Completion(device protocol.DeviceID, folder string) model.FolderCompletion
 	Override(folder string)
+	OverrideFile(folder, file string)
 	Revert(folder string)
 	NeedFolderFiles(folder string, page, perpage int) ([]db.FileInfoTruncated, []db.FileInfoTruncated, []db.FileInfoTruncated)
 	RemoteNeedFolderFiles(device protocol.DeviceID, folder string, page, perpage int) ([]db.FileInfoTruncated, error)
@@ -94,14 +100,27 @@ type modelIntf interface {
 	ConnectionStats() map[string]interface{}
 	DeviceStatistics() map[string]stats.DeviceStatistics
 	FolderStatistics() map[string]stats.FolderStatistics
+	TransferStatistics() stats.TransferStatistics
 	CurrentFolderFile(folder string, file string) (protocol.FileInfo, bool)
 	CurrentGlobalFile(folder string, file string) (protocol.FileInfo, bool)
+	History(folder, file string) ([]model.FileHistoryEntry, error)
 	ResetFolder(folder string)
 	Availability(folder string, file protocol.FileInfo, block protocol.BlockInfo) []model.Availability
 	GetIgnores(folder string) ([]string, []string, error)
+	TestIgnores(folder string, paths []string) ([]ignore.MatchExplanation, error)
 	GetFolderVersions(folder string) (map[string][]versioner.FileVersion, error)
+	GetFileVersions(folder, file string) ([]versioner.FileVersion, error)
+	RestoreFileVersion(folder, file string, versionTime time.Time) error
+	Conflicts(folder string) ([]model.Conflict, error)
+	DeleteConflict(folder, path string) error
+	PromoteConflict(folder, path string) error
 	RestoreFolderVersions(folder string, versions map[string]time.Time) (map[string]string, error)
 	SetIgnores(folder string, content []string) error
+	GetSelection(folder string) []string
+	SetSelection(folder string, prefixes []string) error
+	PullPreview(folder string) ([]model.PullAction, error)
+	ConfirmDeletions(folder string) error
+	VerifyFolder(folder string, repair bool) ([]model.VerifyIssue, error)
 	DelayScan(folder string, next time.Duration)
 	ScanFolder(folder string) error
 	ScanFolders() map[string]error
@@ -111,6 +130,7 @@ type modelIntf interface {
 	GlobalSize(folder string) db.Counts
 	LocalSize(folder string) db.Counts
 	ReceiveOnlyChangedSize(folder string) db.Counts
+	LocalChangedFiles(folder string, page, perpage int) []db.FileInfoTruncated
 	CurrentSequence(folder string) (int64, bool)
 	RemoteSequence(folder string) (int64, bool)
 	State(folder string) (string, time.Time, error)
@@ -122,9 +142,11 @@ type modelIntf interface {
 type configIntf interface {
 	GUI() config.GUIConfiguration
 	LDAP() config.LDAPConfiguration
+	OIDC() config.OIDCConfiguration
 	RawCopy() config.Configuration
 	Options() config.OptionsConfiguration
 	Replace(cfg config.Configuration) (config.Waiter, error)
+	Propose(cfg config.Configuration) []error
 	Subscribe(c config.Committer)
 	Folders() map[string]config.FolderConfiguration
 	Devices() map[protocol.DeviceID]config.DeviceConfiguration
@@ -144,7 +166,7 @@ type rater interface {
 	Rate() float64
 }
 
-func newAPIService(id protocol.DeviceID, cfg configIntf, httpsCertFile, httpsKeyFile, assetDir string, m modelIntf, defaultSub, diskSub events.BufferedSubscription, discoverer discover.CachingMux, connectionsService connectionsIntf, errors, systemLog logger.Recorder, cpu rater) *apiService {
+func newAPIService(id protocol.DeviceID, cfg configIntf, httpsCertFile, httpsKeyFile, assetDir string, m modelIntf, defaultSub, diskSub events.BufferedSubscription, discoverer discover.CachingMux, connectionsService connectionsIntf, errors, systemLog logger.Recorder, cpu rater, eventLog *db.EventLog) *apiService {
 	service := &apiService{
 		id:            id,
 		cfg:           cfg,
@@ -166,6 +188,7 @@ func newAPIService(id protocol.DeviceID, cfg configIntf, httpsCertFile, httpsKey
 		guiErrors:          errors,
 		systemLog:          systemLog,
 		cpu:                cpu,
+		eventLog:           eventLog,
 	}
 
 	return service
@@ -255,18 +278,28 @@ func (s *apiService) Serve() {
 	getRestMux := http.NewServeMux()
 	getRestMux.HandleFunc("/rest/db/completion", s.getDBCompletion)              // device folder
 	getRestMux.HandleFunc("/rest/db/file", s.getDBFile)                          // folder file
+	getRestMux.HandleFunc("/rest/db/history", s.getDBHistory)                    // folder file
 	getRestMux.HandleFunc("/rest/db/ignores", s.getDBIgnores)                    // folder
 	getRestMux.HandleFunc("/rest/db/need", s.getDBNeed)                          // folder [perpage] [page]
 	getRestMux.HandleFunc("/rest/db/remoteneed", s.getDBRemoteNeed)              // device folder [perpage] [page]
+	getRestMux.HandleFunc("/rest/db/localchanged", s.getDBLocalChanged)          // folder [perpage] [page]
+	getRestMux.HandleFunc("/rest/db/selection", s.getDBSelection)                // folder
 	getRestMux.HandleFunc("/rest/db/status", s.getDBStatus)                      // folder
 	getRestMux.HandleFunc("/rest/db/browse", s.getDBBrowse)                      // folder [prefix] [dirsonly] [levels]
-	getRestMux.HandleFunc("/rest/folder/versions", s.getFolderVersions)          // folder
+	getRestMux.HandleFunc("/rest/db/listing", s.getDBListing)                    // folder [prefix] [page] [perpage]
+	getRestMux.HandleFunc("/rest/folder/conflicts", s.getFolderConflicts)        // folder
+	getRestMux.HandleFunc("/rest/folder/file", s.getFolderFile)                  // folder path
+	getRestMux.HandleFunc("/rest/folder/versions", s.getFolderVersions)          // folder [file]
 	getRestMux.HandleFunc("/rest/folder/errors", s.getFolderErrors)              // folder
 	getRestMux.HandleFunc("/rest/folder/pullerrors", s.getFolderErrors)          // folder (deprecated)
+	getRestMux.HandleFunc("/rest/folder/pullpreview", s.getFolderPullPreview)    // folder
+	getRestMux.Handle("/rest/metrics", newPrometheusHandler(s.model, s.cfg))     // -
 	getRestMux.HandleFunc("/rest/events", s.getIndexEvents)                      // [since] [limit] [timeout] [events]
 	getRestMux.HandleFunc("/rest/events/disk", s.getDiskEvents)                  // [since] [limit] [timeout]
+	getRestMux.HandleFunc("/rest/events/stored", s.getStoredEvents)              // [types] [folder] [since] [until] [limit]
 	getRestMux.HandleFunc("/rest/stats/device", s.getDeviceStats)                // -
 	getRestMux.HandleFunc("/rest/stats/folder", s.getFolderStats)                // -
+	getRestMux.HandleFunc("/rest/stats/transfer", s.getTransferStats)            // -
 	getRestMux.HandleFunc("/rest/svc/deviceid", s.getDeviceID)                   // id
 	getRestMux.HandleFunc("/rest/svc/lang", s.getLang)                           // -
 	getRestMux.HandleFunc("/rest/svc/report", s.getReport)                       // -
@@ -287,23 +320,34 @@ func (s *apiService) Serve() {
 
 	// The POST handlers
 	postRestMux := http.NewServeMux()
-	postRestMux.HandleFunc("/rest/db/prio", s.postDBPrio)                          // folder file [perpage] [page]
-	postRestMux.HandleFunc("/rest/db/ignores", s.postDBIgnores)                    // folder
-	postRestMux.HandleFunc("/rest/db/override", s.postDBOverride)                  // folder
-	postRestMux.HandleFunc("/rest/db/revert", s.postDBRevert)                      // folder
-	postRestMux.HandleFunc("/rest/db/scan", s.postDBScan)                          // folder [sub...] [delay]
-	postRestMux.HandleFunc("/rest/folder/versions", s.postFolderVersionsRestore)   // folder <body>
-	postRestMux.HandleFunc("/rest/system/config", s.postSystemConfig)              // <body>
-	postRestMux.HandleFunc("/rest/system/error", s.postSystemError)                // <body>
-	postRestMux.HandleFunc("/rest/system/error/clear", s.postSystemErrorClear)     // -
-	postRestMux.HandleFunc("/rest/system/ping", s.restPing)                        // -
-	postRestMux.HandleFunc("/rest/system/reset", s.postSystemReset)                // [folder]
-	postRestMux.HandleFunc("/rest/system/restart", s.postSystemRestart)            // -
-	postRestMux.HandleFunc("/rest/system/shutdown", s.postSystemShutdown)          // -
-	postRestMux.HandleFunc("/rest/system/upgrade", s.postSystemUpgrade)            // -
-	postRestMux.HandleFunc("/rest/system/pause", s.makeDevicePauseHandler(true))   // [device]
-	postRestMux.HandleFunc("/rest/system/resume", s.makeDevicePauseHandler(false)) // [device]
-	postRestMux.HandleFunc("/rest/system/debug", s.postSystemDebug)                // [enable] [disable]
+	postRestMux.HandleFunc("/rest/db/prio", s.postDBPrio)                           // folder file [perpage] [page]
+	postRestMux.HandleFunc("/rest/db/ignores", s.postDBIgnores)                     // folder
+	postRestMux.HandleFunc("/rest/db/override", s.postDBOverride)                   // folder [file]
+	postRestMux.HandleFunc("/rest/db/revert", s.postDBRevert)                       // folder
+	postRestMux.HandleFunc("/rest/db/selection", s.postDBSelection)                 // folder
+	postRestMux.HandleFunc("/rest/db/scan", s.postDBScan)                           // folder [sub...] [delay]
+	postRestMux.HandleFunc("/rest/db/verify", s.postDBVerify)                       // folder [repair]
+	postRestMux.HandleFunc("/rest/folder/confirmdeletions", s.postConfirmDeletions) // folder
+	postRestMux.HandleFunc("/rest/folder/conflicts/delete", s.postConflictDelete)   // folder path
+	postRestMux.HandleFunc("/rest/folder/conflicts/promote", s.postConflictPromote) // folder path
+	postRestMux.HandleFunc("/rest/folder/file", s.postFolderFile)                   // folder path <body>
+	postRestMux.HandleFunc("/rest/folder/ignores/test", s.postFolderIgnoresTest)    // folder <body>
+	postRestMux.HandleFunc("/rest/folder/versions", s.postFolderVersionsRestore)    // folder [file] [time] <body>
+	postRestMux.HandleFunc("/rest/config/validate", s.postConfigValidate)           // <body>
+	postRestMux.HandleFunc("/rest/system/config", s.postSystemConfig)               // <body>
+	postRestMux.HandleFunc("/rest/system/error", s.postSystemError)                 // <body>
+	postRestMux.HandleFunc("/rest/system/error/clear", s.postSystemErrorClear)      // -
+	postRestMux.HandleFunc("/rest/system/ping", s.restPing)                         // -
+	postRestMux.HandleFunc("/rest/system/reset", s.postSystemReset)                 // [folder]
+	postRestMux.HandleFunc("/rest/system/restart", s.postSystemRestart)             // -
+	postRestMux.HandleFunc("/rest/system/shutdown", s.postSystemShutdown)           // -
+	postRestMux.HandleFunc("/rest/system/upgrade", s.postSystemUpgrade)             // -
+	postRestMux.HandleFunc("/rest/system/pause", s.makeDevicePauseHandler(true))    // [device]
+	postRestMux.HandleFunc("/rest/system/totp", s.postSystemTOTP)                   // -
+	postRestMux.HandleFunc("/rest/system/pairing/host", s.postSystemPairingHost)    // [folder]
+	postRestMux.HandleFunc("/rest/system/pairing/join", s.postSystemPairingJoin)    // pin
+	postRestMux.HandleFunc("/rest/system/resume", s.makeDevicePauseHandler(false))  // [device]
+	postRestMux.HandleFunc("/rest/system/debug", s.postSystemDebug)                 // [enable] [disable]
 
 	// Debug endpoints, not for general use
 	debugMux := http.NewServeMux()
@@ -338,8 +382,10 @@ func (s *apiService) Serve() {
 	// Add our version and ID as a header to responses
 	handler = withDetailsMiddleware(s.id, handler)
 
-	// Wrap everything in basic auth, if user/password is set.
-	if guiCfg.IsAuthEnabled() {
+	// Wrap everything in authentication, if configured.
+	if guiCfg.AuthMode == config.AuthModeOIDC {
+		handler = oidcMiddleware("sessionid-"+s.id.String()[:5], guiCfg, s.cfg.OIDC(), handler)
+	} else if guiCfg.IsAuthEnabled() {
 		handler = basicAuthAndSessionMiddleware("sessionid-"+s.id.String()[:5], guiCfg, s.cfg.LDAP(), handler)
 	}
 
@@ -426,7 +472,7 @@ func (s *apiService) CommitConfiguration(from, to config.Configuration) bool {
 	// No action required when this changes, so mask the fact that it changed at all.
 	from.GUI.Debugging = to.GUI.Debugging
 
-	if to.GUI == from.GUI {
+	if reflect.DeepEqual(to.GUI, from.GUI) {
 		return true
 	}
 
@@ -659,6 +705,30 @@ func (s *apiService) getDBBrowse(w http.ResponseWriter, r *http.Request) {
 	sendJSON(w, s.model.GlobalDirectoryTree(folder, prefix, levels, dirsonly))
 }
 
+func (s *apiService) getDBListing(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	page, _ := strconv.Atoi(qs.Get("page"))
+	perpage, _ := strconv.Atoi(qs.Get("perpage"))
+	if page < 1 {
+		page = 1
+	}
+
+	listing, err := s.model.GlobalDirectoryListing(qs.Get("folder"), qs.Get("prefix"), page, perpage)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if listing == nil {
+		// Serializes as `[]`, not `null`.
+		listing = []model.GlobalListItem{}
+	}
+	sendJSON(w, map[string]interface{}{
+		"listing": listing,
+		"page":    page,
+		"perpage": perpage,
+	})
+}
+
 func (s *apiService) getDBCompletion(w http.ResponseWriter, r *http.Request) {
 	var qs = r.URL.Query()
 	var folder = qs.Get("folder")
@@ -759,6 +829,10 @@ func folderSummary(cfg configIntf, m modelIntf, folder string) (map[string]inter
 func (s *apiService) postDBOverride(w http.ResponseWriter, r *http.Request) {
 	var qs = r.URL.Query()
 	var folder = qs.Get("folder")
+	if file := qs.Get("file"); file != "" {
+		go s.model.OverrideFile(folder, file)
+		return
+	}
 	go s.model.Override(folder)
 }
 
@@ -823,6 +897,22 @@ func (s *apiService) getDBRemoteNeed(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *apiService) getDBLocalChanged(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	folder := qs.Get("folder")
+
+	page, perpage := getPagingParams(qs)
+
+	files := s.model.LocalChangedFiles(folder, page, perpage)
+
+	sendJSON(w, map[string]interface{}{
+		"files":   toNeedSlice(files),
+		"page":    page,
+		"perpage": perpage,
+	})
+}
+
 func (s *apiService) getSystemConnections(w http.ResponseWriter, r *http.Request) {
 	sendJSON(w, s.model.ConnectionStats())
 }
@@ -835,6 +925,10 @@ func (s *apiService) getFolderStats(w http.ResponseWriter, r *http.Request) {
 	sendJSON(w, s.model.FolderStatistics())
 }
 
+func (s *apiService) getTransferStats(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, s.model.TransferStatistics())
+}
+
 func (s *apiService) getDBFile(w http.ResponseWriter, r *http.Request) {
 	qs := r.URL.Query()
 	folder := qs.Get("folder")
@@ -856,8 +950,31 @@ func (s *apiService) getDBFile(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (s *apiService) getDBHistory(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	hist, err := s.model.History(qs.Get("folder"), qs.Get("file"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if hist == nil {
+		// Serializes as `[]`, not `null`.
+		hist = []model.FileHistoryEntry{}
+	}
+	sendJSON(w, map[string]interface{}{
+		"history": hist,
+	})
+}
+
 func (s *apiService) getSystemConfig(w http.ResponseWriter, r *http.Request) {
-	sendJSON(w, s.cfg.RawCopy())
+	cfg := s.cfg.RawCopy()
+	if isRestricted(r) {
+		// Non-admin principals may read the configuration, but the
+		// secrets in it (API keys, passwords) would let them escalate
+		// to admin.
+		cfg.RedactSecrets()
+	}
+	sendJSON(w, cfg)
 }
 
 func (s *apiService) postSystemConfig(w http.ResponseWriter, r *http.Request) {
@@ -903,6 +1020,123 @@ func (s *apiService) postSystemConfig(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *apiService) postSystemTOTP(w http.ResponseWriter, r *http.Request) {
+	secret, err := newTOTPSecret()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	raw := s.cfg.RawCopy()
+	raw.GUI.TOTPSecret = secret
+	if _, err := s.cfg.Replace(raw); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.cfg.Save(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	account := raw.GUI.User
+	if account == "" {
+		account = s.id.String()[:7]
+	}
+	provisioningURL := fmt.Sprintf("otpauth://totp/Syncthing:%s?secret=%s&issuer=Syncthing", account, secret)
+	sendJSON(w, map[string]string{
+		"secret": secret,
+		"url":    provisioningURL,
+		"qr":     "/qr/?text=" + url.QueryEscape(provisioningURL),
+	})
+}
+
+func (s *apiService) postSystemPairingHost(w http.ResponseWriter, r *http.Request) {
+	var folderID, folderLabel string
+	if folder := r.URL.Query().Get("folder"); folder != "" {
+		fcfg, ok := s.cfg.Folders()[folder]
+		if !ok {
+			http.Error(w, "no such folder", http.StatusNotFound)
+			return
+		}
+		folderID = fcfg.ID
+		folderLabel = fcfg.Label
+	}
+
+	pin := pairing.GeneratePIN()
+
+	// The exchange happens in the background; the paired device shows up
+	// in the configuration when the other side has entered the PIN.
+	go func() {
+		res, err := pairing.Host(pin, s.id, folderID, folderLabel, 2*time.Minute)
+		if err != nil {
+			l.Infoln("Pairing:", err)
+			return
+		}
+		if err := s.addPairedDevice(res.Device); err != nil {
+			l.Infoln("Pairing:", err)
+			return
+		}
+		l.Infof("Paired with device %v at %v", res.Device, res.Address)
+	}()
+
+	sendJSON(w, map[string]string{
+		"pin": pin,
+		"qr":  "/qr/?text=" + url.QueryEscape(pin),
+	})
+}
+
+func (s *apiService) postSystemPairingJoin(w http.ResponseWriter, r *http.Request) {
+	pin := r.URL.Query().Get("pin")
+	if pin == "" {
+		http.Error(w, "missing pin parameter", http.StatusBadRequest)
+		return
+	}
+
+	res, err := pairing.Join(pin, s.id, time.Minute)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.addPairedDevice(res.Device); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	l.Infof("Paired with device %v at %v", res.Device, res.Address)
+
+	sendJSON(w, res)
+}
+
+// addPairedDevice adds the device to the configuration, unless it is
+// already there.
+func (s *apiService) addPairedDevice(device protocol.DeviceID) error {
+	if _, ok := s.cfg.Devices()[device]; ok {
+		return nil
+	}
+	if _, err := s.cfg.SetDevice(config.NewDeviceConfiguration(device, "")); err != nil {
+		return err
+	}
+	return s.cfg.Save()
+}
+
+func (s *apiService) postConfigValidate(w http.ResponseWriter, r *http.Request) {
+	to, err := config.ReadJSON(r.Body, myID)
+	r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	errs := s.cfg.Propose(to)
+	problems := make([]string, len(errs))
+	for i, err := range errs {
+		problems[i] = err.Error()
+	}
+	sendJSON(w, map[string]interface{}{
+		"valid":    len(problems) == 0,
+		"problems": problems,
+	})
+}
+
 func (s *apiService) getSystemConfigInsync(w http.ResponseWriter, r *http.Request) {
 	sendJSON(w, map[string]bool{"configInSync": !s.cfg.RequiresRestart()})
 }
@@ -1228,6 +1462,91 @@ func (s *apiService) postDBIgnores(w http.ResponseWriter, r *http.Request) {
 	s.getDBIgnores(w, r)
 }
 
+func (s *apiService) postConfirmDeletions(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	if err := s.model.ConfirmDeletions(qs.Get("folder")); err != nil {
+		http.Error(w, err.Error(), 500)
+	}
+}
+
+func (s *apiService) postFolderIgnoresTest(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	bs, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	var data map[string][]string
+	if err := json.Unmarshal(bs, &data); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	paths := data["paths"]
+	res, err := s.model.TestIgnores(qs.Get("folder"), paths)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	ret := make(map[string]ignore.MatchExplanation, len(paths))
+	for i, path := range paths {
+		ret[path] = res[i]
+	}
+	sendJSON(w, ret)
+}
+
+func (s *apiService) getDBSelection(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	sendJSON(w, map[string][]string{
+		"selection": s.model.GetSelection(qs.Get("folder")),
+	})
+}
+
+func (s *apiService) getFolderPullPreview(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	actions, err := s.model.PullPreview(qs.Get("folder"))
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	sendJSON(w, map[string][]model.PullAction{
+		"actions": actions,
+	})
+}
+
+func (s *apiService) postDBSelection(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	bs, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	var data map[string][]string
+	err = json.Unmarshal(bs, &data)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	if err := s.model.SetSelection(qs.Get("folder"), data["selection"]); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	s.getDBSelection(w, r)
+}
+
 func (s *apiService) getIndexEvents(w http.ResponseWriter, r *http.Request) {
 	s.fss.gotEventRequest()
 	mask := s.getEventMask(r.URL.Query().Get("events"))
@@ -1269,6 +1588,45 @@ func (s *apiService) getEvents(w http.ResponseWriter, r *http.Request, eventSub
 	sendJSON(w, evs)
 }
 
+func (s *apiService) getStoredEvents(w http.ResponseWriter, r *http.Request) {
+	if s.eventLog == nil {
+		http.Error(w, "Persistent event log is not enabled", http.StatusNotFound)
+		return
+	}
+
+	qs := r.URL.Query()
+	filter := db.EventFilter{
+		Folder: qs.Get("folder"),
+	}
+	if types := qs.Get("types"); types != "" {
+		filter.Types = strings.Split(types, ",")
+	}
+	if since := qs.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			http.Error(w, "Invalid since time: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.Since = t
+	}
+	if until := qs.Get("until"); until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			http.Error(w, "Invalid until time: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.Until = t
+	}
+	filter.Limit, _ = strconv.Atoi(qs.Get("limit"))
+
+	// An empty result serializes as `[]`, not `null`.
+	evs := s.eventLog.Events(filter)
+	if evs == nil {
+		evs = []db.StoredEvent{}
+	}
+	sendJSON(w, evs)
+}
+
 func (s *apiService) getEventMask(evs string) events.EventType {
 	eventMask := defaultEventMask
 	if evs != "" {
@@ -1423,6 +1781,21 @@ func (s *apiService) postDBScan(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *apiService) postDBVerify(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	repair, _ := strconv.ParseBool(qs.Get("repair"))
+
+	issues, err := s.model.VerifyFolder(qs.Get("folder"), repair)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	sendJSON(w, map[string][]model.VerifyIssue{
+		"issues": issues,
+	})
+}
+
 func (s *apiService) postDBPrio(w http.ResponseWriter, r *http.Request) {
 	qs := r.URL.Query()
 	folder := qs.Get("folder")
@@ -1468,8 +1841,103 @@ func (s *apiService) getPeerCompletion(w http.ResponseWriter, r *http.Request) {
 	sendJSON(w, comp)
 }
 
+func (s *apiService) getFolderFile(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	folder := qs.Get("folder")
+	path := qs.Get("path")
+
+	folderCfg, ok := s.cfg.Folders()[folder]
+	if !ok {
+		http.Error(w, "No such folder", http.StatusNotFound)
+		return
+	}
+
+	ffs := folderCfg.Filesystem()
+	info, err := ffs.Stat(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if info.IsDir() {
+		http.Error(w, "Is a directory", http.StatusBadRequest)
+		return
+	}
+
+	fd, err := ffs.Open(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer fd.Close()
+
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filepath.Base(path)+`"`)
+	http.ServeContent(w, r, filepath.Base(path), info.ModTime(), fd)
+}
+
+func (s *apiService) postFolderFile(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	folder := qs.Get("folder")
+	path := qs.Get("path")
+
+	folderCfg, ok := s.cfg.Folders()[folder]
+	if !ok {
+		http.Error(w, "No such folder", http.StatusNotFound)
+		return
+	}
+	if path == "" {
+		http.Error(w, "No path given", http.StatusBadRequest)
+		return
+	}
+
+	ffs := folderCfg.Filesystem()
+	if dir := filepath.Dir(path); dir != "." {
+		if err := ffs.MkdirAll(dir, 0755); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Write to a temporary, ignored name and move it in place when
+	// complete, so the scanner never sees a half written file.
+	tmp := fs.TempName(path)
+	fd, err := ffs.Create(tmp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := io.Copy(fd, r.Body); err != nil {
+		fd.Close()
+		ffs.Remove(tmp)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := fd.Close(); err != nil {
+		ffs.Remove(tmp)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := osutil.TryRename(ffs, tmp, path); err != nil {
+		ffs.Remove(tmp)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.model.ScanFolderSubdirs(folder, []string{path}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 func (s *apiService) getFolderVersions(w http.ResponseWriter, r *http.Request) {
 	qs := r.URL.Query()
+	if file := qs.Get("file"); file != "" {
+		versions, err := s.model.GetFileVersions(qs.Get("folder"), file)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		sendJSON(w, versions)
+		return
+	}
 	versions, err := s.model.GetFolderVersions(qs.Get("folder"))
 	if err != nil {
 		http.Error(w, err.Error(), 500)
@@ -1478,9 +1946,47 @@ func (s *apiService) getFolderVersions(w http.ResponseWriter, r *http.Request) {
 	sendJSON(w, versions)
 }
 
+func (s *apiService) getFolderConflicts(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	conflicts, err := s.model.Conflicts(qs.Get("folder"))
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	sendJSON(w, conflicts)
+}
+
+func (s *apiService) postConflictDelete(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	if err := s.model.DeleteConflict(qs.Get("folder"), qs.Get("path")); err != nil {
+		http.Error(w, err.Error(), 500)
+	}
+}
+
+func (s *apiService) postConflictPromote(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	if err := s.model.PromoteConflict(qs.Get("folder"), qs.Get("path")); err != nil {
+		http.Error(w, err.Error(), 500)
+	}
+}
+
 func (s *apiService) postFolderVersionsRestore(w http.ResponseWriter, r *http.Request) {
 	qs := r.URL.Query()
 
+	if file := qs.Get("file"); file != "" {
+		// Restore a single version, identified by file and time query
+		// parameters rather than a body.
+		versionTime, err := time.Parse(time.RFC3339, qs.Get("time"))
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		if err := s.model.RestoreFileVersion(qs.Get("folder"), file, versionTime); err != nil {
+			http.Error(w, err.Error(), 500)
+		}
+		return
+	}
+
 	bs, err := ioutil.ReadAll(r.Body)
 	r.Body.Close()
 	if err != nil {
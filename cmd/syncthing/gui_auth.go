@@ -8,6 +8,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/base64"
 	"fmt"
@@ -24,10 +25,154 @@ import (
 )
 
 var (
-	sessions    = make(map[string]bool)
+	sessions    = make(map[string]sessionInfo)
 	sessionsMut = sync.NewMutex()
 )
 
+// A sessionInfo is the authorization attached to a logged in session.
+type sessionInfo struct {
+	role    string   // "admin", "observer" or "operator"
+	folders []string // folders an operator may manage
+}
+
+// folderReadEndpoints and folderWriteEndpoints are the REST calls that
+// operate on a single folder, named by the folder query parameter. They
+// bound what folder scoped API keys and operator sessions may do:
+// checking only the query parameter would permit any endpoint at all,
+// including whole config rewrites, just by appending ?folder=x.
+var folderReadEndpoints = map[string]bool{
+	"/rest/db/browse":          true,
+	"/rest/db/completion":      true,
+	"/rest/db/file":            true,
+	"/rest/db/history":         true,
+	"/rest/db/ignores":         true,
+	"/rest/db/listing":         true,
+	"/rest/db/localchanged":    true,
+	"/rest/db/need":            true,
+	"/rest/db/remoteneed":      true,
+	"/rest/db/selection":       true,
+	"/rest/db/status":          true,
+	"/rest/folder/conflicts":   true,
+	"/rest/folder/errors":      true,
+	"/rest/folder/file":        true,
+	"/rest/folder/pullerrors":  true,
+	"/rest/folder/pullpreview": true,
+	"/rest/folder/versions":    true,
+}
+
+var folderWriteEndpoints = map[string]bool{
+	"/rest/db/ignores":               true,
+	"/rest/db/override":              true,
+	"/rest/db/prio":                  true,
+	"/rest/db/revert":                true,
+	"/rest/db/scan":                  true,
+	"/rest/db/selection":             true,
+	"/rest/db/verify":                true,
+	"/rest/folder/confirmdeletions":  true,
+	"/rest/folder/conflicts/delete":  true,
+	"/rest/folder/conflicts/promote": true,
+	"/rest/folder/file":              true,
+	"/rest/folder/ignores/test":      true,
+	"/rest/folder/versions":          true,
+}
+
+// Requests from principals that are not full administrators are marked
+// restricted on the request context. Handlers that return secrets, like
+// the config endpoint, redact them for restricted requests: a readonly
+// key or observer session that could read the plaintext admin API key
+// would be an admin key in all but name.
+type restrictedKeyType int
+
+const restrictedKey restrictedKeyType = 0
+
+// markRestricted flags the request as made by a non-admin principal.
+func markRestricted(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), restrictedKey, true))
+}
+
+// isRestricted returns whether the request was made by a non-admin
+// principal.
+func isRestricted(r *http.Request) bool {
+	restricted, _ := r.Context().Value(restrictedKey).(bool)
+	return restricted
+}
+
+// permitsFolderEndpoint returns true when the request is one of the
+// folder scoped REST calls, restricted to the given folder.
+func permitsFolderEndpoint(r *http.Request, folder string) bool {
+	if folder == "" || r.URL.Query().Get("folder") != folder {
+		return false
+	}
+	if r.Method == "GET" || r.Method == "HEAD" {
+		return folderReadEndpoints[r.URL.Path]
+	}
+	return folderWriteEndpoints[r.URL.Path]
+}
+
+// permits returns true when the session may perform the given request.
+// Observers and operators may read everything; operators may addition-
+// ally make changes through the folder scoped endpoints, on one of
+// their folders.
+func (info sessionInfo) permits(r *http.Request) bool {
+	if info.role == "admin" || !strings.HasPrefix(r.URL.Path, "/rest/") {
+		return true
+	}
+	if r.Method == "GET" || r.Method == "HEAD" {
+		return true
+	}
+	if info.role == "operator" {
+		for _, f := range info.folders {
+			if permitsFolderEndpoint(r, f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// apiKeyScopesAdmin returns true when the scopes make the key a full
+// administrator key: no scopes at all, or the admin scope.
+func apiKeyScopesAdmin(scopes []string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, scope := range scopes {
+		if scope == "admin" {
+			return true
+		}
+	}
+	return false
+}
+
+// apiKeyScopesPermit returns true when any of the scopes attached to an
+// API key permits the given request. A key without scopes permits
+// everything. Folder scopes permit only the folder scoped endpoints,
+// with the folder parameter matching the scope.
+func apiKeyScopesPermit(scopes []string, r *http.Request) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, scope := range scopes {
+		switch {
+		case scope == "admin":
+			return true
+		case scope == "readonly":
+			if r.Method == "GET" || r.Method == "HEAD" {
+				return true
+			}
+		case scope == "events":
+			if strings.HasPrefix(r.URL.Path, "/rest/events") {
+				return true
+			}
+		case strings.HasPrefix(scope, "folder:"):
+			if permitsFolderEndpoint(r, scope[len("folder:"):]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func emitLoginAttempt(success bool, username string) {
 	events.Default.Log(events.LoginAttempt, map[string]interface{}{
 		"success":  success,
@@ -37,7 +182,14 @@ func emitLoginAttempt(success bool, username string) {
 
 func basicAuthAndSessionMiddleware(cookieName string, guiCfg config.GUIConfiguration, ldapCfg config.LDAPConfiguration, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if guiCfg.IsValidAPIKey(r.Header.Get("X-API-Key")) {
+		if scopes, ok := guiCfg.APIKeyScopes(r.Header.Get("X-API-Key")); ok {
+			if !apiKeyScopesPermit(scopes, r) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			if !apiKeyScopesAdmin(scopes) {
+				r = markRestricted(r)
+			}
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -45,9 +197,16 @@ func basicAuthAndSessionMiddleware(cookieName string, guiCfg config.GUIConfigura
 		cookie, err := r.Cookie(cookieName)
 		if err == nil && cookie != nil {
 			sessionsMut.Lock()
-			_, ok := sessions[cookie.Value]
+			info, ok := sessions[cookie.Value]
 			sessionsMut.Unlock()
 			if ok {
+				if !info.permits(r) {
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+				if info.role != "admin" {
+					r = markRestricted(r)
+				}
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -80,15 +239,14 @@ func basicAuthAndSessionMiddleware(cookieName string, guiCfg config.GUIConfigura
 			return
 		}
 
-		authOk := false
 		username := string(fields[0])
 		password := string(fields[1])
 
-		authOk = auth(username, password, guiCfg, ldapCfg)
+		info, authOk := auth(username, password, guiCfg, ldapCfg)
 		if !authOk {
 			usernameIso := string(iso88591ToUTF8([]byte(username)))
 			passwordIso := string(iso88591ToUTF8([]byte(password)))
-			authOk = auth(usernameIso, passwordIso, guiCfg, ldapCfg)
+			info, authOk = auth(usernameIso, passwordIso, guiCfg, ldapCfg)
 			if authOk {
 				username = usernameIso
 			}
@@ -100,9 +258,14 @@ func basicAuthAndSessionMiddleware(cookieName string, guiCfg config.GUIConfigura
 			return
 		}
 
+		if !info.permits(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
 		sessionid := rand.String(32)
 		sessionsMut.Lock()
-		sessions[sessionid] = true
+		sessions[sessionid] = info
 		sessionsMut.Unlock()
 		http.SetCookie(w, &http.Cookie{
 			Name:   cookieName,
@@ -111,16 +274,49 @@ func basicAuthAndSessionMiddleware(cookieName string, guiCfg config.GUIConfigura
 		})
 
 		emitLoginAttempt(true, username)
+		if info.role != "admin" {
+			r = markRestricted(r)
+		}
 		next.ServeHTTP(w, r)
 	})
 }
 
-func auth(username string, password string, guiCfg config.GUIConfiguration, ldapCfg config.LDAPConfiguration) bool {
+func auth(username string, password string, guiCfg config.GUIConfiguration, ldapCfg config.LDAPConfiguration) (sessionInfo, bool) {
+	if guiCfg.TOTPSecret != "" {
+		// The second factor is entered appended to the password.
+		if len(password) <= totpDigits {
+			return sessionInfo{}, false
+		}
+		code := password[len(password)-totpDigits:]
+		if !totpVerify(guiCfg.TOTPSecret, code, time.Now()) {
+			return sessionInfo{}, false
+		}
+		password = password[:len(password)-totpDigits]
+	}
+
 	if guiCfg.AuthMode == config.AuthModeLDAP {
-		return authLDAP(username, password, ldapCfg)
-	} else {
-		return authStatic(username, password, guiCfg.User, guiCfg.Password)
+		if authLDAP(username, password, ldapCfg) {
+			return sessionInfo{role: "admin"}, true
+		}
+		return sessionInfo{}, false
 	}
+
+	// The single user/password pair is the administrator.
+	if guiCfg.User != "" && authStatic(username, password, guiCfg.User, guiCfg.Password) {
+		return sessionInfo{role: "admin"}, true
+	}
+
+	for _, user := range guiCfg.Users {
+		if user.Name == username && bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) == nil {
+			role := user.Role
+			if role == "" {
+				role = "observer"
+			}
+			return sessionInfo{role: role, folders: user.Folders}, true
+		}
+	}
+
+	return sessionInfo{}, false
 }
 
 func authStatic(username string, password string, configUser string, configPassword string) bool {
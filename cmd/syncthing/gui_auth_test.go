@@ -7,8 +7,11 @@
 package main
 
 import (
+	"net/http"
 	"testing"
 
+	"github.com/syncthing/syncthing/lib/config"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -38,3 +41,125 @@ func TestStaticAuthPasswordFail(t *testing.T) {
 		t.Fatalf("should fail auth")
 	}
 }
+
+func TestAPIKeyScopes(t *testing.T) {
+	req := func(method, url string) *http.Request {
+		r, _ := http.NewRequest(method, url, nil)
+		return r
+	}
+
+	cases := []struct {
+		scopes []string
+		r      *http.Request
+		permit bool
+	}{
+		{nil, req("POST", "/rest/system/config"), true},
+		{[]string{"admin"}, req("POST", "/rest/system/config"), true},
+		// Readonly keys may GET the config, but getSystemConfig redacts
+		// the secrets in it for non-admin principals.
+		{[]string{"readonly"}, req("GET", "/rest/system/config"), true},
+		{[]string{"readonly"}, req("POST", "/rest/system/config"), false},
+		{[]string{"events"}, req("GET", "/rest/events"), true},
+		{[]string{"events"}, req("GET", "/rest/system/config"), false},
+		{[]string{"folder:default"}, req("POST", "/rest/db/scan?folder=default"), true},
+		{[]string{"folder:default"}, req("POST", "/rest/db/scan?folder=other"), false},
+		{[]string{"readonly", "folder:default"}, req("POST", "/rest/db/scan?folder=default"), true},
+		{[]string{"folder:default"}, req("GET", "/rest/db/status?folder=default"), true},
+		{[]string{"folder:default"}, req("GET", "/rest/system/config?folder=default"), false},
+		{[]string{"folder:default"}, req("POST", "/rest/system/config?folder=default"), false},
+		{[]string{"folder:default"}, req("POST", "/rest/system/shutdown?folder=default"), false},
+	}
+
+	for i, tc := range cases {
+		if res := apiKeyScopesPermit(tc.scopes, tc.r); res != tc.permit {
+			t.Errorf("case %d: scopes %v on %s %s: got %v, expected %v", i, tc.scopes, tc.r.Method, tc.r.URL, res, tc.permit)
+		}
+	}
+}
+
+func TestAPIKeyScopesAdmin(t *testing.T) {
+	cases := []struct {
+		scopes []string
+		admin  bool
+	}{
+		{nil, true},
+		{[]string{"admin"}, true},
+		{[]string{"readonly", "admin"}, true},
+		{[]string{"readonly"}, false},
+		{[]string{"events"}, false},
+		{[]string{"folder:default"}, false},
+	}
+	for i, tc := range cases {
+		if res := apiKeyScopesAdmin(tc.scopes); res != tc.admin {
+			t.Errorf("case %d: scopes %v: got %v, expected %v", i, tc.scopes, res, tc.admin)
+		}
+	}
+}
+
+func TestRestrictedMarking(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/rest/system/config", nil)
+	if isRestricted(r) {
+		t.Error("unmarked request should not be restricted")
+	}
+	if !isRestricted(markRestricted(r)) {
+		t.Error("marked request should be restricted")
+	}
+}
+
+func TestMultiUserAuth(t *testing.T) {
+	guiCfg := config.GUIConfiguration{
+		User:     "root",
+		Password: string(passwordHashBytes),
+		Users: []config.GUIUserConfiguration{
+			{Name: "kid", Password: string(passwordHashBytes), Role: "operator", Folders: []string{"music"}},
+			{Name: "guest", Password: string(passwordHashBytes)},
+		},
+	}
+
+	if info, ok := auth("root", "pass", guiCfg, config.LDAPConfiguration{}); !ok || info.role != "admin" {
+		t.Errorf("expected admin login, got %v %v", info, ok)
+	}
+	if info, ok := auth("kid", "pass", guiCfg, config.LDAPConfiguration{}); !ok || info.role != "operator" {
+		t.Errorf("expected operator login, got %v %v", info, ok)
+	}
+	if info, ok := auth("guest", "pass", guiCfg, config.LDAPConfiguration{}); !ok || info.role != "observer" {
+		t.Errorf("expected observer login, got %v %v", info, ok)
+	}
+	if _, ok := auth("kid", "wrong", guiCfg, config.LDAPConfiguration{}); ok {
+		t.Error("expected wrong password to fail")
+	}
+}
+
+func TestSessionPermits(t *testing.T) {
+	req := func(method, url string) *http.Request {
+		r, _ := http.NewRequest(method, url, nil)
+		return r
+	}
+
+	admin := sessionInfo{role: "admin"}
+	observer := sessionInfo{role: "observer"}
+	operator := sessionInfo{role: "operator", folders: []string{"music"}}
+
+	cases := []struct {
+		info   sessionInfo
+		r      *http.Request
+		permit bool
+	}{
+		{admin, req("POST", "/rest/system/config"), true},
+		{observer, req("GET", "/rest/system/status"), true},
+		{observer, req("POST", "/rest/system/config"), false},
+		{operator, req("GET", "/rest/system/status"), true},
+		{operator, req("POST", "/rest/db/scan?folder=music"), true},
+		{operator, req("POST", "/rest/db/scan?folder=docs"), false},
+		{operator, req("POST", "/rest/system/config"), false},
+		{operator, req("POST", "/rest/system/config?folder=music"), false},
+		{operator, req("POST", "/rest/system/shutdown?folder=music"), false},
+		{observer, req("GET", "/index.html"), true},
+	}
+
+	for i, tc := range cases {
+		if res := tc.info.permits(tc.r); res != tc.permit {
+			t.Errorf("case %d: role %q on %s %s: got %v, expected %v", i, tc.info.role, tc.r.Method, tc.r.URL, res, tc.permit)
+		}
+	}
+}
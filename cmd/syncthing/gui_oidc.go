@@ -0,0 +1,446 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/rand"
+)
+
+// A minimal OIDC relying party for the GUI and REST API. The provider
+// endpoints are discovered from the issuer, the login uses the standard
+// authorization code flow with PKCE, and the ID token is validated
+// (signature against the provider's JWKS, issuer, audience, expiry and
+// nonce) before a session is created. Claims are fetched from the
+// userinfo endpoint with the access token obtained over TLS from the
+// token endpoint. The configured roles claim is mapped to an admin or
+// read only session; read only sessions may only perform GET requests.
+
+const (
+	oidcStateLifetime = 10 * time.Minute // time allowed to complete a login
+	oidcMaxStates     = 100              // pending logins kept at most
+)
+
+var (
+	oidcSessions = make(map[string]string) // session cookie value -> role
+	oidcStates   = make(map[string]oidcPendingLogin)
+)
+
+// An oidcPendingLogin is a login redirect we have issued and for which
+// we accept a callback, for a limited time.
+type oidcPendingLogin struct {
+	verifier string // PKCE code verifier
+	nonce    string // nonce expected in the ID token
+	created  time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func oidcMiddleware(cookieName string, guiCfg config.GUIConfiguration, oidcCfg config.OIDCConfiguration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// API keys work as they do with the other auth modes.
+		if scopes, ok := guiCfg.APIKeyScopes(r.Header.Get("X-API-Key")); ok {
+			if !apiKeyScopesPermit(scopes, r) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			if !apiKeyScopesAdmin(scopes) {
+				r = markRestricted(r)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/oidc/login":
+			oidcLogin(w, r, oidcCfg)
+			return
+		case "/oidc/callback":
+			oidcCallback(w, r, cookieName, oidcCfg)
+			return
+		}
+
+		if cookie, err := r.Cookie(cookieName); err == nil && cookie != nil {
+			sessionsMut.Lock()
+			role, ok := oidcSessions[cookie.Value]
+			sessionsMut.Unlock()
+			if ok {
+				if role == "readonly" && r.Method != "GET" && r.Method != "HEAD" && strings.HasPrefix(r.URL.Path, "/rest/") {
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+				if role != "admin" {
+					r = markRestricted(r)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		// Browsers are sent into the login flow; API clients get a 401.
+		if strings.HasPrefix(r.URL.Path, "/rest/") {
+			http.Error(w, "Not Authorized", http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, "/oidc/login", http.StatusFound)
+	})
+}
+
+func oidcLogin(w http.ResponseWriter, r *http.Request, oidcCfg config.OIDCConfiguration) {
+	disco, err := oidcDiscover(oidcCfg.Issuer)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	state := rand.String(32)
+	pending := oidcPendingLogin{
+		verifier: rand.String(64),
+		nonce:    rand.String(32),
+		created:  time.Now(),
+	}
+	sessionsMut.Lock()
+	oidcPruneStatesLocked()
+	oidcStates[state] = pending
+	sessionsMut.Unlock()
+
+	challenge := sha256.Sum256([]byte(pending.verifier))
+	query := url.Values{
+		"response_type":         []string{"code"},
+		"client_id":             []string{oidcCfg.ClientID},
+		"redirect_uri":          []string{oidcRedirectURI(r)},
+		"scope":                 []string{"openid profile " + oidcRolesClaim(oidcCfg)},
+		"state":                 []string{state},
+		"nonce":                 []string{pending.nonce},
+		"code_challenge":        []string{base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": []string{"S256"},
+	}
+	http.Redirect(w, r, disco.AuthorizationEndpoint+"?"+query.Encode(), http.StatusFound)
+}
+
+// oidcPruneStatesLocked drops expired pending logins, and the oldest
+// ones beyond the cap, so that unauthenticated hits on /oidc/login
+// cannot grow the map without bound.
+func oidcPruneStatesLocked() {
+	for state, pending := range oidcStates {
+		if time.Since(pending.created) > oidcStateLifetime {
+			delete(oidcStates, state)
+		}
+	}
+	for len(oidcStates) >= oidcMaxStates {
+		oldest := ""
+		for state, pending := range oidcStates {
+			if oldest == "" || pending.created.Before(oidcStates[oldest].created) {
+				oldest = state
+			}
+		}
+		delete(oidcStates, oldest)
+	}
+}
+
+func oidcCallback(w http.ResponseWriter, r *http.Request, cookieName string, oidcCfg config.OIDCConfiguration) {
+	state := r.URL.Query().Get("state")
+	sessionsMut.Lock()
+	pending, ok := oidcStates[state]
+	delete(oidcStates, state)
+	sessionsMut.Unlock()
+	if !ok || time.Since(pending.created) > oidcStateLifetime {
+		http.Error(w, "Invalid login state", http.StatusBadRequest)
+		return
+	}
+
+	disco, err := oidcDiscover(oidcCfg.Issuer)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	resp, err := http.PostForm(disco.TokenEndpoint, url.Values{
+		"grant_type":    []string{"authorization_code"},
+		"code":          []string{r.URL.Query().Get("code")},
+		"redirect_uri":  []string{oidcRedirectURI(r)},
+		"client_id":     []string{oidcCfg.ClientID},
+		"client_secret": []string{oidcCfg.ClientSecret},
+		"code_verifier": []string{pending.verifier},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	resp.Body.Close()
+	if err != nil || token.AccessToken == "" || token.IDToken == "" {
+		emitLoginAttempt(false, "")
+		http.Error(w, "Token exchange failed", http.StatusBadGateway)
+		return
+	}
+
+	if err := oidcValidateIDToken(token.IDToken, disco, oidcCfg, pending.nonce); err != nil {
+		emitLoginAttempt(false, "")
+		l.Infoln("OIDC login: rejecting ID token:", err)
+		http.Error(w, "Invalid ID token", http.StatusForbidden)
+		return
+	}
+
+	claims, err := oidcUserinfo(disco.UserinfoEndpoint, token.AccessToken)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	username, _ := claims["preferred_username"].(string)
+	role := oidcRoleForClaims(claims, oidcCfg)
+	if role == "" {
+		emitLoginAttempt(false, username)
+		http.Error(w, "No matching role", http.StatusForbidden)
+		return
+	}
+	emitLoginAttempt(true, username)
+
+	sessionid := rand.String(32)
+	sessionsMut.Lock()
+	oidcSessions[sessionid] = role
+	sessionsMut.Unlock()
+	http.SetCookie(w, &http.Cookie{
+		Name:   cookieName,
+		Value:  sessionid,
+		MaxAge: 0,
+	})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func oidcDiscover(issuer string) (oidcDiscovery, error) {
+	var disco oidcDiscovery
+	resp, err := http.Get(strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return disco, err
+	}
+	err = json.NewDecoder(resp.Body).Decode(&disco)
+	resp.Body.Close()
+	return disco, err
+}
+
+// oidcValidateIDToken verifies the ID token's signature against the
+// provider's published keys and checks issuer, audience, expiry and
+// nonce. The token endpoint response is not simply trusted; a response
+// that doesn't carry a valid ID token for us does not become a session.
+func oidcValidateIDToken(raw string, disco oidcDiscovery, oidcCfg config.OIDCConfiguration, nonce string) error {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return err
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return err
+	}
+	if header.Alg != "RS256" {
+		return fmt.Errorf("unsupported signature algorithm %q", header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+	key, err := oidcSigningKey(disco.JWKSURI, header.Kid)
+	if err != nil {
+		return err
+	}
+	hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig); err != nil {
+		return fmt.Errorf("invalid signature")
+	}
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	var claims struct {
+		Issuer   string      `json:"iss"`
+		Audience interface{} `json:"aud"` // string or array of strings
+		Expiry   int64       `json:"exp"`
+		Nonce    string      `json:"nonce"`
+	}
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return err
+	}
+
+	issuer := disco.Issuer
+	if issuer == "" {
+		issuer = strings.TrimSuffix(oidcCfg.Issuer, "/")
+	}
+	if claims.Issuer != issuer {
+		return fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if !oidcAudienceContains(claims.Audience, oidcCfg.ClientID) {
+		return fmt.Errorf("token not intended for us")
+	}
+	if time.Now().Unix() >= claims.Expiry {
+		return fmt.Errorf("token expired")
+	}
+	if claims.Nonce != nonce {
+		return fmt.Errorf("unexpected nonce")
+	}
+	return nil
+}
+
+func oidcAudienceContains(aud interface{}, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// oidcSigningKey fetches the provider's JWKS and returns the RSA key
+// with the given ID, or the only RSA key when the token names none.
+func oidcSigningKey(jwksURI, kid string) (*rsa.PublicKey, error) {
+	if jwksURI == "" {
+		return nil, fmt.Errorf("provider offers no jwks_uri")
+	}
+	resp, err := http.Get(jwksURI)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, err
+	}
+
+	for _, key := range jwks.Keys {
+		if key.Kty != "RSA" || (kid != "" && key.Kid != kid) {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	}
+	return nil, fmt.Errorf("no matching signing key")
+}
+
+func oidcUserinfo(endpoint, accessToken string) (map[string]interface{}, error) {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("userinfo: unexpected status %s", resp.Status)
+	}
+
+	var claims map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// oidcRoleForClaims maps the roles claim to "admin", "readonly" or ""
+// (no access). Without a configured admin role, any authenticated user
+// is an admin.
+func oidcRoleForClaims(claims map[string]interface{}, oidcCfg config.OIDCConfiguration) string {
+	if oidcCfg.AdminRole == "" {
+		return "admin"
+	}
+
+	var roles []string
+	switch claim := claims[oidcRolesClaim(oidcCfg)].(type) {
+	case string:
+		roles = strings.Split(claim, " ")
+	case []interface{}:
+		for _, role := range claim {
+			if s, ok := role.(string); ok {
+				roles = append(roles, s)
+			}
+		}
+	}
+
+	result := ""
+	for _, role := range roles {
+		switch role {
+		case oidcCfg.AdminRole:
+			return "admin"
+		case oidcCfg.ReadOnlyRole:
+			result = "readonly"
+		}
+	}
+	return result
+}
+
+func oidcRolesClaim(oidcCfg config.OIDCConfiguration) string {
+	if oidcCfg.RolesClaim != "" {
+		return oidcCfg.RolesClaim
+	}
+	return "groups"
+}
+
+func oidcRedirectURI(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/oidc/callback"
+}
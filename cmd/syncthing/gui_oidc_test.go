@@ -0,0 +1,49 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/syncthing/syncthing/lib/config"
+)
+
+func TestOIDCRoleForClaims(t *testing.T) {
+	cfg := config.OIDCConfiguration{
+		AdminRole:    "syncthing-admins",
+		ReadOnlyRole: "syncthing-users",
+	}
+
+	cases := []struct {
+		claims map[string]interface{}
+		role   string
+	}{
+		{map[string]interface{}{"groups": []interface{}{"syncthing-admins"}}, "admin"},
+		{map[string]interface{}{"groups": []interface{}{"syncthing-users"}}, "readonly"},
+		{map[string]interface{}{"groups": []interface{}{"syncthing-users", "syncthing-admins"}}, "admin"},
+		{map[string]interface{}{"groups": "syncthing-users syncthing-admins"}, "admin"},
+		{map[string]interface{}{"groups": []interface{}{"unrelated"}}, ""},
+		{map[string]interface{}{}, ""},
+	}
+
+	for i, tc := range cases {
+		if role := oidcRoleForClaims(tc.claims, cfg); role != tc.role {
+			t.Errorf("case %d: got %q, expected %q", i, role, tc.role)
+		}
+	}
+
+	// Without a configured admin role, everyone authenticated is admin.
+	if role := oidcRoleForClaims(map[string]interface{}{}, config.OIDCConfiguration{}); role != "admin" {
+		t.Errorf("got %q, expected admin", role)
+	}
+
+	// A custom roles claim is honoured.
+	cfg.RolesClaim = "roles"
+	if role := oidcRoleForClaims(map[string]interface{}{"roles": []interface{}{"syncthing-admins"}}, cfg); role != "admin" {
+		t.Errorf("got %q, expected admin", role)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TOTP (RFC 6238) with the usual parameters: SHA-1, six digits, thirty
+// second steps. The secret is stored base32 encoded, as authenticator
+// apps expect it.
+
+const (
+	totpDigits = 6
+	totpStep   = 30 * time.Second
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newTOTPSecret returns a new random base32 encoded TOTP secret.
+func newTOTPSecret() (string, error) {
+	bs := make([]byte, 20)
+	if _, err := rand.Read(bs); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(bs), nil
+}
+
+// totpCode returns the code for the given secret at the given time.
+func totpCode(secret string, t time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/int64(totpStep.Seconds())))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, code%1000000), nil
+}
+
+// totpVerify returns true when the code is valid for the secret at the
+// given time, allowing one step of clock skew in either direction.
+func totpVerify(secret, code string, t time.Time) bool {
+	for skew := -1; skew <= 1; skew++ {
+		expected, err := totpCode(secret, t.Add(time.Duration(skew)*totpStep))
+		if err != nil {
+			return false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return true
+		}
+	}
+	return false
+}
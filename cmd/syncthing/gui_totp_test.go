@@ -0,0 +1,78 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/config"
+)
+
+// Test vectors from RFC 6238, appendix B, truncated to six digits. The
+// secret is the ASCII string "12345678901234567890" in base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	cases := []struct {
+		t    int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tc := range cases {
+		code, err := totpCode(rfc6238Secret, time.Unix(tc.t, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tc.code {
+			t.Errorf("at %d: got %s, expected %s", tc.t, code, tc.code)
+		}
+	}
+}
+
+func TestTOTPVerify(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	if !totpVerify(rfc6238Secret, "081804", now) {
+		t.Error("expected the current code to verify")
+	}
+	// One step of skew in either direction is accepted.
+	if !totpVerify(rfc6238Secret, "081804", now.Add(totpStep)) {
+		t.Error("expected the previous code to verify")
+	}
+	if totpVerify(rfc6238Secret, "123456", now) {
+		t.Error("expected a wrong code to fail")
+	}
+}
+
+func TestAuthWithTOTP(t *testing.T) {
+	now := time.Now()
+	code, err := totpCode(rfc6238Secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guiCfg := config.GUIConfiguration{
+		User:       "user",
+		Password:   string(passwordHashBytes),
+		TOTPSecret: rfc6238Secret,
+	}
+
+	if _, ok := auth("user", "pass", guiCfg, config.LDAPConfiguration{}); ok {
+		t.Error("expected login without a code to fail")
+	}
+	if _, ok := auth("user", "pass"+code, guiCfg, config.LDAPConfiguration{}); !ok {
+		t.Error("expected login with password and code to pass")
+	}
+	if _, ok := auth("user", "pass000000", guiCfg, config.LDAPConfiguration{}); ok {
+		t.Error("expected login with a wrong code to fail")
+	}
+}
@@ -224,6 +224,7 @@ var (
 
 type RuntimeOptions struct {
 	confDir        string
+	dbBackend      string
 	resetDatabase  bool
 	resetDeltaIdxs bool
 	showVersion    bool
@@ -285,6 +286,7 @@ func parseCommandLineOptions() RuntimeOptions {
 	flag.StringVar(&options.guiAddress, "gui-address", options.guiAddress, "Override GUI address (e.g. \"http://192.0.2.42:8443\")")
 	flag.StringVar(&options.guiAPIKey, "gui-apikey", options.guiAPIKey, "Override GUI API key")
 	flag.StringVar(&options.confDir, "home", "", "Set configuration directory")
+	flag.StringVar(&options.dbBackend, "db-backend", "leveldb", "Select database backend")
 	flag.IntVar(&options.logFlags, "logflags", options.logFlags, "Select information in log line prefix (see below)")
 	flag.BoolVar(&options.noBrowser, "no-browser", false, "Do not start browser")
 	flag.BoolVar(&options.browserOnly, "browser-only", false, "Open GUI in browser")
@@ -682,7 +684,7 @@ func syncthingMain(runtimeOptions RuntimeOptions) {
 	l.Infof("Hashing performance is %.02f MB/s", perf)
 
 	dbFile := locations[locDatabase]
-	ldb, err := db.Open(dbFile)
+	ldb, err := db.OpenBackend(runtimeOptions.dbBackend, dbFile)
 	if err != nil {
 		l.Fatalln("Error opening database:", err)
 	}
@@ -762,6 +764,7 @@ func syncthingMain(runtimeOptions RuntimeOptions) {
 	}
 
 	mainService.Add(m)
+	mainService.Add(newFolderSchedulerService(cfg))
 
 	// Start discovery
 
@@ -772,6 +775,10 @@ func syncthingMain(runtimeOptions RuntimeOptions) {
 	// connections.
 
 	tlsCfg := tlsutil.SecureDefault()
+	if err := tlsutil.ConfigureSuites(tlsCfg, cfg.Options().TLSCipherSuites, cfg.Options().TLSMinVersion); err != nil {
+		l.Warnln("TLS configuration:", err)
+		os.Exit(exitError)
+	}
 	tlsCfg.Certificates = []tls.Certificate{cert}
 	tlsCfg.NextProtos = []string{bepProtocolName}
 	tlsCfg.ClientAuth = tls.RequestClientCert
@@ -814,11 +821,26 @@ func syncthingMain(runtimeOptions RuntimeOptions) {
 		} else {
 			cachedDiscovery.Add(mcd, 0, 0)
 		}
+		// unicasts to any configured static targets
+		if targets := cfg.Options().LocalAnnUnicastTargets; len(targets) > 0 {
+			ucd, err := discover.NewLocalUnicast(myID, targets, connectionsService)
+			if err != nil {
+				l.Warnln("Unicast local discovery:", err)
+			} else {
+				cachedDiscovery.Add(ucd, 0, 0)
+			}
+		}
+	}
+
+	var eventLog *db.EventLog
+	if opts := cfg.Options(); opts.EventLogMaxEvents > 0 {
+		eventLog = db.NewEventLog(ldb, opts.EventLogMaxEvents)
+		mainService.Add(newEventLogService(eventLog))
 	}
 
 	// GUI
 
-	setupGUI(mainService, cfg, m, defaultSub, diskSub, cachedDiscovery, connectionsService, errors, systemLog, runtimeOptions)
+	setupGUI(mainService, cfg, m, defaultSub, diskSub, cachedDiscovery, connectionsService, errors, systemLog, runtimeOptions, eventLog)
 
 	if runtimeOptions.cpuProfile {
 		f, err := os.Create(fmt.Sprintf("cpu-%d.pprof", os.Getpid()))
@@ -855,6 +877,18 @@ func syncthingMain(runtimeOptions RuntimeOptions) {
 	usageReportingSvc := newUsageReportingService(cfg, m, connectionsService)
 	mainService.Add(usageReportingSvc)
 
+	if opts := cfg.Options(); opts.ManagementURL != "" {
+		mainService.Add(newManagedConfigService(cfg))
+	}
+
+	if len(cfg.Webhooks()) > 0 {
+		mainService.Add(newWebhookService(cfg))
+	}
+
+	if cfg.MQTT().Address != "" {
+		mainService.Add(newMQTTService(cfg))
+	}
+
 	if opts := cfg.Options(); opts.RestartOnWakeup {
 		go standbyMonitor()
 	}
@@ -1033,7 +1067,7 @@ func startAuditing(mainService *suture.Supervisor, auditFile string) {
 	l.Infoln("Audit log in", auditDest)
 }
 
-func setupGUI(mainService *suture.Supervisor, cfg *config.Wrapper, m *model.Model, defaultSub, diskSub events.BufferedSubscription, discoverer discover.CachingMux, connectionsService *connections.Service, errors, systemLog logger.Recorder, runtimeOptions RuntimeOptions) {
+func setupGUI(mainService *suture.Supervisor, cfg *config.Wrapper, m *model.Model, defaultSub, diskSub events.BufferedSubscription, discoverer discover.CachingMux, connectionsService *connections.Service, errors, systemLog logger.Recorder, runtimeOptions RuntimeOptions, eventLog *db.EventLog) {
 	guiCfg := cfg.GUI()
 
 	if !guiCfg.Enabled {
@@ -1047,7 +1081,7 @@ func setupGUI(mainService *suture.Supervisor, cfg *config.Wrapper, m *model.Mode
 	cpu := newCPUService()
 	mainService.Add(cpu)
 
-	api := newAPIService(myID, cfg, locations[locHTTPSCertFile], locations[locHTTPSKeyFile], runtimeOptions.assetDir, m, defaultSub, diskSub, discoverer, connectionsService, errors, systemLog, cpu)
+	api := newAPIService(myID, cfg, locations[locHTTPSCertFile], locations[locHTTPSKeyFile], runtimeOptions.assetDir, m, defaultSub, diskSub, discoverer, connectionsService, errors, systemLog, cpu, eventLog)
 	cfg.Subscribe(api)
 	mainService.Add(api)
 
@@ -0,0 +1,162 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/config"
+)
+
+// The managed config service periodically fetches a configuration
+// document from a central controller and applies it through the config
+// wrapper. The document is a JSON config as accepted by the REST API,
+// signed with HMAC-SHA256 using the shared management key, carried in
+// the X-Syncthing-Signature header. After each attempt the apply status
+// is reported back to the controller with a POST to the same URL.
+// Pushing a config to a device instead works through the regular
+// authenticated REST config endpoint.
+
+const managementSignatureHeader = "X-Syncthing-Signature"
+
+type managedConfigService struct {
+	cfg  *config.Wrapper
+	stop chan struct{}
+}
+
+func newManagedConfigService(cfg *config.Wrapper) *managedConfigService {
+	return &managedConfigService{
+		cfg:  cfg,
+		stop: make(chan struct{}),
+	}
+}
+
+func (s *managedConfigService) Serve() {
+	interval := time.Duration(s.cfg.Options().ManagementIntervalS) * time.Second
+	if interval <= 0 {
+		interval = 300 * time.Second
+	}
+
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+
+		case <-timer.C:
+			if err := s.fetchAndApply(); err != nil {
+				l.Infoln("Managed config:", err)
+			}
+			timer.Reset(interval)
+		}
+	}
+}
+
+func (s *managedConfigService) Stop() {
+	close(s.stop)
+}
+
+func (s *managedConfigService) String() string {
+	return fmt.Sprintf("managedConfigService@%p", s)
+}
+
+func (s *managedConfigService) fetchAndApply() error {
+	opts := s.cfg.Options()
+
+	resp, err := http.Get(opts.ManagementURL)
+	if err != nil {
+		return err
+	}
+	bs, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s from %s", resp.Status, opts.ManagementURL)
+	}
+
+	if err := verifySignature(bs, resp.Header.Get(managementSignatureHeader), opts.ManagementKey); err != nil {
+		return err
+	}
+
+	to, err := config.ReadJSON(bytes.NewReader(bs), myID)
+	if err != nil {
+		s.report(opts.ManagementURL, err)
+		return err
+	}
+
+	applyErr := s.apply(to)
+	s.report(opts.ManagementURL, applyErr)
+	return applyErr
+}
+
+func (s *managedConfigService) apply(to config.Configuration) error {
+	wg, err := s.cfg.Replace(to)
+	if err != nil {
+		return err
+	}
+	wg.Wait()
+	return s.cfg.Save()
+}
+
+// report posts the apply status back to the controller. Failure to
+// report is logged but not an error; the next poll will report again.
+func (s *managedConfigService) report(url string, applyErr error) {
+	status := map[string]interface{}{
+		"device": myID.String(),
+		"ok":     applyErr == nil,
+	}
+	if applyErr != nil {
+		status["error"] = applyErr.Error()
+	}
+
+	bs, err := json.Marshal(status)
+	if err != nil {
+		return
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(bs))
+	if err != nil {
+		l.Debugln("Managed config: reporting status:", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// verifySignature checks the HMAC-SHA256 signature over the document
+// against the shared key.
+func verifySignature(document []byte, signature, key string) error {
+	if key == "" {
+		return errors.New("management key is not set; refusing unsigned configuration")
+	}
+
+	sig, err := hex.DecodeString(signature)
+	if err != nil || len(sig) == 0 {
+		return errors.New("missing or malformed configuration signature")
+	}
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(document)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return errors.New("configuration signature verification failed")
+	}
+	return nil
+}
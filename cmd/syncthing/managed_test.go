@@ -0,0 +1,101 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/syncthing/syncthing/lib/config"
+)
+
+func TestVerifySignature(t *testing.T) {
+	doc := []byte("document")
+	mac := hmac.New(sha256.New, []byte("key"))
+	mac.Write(doc)
+	sig := hex.EncodeToString(mac.Sum(nil))
+
+	if err := verifySignature(doc, sig, "key"); err != nil {
+		t.Error("expected valid signature to verify:", err)
+	}
+	if err := verifySignature(doc, sig, "otherkey"); err == nil {
+		t.Error("expected wrong key to fail verification")
+	}
+	if err := verifySignature(doc, "", "key"); err == nil {
+		t.Error("expected missing signature to fail verification")
+	}
+	if err := verifySignature(doc, sig, ""); err == nil {
+		t.Error("expected missing key to fail verification")
+	}
+}
+
+func TestManagedConfigFetchAndApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syncthing-managed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The managed config document: the current config with a new device
+	// name for ourselves.
+	remote := config.New(myID)
+	remote.Devices[0].Name = "managed name"
+	doc := new(bytes.Buffer)
+	if err := remote.WriteJSON(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	mac := hmac.New(sha256.New, []byte("managementkey"))
+	mac.Write(doc.Bytes())
+	sig := hex.EncodeToString(mac.Sum(nil))
+
+	var status map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			json.NewDecoder(r.Body).Decode(&status)
+			return
+		}
+		w.Header().Set(managementSignatureHeader, sig)
+		w.Write(doc.Bytes())
+	}))
+	defer ts.Close()
+
+	cfg := config.Wrap(filepath.Join(dir, "config.xml"), config.New(myID))
+	opts := cfg.Options()
+	opts.ManagementURL = ts.URL
+	opts.ManagementKey = "managementkey"
+	if _, err := cfg.SetOptions(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := newManagedConfigService(cfg)
+	if err := svc.fetchAndApply(); err != nil {
+		t.Fatal(err)
+	}
+
+	if dev, ok := cfg.Device(myID); !ok || dev.Name != "managed name" {
+		t.Errorf("expected the managed config to be applied, got %q", dev.Name)
+	}
+	if status == nil || status["ok"] != true {
+		t.Errorf("expected an ok status report, got %v", status)
+	}
+
+	// A tampered document must not be applied.
+	doc.WriteString(" ")
+	if err := svc.fetchAndApply(); err == nil {
+		t.Error("expected a tampered config to be rejected")
+	}
+}
@@ -28,6 +28,10 @@ func (c *mockedConfig) LDAP() config.LDAPConfiguration {
 	return config.LDAPConfiguration{}
 }
 
+func (c *mockedConfig) OIDC() config.OIDCConfiguration {
+	return config.OIDCConfiguration{}
+}
+
 func (c *mockedConfig) RawCopy() config.Configuration {
 	cfg := config.Configuration{}
 	util.SetDefaults(&cfg.Options)
@@ -42,6 +46,10 @@ func (c *mockedConfig) Replace(cfg config.Configuration) (config.Waiter, error)
 	return noopWaiter{}, nil
 }
 
+func (c *mockedConfig) Propose(cfg config.Configuration) []error {
+	return nil
+}
+
 func (c *mockedConfig) Subscribe(cm config.Committer) {}
 
 func (c *mockedConfig) Folders() map[string]config.FolderConfiguration {
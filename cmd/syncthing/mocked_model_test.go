@@ -11,6 +11,7 @@ import (
 
 	"github.com/syncthing/syncthing/lib/connections"
 	"github.com/syncthing/syncthing/lib/db"
+	"github.com/syncthing/syncthing/lib/ignore"
 	"github.com/syncthing/syncthing/lib/model"
 	"github.com/syncthing/syncthing/lib/protocol"
 	"github.com/syncthing/syncthing/lib/stats"
@@ -29,6 +30,8 @@ func (m *mockedModel) Completion(device protocol.DeviceID, folder string) model.
 
 func (m *mockedModel) Override(folder string) {}
 
+func (m *mockedModel) OverrideFile(folder, file string) {}
+
 func (m *mockedModel) Revert(folder string) {}
 
 func (m *mockedModel) NeedFolderFiles(folder string, page, perpage int) ([]db.FileInfoTruncated, []db.FileInfoTruncated, []db.FileInfoTruncated) {
@@ -55,6 +58,10 @@ func (m *mockedModel) FolderStatistics() map[string]stats.FolderStatistics {
 	return nil
 }
 
+func (m *mockedModel) TransferStatistics() stats.TransferStatistics {
+	return stats.TransferStatistics{}
+}
+
 func (m *mockedModel) CurrentFolderFile(folder string, file string) (protocol.FileInfo, bool) {
 	return protocol.FileInfo{}, false
 }
@@ -63,6 +70,14 @@ func (m *mockedModel) CurrentGlobalFile(folder string, file string) (protocol.Fi
 	return protocol.FileInfo{}, false
 }
 
+func (m *mockedModel) History(folder, file string) ([]model.FileHistoryEntry, error) {
+	return nil, nil
+}
+
+func (m *mockedModel) GlobalDirectoryListing(folder, prefix string, page, perpage int) ([]model.GlobalListItem, error) {
+	return nil, nil
+}
+
 func (m *mockedModel) ResetFolder(folder string) {
 }
 
@@ -74,10 +89,46 @@ func (m *mockedModel) GetIgnores(folder string) ([]string, []string, error) {
 	return nil, nil, nil
 }
 
+func (m *mockedModel) TestIgnores(folder string, paths []string) ([]ignore.MatchExplanation, error) {
+	return nil, nil
+}
+
 func (m *mockedModel) SetIgnores(folder string, content []string) error {
 	return nil
 }
 
+func (m *mockedModel) GetSelection(folder string) []string {
+	return nil
+}
+
+func (m *mockedModel) PullPreview(folder string) ([]model.PullAction, error) {
+	return nil, nil
+}
+
+func (m *mockedModel) ConfirmDeletions(folder string) error {
+	return nil
+}
+
+func (m *mockedModel) VerifyFolder(folder string, repair bool) ([]model.VerifyIssue, error) {
+	return nil, nil
+}
+
+func (m *mockedModel) Conflicts(folder string) ([]model.Conflict, error) {
+	return nil, nil
+}
+
+func (m *mockedModel) DeleteConflict(folder, path string) error {
+	return nil
+}
+
+func (m *mockedModel) PromoteConflict(folder, path string) error {
+	return nil
+}
+
+func (m *mockedModel) SetSelection(folder string, prefixes []string) error {
+	return nil
+}
+
 func (m *mockedModel) GetFolderVersions(folder string) (map[string][]versioner.FileVersion, error) {
 	return nil, nil
 }
@@ -86,6 +137,14 @@ func (m *mockedModel) RestoreFolderVersions(folder string, versions map[string]t
 	return nil, nil
 }
 
+func (m *mockedModel) GetFileVersions(folder, file string) ([]versioner.FileVersion, error) {
+	return nil, nil
+}
+
+func (m *mockedModel) RestoreFileVersion(folder, file string, versionTime time.Time) error {
+	return nil
+}
+
 func (m *mockedModel) PauseDevice(device protocol.DeviceID) {
 }
 
@@ -123,6 +182,10 @@ func (m *mockedModel) ReceiveOnlyChangedSize(folder string) db.Counts {
 	return db.Counts{}
 }
 
+func (m *mockedModel) LocalChangedFiles(folder string, page, perpage int) []db.FileInfoTruncated {
+	return nil
+}
+
 func (m *mockedModel) CurrentSequence(folder string) (int64, bool) {
 	return 0, false
 }
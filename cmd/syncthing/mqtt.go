@@ -0,0 +1,331 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/events"
+)
+
+// The mqttService publishes folder and device status events to an MQTT
+// broker, for consumption by home automation systems and the like.
+// Messages are published retained so a subscriber that connects late
+// still sees the current state. We speak just enough MQTT 3.1.1
+// ourselves to connect and publish at QoS 0 or 1.
+
+const (
+	mqttKeepAliveSeconds = 60
+	mqttIOTimeout        = 10 * time.Second
+	mqttReconnectPause   = time.Minute
+)
+
+const mqttEventMask = events.StateChanged | events.FolderSummary | events.FolderCompletion | events.DeviceConnected | events.DeviceDisconnected
+
+type mqttService struct {
+	cfg     *config.Wrapper
+	stop    chan struct{}
+	started chan struct{}
+}
+
+func newMQTTService(cfg *config.Wrapper) *mqttService {
+	return &mqttService{
+		cfg:     cfg,
+		stop:    make(chan struct{}),
+		started: make(chan struct{}),
+	}
+}
+
+func (s *mqttService) Serve() {
+	mqttCfg := s.cfg.MQTT()
+	if mqttCfg.TopicPrefix == "" {
+		mqttCfg.TopicPrefix = "syncthing"
+	}
+	if mqttCfg.ClientID == "" {
+		mqttCfg.ClientID = "syncthing-" + myID.Short().String()
+	}
+
+	sub := events.Default.Subscribe(mqttEventMask)
+	defer events.Default.Unsubscribe(sub)
+	close(s.started)
+
+	ticker := time.NewTicker(mqttKeepAliveSeconds / 2 * time.Second)
+	defer ticker.Stop()
+
+	var client *mqttClient
+	var nextAttempt time.Time
+	defer func() {
+		if client != nil {
+			client.close()
+		}
+	}()
+
+	for {
+		select {
+		case ev := <-sub.C():
+			topic, payload, ok := mqttMessage(mqttCfg.TopicPrefix, ev)
+			if !ok {
+				continue
+			}
+			if client == nil {
+				if time.Now().Before(nextAttempt) {
+					continue
+				}
+				c, err := mqttConnect(mqttCfg)
+				if err != nil {
+					l.Infoln("MQTT:", err)
+					nextAttempt = time.Now().Add(mqttReconnectPause)
+					continue
+				}
+				client = c
+			}
+			if err := client.publish(topic, payload, mqttCfg.QoS); err != nil {
+				l.Infoln("MQTT:", err)
+				client.close()
+				client = nil
+				nextAttempt = time.Now().Add(mqttReconnectPause)
+			}
+
+		case <-ticker.C:
+			if client == nil {
+				continue
+			}
+			if err := client.ping(); err != nil {
+				client.close()
+				client = nil
+			}
+
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *mqttService) Stop() {
+	close(s.stop)
+}
+
+func (s *mqttService) String() string {
+	return "mqttService"
+}
+
+// WaitForStart returns once the service is subscribed to events.
+func (s *mqttService) WaitForStart() {
+	<-s.started
+}
+
+// mqttMessage maps an event to a topic and payload. Folder events carry
+// their event data as JSON; device connectivity is a plain boolean so
+// that it is trivial to use as a binary sensor.
+func mqttMessage(prefix string, ev events.Event) (string, []byte, bool) {
+	switch ev.Type {
+	case events.StateChanged:
+		folder := eventDataString(ev.Data, "folder")
+		payload, _ := json.Marshal(ev.Data)
+		return prefix + "/folder/" + folder + "/state", payload, folder != ""
+
+	case events.FolderSummary:
+		folder := eventDataString(ev.Data, "folder")
+		payload, _ := json.Marshal(ev.Data)
+		return prefix + "/folder/" + folder + "/summary", payload, folder != ""
+
+	case events.FolderCompletion:
+		folder := eventDataString(ev.Data, "folder")
+		device := eventDataString(ev.Data, "device")
+		payload, _ := json.Marshal(ev.Data)
+		return prefix + "/folder/" + folder + "/completion/" + device, payload, folder != "" && device != ""
+
+	case events.DeviceConnected:
+		device := eventDataString(ev.Data, "id")
+		return prefix + "/device/" + device + "/connected", []byte("true"), device != ""
+
+	case events.DeviceDisconnected:
+		device := eventDataString(ev.Data, "id")
+		return prefix + "/device/" + device + "/connected", []byte("false"), device != ""
+	}
+
+	return "", nil, false
+}
+
+// eventDataString digs a string out of the event data, which is one of
+// two kinds of map depending on the event type. It is also used by the
+// persistent event log to attribute events to folders.
+func eventDataString(data interface{}, key string) string {
+	switch m := data.(type) {
+	case map[string]string:
+		return m[key]
+	case map[string]interface{}:
+		s, _ := m[key].(string)
+		return s
+	}
+	return ""
+}
+
+// An mqttClient is a connection to a broker. It is not safe for
+// concurrent use; the service serializes all calls.
+type mqttClient struct {
+	conn   net.Conn
+	nextID uint16
+}
+
+func mqttConnect(cfg config.MQTTConfiguration) (*mqttClient, error) {
+	conn, err := net.DialTimeout("tcp", cfg.Address, mqttIOTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeMQTTString(&buf, "MQTT")
+	buf.WriteByte(4)    // protocol level 3.1.1
+	flags := byte(0x02) // clean session
+	if cfg.Username != "" {
+		flags |= 0x80
+	}
+	if cfg.Password != "" {
+		flags |= 0x40
+	}
+	buf.WriteByte(flags)
+	binary.Write(&buf, binary.BigEndian, uint16(mqttKeepAliveSeconds))
+	writeMQTTString(&buf, cfg.ClientID)
+	if cfg.Username != "" {
+		writeMQTTString(&buf, cfg.Username)
+	}
+	if cfg.Password != "" {
+		writeMQTTString(&buf, cfg.Password)
+	}
+
+	c := &mqttClient{conn: conn, nextID: 1}
+	if err := c.writePacket(0x10, buf.Bytes()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	typ, body, err := c.readPacket()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if typ != 0x20 || len(body) != 2 {
+		conn.Close()
+		return nil, errors.New("mqtt: unexpected response to connect")
+	}
+	if body[1] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: connection refused by broker (code %d)", body[1])
+	}
+	return c, nil
+}
+
+func (c *mqttClient) publish(topic string, payload []byte, qos int) error {
+	var buf bytes.Buffer
+	writeMQTTString(&buf, topic)
+	var id uint16
+	if qos > 0 {
+		id = c.nextID
+		c.nextID++
+		if c.nextID == 0 {
+			c.nextID = 1
+		}
+		binary.Write(&buf, binary.BigEndian, id)
+	}
+	buf.Write(payload)
+
+	flags := byte(0x01) // retain
+	if qos > 0 {
+		flags |= 0x02 // QoS 1
+	}
+	if err := c.writePacket(0x30|flags, buf.Bytes()); err != nil {
+		return err
+	}
+	if qos == 0 {
+		return nil
+	}
+
+	for {
+		typ, body, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+		if typ == 0xd0 {
+			// A ping response may be interleaved; skip it.
+			continue
+		}
+		if typ != 0x40 || len(body) != 2 || binary.BigEndian.Uint16(body) != id {
+			return errors.New("mqtt: unexpected response to publish")
+		}
+		return nil
+	}
+}
+
+func (c *mqttClient) ping() error {
+	return c.writePacket(0xc0, nil)
+}
+
+func (c *mqttClient) close() {
+	c.writePacket(0xe0, nil) // DISCONNECT
+	c.conn.Close()
+}
+
+func (c *mqttClient) writePacket(header byte, body []byte) error {
+	c.conn.SetWriteDeadline(time.Now().Add(mqttIOTimeout))
+	buf := []byte{header}
+	rem := len(body)
+	for {
+		b := byte(rem % 128)
+		rem /= 128
+		if rem > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if rem == 0 {
+			break
+		}
+	}
+	buf = append(buf, body...)
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+func (c *mqttClient) readPacket() (byte, []byte, error) {
+	c.conn.SetReadDeadline(time.Now().Add(mqttIOTimeout))
+	var hdr [1]byte
+	if _, err := io.ReadFull(c.conn, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	length, mult := 0, 1
+	for i := 0; ; i++ {
+		var b [1]byte
+		if _, err := io.ReadFull(c.conn, b[:]); err != nil {
+			return 0, nil, err
+		}
+		length += int(b[0]&0x7f) * mult
+		mult *= 128
+		if b[0]&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, errors.New("mqtt: malformed remaining length")
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.conn, body); err != nil {
+		return 0, nil, err
+	}
+	return hdr[0] &^ 0x0f, body, nil
+}
+
+func writeMQTTString(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+}
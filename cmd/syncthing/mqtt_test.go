@@ -0,0 +1,113 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/events"
+)
+
+func TestMQTTMessage(t *testing.T) {
+	topic, payload, ok := mqttMessage("syncthing", events.Event{
+		Type: events.StateChanged,
+		Data: map[string]interface{}{"folder": "default", "to": "syncing", "from": "idle"},
+	})
+	if !ok || topic != "syncthing/folder/default/state" {
+		t.Errorf("unexpected topic %q", topic)
+	}
+	if len(payload) == 0 {
+		t.Error("expected a JSON payload")
+	}
+
+	topic, payload, ok = mqttMessage("syncthing", events.Event{
+		Type: events.DeviceDisconnected,
+		Data: map[string]string{"id": "device1"},
+	})
+	if !ok || topic != "syncthing/device/device1/connected" {
+		t.Errorf("unexpected topic %q", topic)
+	}
+	if string(payload) != "false" {
+		t.Errorf("unexpected payload %q", payload)
+	}
+
+	if _, _, ok := mqttMessage("syncthing", events.Event{
+		Type: events.StateChanged,
+		Data: map[string]interface{}{},
+	}); ok {
+		t.Error("expected an event without a folder to be skipped")
+	}
+}
+
+func TestMQTTPublish(t *testing.T) {
+	// A fake broker that accepts the connection and acknowledges one
+	// QoS 1 publish, recording the topic.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	topics := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		typ, _, err := readMQTTTestPacket(conn)
+		if err != nil || typ != 0x10 {
+			t.Error("expected a connect packet, got type", typ)
+			return
+		}
+		conn.Write([]byte{0x20, 2, 0, 0}) // CONNACK, accepted
+
+		typ, body, err := readMQTTTestPacket(conn)
+		if err != nil || typ&0xf0 != 0x30 {
+			t.Error("expected a publish packet, got type", typ)
+			return
+		}
+		topicLen := int(binary.BigEndian.Uint16(body))
+		topics <- string(body[2 : 2+topicLen])
+		id := body[2+topicLen : 4+topicLen]
+		conn.Write([]byte{0x40, 2, id[0], id[1]}) // PUBACK
+	}()
+
+	client, err := mqttConnect(config.MQTTConfiguration{
+		Address:  listener.Addr().String(),
+		ClientID: "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.close()
+
+	if err := client.publish("syncthing/folder/default/state", []byte(`{}`), 1); err != nil {
+		t.Fatal(err)
+	}
+	if topic := <-topics; topic != "syncthing/folder/default/state" {
+		t.Errorf("broker saw unexpected topic %q", topic)
+	}
+}
+
+func readMQTTTestPacket(conn net.Conn) (byte, []byte, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	// Remaining lengths in the test stay below 128 bytes.
+	body := make([]byte, hdr[1])
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return 0, nil, err
+	}
+	return hdr[0], body, nil
+}
@@ -0,0 +1,106 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+var (
+	promDescFolderCompletion = prometheus.NewDesc("syncthing_folder_completion_percent",
+		"Completion percentage of the local device for the folder.", []string{"folder"}, nil)
+	promDescFolderGlobalBytes = prometheus.NewDesc("syncthing_folder_global_bytes",
+		"Size of the global (cluster-wide latest) version of the folder.", []string{"folder"}, nil)
+	promDescFolderLocalBytes = prometheus.NewDesc("syncthing_folder_local_bytes",
+		"Size of the locally present data in the folder.", []string{"folder"}, nil)
+	promDescFolderNeedBytes = prometheus.NewDesc("syncthing_folder_need_bytes",
+		"Outstanding bytes to sync for the folder; the puller queue in bytes.", []string{"folder"}, nil)
+	promDescFolderNeedItems = prometheus.NewDesc("syncthing_folder_need_items",
+		"Outstanding files, directories and symlinks to sync for the folder.", []string{"folder"}, nil)
+	promDescDeviceConnected = prometheus.NewDesc("syncthing_device_connected",
+		"Whether the device is currently connected.", []string{"device"}, nil)
+	promDescDeviceInBytes = prometheus.NewDesc("syncthing_device_in_bytes_total",
+		"Bytes received from the device over the current connection.", []string{"device"}, nil)
+	promDescDeviceOutBytes = prometheus.NewDesc("syncthing_device_out_bytes_total",
+		"Bytes sent to the device over the current connection.", []string{"device"}, nil)
+	promDescTotalInBytes = prometheus.NewDesc("syncthing_total_in_bytes_total",
+		"Total bytes received over all connections since startup.", nil, nil)
+	promDescTotalOutBytes = prometheus.NewDesc("syncthing_total_out_bytes_total",
+		"Total bytes sent over all connections since startup.", nil, nil)
+)
+
+// prometheusCollector exposes folder and connection state as Prometheus
+// metrics. The values are gathered from the model at scrape time, so there
+// is no sampling machinery to keep running between scrapes.
+type prometheusCollector struct {
+	model modelIntf
+	cfg   configIntf
+}
+
+func (c *prometheusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- promDescFolderCompletion
+	ch <- promDescFolderGlobalBytes
+	ch <- promDescFolderLocalBytes
+	ch <- promDescFolderNeedBytes
+	ch <- promDescFolderNeedItems
+	ch <- promDescDeviceConnected
+	ch <- promDescDeviceInBytes
+	ch <- promDescDeviceOutBytes
+	ch <- promDescTotalInBytes
+	ch <- promDescTotalOutBytes
+}
+
+func (c *prometheusCollector) Collect(ch chan<- prometheus.Metric) {
+	for folder := range c.cfg.Folders() {
+		comp := c.model.Completion(protocol.LocalDeviceID, folder)
+		global := c.model.GlobalSize(folder)
+		local := c.model.LocalSize(folder)
+		need := c.model.NeedSize(folder)
+
+		ch <- prometheus.MustNewConstMetric(promDescFolderCompletion, prometheus.GaugeValue, comp.CompletionPct, folder)
+		ch <- prometheus.MustNewConstMetric(promDescFolderGlobalBytes, prometheus.GaugeValue, float64(global.Bytes), folder)
+		ch <- prometheus.MustNewConstMetric(promDescFolderLocalBytes, prometheus.GaugeValue, float64(local.Bytes), folder)
+		ch <- prometheus.MustNewConstMetric(promDescFolderNeedBytes, prometheus.GaugeValue, float64(need.Bytes), folder)
+		ch <- prometheus.MustNewConstMetric(promDescFolderNeedItems, prometheus.GaugeValue, float64(need.Files+need.Directories+need.Symlinks), folder)
+	}
+
+	for deviceID := range c.cfg.Devices() {
+		if deviceID == protocol.LocalDeviceID {
+			continue
+		}
+		device := deviceID.String()
+		conn, connected := c.model.Connection(deviceID)
+		var connectedVal float64
+		if connected {
+			connectedVal = 1
+			stats := conn.Statistics()
+			ch <- prometheus.MustNewConstMetric(promDescDeviceInBytes, prometheus.CounterValue, float64(stats.InBytesTotal), device)
+			ch <- prometheus.MustNewConstMetric(promDescDeviceOutBytes, prometheus.CounterValue, float64(stats.OutBytesTotal), device)
+		}
+		ch <- prometheus.MustNewConstMetric(promDescDeviceConnected, prometheus.GaugeValue, connectedVal, device)
+	}
+
+	in, out := protocol.TotalInOut()
+	ch <- prometheus.MustNewConstMetric(promDescTotalInBytes, prometheus.CounterValue, float64(in))
+	ch <- prometheus.MustNewConstMetric(promDescTotalOutBytes, prometheus.CounterValue, float64(out))
+}
+
+// newPrometheusHandler returns an HTTP handler serving the metrics of the
+// given model and config in Prometheus exposition format, along with the
+// standard Go runtime and process metrics.
+func newPrometheusHandler(model modelIntf, cfg configIntf) http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(&prometheusCollector{model: model, cfg: cfg})
+	reg.MustRegister(prometheus.NewGoCollector())
+	reg.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,164 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/events"
+)
+
+// The webhookService subscribes to events and POSTs those selected per
+// webhook as JSON to the configured URLs. Each webhook has its own
+// delivery queue so a slow endpoint does not hold up the others.
+// Failed deliveries are retried with exponential backoff; when the
+// webhook has a key the body is signed with HMAC-SHA256, carried in the
+// X-Syncthing-Signature header.
+
+var (
+	webhookInitialBackoff = 30 * time.Second
+	webhookMaxAttempts    = 5
+	webhookQueueLength    = 16
+)
+
+type webhookService struct {
+	cfg     *config.Wrapper
+	stop    chan struct{}
+	started chan struct{}
+}
+
+type webhook struct {
+	url   string
+	key   string
+	mask  events.EventType
+	queue chan []byte
+}
+
+func newWebhookService(cfg *config.Wrapper) *webhookService {
+	return &webhookService{
+		cfg:     cfg,
+		stop:    make(chan struct{}),
+		started: make(chan struct{}),
+	}
+}
+
+func (s *webhookService) Serve() {
+	var hooks []*webhook
+	var mask events.EventType
+	for _, hookCfg := range s.cfg.Webhooks() {
+		hook := &webhook{
+			url:   hookCfg.URL,
+			key:   hookCfg.Key,
+			queue: make(chan []byte, webhookQueueLength),
+		}
+		for _, name := range hookCfg.Events {
+			hook.mask |= events.UnmarshalEventType(name)
+		}
+		if hook.mask == 0 {
+			hook.mask = events.AllEvents
+		}
+		mask |= hook.mask
+		hooks = append(hooks, hook)
+		go s.deliverLoop(hook)
+	}
+
+	sub := events.Default.Subscribe(mask)
+	defer events.Default.Unsubscribe(sub)
+	close(s.started)
+
+	for {
+		select {
+		case ev := <-sub.C():
+			bs, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			for _, hook := range hooks {
+				if hook.mask&ev.Type == 0 {
+					continue
+				}
+				select {
+				case hook.queue <- bs:
+				default:
+					l.Infoln("Webhook: dropping event for", hook.url, "(queue full)")
+				}
+			}
+
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *webhookService) Stop() {
+	close(s.stop)
+}
+
+func (s *webhookService) String() string {
+	return "webhookService"
+}
+
+// WaitForStart returns once the service is subscribed to events.
+func (s *webhookService) WaitForStart() {
+	<-s.started
+}
+
+func (s *webhookService) deliverLoop(hook *webhook) {
+	for {
+		select {
+		case bs := <-hook.queue:
+			s.deliver(hook, bs)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *webhookService) deliver(hook *webhook, body []byte) {
+	backoff := webhookInitialBackoff
+	for attempt := 0; attempt < webhookMaxAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-s.stop:
+				return
+			}
+			backoff *= 2
+		}
+
+		req, err := http.NewRequest("POST", hook.url, bytes.NewReader(body))
+		if err != nil {
+			l.Infoln("Webhook:", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if hook.key != "" {
+			mac := hmac.New(sha256.New, []byte(hook.key))
+			mac.Write(body)
+			req.Header.Set("X-Syncthing-Signature", hex.EncodeToString(mac.Sum(nil)))
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			l.Debugln("Webhook:", err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return
+		}
+		l.Debugln("Webhook: unexpected status", resp.Status, "from", hook.url)
+	}
+	l.Infoln("Webhook: giving up delivering to", hook.url)
+}
@@ -0,0 +1,91 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/events"
+)
+
+func TestWebhookDelivery(t *testing.T) {
+	oldBackoff := webhookInitialBackoff
+	webhookInitialBackoff = 10 * time.Millisecond
+	defer func() { webhookInitialBackoff = oldBackoff }()
+
+	// The server fails the first two attempts to exercise the retry
+	// logic, then verifies the signature on the delivered body.
+	attempts := 0
+	received := make(chan events.Event, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			http.Error(w, "not yet", http.StatusInternalServerError)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("hookkey"))
+		mac.Write(body)
+		if r.Header.Get("X-Syncthing-Signature") != hex.EncodeToString(mac.Sum(nil)) {
+			t.Error("expected a valid signature on the request")
+		}
+
+		var ev events.Event
+		if err := json.Unmarshal(body, &ev); err != nil {
+			t.Error("expected an event as JSON:", err)
+		}
+		received <- ev
+	}))
+	defer ts.Close()
+
+	cfg := config.Wrap("/dev/null", config.New(myID))
+	waiter, err := cfg.Replace(config.Configuration{
+		Version: config.CurrentVersion,
+		Webhooks: []config.WebhookConfiguration{{
+			URL:    ts.URL,
+			Events: []string{"ConfigSaved"},
+			Key:    "hookkey",
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiter.Wait()
+
+	svc := newWebhookService(cfg)
+	go svc.Serve()
+	defer svc.Stop()
+	svc.WaitForStart()
+
+	// An unselected event type must not be delivered; the selected one
+	// follows and must arrive despite the initial failures.
+	events.Default.Log(events.StartupComplete, nil)
+	events.Default.Log(events.ConfigSaved, map[string]string{"test": "data"})
+
+	select {
+	case ev := <-received:
+		if ev.Type != events.ConfigSaved {
+			t.Errorf("expected a ConfigSaved event, got %v", ev.Type)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the webhook delivery")
+	}
+
+	if attempts != 3 {
+		t.Errorf("expected three delivery attempts, got %d", attempts)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/sync"
+)
+
+// The Unicast beacon sends the announcement packets to a fixed list of
+// ip:port targets instead of broadcasting or multicasting them, for use
+// across routed subnets where those are blocked. Replies arrive on the
+// same socket, addressed to our source port.
+
+type Unicast struct {
+	targets []string
+	inbox   chan []byte
+	outbox  chan recv
+
+	conn    *net.UDPConn
+	connMut sync.Mutex
+	stop    chan struct{}
+	errorHolder
+}
+
+func NewUnicast(targets []string) *Unicast {
+	return &Unicast{
+		targets: targets,
+		inbox:   make(chan []byte),
+		outbox:  make(chan recv, 16),
+		stop:    make(chan struct{}),
+	}
+}
+
+func (b *Unicast) Send(data []byte) {
+	b.inbox <- data
+}
+
+func (b *Unicast) Recv() ([]byte, net.Addr) {
+	recv := <-b.outbox
+	return recv.data, recv.src
+}
+
+func (b *Unicast) Serve() {
+	l.Debugln(b, "starting")
+	defer l.Debugln(b, "stopping")
+
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		l.Debugln(err)
+		b.setError(err)
+		return
+	}
+	defer conn.Close()
+
+	b.connMut.Lock()
+	b.conn = conn
+	b.connMut.Unlock()
+
+	go b.readerLoop(conn)
+
+	for bs := range b.inbox {
+		success := 0
+		for _, target := range b.targets {
+			dst, err := net.ResolveUDPAddr("udp", target)
+			if err != nil {
+				l.Debugln(err)
+				b.setError(err)
+				continue
+			}
+
+			conn.SetWriteDeadline(time.Now().Add(time.Second))
+			_, err = conn.WriteTo(bs, dst)
+			conn.SetWriteDeadline(time.Time{})
+
+			if err, ok := err.(net.Error); ok && err.Timeout() {
+				// Write timeouts should not happen. We treat it as a fatal
+				// error on the socket.
+				l.Debugln(err)
+				b.setError(err)
+				return
+			}
+
+			if err != nil {
+				// Some other error that we don't expect. Debug and continue.
+				l.Debugln(err)
+				b.setError(err)
+				continue
+			}
+
+			l.Debugf("sent %d bytes to %s", len(bs), dst)
+			success++
+		}
+
+		if success > 0 {
+			b.setError(nil)
+		}
+	}
+}
+
+func (b *Unicast) readerLoop(conn *net.UDPConn) {
+	bs := make([]byte, 65536)
+	for {
+		n, addr, err := conn.ReadFrom(bs)
+		if err != nil {
+			select {
+			case <-b.stop:
+			default:
+				l.Debugln(err)
+				b.setError(err)
+			}
+			return
+		}
+
+		l.Debugf("recv %d bytes from %s", n, addr)
+
+		c := make([]byte, n)
+		copy(c, bs)
+		select {
+		case b.outbox <- recv{c, addr}:
+		default:
+			l.Debugln("dropping message")
+		}
+	}
+}
+
+func (b *Unicast) Stop() {
+	close(b.stop)
+	b.connMut.Lock()
+	if b.conn != nil {
+		b.conn.Close()
+	}
+	b.connMut.Unlock()
+}
+
+func (b *Unicast) String() string {
+	return fmt.Sprintf("unicast@%p", b)
+}
@@ -0,0 +1,167 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package blockdelta implements rsync-style delta transfers within a
+// single block. The requesting side hashes fixed size chunks of its old
+// copy of the block and sends those hashes along with the request. The
+// sending side scans the new block content for matching chunks using a
+// rolling checksum and, when that pays off, responds with copy and
+// literal instructions instead of the full block.
+package blockdelta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	vanilla "hash/adler32"
+
+	"github.com/chmduquesne/rollinghash/adler32"
+	"github.com/syncthing/syncthing/lib/sha256"
+)
+
+const (
+	// ChunkSize is the sub-chunk granularity. Both sides must use the
+	// same value for the hashes to be comparable.
+	ChunkSize = 4096
+
+	// hashLen is the serialized size of one chunk hash: a four byte
+	// rolling checksum followed by eight bytes of SHA-256.
+	hashLen = 4 + 8
+)
+
+var errCorruptDelta = errors.New("corrupt delta")
+
+// Hashes returns the serialized chunk hashes for the given old block
+// content. Only full chunks are hashed; a trailing partial chunk can
+// never be matched by the fixed size rolling window and is left out.
+func Hashes(source []byte) []byte {
+	n := len(source) / ChunkSize
+	if n == 0 {
+		return nil
+	}
+	buf := make([]byte, 0, n*hashLen)
+	for i := 0; i < n; i++ {
+		chunk := source[i*ChunkSize : (i+1)*ChunkSize]
+		var weak [4]byte
+		binary.BigEndian.PutUint32(weak[:], vanilla.Checksum(chunk))
+		buf = append(buf, weak[:]...)
+		strong := sha256.Sum256(chunk)
+		buf = append(buf, strong[:8]...)
+	}
+	return buf
+}
+
+// Encode returns delta instructions that rebuild target out of chunks
+// of the old block described by hashes, plus literal data for whatever
+// doesn't match. It returns nil when no chunks match or the delta would
+// not be smaller than the target itself, in which case the full data
+// should be sent instead.
+//
+// The format is a sequence of uvarint-prefixed instructions. An even
+// value 2*i means "copy chunk i of the old block"; an odd value 2*l+1
+// means "the next l bytes are literal data".
+func Encode(target, hashes []byte) []byte {
+	if len(hashes) < hashLen || len(target) < ChunkSize {
+		return nil
+	}
+
+	type chunk struct {
+		index  int
+		strong []byte
+	}
+	chunks := make(map[uint32][]chunk, len(hashes)/hashLen)
+	for i := 0; (i+1)*hashLen <= len(hashes); i++ {
+		rec := hashes[i*hashLen : (i+1)*hashLen]
+		weak := binary.BigEndian.Uint32(rec)
+		chunks[weak] = append(chunks[weak], chunk{i, rec[4:]})
+	}
+
+	delta := make([]byte, 0, len(target)/2)
+	var numBuf [binary.MaxVarintLen64]byte
+	copies := 0
+	litStart := 0 // start of the pending literal run, ending at pos
+
+	emitLiteral := func(end int) {
+		if end == litStart {
+			return
+		}
+		n := binary.PutUvarint(numBuf[:], uint64(end-litStart)<<1|1)
+		delta = append(delta, numBuf[:n]...)
+		delta = append(delta, target[litStart:end]...)
+	}
+
+	hf := adler32.New()
+	hf.Write(target[:ChunkSize])
+	pos := 0
+	for {
+		match := -1
+		if cands, ok := chunks[hf.Sum32()]; ok {
+			strong := sha256.Sum256(target[pos : pos+ChunkSize])
+			for _, c := range cands {
+				if bytes.Equal(strong[:8], c.strong) {
+					match = c.index
+					break
+				}
+			}
+		}
+
+		if match >= 0 {
+			emitLiteral(pos)
+			n := binary.PutUvarint(numBuf[:], uint64(match)<<1)
+			delta = append(delta, numBuf[:n]...)
+			copies++
+			pos += ChunkSize
+			litStart = pos
+			if pos+ChunkSize > len(target) {
+				break
+			}
+			hf.Reset()
+			hf.Write(target[pos : pos+ChunkSize])
+			continue
+		}
+
+		if pos+ChunkSize >= len(target) {
+			break
+		}
+		hf.Roll(target[pos+ChunkSize])
+		pos++
+	}
+	emitLiteral(len(target))
+
+	if copies == 0 || len(delta) >= len(target) {
+		return nil
+	}
+	return delta
+}
+
+// Apply rebuilds block content from the old block the hashes were taken
+// from and the delta instructions. The result must still be verified
+// against the expected block hash by the caller.
+func Apply(source, delta []byte) ([]byte, error) {
+	var out []byte
+	for len(delta) > 0 {
+		v, n := binary.Uvarint(delta)
+		if n <= 0 {
+			return nil, errCorruptDelta
+		}
+		delta = delta[n:]
+		if v&1 == 1 {
+			l := int(v >> 1)
+			if l < 0 || l > len(delta) {
+				return nil, errCorruptDelta
+			}
+			out = append(out, delta[:l]...)
+			delta = delta[l:]
+		} else {
+			off := int(v>>1) * ChunkSize
+			if off < 0 || off+ChunkSize > len(source) {
+				return nil, errCorruptDelta
+			}
+			out = append(out, source[off:off+ChunkSize]...)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package blockdelta
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestEncodeApply(t *testing.T) {
+	old := make([]byte, 128<<10)
+	rand.Read(old)
+
+	// The new block is the old one with a few bytes changed in the
+	// middle and some data inserted near the front, shifting the chunk
+	// alignment for most of the block.
+	new := make([]byte, 0, len(old)+100)
+	new = append(new, old[:1000]...)
+	new = append(new, []byte("inserted data")...)
+	new = append(new, old[1000:]...)
+	new[64<<10] ^= 0xff
+
+	delta := Encode(new, Hashes(old))
+	if delta == nil {
+		t.Fatal("expected a delta for mostly unchanged data")
+	}
+	if len(delta) > len(new)/4 {
+		t.Errorf("delta unexpectedly large: %d bytes for %d bytes of data", len(delta), len(new))
+	}
+
+	res, err := Apply(old, delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, new) {
+		t.Error("applied delta does not match the target")
+	}
+}
+
+func TestEncodeUnrelatedData(t *testing.T) {
+	old := make([]byte, 32<<10)
+	rand.Read(old)
+	new := make([]byte, 32<<10)
+	rand.Read(new)
+
+	if delta := Encode(new, Hashes(old)); delta != nil {
+		t.Error("expected no delta for unrelated data")
+	}
+}
+
+func TestApplyCorrupt(t *testing.T) {
+	old := make([]byte, 8<<10)
+	rand.Read(old)
+
+	for _, delta := range [][]byte{
+		{0x80},             // truncated uvarint
+		{0x09},             // literal of four bytes, no data
+		{0x06},             // copy of chunk 3, out of range
+		{0x03, 0x00, 0x80}, // literal followed by truncated uvarint
+	} {
+		if _, err := Apply(old, delta); err == nil {
+			t.Errorf("expected an error applying %x", delta)
+		}
+	}
+}
+
+func TestHashesShortBlock(t *testing.T) {
+	if h := Hashes(make([]byte, ChunkSize-1)); h != nil {
+		t.Error("expected no hashes for less than one chunk")
+	}
+	if h := Hashes(make([]byte, 2*ChunkSize+100)); len(h) != 2*hashLen {
+		t.Errorf("expected hashes for two full chunks, got %d bytes", len(h))
+	}
+}
@@ -11,6 +11,7 @@ type AuthMode int
 const (
 	AuthModeStatic AuthMode = iota // default is static
 	AuthModeLDAP
+	AuthModeOIDC
 )
 
 func (t AuthMode) String() string {
@@ -19,6 +20,8 @@ func (t AuthMode) String() string {
 		return "static"
 	case AuthModeLDAP:
 		return "ldap"
+	case AuthModeOIDC:
+		return "oidc"
 	default:
 		return "unknown"
 	}
@@ -32,6 +35,8 @@ func (t *AuthMode) UnmarshalText(bs []byte) error {
 	switch string(bs) {
 	case "ldap":
 		*t = AuthModeLDAP
+	case "oidc":
+		*t = AuthModeOIDC
 	case "static":
 		*t = AuthModeStatic
 	default:
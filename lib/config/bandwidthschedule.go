@@ -0,0 +1,29 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+import "time"
+
+// BandwidthScheduleEntry is a time-of-day rule for the overall bandwidth
+// limits. While the entry is in effect, its rates replace maxSendKbps and
+// maxRecvKbps. Zero or negative rates mean unlimited, as usual.
+type BandwidthScheduleEntry struct {
+	ScheduleWindow
+	MaxSendKbps int `xml:"maxSendKbps,attr" json:"maxSendKbps"`
+	MaxRecvKbps int `xml:"maxRecvKbps,attr" json:"maxRecvKbps"`
+}
+
+// ActiveBandwidthScheduleEntry returns the first entry in effect at the
+// given time, if any.
+func ActiveBandwidthScheduleEntry(entries []BandwidthScheduleEntry, t time.Time) (BandwidthScheduleEntry, bool) {
+	for _, e := range entries {
+		if e.Matches(t) {
+			return e, true
+		}
+	}
+	return BandwidthScheduleEntry{}, false
+}
@@ -125,15 +125,18 @@ func ReadJSON(r io.Reader, myID protocol.DeviceID) (Configuration, error) {
 }
 
 type Configuration struct {
-	Version        int                   `xml:"version,attr" json:"version"`
-	Folders        []FolderConfiguration `xml:"folder" json:"folders"`
-	Devices        []DeviceConfiguration `xml:"device" json:"devices"`
-	GUI            GUIConfiguration      `xml:"gui" json:"gui"`
-	LDAP           LDAPConfiguration     `xml:"ldap" json:"ldap"`
-	Options        OptionsConfiguration  `xml:"options" json:"options"`
-	IgnoredDevices []ObservedDevice      `xml:"remoteIgnoredDevice" json:"remoteIgnoredDevices"`
-	PendingDevices []ObservedDevice      `xml:"pendingDevice" json:"pendingDevices"`
-	XMLName        xml.Name              `xml:"configuration" json:"-"`
+	Version        int                    `xml:"version,attr" json:"version"`
+	Folders        []FolderConfiguration  `xml:"folder" json:"folders"`
+	Devices        []DeviceConfiguration  `xml:"device" json:"devices"`
+	GUI            GUIConfiguration       `xml:"gui" json:"gui"`
+	LDAP           LDAPConfiguration      `xml:"ldap" json:"ldap"`
+	OIDC           OIDCConfiguration      `xml:"oidc" json:"oidc"`
+	MQTT           MQTTConfiguration      `xml:"mqtt" json:"mqtt"`
+	Options        OptionsConfiguration   `xml:"options" json:"options"`
+	Webhooks       []WebhookConfiguration `xml:"webhook" json:"webhooks"`
+	IgnoredDevices []ObservedDevice       `xml:"remoteIgnoredDevice" json:"remoteIgnoredDevices"`
+	PendingDevices []ObservedDevice       `xml:"pendingDevice" json:"pendingDevices"`
+	XMLName        xml.Name               `xml:"configuration" json:"-"`
 
 	MyID            protocol.DeviceID `xml:"-" json:"-"` // Provided by the instantiator.
 	OriginalVersion int               `xml:"-" json:"-"` // The version we read from disk, before any conversion
@@ -157,6 +160,13 @@ func (cfg Configuration) Copy() Configuration {
 	newCfg.Options = cfg.Options.Copy()
 	newCfg.GUI = cfg.GUI.Copy()
 
+	if cfg.Webhooks != nil {
+		newCfg.Webhooks = make([]WebhookConfiguration, len(cfg.Webhooks))
+		for i := range newCfg.Webhooks {
+			newCfg.Webhooks[i] = cfg.Webhooks[i].Copy()
+		}
+	}
+
 	// DeviceIDs are values
 	newCfg.IgnoredDevices = make([]ObservedDevice, len(cfg.IgnoredDevices))
 	copy(newCfg.IgnoredDevices, cfg.IgnoredDevices)
@@ -314,6 +324,23 @@ func (cfg *Configuration) clean() error {
 		return cfg.Folders[a].ID < cfg.Folders[b].ID
 	})
 
+	// Expand group sharing: a folder shared with a group is shared with
+	// every device carrying a matching tag, so adding a device to a group
+	// shares all the group's folders with it.
+	taggedDevices := make(map[string][]protocol.DeviceID)
+	for _, device := range cfg.Devices {
+		for _, tag := range device.Tags {
+			taggedDevices[tag] = append(taggedDevices[tag], device.DeviceID)
+		}
+	}
+	for i := range cfg.Folders {
+		for _, group := range cfg.Folders[i].Groups {
+			for _, id := range taggedDevices[group] {
+				cfg.Folders[i].Devices = ensureDevicePresent(cfg.Folders[i].Devices, id)
+			}
+		}
+	}
+
 	// Ensure that in all folder configs
 	// - any loose devices are not present in the wrong places
 	// - there are no duplicate devices
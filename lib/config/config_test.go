@@ -69,6 +69,7 @@ func TestDefaultValues(t *testing.T) {
 		UnackedNotificationIDs:  []string{},
 		DefaultFolderPath:       "~",
 		SetLowPriority:          true,
+		ManagementIntervalS:     300,
 	}
 
 	cfg := New(device1)
@@ -212,8 +213,10 @@ func TestOverriddenValues(t *testing.T) {
 			"channelNotification",   // added in 17->18 migration
 			"fsWatcherNotification", // added in 27->28 migration
 		},
-		DefaultFolderPath: "/media/syncthing",
-		SetLowPriority:    false,
+		DefaultFolderPath:   "/media/syncthing",
+		SetLowPriority:      false,
+		TLSCipherSuites:     []string{},
+		ManagementIntervalS: 300,
 	}
 
 	os.Unsetenv("STNOUPGRADE")
@@ -1112,3 +1115,40 @@ func defaultConfigAsMap() map[string]interface{} {
 	}
 	return tmp
 }
+
+func TestDeviceGroups(t *testing.T) {
+	cfg := New(device1)
+	dev2 := NewDeviceConfiguration(device2, "lab1")
+	dev2.Tags = []string{"lab"}
+	dev3 := NewDeviceConfiguration(device3, "office1")
+	cfg.Devices = append(cfg.Devices, dev2, dev3)
+	cfg.Folders = []FolderConfiguration{
+		{ID: "shared", Path: "testdata", Groups: []string{"lab"}},
+		{ID: "private", Path: "testdata"},
+	}
+
+	if err := cfg.prepare(device1); err != nil {
+		t.Fatal(err)
+	}
+
+	folderDevices := func(id string) map[protocol.DeviceID]bool {
+		m := make(map[protocol.DeviceID]bool)
+		for _, folder := range cfg.Folders {
+			if folder.ID == id {
+				for _, dev := range folder.Devices {
+					m[dev.DeviceID] = true
+				}
+			}
+		}
+		return m
+	}
+
+	if devs := folderDevices("shared"); !devs[device2] {
+		t.Error("expected the group folder to be shared with the tagged device")
+	} else if devs[device3] {
+		t.Error("did not expect the group folder to be shared with the untagged device")
+	}
+	if devs := folderDevices("private"); devs[device2] {
+		t.Error("did not expect the ungrouped folder to be shared with the tagged device")
+	}
+}
@@ -21,14 +21,21 @@ type DeviceConfiguration struct {
 	Introducer               bool                 `xml:"introducer,attr" json:"introducer"`
 	SkipIntroductionRemovals bool                 `xml:"skipIntroductionRemovals,attr" json:"skipIntroductionRemovals"`
 	IntroducedBy             protocol.DeviceID    `xml:"introducedBy,attr" json:"introducedBy"`
+	IntroducedCertNames      []string             `xml:"introducedCertName,omitempty" json:"introducedCertNames"`
+	MaxIntroducedDevices     int                  `xml:"maxIntroducedDevices" json:"maxIntroducedDevices"`
 	Paused                   bool                 `xml:"paused" json:"paused"`
 	AllowedNetworks          []string             `xml:"allowedNetwork,omitempty" json:"allowedNetworks"`
 	AutoAcceptFolders        bool                 `xml:"autoAcceptFolders" json:"autoAcceptFolders"`
+	AutoAcceptPathTemplate   string               `xml:"autoAcceptPathTemplate,omitempty" json:"autoAcceptPathTemplate"`
 	MaxSendKbps              int                  `xml:"maxSendKbps" json:"maxSendKbps"`
 	MaxRecvKbps              int                  `xml:"maxRecvKbps" json:"maxRecvKbps"`
+	MaxMonthlyTraffic        Size                 `xml:"maxMonthlyTraffic" json:"maxMonthlyTraffic"` // Pause the device when this much traffic has been exchanged with it during a calendar month. Zero or a percentage means no cap.
+	Tags                     []string             `xml:"tag,omitempty" json:"tags"`
 	IgnoredFolders           []ObservedFolder     `xml:"ignoredFolder" json:"ignoredFolders"`
 	PendingFolders           []ObservedFolder     `xml:"pendingFolder" json:"pendingFolders"`
 	MaxRequestKiB            int                  `xml:"maxRequestKiB" json:"maxRequestKiB"`
+	ProxyURL                 string               `xml:"proxyURL,omitempty" json:"proxyURL"`                  // Dial this device through the given socks5:// or http:// proxy.
+	DeltaTransfers           bool                 `xml:"deltaTransfers,attr,omitempty" json:"deltaTransfers"` // Request sub-block deltas against our old data from this device instead of full blocks; for slow links.
 }
 
 func NewDeviceConfiguration(id protocol.DeviceID, name string) DeviceConfiguration {
@@ -44,8 +51,16 @@ func (cfg DeviceConfiguration) Copy() DeviceConfiguration {
 	c := cfg
 	c.Addresses = make([]string, len(cfg.Addresses))
 	copy(c.Addresses, cfg.Addresses)
+	if cfg.IntroducedCertNames != nil {
+		c.IntroducedCertNames = make([]string, len(cfg.IntroducedCertNames))
+		copy(c.IntroducedCertNames, cfg.IntroducedCertNames)
+	}
 	c.AllowedNetworks = make([]string, len(cfg.AllowedNetworks))
 	copy(c.AllowedNetworks, cfg.AllowedNetworks)
+	if cfg.Tags != nil {
+		c.Tags = make([]string, len(cfg.Tags))
+		copy(c.Tags, cfg.Tags)
+	}
 	c.IgnoredFolders = make([]ObservedFolder, len(cfg.IgnoredFolders))
 	copy(c.IgnoredFolders, cfg.IgnoredFolders)
 	c.PendingFolders = make([]ObservedFolder, len(cfg.PendingFolders))
@@ -26,33 +26,50 @@ var (
 const DefaultMarkerName = ".stfolder"
 
 type FolderConfiguration struct {
-	ID                    string                      `xml:"id,attr" json:"id"`
-	Label                 string                      `xml:"label,attr" json:"label" restart:"false"`
-	FilesystemType        fs.FilesystemType           `xml:"filesystemType" json:"filesystemType"`
-	Path                  string                      `xml:"path,attr" json:"path"`
-	Type                  FolderType                  `xml:"type,attr" json:"type"`
-	Devices               []FolderDeviceConfiguration `xml:"device" json:"devices"`
-	RescanIntervalS       int                         `xml:"rescanIntervalS,attr" json:"rescanIntervalS"`
-	FSWatcherEnabled      bool                        `xml:"fsWatcherEnabled,attr" json:"fsWatcherEnabled"`
-	FSWatcherDelayS       int                         `xml:"fsWatcherDelayS,attr" json:"fsWatcherDelayS"`
-	IgnorePerms           bool                        `xml:"ignorePerms,attr" json:"ignorePerms"`
-	AutoNormalize         bool                        `xml:"autoNormalize,attr" json:"autoNormalize"`
-	MinDiskFree           Size                        `xml:"minDiskFree" json:"minDiskFree"`
-	Versioning            VersioningConfiguration     `xml:"versioning" json:"versioning"`
-	Copiers               int                         `xml:"copiers" json:"copiers"` // This defines how many files are handled concurrently.
-	PullerMaxPendingKiB   int                         `xml:"pullerMaxPendingKiB" json:"pullerMaxPendingKiB"`
-	Hashers               int                         `xml:"hashers" json:"hashers"` // Less than one sets the value to the number of cores. These are CPU bound due to hashing.
-	Order                 PullOrder                   `xml:"order" json:"order"`
-	IgnoreDelete          bool                        `xml:"ignoreDelete" json:"ignoreDelete"`
-	ScanProgressIntervalS int                         `xml:"scanProgressIntervalS" json:"scanProgressIntervalS"` // Set to a negative value to disable. Value of 0 will get replaced with value of 2 (default value)
-	PullerPauseS          int                         `xml:"pullerPauseS" json:"pullerPauseS"`
-	MaxConflicts          int                         `xml:"maxConflicts" json:"maxConflicts"`
-	DisableSparseFiles    bool                        `xml:"disableSparseFiles" json:"disableSparseFiles"`
-	DisableTempIndexes    bool                        `xml:"disableTempIndexes" json:"disableTempIndexes"`
-	Paused                bool                        `xml:"paused" json:"paused"`
-	WeakHashThresholdPct  int                         `xml:"weakHashThresholdPct" json:"weakHashThresholdPct"` // Use weak hash if more than X percent of the file has changed. Set to -1 to always use weak hash.
-	MarkerName            string                      `xml:"markerName" json:"markerName"`
-	UseLargeBlocks        bool                        `xml:"useLargeBlocks" json:"useLargeBlocks"`
+	ID                      string                      `xml:"id,attr" json:"id"`
+	Label                   string                      `xml:"label,attr" json:"label" restart:"false"`
+	FilesystemType          fs.FilesystemType           `xml:"filesystemType" json:"filesystemType"`
+	Path                    string                      `xml:"path,attr" json:"path"`
+	Type                    FolderType                  `xml:"type,attr" json:"type"`
+	Devices                 []FolderDeviceConfiguration `xml:"device" json:"devices"`
+	RescanIntervalS         int                         `xml:"rescanIntervalS,attr" json:"rescanIntervalS"`
+	RescanIntervalMaxS      int                         `xml:"rescanIntervalMaxS,attr,omitempty" json:"rescanIntervalMaxS"` // When larger than rescanIntervalS the interval adapts: it doubles after every scheduled scan that finds no changes, up to this bound, and snaps back on activity.
+	FSWatcherEnabled        bool                        `xml:"fsWatcherEnabled,attr" json:"fsWatcherEnabled"`
+	FSWatcherDelayS         int                         `xml:"fsWatcherDelayS,attr" json:"fsWatcherDelayS"`
+	FSWatcherPollIntervalS  int                         `xml:"fsWatcherPollIntervalS,attr,omitempty" json:"fsWatcherPollIntervalS"` // Interval for the polling watcher used when native watching fails. Zero means the default of one minute.
+	JournalWatcher          bool                        `xml:"journalWatcher,attr,omitempty" json:"journalWatcher"`                 // Prefer the kernel change journal (fanotify) over per-directory watches; for very large folders. Falls back to the regular watcher when unavailable.
+	ScrubIntervalDays       int                         `xml:"scrubIntervalDays,attr,omitempty" json:"scrubIntervalDays"`           // When set, periodically verify folder contents against the recorded block hashes to catch bitrot. Zero disables scrubbing.
+	IgnorePerms             bool                        `xml:"ignorePerms,attr" json:"ignorePerms"`
+	AutoNormalize           bool                        `xml:"autoNormalize,attr" json:"autoNormalize"`
+	MinDiskFree             Size                        `xml:"minDiskFree" json:"minDiskFree"`
+	MaxFolderSize           Size                        `xml:"maxFolderSize" json:"maxFolderSize"`   // Stop pulling when the local folder reaches this size. Zero or a percentage means no limit.
+	MaxDeleteRatio          int                         `xml:"maxDeleteRatio" json:"maxDeleteRatio"` // Stop pulling when a pull would delete more than this percentage of local files. Zero means no limit.
+	Versioning              VersioningConfiguration     `xml:"versioning" json:"versioning"`
+	Copiers                 int                         `xml:"copiers" json:"copiers"` // This defines how many files are handled concurrently.
+	PullerMaxPendingKiB     int                         `xml:"pullerMaxPendingKiB" json:"pullerMaxPendingKiB"`
+	Hashers                 int                         `xml:"hashers" json:"hashers"` // Less than one sets the value to the number of cores. These are CPU bound due to hashing.
+	Order                   PullOrder                   `xml:"order" json:"order"`
+	IgnoreDelete            bool                        `xml:"ignoreDelete" json:"ignoreDelete"`
+	ScanProgressIntervalS   int                         `xml:"scanProgressIntervalS" json:"scanProgressIntervalS"` // Set to a negative value to disable. Value of 0 will get replaced with value of 2 (default value)
+	PullerPauseS            int                         `xml:"pullerPauseS" json:"pullerPauseS"`
+	MaxConflicts            int                         `xml:"maxConflicts" json:"maxConflicts"`
+	ConflictResolution      string                      `xml:"conflictResolution,omitempty" json:"conflictResolution"` // "keep-both" (default), "keep-newest", "keep-largest" or "prefer-device:<device id>"; decides whether the losing side of a conflict is kept as a conflict copy.
+	DisableSparseFiles      bool                        `xml:"disableSparseFiles" json:"disableSparseFiles"`
+	PullSequential          bool                        `xml:"pullSequential" json:"pullSequential"` // Pull blocks in file order so the start of a file completes first; for streaming consumers.
+	DisableTempIndexes      bool                        `xml:"disableTempIndexes" json:"disableTempIndexes"`
+	Paused                  bool                        `xml:"paused" json:"paused"`
+	SyncSchedule            []ScheduleWindow            `xml:"syncSchedule" json:"syncSchedule"`                 // When non-empty, the folder is automatically paused outside these windows.
+	WeakHashThresholdPct    int                         `xml:"weakHashThresholdPct" json:"weakHashThresholdPct"` // Use weak hash if more than X percent of the file has changed. Set to -1 to always use weak hash, or above 100 to never use it.
+	MarkerName              string                      `xml:"markerName" json:"markerName"`
+	UseLargeBlocks          bool                        `xml:"useLargeBlocks" json:"useLargeBlocks"`
+	DeduplicateOnReceive    bool                        `xml:"deduplicateOnReceive" json:"deduplicateOnReceive"`                 // Hardlink received files to an existing local file with identical content instead of writing a new copy.
+	FilenameNormalization   string                      `xml:"filenameNormalization" json:"filenameNormalization"`               // Unicode normalization for incoming names: "none", "nfc" or "nfd". Empty means the platform default.
+	CaseSensitiveFS         bool                        `xml:"caseSensitiveFS,omitempty" json:"caseSensitiveFS"`                 // Skip case conflict checks; safe only when the folder path is on a case sensitive filesystem.
+	SyncXattrs              bool                        `xml:"syncXattrs,omitempty" json:"syncXattrs"`                           // Preserve extended attributes when files are replaced by the puller.
+	CopyOwnershipFromParent bool                        `xml:"copyOwnershipFromParent,omitempty" json:"copyOwnershipFromParent"` // Make created items inherit owner and group from the containing directory; requires running with chown capability.
+	PullPriority            int                         `xml:"pullPriority,omitempty" json:"pullPriority"`                       // Scales the folder's outstanding request budget, favoring it over lower priority folders pulling from the same devices. Zero or one is normal priority.
+	NestedIgnores           bool                        `xml:"nestedIgnores,omitempty" json:"nestedIgnores"`                     // Also honour .stignore files found in subdirectories, with their patterns scoped to the directory they are in.
+	Groups                  []string                    `xml:"group,omitempty" json:"groups"`                                    // Share the folder with every device carrying a matching tag, in addition to those listed explicitly.
 
 	cachedFilesystem fs.Filesystem
 
@@ -62,8 +79,9 @@ type FolderConfiguration struct {
 }
 
 type FolderDeviceConfiguration struct {
-	DeviceID     protocol.DeviceID `xml:"id,attr" json:"deviceID"`
-	IntroducedBy protocol.DeviceID `xml:"introducedBy,attr" json:"introducedBy"`
+	DeviceID           protocol.DeviceID `xml:"id,attr" json:"deviceID"`
+	IntroducedBy       protocol.DeviceID `xml:"introducedBy,attr" json:"introducedBy"`
+	EncryptionPassword string            `xml:"encryptionPassword,omitempty" json:"encryptionPassword"` // Set to share the folder with this device in encrypted (untrusted) mode
 }
 
 func NewFolderConfiguration(myID protocol.DeviceID, id, label string, fsType fs.FilesystemType, path string) FolderConfiguration {
@@ -88,7 +106,13 @@ func (f FolderConfiguration) Copy() FolderConfiguration {
 	c := f
 	c.Devices = make([]FolderDeviceConfiguration, len(f.Devices))
 	copy(c.Devices, f.Devices)
+	if f.Groups != nil {
+		c.Groups = make([]string, len(f.Groups))
+		copy(c.Groups, f.Groups)
+	}
 	c.Versioning = f.Versioning.Copy()
+	c.SyncSchedule = make([]ScheduleWindow, len(f.SyncSchedule))
+	copy(c.SyncSchedule, f.SyncSchedule)
 	return c
 }
 
@@ -222,11 +246,25 @@ func (f *FolderConfiguration) prepare() {
 		f.RescanIntervalS = 0
 	}
 
+	if f.RescanIntervalMaxS > MaxRescanIntervalS {
+		f.RescanIntervalMaxS = MaxRescanIntervalS
+	} else if f.RescanIntervalMaxS < 0 {
+		f.RescanIntervalMaxS = 0
+	}
+
+	if f.ScrubIntervalDays < 0 {
+		f.ScrubIntervalDays = 0
+	}
+
 	if f.FSWatcherDelayS <= 0 {
 		f.FSWatcherEnabled = false
 		f.FSWatcherDelayS = 10
 	}
 
+	if f.FSWatcherPollIntervalS < 0 {
+		f.FSWatcherPollIntervalS = 0
+	}
+
 	if f.Versioning.Params == nil {
 		f.Versioning.Params = make(map[string]string)
 	}
@@ -280,9 +318,23 @@ func (f *FolderConfiguration) CheckAvailableSpace(req int64) error {
 	}
 	usage.Free -= req
 	if usage.Free > 0 {
-		if err := checkFreeSpace(f.MinDiskFree, usage); err == nil {
+		if err := CheckFreeSpace(f.MinDiskFree, usage); err == nil {
 			return nil
 		}
 	}
 	return fmt.Errorf("insufficient space in %v %v", fs.Type(), fs.URI())
 }
+
+// CheckFolderSize returns an error when the given local folder size in
+// bytes exceeds the configured maximum. Percentages make no sense for a
+// folder quota and are treated as no limit.
+func (f *FolderConfiguration) CheckFolderSize(usage int64) error {
+	max := f.MaxFolderSize.BaseValue()
+	if max <= 0 || f.MaxFolderSize.Percentage() {
+		return nil
+	}
+	if float64(usage) >= max {
+		return fmt.Errorf("folder size %d bytes is at or above the maximum of %v", usage, f.MaxFolderSize)
+	}
+	return nil
+}
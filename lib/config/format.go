@@ -0,0 +1,122 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+// The config file is XML by default, but JSON and YAML work as well,
+// selected by the file extension. All formats use the same field names
+// as the REST API and go through the same preparation and migration
+// pipeline on load.
+
+// ReadYAML reads a YAML configuration.
+func ReadYAML(r io.Reader, myID protocol.DeviceID) (Configuration, error) {
+	bs, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Configuration{}, err
+	}
+
+	var intf interface{}
+	if err := yaml.Unmarshal(bs, &intf); err != nil {
+		return Configuration{}, err
+	}
+
+	// Take the detour over JSON so the json struct tags apply.
+	bs, err = json.Marshal(yamlToJSON(intf))
+	if err != nil {
+		return Configuration{}, err
+	}
+	return ReadJSON(bytes.NewReader(bs), myID)
+}
+
+// WriteJSON writes the configuration in JSON format.
+func (cfg *Configuration) WriteJSON(w io.Writer) error {
+	bs, err := json.MarshalIndent(cfg, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(bs, '\n'))
+	return err
+}
+
+// WriteYAML writes the configuration in YAML format.
+func (cfg *Configuration) WriteYAML(w io.Writer) error {
+	bs, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	var intf interface{}
+	if err := json.Unmarshal(bs, &intf); err != nil {
+		return err
+	}
+
+	bs, err = yaml.Marshal(intf)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(bs)
+	return err
+}
+
+// readConfig reads a configuration in the format given by the file
+// extension of path.
+func readConfig(r io.Reader, path string, myID protocol.DeviceID) (Configuration, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return ReadJSON(r, myID)
+	case ".yaml", ".yml":
+		return ReadYAML(r, myID)
+	default:
+		return ReadXML(r, myID)
+	}
+}
+
+// writeTo writes the configuration in the format given by the file
+// extension of path.
+func (cfg *Configuration) writeTo(w io.Writer, path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return cfg.WriteJSON(w)
+	case ".yaml", ".yml":
+		return cfg.WriteYAML(w)
+	default:
+		return cfg.WriteXML(w)
+	}
+}
+
+// yamlToJSON rewrites the maps produced by YAML unmarshalling so they
+// can be passed to encoding/json, which requires string keys.
+func yamlToJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[fmt.Sprint(key)] = yamlToJSON(val)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = yamlToJSON(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
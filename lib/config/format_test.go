@@ -0,0 +1,82 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadYAML(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syncthing-yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfgFile := filepath.Join(dir, "config.yaml")
+	data := `version: 28
+folders:
+  - id: yamlfolder
+    label: A folder
+    path: ` + filepath.Join(dir, "yamlfolder") + `
+options:
+  maxSendKbps: 100
+`
+	if err := ioutil.WriteFile(cfgFile, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	wr, err := Load(cfgFile, device1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fcfg, ok := wr.Folder("yamlfolder")
+	if !ok {
+		t.Fatal("expected folder from YAML config")
+	}
+	if fcfg.Label != "A folder" {
+		t.Errorf("unexpected label %q", fcfg.Label)
+	}
+	if wr.Options().MaxSendKbps != 100 {
+		t.Errorf("unexpected maxSendKbps %d", wr.Options().MaxSendKbps)
+	}
+
+	// Saving writes YAML that loads back to the same thing.
+	if err := wr.Save(); err != nil {
+		t.Fatal(err)
+	}
+	again, err := Load(cfgFile, device1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := again.Folder("yamlfolder"); !ok {
+		t.Error("expected folder after YAML roundtrip")
+	}
+}
+
+func TestJSONRoundtrip(t *testing.T) {
+	cfg := New(device1)
+	cfg.Folders = append(cfg.Folders, FolderConfiguration{ID: "jsonfolder", Path: "testdata"})
+
+	buf := new(bytes.Buffer)
+	if err := cfg.WriteJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadJSON(buf, device1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Folders) != 1 || read.Folders[0].ID != "jsonfolder" {
+		t.Errorf("unexpected folders after roundtrip: %v", read.Folders)
+	}
+}
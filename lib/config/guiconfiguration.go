@@ -13,22 +13,45 @@ import (
 )
 
 type GUIConfiguration struct {
-	Enabled                   bool     `xml:"enabled,attr" json:"enabled" default:"true"`
-	RawAddress                string   `xml:"address" json:"address" default:"127.0.0.1:8384"`
-	User                      string   `xml:"user,omitempty" json:"user"`
-	Password                  string   `xml:"password,omitempty" json:"password"`
-	AuthMode                  AuthMode `xml:"authMode,omitempty" json:"authMode"`
-	RawUseTLS                 bool     `xml:"tls,attr" json:"useTLS"`
-	APIKey                    string   `xml:"apikey,omitempty" json:"apiKey"`
-	InsecureAdminAccess       bool     `xml:"insecureAdminAccess,omitempty" json:"insecureAdminAccess"`
-	Theme                     string   `xml:"theme" json:"theme" default:"default"`
-	Debugging                 bool     `xml:"debugging,attr" json:"debugging"`
-	InsecureSkipHostCheck     bool     `xml:"insecureSkipHostcheck,omitempty" json:"insecureSkipHostcheck"`
-	InsecureAllowFrameLoading bool     `xml:"insecureAllowFrameLoading,omitempty" json:"insecureAllowFrameLoading"`
+	Enabled                   bool                   `xml:"enabled,attr" json:"enabled" default:"true"`
+	RawAddress                string                 `xml:"address" json:"address" default:"127.0.0.1:8384"`
+	User                      string                 `xml:"user,omitempty" json:"user"`
+	Password                  string                 `xml:"password,omitempty" json:"password"`
+	Users                     []GUIUserConfiguration `xml:"guiUser,omitempty" json:"users"`
+	TOTPSecret                string                 `xml:"totpSecret,omitempty" json:"-"` // When set, logins require a TOTP code appended to the password.
+	AuthMode                  AuthMode               `xml:"authMode,omitempty" json:"authMode"`
+	RawUseTLS                 bool                   `xml:"tls,attr" json:"useTLS"`
+	APIKey                    string                 `xml:"apikey,omitempty" json:"apiKey"`
+	APIKeys                   []APIKeyConfiguration  `xml:"scopedApikey,omitempty" json:"apiKeys"`
+	InsecureAdminAccess       bool                   `xml:"insecureAdminAccess,omitempty" json:"insecureAdminAccess"`
+	Theme                     string                 `xml:"theme" json:"theme" default:"default"`
+	Debugging                 bool                   `xml:"debugging,attr" json:"debugging"`
+	InsecureSkipHostCheck     bool                   `xml:"insecureSkipHostcheck,omitempty" json:"insecureSkipHostcheck"`
+	InsecureAllowFrameLoading bool                   `xml:"insecureAllowFrameLoading,omitempty" json:"insecureAllowFrameLoading"`
+}
+
+// A GUIUserConfiguration is an additional GUI user with a role. Roles
+// are "admin" (everything), "observer" (read only) and "operator" (read
+// only, plus folder operations on the listed folders). A user without a
+// role is an observer.
+type GUIUserConfiguration struct {
+	Name     string   `xml:"name,attr" json:"name"`
+	Password string   `xml:"password,attr" json:"password"` // bcrypt hash
+	Role     string   `xml:"role,attr,omitempty" json:"role"`
+	Folders  []string `xml:"folder,omitempty" json:"folders"`
+}
+
+// An APIKeyConfiguration is an extra API key with restricted permissions.
+// Scopes are "admin" (everything), "readonly" (GET requests only),
+// "events" (the event endpoints only) and "folder:<id>" (requests
+// limited to the given folder). A key without scopes is an admin key.
+type APIKeyConfiguration struct {
+	Key    string   `xml:"key,attr" json:"key"`
+	Scopes []string `xml:"scope,omitempty" json:"scopes"`
 }
 
 func (c GUIConfiguration) IsAuthEnabled() bool {
-	return c.AuthMode == AuthModeLDAP || (len(c.User) > 0 && len(c.Password) > 0)
+	return c.AuthMode == AuthModeLDAP || (len(c.User) > 0 && len(c.Password) > 0) || len(c.Users) > 0
 }
 
 func (c GUIConfiguration) IsOverridden() bool {
@@ -117,20 +140,51 @@ func (c GUIConfiguration) URL() string {
 }
 
 // IsValidAPIKey returns true when the given API key is valid, including both
-// the value in config and any overrides
+// the value in config, any scoped keys, and any overrides
 func (c GUIConfiguration) IsValidAPIKey(apiKey string) bool {
-	switch apiKey {
-	case "":
-		return false
-
-	case c.APIKey, os.Getenv("STGUIAPIKEY"):
-		return true
+	_, ok := c.APIKeyScopes(apiKey)
+	return ok
+}
 
-	default:
-		return false
+// APIKeyScopes returns the scopes attached to the given API key and
+// whether the key is valid at all. The main API key and the environment
+// override are valid without scope restrictions.
+func (c GUIConfiguration) APIKeyScopes(apiKey string) ([]string, bool) {
+	if apiKey == "" {
+		return nil, false
 	}
+	if apiKey == c.APIKey || apiKey == os.Getenv("STGUIAPIKEY") {
+		return nil, true
+	}
+	for _, key := range c.APIKeys {
+		if apiKey == key.Key {
+			return key.Scopes, true
+		}
+	}
+	return nil, false
 }
 
 func (c GUIConfiguration) Copy() GUIConfiguration {
-	return c
+	cp := c
+	if c.Users != nil {
+		cp.Users = make([]GUIUserConfiguration, len(c.Users))
+		for i := range c.Users {
+			cp.Users[i] = c.Users[i]
+			if c.Users[i].Folders != nil {
+				cp.Users[i].Folders = make([]string, len(c.Users[i].Folders))
+				copy(cp.Users[i].Folders, c.Users[i].Folders)
+			}
+		}
+	}
+	if c.APIKeys != nil {
+		cp.APIKeys = make([]APIKeyConfiguration, len(c.APIKeys))
+		for i := range c.APIKeys {
+			cp.APIKeys[i] = c.APIKeys[i]
+			if c.APIKeys[i].Scopes != nil {
+				cp.APIKeys[i].Scopes = make([]string, len(c.APIKeys[i].Scopes))
+				copy(cp.APIKeys[i].Scopes, c.APIKeys[i].Scopes)
+			}
+		}
+	}
+	return cp
 }
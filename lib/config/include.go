@@ -0,0 +1,105 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/syncthing/syncthing/lib/osutil"
+)
+
+// Folders can be split out of the main config file into fragments in a
+// folders.d directory next to it. Each fragment is a <configuration>
+// element containing <folder> elements and is merged on load. A folder
+// read from a fragment is owned by that fragment: on save it is written
+// back there and left out of the main config file. This lets
+// configuration management tools own their fragments without fighting
+// the GUI over the main file.
+
+const includeDirName = "folders.d"
+
+// a fragment is the parseable content of an include file.
+type fragment struct {
+	XMLName xml.Name              `xml:"configuration"`
+	Folders []FolderConfiguration `xml:"folder"`
+}
+
+// loadIncludedFolders reads all fragments belonging to the config file at
+// the given path and merges their folders into cfg. It returns a map from
+// folder ID to the owning fragment path.
+func loadIncludedFolders(path string, cfg *Configuration) (map[string]string, error) {
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), includeDirName, "*.xml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+
+	owners := make(map[string]string)
+	for _, match := range matches {
+		fd, err := os.Open(match)
+		if err != nil {
+			return nil, err
+		}
+
+		var frag fragment
+		err = xml.NewDecoder(fd).Decode(&frag)
+		fd.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, folder := range frag.Folders {
+			if _, ok := owners[folder.ID]; ok {
+				l.Warnf("Folder %q is defined in multiple config fragments; using the first", folder.ID)
+				continue
+			}
+			owners[folder.ID] = match
+			cfg.Folders = append(cfg.Folders, folder)
+		}
+	}
+	return owners, nil
+}
+
+// saveIncludedFolders writes each fragment-owned folder in cfg back to its
+// fragment and removes it from cfg, leaving only main-file folders behind.
+func saveIncludedFolders(cfg *Configuration, owners map[string]string) error {
+	perFragment := make(map[string][]FolderConfiguration)
+	remaining := cfg.Folders[:0]
+	for _, folder := range cfg.Folders {
+		if path, ok := owners[folder.ID]; ok {
+			perFragment[path] = append(perFragment[path], folder)
+		} else {
+			remaining = append(remaining, folder)
+		}
+	}
+	cfg.Folders = remaining
+
+	for path, folders := range perFragment {
+		fd, err := osutil.CreateAtomic(path)
+		if err != nil {
+			return err
+		}
+
+		e := xml.NewEncoder(fd)
+		e.Indent("", "    ")
+		err = e.Encode(fragment{Folders: folders})
+		if err == nil {
+			_, err = fd.Write([]byte("\n"))
+		}
+		if err != nil {
+			fd.Close()
+			return err
+		}
+		if err := fd.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
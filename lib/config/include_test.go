@@ -0,0 +1,80 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIncludedFolders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syncthing-include")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfgFile := filepath.Join(dir, "config.xml")
+	main := `<configuration version="28">
+    <folder id="main" path="` + filepath.Join(dir, "main") + `"/>
+</configuration>
+`
+	if err := ioutil.WriteFile(cfgFile, []byte(main), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fragFile := filepath.Join(dir, "folders.d", "extra.xml")
+	frag := `<configuration>
+    <folder id="extra" label="before" path="` + filepath.Join(dir, "extra") + `"/>
+</configuration>
+`
+	if err := os.MkdirAll(filepath.Dir(fragFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fragFile, []byte(frag), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	wr, err := Load(cfgFile, device1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	folders := wr.Folders()
+	if _, ok := folders["main"]; !ok {
+		t.Error("expected folder from the main file")
+	}
+	fcfg, ok := folders["extra"]
+	if !ok {
+		t.Fatal("expected folder from the fragment")
+	}
+
+	// Changing the fragment folder and saving writes it back to the
+	// fragment, not the main file.
+	fcfg.Label = "after"
+	if _, err := wr.SetFolder(fcfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := wr.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if bs, err := ioutil.ReadFile(fragFile); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(string(bs), `label="after"`) {
+		t.Errorf("fragment was not updated:\n%s", bs)
+	}
+
+	if bs, err := ioutil.ReadFile(cfgFile); err != nil {
+		t.Fatal(err)
+	} else if strings.Contains(string(bs), `id="extra"`) {
+		t.Errorf("fragment folder leaked into the main file:\n%s", bs)
+	}
+}
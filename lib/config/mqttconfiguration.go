@@ -0,0 +1,24 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+// An MQTTConfiguration points at a broker that folder and device status
+// events are published to. Publishing is enabled when the address is
+// nonempty. An empty topic prefix means "syncthing", and the client ID
+// defaults to "syncthing-" plus our short device ID.
+type MQTTConfiguration struct {
+	Address     string `xml:"address,omitempty" json:"address"`
+	ClientID    string `xml:"clientID,omitempty" json:"clientID"`
+	Username    string `xml:"username,omitempty" json:"username"`
+	Password    string `xml:"password,omitempty" json:"password"`
+	TopicPrefix string `xml:"topicPrefix,omitempty" json:"topicPrefix"`
+	QoS         int    `xml:"qos,omitempty" json:"qos"`
+}
+
+func (c MQTTConfiguration) Copy() MQTTConfiguration {
+	return c
+}
@@ -0,0 +1,20 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+type OIDCConfiguration struct {
+	Issuer       string `xml:"issuer,omitempty" json:"issuer"`
+	ClientID     string `xml:"clientID,omitempty" json:"clientID"`
+	ClientSecret string `xml:"clientSecret,omitempty" json:"clientSecret"`
+	RolesClaim   string `xml:"rolesClaim,omitempty" json:"rolesClaim"`     // Claim holding the user's roles; "groups" when empty.
+	AdminRole    string `xml:"adminRole,omitempty" json:"adminRole"`       // Role granting full access; when empty, any authenticated user is admin.
+	ReadOnlyRole string `xml:"readOnlyRole,omitempty" json:"readOnlyRole"` // Role granting read only access.
+}
+
+func (c OIDCConfiguration) Copy() OIDCConfiguration {
+	return c
+}
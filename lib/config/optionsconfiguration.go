@@ -13,44 +13,59 @@ import (
 )
 
 type OptionsConfiguration struct {
-	ListenAddresses         []string `xml:"listenAddress" json:"listenAddresses" default:"default"`
-	GlobalAnnServers        []string `xml:"globalAnnounceServer" json:"globalAnnounceServers" json:"globalAnnounceServer" default:"default" restart:"true"`
-	GlobalAnnEnabled        bool     `xml:"globalAnnounceEnabled" json:"globalAnnounceEnabled" default:"true" restart:"true"`
-	LocalAnnEnabled         bool     `xml:"localAnnounceEnabled" json:"localAnnounceEnabled" default:"true" restart:"true"`
-	LocalAnnPort            int      `xml:"localAnnouncePort" json:"localAnnouncePort" default:"21027" restart:"true"`
-	LocalAnnMCAddr          string   `xml:"localAnnounceMCAddr" json:"localAnnounceMCAddr" default:"[ff12::8384]:21027" restart:"true"`
-	MaxSendKbps             int      `xml:"maxSendKbps" json:"maxSendKbps"`
-	MaxRecvKbps             int      `xml:"maxRecvKbps" json:"maxRecvKbps"`
-	ReconnectIntervalS      int      `xml:"reconnectionIntervalS" json:"reconnectionIntervalS" default:"60"`
-	RelaysEnabled           bool     `xml:"relaysEnabled" json:"relaysEnabled" default:"true"`
-	RelayReconnectIntervalM int      `xml:"relayReconnectIntervalM" json:"relayReconnectIntervalM" default:"10"`
-	StartBrowser            bool     `xml:"startBrowser" json:"startBrowser" default:"true"`
-	NATEnabled              bool     `xml:"natEnabled" json:"natEnabled" default:"true"`
-	NATLeaseM               int      `xml:"natLeaseMinutes" json:"natLeaseMinutes" default:"60"`
-	NATRenewalM             int      `xml:"natRenewalMinutes" json:"natRenewalMinutes" default:"30"`
-	NATTimeoutS             int      `xml:"natTimeoutSeconds" json:"natTimeoutSeconds" default:"10"`
-	URAccepted              int      `xml:"urAccepted" json:"urAccepted"` // Accepted usage reporting version; 0 for off (undecided), -1 for off (permanently)
-	URSeen                  int      `xml:"urSeen" json:"urSeen"`         // Report which the user has been prompted for.
-	URUniqueID              string   `xml:"urUniqueID" json:"urUniqueId"` // Unique ID for reporting purposes, regenerated when UR is turned on.
-	URURL                   string   `xml:"urURL" json:"urURL" default:"https://data.syncthing.net/newdata"`
-	URPostInsecurely        bool     `xml:"urPostInsecurely" json:"urPostInsecurely" default:"false"` // For testing
-	URInitialDelayS         int      `xml:"urInitialDelayS" json:"urInitialDelayS" default:"1800"`
-	RestartOnWakeup         bool     `xml:"restartOnWakeup" json:"restartOnWakeup" default:"true" restart:"true"`
-	AutoUpgradeIntervalH    int      `xml:"autoUpgradeIntervalH" json:"autoUpgradeIntervalH" default:"12" restart:"true"` // 0 for off
-	UpgradeToPreReleases    bool     `xml:"upgradeToPreReleases" json:"upgradeToPreReleases" restart:"true"`              // when auto upgrades are enabled
-	KeepTemporariesH        int      `xml:"keepTemporariesH" json:"keepTemporariesH" default:"24"`                        // 0 for off
-	CacheIgnoredFiles       bool     `xml:"cacheIgnoredFiles" json:"cacheIgnoredFiles" default:"false" restart:"true"`
-	ProgressUpdateIntervalS int      `xml:"progressUpdateIntervalS" json:"progressUpdateIntervalS" default:"5"`
-	LimitBandwidthInLan     bool     `xml:"limitBandwidthInLan" json:"limitBandwidthInLan" default:"false"`
-	MinHomeDiskFree         Size     `xml:"minHomeDiskFree" json:"minHomeDiskFree" default:"1 %"`
-	ReleasesURL             string   `xml:"releasesURL" json:"releasesURL" default:"https://upgrades.syncthing.net/meta.json" restart:"true"`
-	AlwaysLocalNets         []string `xml:"alwaysLocalNet" json:"alwaysLocalNets"`
-	OverwriteRemoteDevNames bool     `xml:"overwriteRemoteDeviceNamesOnConnect" json:"overwriteRemoteDeviceNamesOnConnect" default:"false"`
-	TempIndexMinBlocks      int      `xml:"tempIndexMinBlocks" json:"tempIndexMinBlocks" default:"10"`
-	UnackedNotificationIDs  []string `xml:"unackedNotificationID" json:"unackedNotificationIDs"`
-	TrafficClass            int      `xml:"trafficClass" json:"trafficClass"`
-	DefaultFolderPath       string   `xml:"defaultFolderPath" json:"defaultFolderPath" default:"~"`
-	SetLowPriority          bool     `xml:"setLowPriority" json:"setLowPriority" default:"true"`
+	ListenAddresses         []string                 `xml:"listenAddress" json:"listenAddresses" default:"default"`
+	GlobalAnnServers        []string                 `xml:"globalAnnounceServer" json:"globalAnnounceServers" json:"globalAnnounceServer" default:"default" restart:"true"`
+	GlobalAnnEnabled        bool                     `xml:"globalAnnounceEnabled" json:"globalAnnounceEnabled" default:"true" restart:"true"`
+	LocalAnnEnabled         bool                     `xml:"localAnnounceEnabled" json:"localAnnounceEnabled" default:"true" restart:"true"`
+	LocalAnnPort            int                      `xml:"localAnnouncePort" json:"localAnnouncePort" default:"21027" restart:"true"`
+	LocalAnnMCAddr          string                   `xml:"localAnnounceMCAddr" json:"localAnnounceMCAddr" default:"[ff12::8384]:21027" restart:"true"`
+	LocalAnnUnicastTargets  []string                 `xml:"localAnnounceUnicastTarget" json:"localAnnounceUnicastTargets" restart:"true"` // ip:port destinations for local announcements where broadcast/multicast doesn't reach.
+	MaxSendKbps             int                      `xml:"maxSendKbps" json:"maxSendKbps"`
+	MaxRecvKbps             int                      `xml:"maxRecvKbps" json:"maxRecvKbps"`
+	BandwidthSchedule       []BandwidthScheduleEntry `xml:"bandwidthSchedule" json:"bandwidthSchedule"` // Time of day overrides for the overall rate limits.
+	ReconnectIntervalS      int                      `xml:"reconnectionIntervalS" json:"reconnectionIntervalS" default:"60"`
+	RelaysEnabled           bool                     `xml:"relaysEnabled" json:"relaysEnabled" default:"true"`
+	MultipathEnabled        bool                     `xml:"multipathEnabled" json:"multipathEnabled"`                 // Maintain several simultaneous connections per device and spread requests over them.
+	ConnPriorityTCPLAN      int                      `xml:"connectionPriorityTcpLan" json:"connectionPriorityTcpLan"` // Overrides the built-in transport ranking when set (> 0); lower is better.
+	ConnPriorityTCPWAN      int                      `xml:"connectionPriorityTcpWan" json:"connectionPriorityTcpWan"`
+	ConnPriorityRelay       int                      `xml:"connectionPriorityRelay" json:"connectionPriorityRelay"`
+	MeteredNetworks         []string                 `xml:"meteredNetwork" json:"meteredNetworks"`  // CIDRs of networks where transfers cost money; used only as a last resort when pulling.
+	TCPHolePunching         bool                     `xml:"tcpHolePunching" json:"tcpHolePunching"` // Bind outgoing dials to the listen port so simultaneous opens can punch through NATs.
+	RelayReconnectIntervalM int                      `xml:"relayReconnectIntervalM" json:"relayReconnectIntervalM" default:"10"`
+	StartBrowser            bool                     `xml:"startBrowser" json:"startBrowser" default:"true"`
+	NATEnabled              bool                     `xml:"natEnabled" json:"natEnabled" default:"true"`
+	NATLeaseM               int                      `xml:"natLeaseMinutes" json:"natLeaseMinutes" default:"60"`
+	NATRenewalM             int                      `xml:"natRenewalMinutes" json:"natRenewalMinutes" default:"30"`
+	NATTimeoutS             int                      `xml:"natTimeoutSeconds" json:"natTimeoutSeconds" default:"10"`
+	URAccepted              int                      `xml:"urAccepted" json:"urAccepted"` // Accepted usage reporting version; 0 for off (undecided), -1 for off (permanently)
+	URSeen                  int                      `xml:"urSeen" json:"urSeen"`         // Report which the user has been prompted for.
+	URUniqueID              string                   `xml:"urUniqueID" json:"urUniqueId"` // Unique ID for reporting purposes, regenerated when UR is turned on.
+	URURL                   string                   `xml:"urURL" json:"urURL" default:"https://data.syncthing.net/newdata"`
+	URPostInsecurely        bool                     `xml:"urPostInsecurely" json:"urPostInsecurely" default:"false"` // For testing
+	URInitialDelayS         int                      `xml:"urInitialDelayS" json:"urInitialDelayS" default:"1800"`
+	RestartOnWakeup         bool                     `xml:"restartOnWakeup" json:"restartOnWakeup" default:"true" restart:"true"`
+	AutoUpgradeIntervalH    int                      `xml:"autoUpgradeIntervalH" json:"autoUpgradeIntervalH" default:"12" restart:"true"` // 0 for off
+	UpgradeToPreReleases    bool                     `xml:"upgradeToPreReleases" json:"upgradeToPreReleases" restart:"true"`              // when auto upgrades are enabled
+	KeepTemporariesH        int                      `xml:"keepTemporariesH" json:"keepTemporariesH" default:"24"`                        // 0 for off
+	CacheIgnoredFiles       bool                     `xml:"cacheIgnoredFiles" json:"cacheIgnoredFiles" default:"false" restart:"true"`
+	ProgressUpdateIntervalS int                      `xml:"progressUpdateIntervalS" json:"progressUpdateIntervalS" default:"5"`
+	LimitBandwidthInLan     bool                     `xml:"limitBandwidthInLan" json:"limitBandwidthInLan" default:"false"`
+	MinHomeDiskFree         Size                     `xml:"minHomeDiskFree" json:"minHomeDiskFree" default:"1 %"`
+	ReleasesURL             string                   `xml:"releasesURL" json:"releasesURL" default:"https://upgrades.syncthing.net/meta.json" restart:"true"`
+	AlwaysLocalNets         []string                 `xml:"alwaysLocalNet" json:"alwaysLocalNets"`
+	OverwriteRemoteDevNames bool                     `xml:"overwriteRemoteDeviceNamesOnConnect" json:"overwriteRemoteDeviceNamesOnConnect" default:"false"`
+	TempIndexMinBlocks      int                      `xml:"tempIndexMinBlocks" json:"tempIndexMinBlocks" default:"10"`
+	UnackedNotificationIDs  []string                 `xml:"unackedNotificationID" json:"unackedNotificationIDs"`
+	TrafficClass            int                      `xml:"trafficClass" json:"trafficClass"`
+	DefaultFolderPath       string                   `xml:"defaultFolderPath" json:"defaultFolderPath" default:"~"`
+	SetLowPriority          bool                     `xml:"setLowPriority" json:"setLowPriority" default:"true"`
+	MaxConcurrentScans      int                      `xml:"maxConcurrentScans" json:"maxConcurrentScans" restart:"true"` // Maximum number of folders scanning at once; 0 for unlimited
+	TLSCipherSuites         []string                 `xml:"tlsCipherSuite" json:"tlsCipherSuites" restart:"true"`        // Cipher suite names for device connections; empty for the built-in default set
+	TLSMinVersion           string                   `xml:"tlsMinVersion" json:"tlsMinVersion" restart:"true"`           // Minimum TLS version for device connections; empty for the built-in default
+	ManagementURL           string                   `xml:"managementURL" json:"managementURL" restart:"true"`           // When set, periodically fetch a signed configuration from this URL and apply it.
+	ManagementKey           string                   `xml:"managementKey" json:"managementKey" restart:"true"`           // Shared key used to verify the signature on centrally managed configurations.
+	ManagementIntervalS     int                      `xml:"managementIntervalS" json:"managementIntervalS" default:"300" restart:"true"`
+	EventLogMaxEvents       int                      `xml:"eventLogMaxEvents" json:"eventLogMaxEvents" restart:"true"` // Keep this many events in a persistent log; 0 to disable
 
 	DeprecatedUPnPEnabled        bool     `xml:"upnpEnabled,omitempty" json:"-"`
 	DeprecatedUPnPLeaseM         int      `xml:"upnpLeaseMinutes,omitempty" json:"-"`
@@ -70,6 +85,8 @@ func (orig OptionsConfiguration) Copy() OptionsConfiguration {
 	copy(c.AlwaysLocalNets, orig.AlwaysLocalNets)
 	c.UnackedNotificationIDs = make([]string, len(orig.UnackedNotificationIDs))
 	copy(c.UnackedNotificationIDs, orig.UnackedNotificationIDs)
+	c.TLSCipherSuites = make([]string, len(orig.TLSCipherSuites))
+	copy(c.TLSCipherSuites, orig.TLSCipherSuites)
 	return c
 }
 
@@ -0,0 +1,110 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+// A ScheduleWindow is a recurring period of time, given as a range of
+// weekdays and a time of day range. It is the common part of the
+// bandwidth schedule entries and the folder sync schedules.
+type ScheduleWindow struct {
+	Days  string `xml:"days,attr" json:"days"`   // Weekday names, "mon,tue" or "mon-fri" style; empty means every day
+	Start string `xml:"start,attr" json:"start"` // Start of the period, "08:00" style, inclusive
+	End   string `xml:"end,attr" json:"end"`     // End of the period, exclusive; before Start means the period wraps past midnight
+}
+
+var scheduleWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Matches returns true if the window covers the given time. A window
+// that doesn't parse never matches.
+func (w ScheduleWindow) Matches(t time.Time) bool {
+	start, err := scheduleMinutes(w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := scheduleMinutes(w.End)
+	if err != nil {
+		return false
+	}
+
+	now := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	if end < start {
+		// The period wraps past midnight; the part after midnight belongs
+		// to the day the period started.
+		if now < end {
+			day = (day + 6) % 7
+		}
+		if now >= end && now < start {
+			return false
+		}
+	} else if now < start || now >= end {
+		return false
+	}
+
+	return w.matchesDay(day)
+}
+
+func (w ScheduleWindow) matchesDay(day time.Weekday) bool {
+	if w.Days == "" {
+		return true
+	}
+	for _, tok := range strings.Split(strings.ToLower(w.Days), ",") {
+		tok = strings.TrimSpace(tok)
+		if dash := strings.Index(tok, "-"); dash >= 0 {
+			first, firstOK := scheduleWeekdays[strings.TrimSpace(tok[:dash])]
+			last, lastOK := scheduleWeekdays[strings.TrimSpace(tok[dash+1:])]
+			if !firstOK || !lastOK {
+				continue
+			}
+			// A range like fri-mon wraps around the weekend.
+			for d := first; ; d = (d + 1) % 7 {
+				if d == day {
+					return true
+				}
+				if d == last {
+					break
+				}
+			}
+			continue
+		}
+		if d, ok := scheduleWeekdays[tok]; ok && d == day {
+			return true
+		}
+	}
+	return false
+}
+
+func scheduleMinutes(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// AnyScheduleWindowMatches returns true if any of the windows covers the
+// given time.
+func AnyScheduleWindowMatches(windows []ScheduleWindow, t time.Time) bool {
+	for _, w := range windows {
+		if w.Matches(t) {
+			return true
+		}
+	}
+	return false
+}
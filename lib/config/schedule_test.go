@@ -0,0 +1,55 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleWindowMatches(t *testing.T) {
+	// 2019-01-07 is a Monday.
+	day := func(weekday int, hhmm string) time.Time {
+		tm, err := time.Parse("2006-01-02 15:04", "2019-01-07 "+hhmm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm.AddDate(0, 0, weekday)
+	}
+
+	cases := []struct {
+		window  ScheduleWindow
+		t       time.Time
+		matches bool
+	}{
+		// Plain business hours entry, any day
+		{ScheduleWindow{Start: "08:00", End: "18:00"}, day(0, "08:00"), true},
+		{ScheduleWindow{Start: "08:00", End: "18:00"}, day(0, "17:59"), true},
+		{ScheduleWindow{Start: "08:00", End: "18:00"}, day(0, "18:00"), false},
+		{ScheduleWindow{Start: "08:00", End: "18:00"}, day(0, "07:59"), false},
+		// Day restrictions
+		{ScheduleWindow{Days: "mon-fri", Start: "08:00", End: "18:00"}, day(0, "12:00"), true},
+		{ScheduleWindow{Days: "mon-fri", Start: "08:00", End: "18:00"}, day(5, "12:00"), false},
+		{ScheduleWindow{Days: "sat,sun", Start: "00:00", End: "23:59"}, day(5, "12:00"), true},
+		{ScheduleWindow{Days: "fri-mon", Start: "08:00", End: "18:00"}, day(6, "12:00"), true},
+		{ScheduleWindow{Days: "fri-mon", Start: "08:00", End: "18:00"}, day(2, "12:00"), false},
+		// Wrapping past midnight; the early hours belong to the start day
+		{ScheduleWindow{Days: "mon", Start: "22:00", End: "06:00"}, day(0, "23:00"), true},
+		{ScheduleWindow{Days: "mon", Start: "22:00", End: "06:00"}, day(1, "05:00"), true},
+		{ScheduleWindow{Days: "mon", Start: "22:00", End: "06:00"}, day(1, "07:00"), false},
+		{ScheduleWindow{Days: "mon", Start: "22:00", End: "06:00"}, day(0, "12:00"), false},
+		// Broken entries never match
+		{ScheduleWindow{Start: "8 am", End: "18:00"}, day(0, "12:00"), false},
+		{ScheduleWindow{Days: "frf", Start: "08:00", End: "18:00"}, day(0, "12:00"), false},
+	}
+
+	for i, tc := range cases {
+		if m := tc.window.Matches(tc.t); m != tc.matches {
+			t.Errorf("case %d: Matches(%v) => %v, expected %v", i, tc.t, m, tc.matches)
+		}
+	}
+}
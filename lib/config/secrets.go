@@ -0,0 +1,202 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Sensitive fields can be stored encrypted in the config file, protected
+// by a master passphrase taken from the STCONFIGPASSPHRASE environment
+// variable. The caller (or a wrapper script integrating with an OS
+// keyring) is responsible for providing the passphrase; when it is set we
+// transparently decrypt on load and encrypt on save. Encrypted values are
+// recognizable by a prefix so unencrypted configs keep working as before.
+
+const (
+	secretPrefix     = "aes-gcm:"
+	secretKDFRounds  = 4096
+	secretSaltLength = 16
+)
+
+var errWrongPassphrase = errors.New("config secret: wrong passphrase or corrupt value")
+
+// configPassphrase returns the master passphrase for config secrets, or
+// the empty string when secret encryption is not in use.
+func configPassphrase() string {
+	return os.Getenv("STCONFIGPASSPHRASE")
+}
+
+// isEncryptedSecret returns true when the value carries the encrypted
+// secret prefix.
+func isEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+// encryptSecret returns the encrypted form of the given plaintext, as a
+// string safe to store in the config file. Already encrypted values are
+// returned as they are.
+func encryptSecret(passphrase, plaintext string) (string, error) {
+	if plaintext == "" || isEncryptedSecret(plaintext) {
+		return plaintext, nil
+	}
+
+	salt := make([]byte, secretSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	gcm, err := secretCipher(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	bs := salt
+	bs = append(bs, nonce...)
+	bs = gcm.Seal(bs, nonce, []byte(plaintext), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(bs), nil
+}
+
+// decryptSecret returns the plaintext for the given encrypted value.
+// Values without the encrypted secret prefix are returned as they are.
+func decryptSecret(passphrase, value string) (string, error) {
+	if !isEncryptedSecret(value) {
+		return value, nil
+	}
+
+	bs, err := base64.StdEncoding.DecodeString(value[len(secretPrefix):])
+	if err != nil {
+		return "", err
+	}
+	if len(bs) < secretSaltLength {
+		return "", errWrongPassphrase
+	}
+
+	gcm, err := secretCipher(passphrase, bs[:secretSaltLength])
+	if err != nil {
+		return "", err
+	}
+
+	bs = bs[secretSaltLength:]
+	if len(bs) < gcm.NonceSize() {
+		return "", errWrongPassphrase
+	}
+
+	plaintext, err := gcm.Open(nil, bs[:gcm.NonceSize()], bs[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errWrongPassphrase
+	}
+	return string(plaintext), nil
+}
+
+func secretCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key := pbkdf2.Key([]byte(passphrase), salt, secretKDFRounds, 32, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// secretFields returns pointers to the fields of the configuration that
+// hold secrets and should be encrypted at rest.
+func (cfg *Configuration) secretFields() []*string {
+	fields := []*string{
+		&cfg.GUI.APIKey,
+		&cfg.GUI.Password,
+		&cfg.GUI.TOTPSecret,
+		&cfg.OIDC.ClientSecret,
+		&cfg.MQTT.Password,
+	}
+	for i := range cfg.GUI.APIKeys {
+		fields = append(fields, &cfg.GUI.APIKeys[i].Key)
+	}
+	for i := range cfg.Webhooks {
+		fields = append(fields, &cfg.Webhooks[i].Key)
+	}
+	for i := range cfg.Folders {
+		for j := range cfg.Folders[i].Devices {
+			fields = append(fields, &cfg.Folders[i].Devices[j].EncryptionPassword)
+		}
+	}
+	return fields
+}
+
+// secretVersioningParams are the versioning parameters that hold
+// secrets, by versioner type. They live in a map and can't be covered
+// by secretFields.
+var secretVersioningParams = map[string][]string{
+	"webdav": {"password"},
+}
+
+// forEachSecret applies fn to every sensitive config value in place.
+func (cfg *Configuration) forEachSecret(fn func(string) (string, error)) error {
+	for _, field := range cfg.secretFields() {
+		v, err := fn(*field)
+		if err != nil {
+			return err
+		}
+		*field = v
+	}
+	for i := range cfg.Folders {
+		params := cfg.Folders[i].Versioning.Params
+		for _, name := range secretVersioningParams[cfg.Folders[i].Versioning.Type] {
+			if value, ok := params[name]; ok {
+				v, err := fn(value)
+				if err != nil {
+					return err
+				}
+				params[name] = v
+			}
+		}
+	}
+	return nil
+}
+
+// RedactSecrets blanks all secret values in place, for handing the
+// configuration to principals who may view the settings but not the
+// credentials in them.
+func (cfg *Configuration) RedactSecrets() {
+	_ = cfg.forEachSecret(func(string) (string, error) {
+		return "", nil
+	})
+}
+
+// encryptSecrets encrypts all sensitive fields in place.
+func (cfg *Configuration) encryptSecrets(passphrase string) error {
+	return cfg.forEachSecret(func(value string) (string, error) {
+		return encryptSecret(passphrase, value)
+	})
+}
+
+// decryptSecrets decrypts all sensitive fields in place.
+func (cfg *Configuration) decryptSecrets(passphrase string) error {
+	return cfg.forEachSecret(func(value string) (string, error) {
+		if !isEncryptedSecret(value) {
+			return value, nil
+		}
+		if passphrase == "" {
+			return "", fmt.Errorf("config contains encrypted secrets; set STCONFIGPASSPHRASE to decrypt them")
+		}
+		return decryptSecret(passphrase, value)
+	})
+}
@@ -0,0 +1,128 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+import "testing"
+
+func TestSecretRoundtrip(t *testing.T) {
+	enc, err := encryptSecret("s3cret", "the api key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isEncryptedSecret(enc) {
+		t.Errorf("encrypted value %q lacks the secret prefix", enc)
+	}
+
+	dec, err := decryptSecret("s3cret", enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec != "the api key" {
+		t.Errorf("roundtrip returned %q", dec)
+	}
+
+	if _, err := decryptSecret("wrong", enc); err == nil {
+		t.Error("expected an error decrypting with the wrong passphrase")
+	}
+}
+
+func TestSecretPassthrough(t *testing.T) {
+	// Values without the prefix pass through both directions unchanged.
+	if enc, err := encryptSecret("s3cret", ""); err != nil || enc != "" {
+		t.Errorf("got %q, %v", enc, err)
+	}
+	if dec, err := decryptSecret("s3cret", "plaintext"); err != nil || dec != "plaintext" {
+		t.Errorf("got %q, %v", dec, err)
+	}
+
+	// Encrypting an already encrypted value does not double-wrap it.
+	enc, _ := encryptSecret("s3cret", "value")
+	again, err := encryptSecret("s3cret", enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != enc {
+		t.Error("encrypted value was encrypted again")
+	}
+}
+
+func TestConfigSecrets(t *testing.T) {
+	cfg := New(device1)
+	cfg.GUI.APIKey = "abc123"
+	cfg.GUI.Password = "$2a$10$hash"
+	cfg.GUI.APIKeys = []APIKeyConfiguration{{Key: "scoped123", Scopes: []string{"readonly"}}}
+	cfg.MQTT.Password = "mqttpass"
+	cfg.Webhooks = []WebhookConfiguration{{Key: "hooksecret"}}
+	cfg.Folders = []FolderConfiguration{{
+		ID:         "default",
+		Devices:    []FolderDeviceConfiguration{{DeviceID: device1, EncryptionPassword: "folderpass"}},
+		Versioning: VersioningConfiguration{Type: "webdav", Params: map[string]string{"password": "davpass", "url": "https://example.com"}},
+	}}
+
+	if err := cfg.encryptSecrets("s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	if !isEncryptedSecret(cfg.GUI.APIKey) || !isEncryptedSecret(cfg.GUI.Password) {
+		t.Error("secrets were not encrypted")
+	}
+	if !isEncryptedSecret(cfg.GUI.APIKeys[0].Key) || !isEncryptedSecret(cfg.MQTT.Password) || !isEncryptedSecret(cfg.Webhooks[0].Key) {
+		t.Error("scoped key, MQTT or webhook secrets were not encrypted")
+	}
+	if !isEncryptedSecret(cfg.Folders[0].Devices[0].EncryptionPassword) {
+		t.Error("folder encryption password was not encrypted")
+	}
+	if !isEncryptedSecret(cfg.Folders[0].Versioning.Params["password"]) {
+		t.Error("versioner password was not encrypted")
+	}
+	if cfg.Folders[0].Versioning.Params["url"] != "https://example.com" {
+		t.Error("non-secret versioning parameter was touched")
+	}
+
+	// Without a passphrase, encrypted secrets are an error.
+	broken := cfg.Copy()
+	if err := broken.decryptSecrets(""); err == nil {
+		t.Error("expected an error decrypting without a passphrase")
+	}
+
+	if err := cfg.decryptSecrets("s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.GUI.APIKey != "abc123" || cfg.GUI.Password != "$2a$10$hash" {
+		t.Errorf("unexpected decrypted values %q, %q", cfg.GUI.APIKey, cfg.GUI.Password)
+	}
+	if cfg.GUI.APIKeys[0].Key != "scoped123" || cfg.MQTT.Password != "mqttpass" || cfg.Webhooks[0].Key != "hooksecret" {
+		t.Error("scoped key, MQTT or webhook secrets did not roundtrip")
+	}
+	if cfg.Folders[0].Devices[0].EncryptionPassword != "folderpass" || cfg.Folders[0].Versioning.Params["password"] != "davpass" {
+		t.Error("folder secrets did not roundtrip")
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	cfg := New(device1)
+	cfg.GUI.APIKey = "abc123"
+	cfg.GUI.APIKeys = []APIKeyConfiguration{{Key: "scoped123", Scopes: []string{"readonly"}}}
+	cfg.GUI.TOTPSecret = "totpsecret"
+	cfg.OIDC.ClientSecret = "clientsecret"
+	cfg.Folders = []FolderConfiguration{{
+		ID:         "default",
+		Devices:    []FolderDeviceConfiguration{{DeviceID: device1, EncryptionPassword: "folderpass"}},
+		Versioning: VersioningConfiguration{Type: "webdav", Params: map[string]string{"password": "davpass", "url": "https://example.com"}},
+	}}
+
+	cfg.RedactSecrets()
+
+	if cfg.GUI.APIKey != "" || cfg.GUI.APIKeys[0].Key != "" || cfg.GUI.TOTPSecret != "" || cfg.OIDC.ClientSecret != "" {
+		t.Error("GUI or OIDC secrets were not redacted")
+	}
+	if cfg.Folders[0].Devices[0].EncryptionPassword != "" || cfg.Folders[0].Versioning.Params["password"] != "" {
+		t.Error("folder secrets were not redacted")
+	}
+	if cfg.GUI.APIKeys[0].Scopes[0] != "readonly" || cfg.Folders[0].Versioning.Params["url"] != "https://example.com" {
+		t.Error("non-secret values were touched")
+	}
+}
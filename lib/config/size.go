@@ -76,7 +76,9 @@ func (Size) ParseDefault(s string) (interface{}, error) {
 	return ParseSize(s)
 }
 
-func checkFreeSpace(req Size, usage fs.Usage) error {
+// CheckFreeSpace checks that the free space in usage doesn't fall below
+// the required amount.
+func CheckFreeSpace(req Size, usage fs.Usage) error {
 	val := req.BaseValue()
 	if val <= 0 {
 		return nil
@@ -70,3 +70,32 @@ func TestParseSize(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckFolderSize(t *testing.T) {
+	cases := []struct {
+		max   string
+		usage int64
+		ok    bool
+	}{
+		// No limit set
+		{"", 12345, true},
+		{"0", 12345, true},
+		// Percentages make no sense as folder quotas and are ignored
+		{"50%", 12345, true},
+		// Below, at and above the limit
+		{"1k", 999, true},
+		{"1k", 1000, false},
+		{"1k", 1001, false},
+	}
+
+	for _, tc := range cases {
+		size, err := ParseSize(tc.max)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := FolderConfiguration{MaxFolderSize: size}
+		if err := f.CheckFolderSize(tc.usage); (err == nil) != tc.ok {
+			t.Errorf("CheckFolderSize(%v) with max %q: %v, wanted ok=%v", tc.usage, tc.max, err, tc.ok)
+		}
+	}
+}
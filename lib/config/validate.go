@@ -0,0 +1,95 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+// Propose runs the given configuration through the same cleaning,
+// migration and subscriber verification as a Replace would, but without
+// committing anything. It returns every problem found; an empty slice
+// means the configuration would be accepted. This includes issues that a
+// commit would silently paper over, like references to unknown devices.
+func (w *Wrapper) Propose(to Configuration) []error {
+	// Lint before cleaning, as cleaning silently fixes some of these.
+	errs := to.lint()
+
+	if err := to.clean(); err != nil {
+		return append(errs, err)
+	}
+
+	w.mut.Lock()
+	from := w.cfg.Copy()
+	subs := append([]Committer(nil), w.subs...)
+	w.mut.Unlock()
+
+	for _, sub := range subs {
+		if err := sub.VerifyConfiguration(from.Copy(), to.Copy()); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", sub, err))
+		}
+	}
+
+	return errs
+}
+
+// lint returns the set of problems in the configuration that cleaning
+// either rejects or silently repairs.
+func (cfg *Configuration) lint() []error {
+	var errs []error
+
+	existingDevices := make(map[protocol.DeviceID]bool)
+	for _, device := range cfg.Devices {
+		existingDevices[device.DeviceID] = true
+	}
+
+	seenFolders := make(map[string]bool)
+	for _, folder := range cfg.Folders {
+		if folder.ID == "" {
+			errs = append(errs, fmt.Errorf("folder with empty ID"))
+			continue
+		}
+		if seenFolders[folder.ID] {
+			errs = append(errs, fmt.Errorf("folder %q: duplicate folder ID", folder.ID))
+		}
+		seenFolders[folder.ID] = true
+
+		if folder.Path == "" {
+			errs = append(errs, fmt.Errorf("folder %q: empty path", folder.ID))
+		}
+
+		for _, dev := range folder.Devices {
+			if !existingDevices[dev.DeviceID] {
+				errs = append(errs, fmt.Errorf("folder %q: shared with unknown device %v", folder.ID, dev.DeviceID))
+			}
+		}
+
+		if !folder.Paused && folder.Path != "" {
+			if err := folder.CheckPath(); err != nil {
+				errs = append(errs, fmt.Errorf("folder %q: %v", folder.ID, err))
+			}
+		}
+	}
+
+	// Folders nested within each other sync their own metadata and
+	// usually indicate a misconfiguration.
+	for _, folder := range cfg.Folders {
+		for _, other := range cfg.Folders {
+			if folder.ID == other.ID || folder.Path == "" || other.Path == "" {
+				continue
+			}
+			if fs.IsParent(folder.Path, other.Path) {
+				errs = append(errs, fmt.Errorf("folder %q: path is inside the path of folder %q", folder.ID, other.ID))
+			}
+		}
+	}
+
+	return errs
+}
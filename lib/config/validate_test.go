@@ -0,0 +1,50 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPropose(t *testing.T) {
+	wr := Wrap("/dev/null", New(device1))
+
+	// An empty config proposes cleanly.
+	if errs := wr.Propose(New(device1)); len(errs) != 0 {
+		t.Errorf("unexpected problems: %v", errs)
+	}
+
+	// A folder shared with an unknown device, nested inside another
+	// folder, with neither path existing.
+	to := New(device1)
+	to.Folders = []FolderConfiguration{
+		{ID: "outer", Path: "testdata/nonexistent"},
+		{ID: "inner", Path: "testdata/nonexistent/sub", Devices: []FolderDeviceConfiguration{{DeviceID: device2}}},
+	}
+
+	errs := wr.Propose(to)
+	if len(errs) == 0 {
+		t.Fatal("expected problems")
+	}
+
+	all := make([]string, len(errs))
+	for i, err := range errs {
+		all[i] = err.Error()
+	}
+	joined := strings.Join(all, "; ")
+	for _, expected := range []string{"unknown device", "inside the path", "folder path missing"} {
+		if !strings.Contains(joined, expected) {
+			t.Errorf("expected a problem mentioning %q in %q", expected, joined)
+		}
+	}
+
+	// Nothing was committed.
+	if len(wr.RawCopy().Folders) != 0 {
+		t.Error("propose committed the configuration")
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+// A WebhookConfiguration describes one webhook destination: events of
+// the listed types are POSTed to the URL. An empty event list means all
+// events. When a key is set the request body is signed with
+// HMAC-SHA256.
+type WebhookConfiguration struct {
+	URL    string   `xml:"url,attr" json:"url"`
+	Events []string `xml:"event,omitempty" json:"events"`
+	Key    string   `xml:"key,omitempty" json:"key"`
+}
+
+func (c WebhookConfiguration) Copy() WebhookConfiguration {
+	cp := c
+	if c.Events != nil {
+		cp.Events = make([]string, len(c.Events))
+		copy(cp.Events, c.Events)
+	}
+	return cp
+}
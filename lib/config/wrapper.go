@@ -59,8 +59,9 @@ func (noopWaiter) Wait() {}
 // notifications of changes to registered Handlers
 
 type Wrapper struct {
-	cfg  Configuration
-	path string
+	cfg      Configuration
+	path     string
+	includes map[string]string // folder ID -> owning config fragment, if any
 
 	deviceMap map[protocol.DeviceID]DeviceConfiguration
 	folderMap map[string]FolderConfiguration
@@ -92,12 +93,31 @@ func Load(path string, myID protocol.DeviceID) (*Wrapper, error) {
 	}
 	defer fd.Close()
 
-	cfg, err := ReadXML(fd, myID)
+	cfg, err := readConfig(fd, path, myID)
 	if err != nil {
 		return nil, err
 	}
 
-	return Wrap(path, cfg), nil
+	// Secrets are held decrypted in memory; they are re-encrypted on save.
+	if err := cfg.decryptSecrets(configPassphrase()); err != nil {
+		return nil, err
+	}
+
+	// Merge in folders from config fragments, then prepare again so the
+	// merged folders get the same treatment as those from the main file.
+	includes, err := loadIncludedFolders(path, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(includes) > 0 {
+		if err := cfg.prepare(myID); err != nil {
+			return nil, err
+		}
+	}
+
+	w := Wrap(path, cfg)
+	w.includes = includes
+	return w, nil
 }
 
 func (w *Wrapper) ConfigPath() string {
@@ -312,6 +332,29 @@ func (w *Wrapper) LDAP() LDAPConfiguration {
 	return w.cfg.LDAP.Copy()
 }
 
+// Webhooks returns the configured webhook destinations.
+func (w *Wrapper) Webhooks() []WebhookConfiguration {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	webhooks := make([]WebhookConfiguration, len(w.cfg.Webhooks))
+	for i := range w.cfg.Webhooks {
+		webhooks[i] = w.cfg.Webhooks[i].Copy()
+	}
+	return webhooks
+}
+
+func (w *Wrapper) OIDC() OIDCConfiguration {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	return w.cfg.OIDC.Copy()
+}
+
+func (w *Wrapper) MQTT() MQTTConfiguration {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	return w.cfg.MQTT.Copy()
+}
+
 // GUI returns the current GUI configuration object.
 func (w *Wrapper) GUI() GUIConfiguration {
 	w.mut.Lock()
@@ -386,8 +429,27 @@ func (w *Wrapper) Save() error {
 		return err
 	}
 
-	if err := w.cfg.WriteXML(fd); err != nil {
-		l.Debugln("WriteXML:", err)
+	cfg := w.cfg
+	if passphrase := configPassphrase(); passphrase != "" {
+		cfg = w.cfg.Copy()
+		if err := cfg.encryptSecrets(passphrase); err != nil {
+			l.Debugln("encryptSecrets:", err)
+			fd.Close()
+			return err
+		}
+	}
+
+	if len(w.includes) > 0 {
+		cfg = cfg.Copy()
+		if err := saveIncludedFolders(&cfg, w.includes); err != nil {
+			l.Debugln("saveIncludedFolders:", err)
+			fd.Close()
+			return err
+		}
+	}
+
+	if err := cfg.writeTo(fd, w.path); err != nil {
+		l.Debugln("writeTo:", err)
 		fd.Close()
 		return err
 	}
@@ -502,7 +564,7 @@ func (w *Wrapper) AddOrUpdatePendingFolder(id, label string, device protocol.Dev
 func (w *Wrapper) CheckHomeFreeSpace() error {
 	path := filepath.Dir(w.ConfigPath())
 	if usage, err := fs.NewFilesystem(fs.FilesystemTypeBasic, path).Usage("."); err == nil {
-		if err = checkFreeSpace(w.Options().MinHomeDiskFree, usage); err != nil {
+		if err = CheckFreeSpace(w.Options().MinHomeDiskFree, usage); err != nil {
 			return fmt.Errorf("insufficient space on home disk (%v): %v", path, err)
 		}
 	}
@@ -6,7 +6,34 @@
 
 package connections
 
+import (
+	"strings"
+
+	"github.com/syncthing/syncthing/lib/config"
+)
+
 const (
 	tcpPriority   = 10
 	relayPriority = 200
 )
+
+// priorityFor returns the priority for a connection over the given
+// transport, taking any configured overrides into account. The
+// transport may be a URL scheme such as "tcp4" or "dynamic+https" as
+// well as a plain transport name. Lower is better, just like nice etc.
+func priorityFor(opts config.OptionsConfiguration, transport string, isLAN bool, def int) int {
+	switch {
+	case strings.HasPrefix(transport, "tcp"):
+		if isLAN && opts.ConnPriorityTCPLAN > 0 {
+			return opts.ConnPriorityTCPLAN
+		}
+		if !isLAN && opts.ConnPriorityTCPWAN > 0 {
+			return opts.ConnPriorityTCPWAN
+		}
+	case strings.HasPrefix(transport, "relay"), strings.HasPrefix(transport, "dynamic"):
+		if opts.ConnPriorityRelay > 0 {
+			return opts.ConnPriorityRelay
+		}
+	}
+	return def
+}
@@ -10,7 +10,9 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"reflect"
 	"sync/atomic"
+	"time"
 
 	"github.com/syncthing/syncthing/lib/config"
 	"github.com/syncthing/syncthing/lib/protocol"
@@ -27,6 +29,7 @@ type limiter struct {
 	limitsLAN           atomicBool
 	deviceReadLimiters  map[protocol.DeviceID]*rate.Limiter
 	deviceWriteLimiters map[protocol.DeviceID]*rate.Limiter
+	options             config.OptionsConfiguration
 }
 
 type waiter interface {
@@ -49,9 +52,23 @@ func newLimiter(cfg *config.Wrapper) *limiter {
 	prev := config.Configuration{Options: config.OptionsConfiguration{MaxRecvKbps: -1, MaxSendKbps: -1}}
 
 	l.CommitConfiguration(prev, cfg.RawCopy())
+	go l.scheduleLoop()
 	return l
 }
 
+// scheduleLoop re-evaluates the bandwidth schedule so the limits flip over
+// when an entry begins or ends. The limiter lives for the lifetime of the
+// process, so there is no stopping mechanism.
+func (lim *limiter) scheduleLoop() {
+	for range time.Tick(time.Minute) {
+		lim.mu.Lock()
+		if len(lim.options.BandwidthSchedule) > 0 {
+			lim.applyLimitsLocked(time.Now())
+		}
+		lim.mu.Unlock()
+	}
+}
+
 // This function sets limiters according to corresponding DeviceConfiguration
 func (lim *limiter) setLimitsLocked(device config.DeviceConfiguration) bool {
 	readLimiter := lim.getReadLimiterLocked(device.DeviceID)
@@ -128,47 +145,69 @@ func (lim *limiter) CommitConfiguration(from, to config.Configuration) bool {
 	// Delete, add or update limiters for devices
 	lim.processDevicesConfigurationLocked(from, to)
 
+	lim.options = to.Options
+
 	if from.Options.MaxRecvKbps == to.Options.MaxRecvKbps &&
 		from.Options.MaxSendKbps == to.Options.MaxSendKbps &&
-		from.Options.LimitBandwidthInLan == to.Options.LimitBandwidthInLan {
+		from.Options.LimitBandwidthInLan == to.Options.LimitBandwidthInLan &&
+		reflect.DeepEqual(from.Options.BandwidthSchedule, to.Options.BandwidthSchedule) {
 		return true
 	}
 
+	lim.limitsLAN.set(to.Options.LimitBandwidthInLan)
+	lim.applyLimitsLocked(time.Now())
+
+	return true
+}
+
+// applyLimitsLocked sets the overall read and write limits from the
+// configured rates, or from the bandwidth schedule entry in effect at the
+// given time if there is one.
+func (lim *limiter) applyLimitsLocked(now time.Time) {
+	sendKbps := lim.options.MaxSendKbps
+	recvKbps := lim.options.MaxRecvKbps
+	if entry, ok := config.ActiveBandwidthScheduleEntry(lim.options.BandwidthSchedule, now); ok {
+		sendKbps = entry.MaxSendKbps
+		recvKbps = entry.MaxRecvKbps
+	}
+
 	limited := false
 	sendLimitStr := "is unlimited"
 	recvLimitStr := "is unlimited"
 
 	// The rate variables are in KiB/s in the config (despite the camel casing
 	// of the name). We multiply by 1024 to get bytes/s.
-	if to.Options.MaxRecvKbps <= 0 {
-		lim.read.SetLimit(rate.Inf)
-	} else {
-		lim.read.SetLimit(1024 * rate.Limit(to.Options.MaxRecvKbps))
-		recvLimitStr = fmt.Sprintf("limit is %d KiB/s", to.Options.MaxRecvKbps)
+	recvLimit := rate.Inf
+	if recvKbps > 0 {
+		recvLimit = 1024 * rate.Limit(recvKbps)
+		recvLimitStr = fmt.Sprintf("limit is %d KiB/s", recvKbps)
 		limited = true
 	}
-
-	if to.Options.MaxSendKbps <= 0 {
-		lim.write.SetLimit(rate.Inf)
-	} else {
-		lim.write.SetLimit(1024 * rate.Limit(to.Options.MaxSendKbps))
-		sendLimitStr = fmt.Sprintf("limit is %d KiB/s", to.Options.MaxSendKbps)
+	sendLimit := rate.Inf
+	if sendKbps > 0 {
+		sendLimit = 1024 * rate.Limit(sendKbps)
+		sendLimitStr = fmt.Sprintf("limit is %d KiB/s", sendKbps)
 		limited = true
 	}
 
-	lim.limitsLAN.set(to.Options.LimitBandwidthInLan)
+	if recvLimit == lim.read.Limit() && sendLimit == lim.write.Limit() {
+		// Nothing changed; the schedule ticked over to an entry with the
+		// same rates, or a config change didn't touch the effective rates.
+		return
+	}
+
+	lim.read.SetLimit(recvLimit)
+	lim.write.SetLimit(sendLimit)
 
 	l.Infof("Overall send rate %s, receive rate %s", sendLimitStr, recvLimitStr)
 
 	if limited {
-		if to.Options.LimitBandwidthInLan {
+		if lim.options.LimitBandwidthInLan {
 			l.Infoln("Rate limits apply to LAN connections")
 		} else {
 			l.Infoln("Rate limits do not apply to LAN connections")
 		}
 	}
-
-	return true
 }
 
 func (lim *limiter) String() string {
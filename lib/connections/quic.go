@@ -0,0 +1,43 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package connections
+
+import "github.com/syncthing/syncthing/lib/config"
+
+// The quic:// scheme is reserved for the QUIC transport. This build does
+// not include a QUIC implementation, so the factories below make the
+// scheme known but never valid, the same way deprecated protocols are
+// handled. That way a config listing quic:// addresses degrades to a
+// debug log line instead of a per-round "unknown address scheme" warning,
+// and the scheme keeps its meaning once the transport lands.
+
+// unsupportedListener is known but not compiled in
+type unsupportedListener struct {
+	listenerFactory
+}
+
+func (unsupportedListener) Valid(_ config.Configuration) error {
+	return errUnsupported
+}
+
+// unsupportedDialer is known but not compiled in
+type unsupportedDialer struct {
+	dialerFactory
+}
+
+func (unsupportedDialer) Valid(_ config.Configuration) error {
+	return errUnsupported
+}
+
+func init() {
+	listeners["quic"] = unsupportedListener{}
+	listeners["quic4"] = unsupportedListener{}
+	listeners["quic6"] = unsupportedListener{}
+	dialers["quic"] = unsupportedDialer{}
+	dialers["quic4"] = unsupportedDialer{}
+	dialers["quic6"] = unsupportedDialer{}
+}
@@ -40,13 +40,18 @@ var (
 )
 
 var (
-	errDisabled   = errors.New("disabled by configuration")
-	errDeprecated = errors.New("deprecated protocol")
+	errDisabled    = errors.New("disabled by configuration")
+	errDeprecated  = errors.New("deprecated protocol")
+	errUnsupported = errors.New("protocol not supported in this build")
 )
 
 const (
 	perDeviceWarningIntv = 15 * time.Minute
 	tlsHandshakeTimeout  = 10 * time.Second
+
+	// With multipath enabled this is the maximum number of simultaneous
+	// connections we maintain to a single device.
+	maxConnectionsPerDevice = 3
 )
 
 // From go/src/crypto/tls/cipher_suites.go
@@ -226,11 +231,22 @@ next:
 
 		// If we have a relay connection, and the new incoming connection is
 		// not a relay connection, we should drop that, and prefer this one.
+		// Apply any configured priority override for this transport now,
+		// so that the connection upgrade decisions below use the user's
+		// ranking rather than the built-in one.
+		c.priority = priorityFor(s.cfg.Options(), c.connType.Transport(), s.isLAN(c.RemoteAddr()), c.priority)
+
 		ct, connected := s.model.Connection(remoteID)
 
 		// Lower priority is better, just like nice etc.
+		secondary := false
 		if connected && ct.Priority() > c.priority {
 			l.Debugf("Switching connections %s (existing: %s new: %s)", remoteID, ct, c)
+		} else if connected && s.cfg.Options().MultipathEnabled && s.model.ConnectionCount(remoteID) < maxConnectionsPerDevice {
+			// With multipath enabled we keep additional connections to an
+			// already connected device and spread requests over them.
+			l.Debugf("Keeping additional connection to %s (existing: %s new: %s)", remoteID, ct, c)
+			secondary = true
 		} else if connected {
 			// We should not already be connected to the other party. TODO: This
 			// could use some better handling. If the old connection is dead but
@@ -272,12 +288,29 @@ next:
 		isLAN := s.isLAN(c.RemoteAddr())
 		rd, wr := s.limiter.getLimiters(remoteID, c, isLAN)
 
-		protoConn := protocol.NewConnection(remoteID, rd, wr, s.model, c.String(), deviceCfg.Compression)
+		var sm *secondaryModel
+		var receiver protocol.Model = s.model
+		if secondary {
+			sm = &secondaryModel{model: s.model}
+			receiver = sm
+		}
+		protoConn := protocol.NewConnection(remoteID, rd, wr, receiver, c.String(), deviceCfg.Compression)
+		if keys := folderEncryptionKeys(s.cfg, remoteID); len(keys) > 0 {
+			// Some folders are shared with this device in encrypted
+			// (untrusted) mode; wrap the connection so outgoing indexes
+			// and requests for those folders are encrypted.
+			protoConn = protocol.NewEncryptedConnection(keys, protoConn)
+		}
 		modelConn := completeConn{c, protoConn}
 
 		l.Infof("Established secure connection to %s at %s (%s)", remoteID, c, tlsCipherSuiteNames[c.ConnectionState().CipherSuite])
 
-		s.model.AddConnection(modelConn, hello)
+		if secondary {
+			sm.conn = modelConn
+			s.model.AddSecondaryConnection(modelConn, hello)
+		} else {
+			s.model.AddConnection(modelConn, hello)
+		}
 		continue next
 	}
 }
@@ -322,7 +355,11 @@ func (s *Service) connect() {
 
 			ct, connected := s.model.Connection(deviceID)
 
-			if connected && ct.Priority() == bestDialerPrio {
+			// With multipath enabled we keep dialing for additional paths
+			// to already connected devices, until we have enough of them.
+			multipath := connected && s.cfg.Options().MultipathEnabled && s.model.ConnectionCount(deviceID) < maxConnectionsPerDevice
+
+			if connected && ct.Priority() == bestDialerPrio && !multipath {
 				// Things are already as good as they can get.
 				continue
 			}
@@ -382,6 +419,9 @@ func (s *Service) connect() {
 				case errDeprecated:
 					l.Debugln("Dialer for", uri, "is deprecated")
 					continue
+				case errUnsupported:
+					l.Debugln("Dialer for", uri, "is not supported in this build")
+					continue
 				default:
 					l.Infof("Dialer for %v: %v", uri, err)
 					continue
@@ -389,23 +429,22 @@ func (s *Service) connect() {
 
 				priority := dialerFactory.Priority()
 
-				if connected && priority >= ct.Priority() {
-					l.Debugf("Not dialing using %s as priority is less than current connection (%d >= %d)", dialerFactory, dialerFactory.Priority(), ct.Priority())
+				// For LAN addresses, increase the priority so that we
+				// try these first.
+				isLAN := !dialerFactory.AlwaysWAN() && s.isLANHost(uri.Host)
+				if isLAN {
+					priority -= 1
+				}
+				priority = priorityFor(s.cfg.Options(), uri.Scheme, isLAN, priority)
+
+				if connected && priority >= ct.Priority() && !multipath {
+					l.Debugf("Not dialing using %s as priority is less than current connection (%d >= %d)", dialerFactory, priority, ct.Priority())
 					continue
 				}
 
 				dialer := dialerFactory.New(s.cfg, s.tlsCfg)
 				nextDial[nextDialKey] = now.Add(dialer.RedialFrequency())
 
-				// For LAN addresses, increase the priority so that we
-				// try these first.
-				switch {
-				case dialerFactory.AlwaysWAN():
-					// Do nothing.
-				case s.isLANHost(uri.Host):
-					priority -= 1
-				}
-
 				dialTargets = append(dialTargets, dialTarget{
 					dialer:   dialer,
 					priority: priority,
@@ -488,6 +527,22 @@ func (s *Service) isLAN(addr net.Addr) bool {
 	return false
 }
 
+// folderEncryptionKeys returns the encryption keys for folders shared
+// with the given device in encrypted (untrusted) mode, by folder ID. An
+// empty map means no folders are encrypted towards this device.
+func folderEncryptionKeys(cfg *config.Wrapper, device protocol.DeviceID) map[string]*[protocol.KeySize]byte {
+	keys := make(map[string]*[protocol.KeySize]byte)
+	for folderID, fcfg := range cfg.Folders() {
+		for _, dev := range fcfg.Devices {
+			if dev.DeviceID == device && dev.EncryptionPassword != "" {
+				keys[folderID] = protocol.KeyFromPassword(folderID, dev.EncryptionPassword)
+				break
+			}
+		}
+	}
+	return keys
+}
+
 func (s *Service) createListener(factory listenerFactory, uri *url.URL) bool {
 	// must be called with listenerMut held
 
@@ -557,6 +612,9 @@ func (s *Service) CommitConfiguration(from, to config.Configuration) bool {
 		case errDeprecated:
 			l.Debugln("Listener for", uri, "is deprecated")
 			continue
+		case errUnsupported:
+			l.Debugln("Listener for", uri, "is not supported in this build")
+			continue
 		default:
 			l.Infof("Listener for %v: %v", uri, err)
 			continue
@@ -54,6 +54,8 @@ const (
 	connTypeRelayServer
 	connTypeTCPClient
 	connTypeTCPServer
+	connTypeTorClient
+	connTypeTorServer
 )
 
 func (t connType) String() string {
@@ -66,6 +68,10 @@ func (t connType) String() string {
 		return "tcp-client"
 	case connTypeTCPServer:
 		return "tcp-server"
+	case connTypeTorClient:
+		return "tor-client"
+	case connTypeTorServer:
+		return "tor-server"
 	default:
 		return "unknown-type"
 	}
@@ -77,6 +83,8 @@ func (t connType) Transport() string {
 		return "relay"
 	case connTypeTCPClient, connTypeTCPServer:
 		return "tcp"
+	case connTypeTorClient, connTypeTorServer:
+		return "tor"
 	default:
 		return "unknown"
 	}
@@ -151,11 +159,48 @@ type genericListener interface {
 type Model interface {
 	protocol.Model
 	AddConnection(conn Connection, hello protocol.HelloResult)
+	AddSecondaryConnection(conn Connection, hello protocol.HelloResult)
+	RemoveSecondaryConnection(conn Connection, err error)
 	Connection(remoteID protocol.DeviceID) (Connection, bool)
+	ConnectionCount(remoteID protocol.DeviceID) int
 	OnHello(protocol.DeviceID, net.Addr, protocol.HelloResult) error
 	GetHello(protocol.DeviceID) protocol.HelloIntf
 }
 
+// secondaryModel is the model presented to additional (multipath)
+// connections to an already connected device. Requests and download
+// progress pass through to the real model, while index data and cluster
+// config messages are handled on the primary connection only and are
+// dropped here. The conn field is set before the connection is started.
+type secondaryModel struct {
+	model Model
+	conn  Connection
+}
+
+func (sm *secondaryModel) Index(deviceID protocol.DeviceID, folder string, files []protocol.FileInfo) {
+	l.Debugf("Dropping index from %s on secondary connection", deviceID)
+}
+
+func (sm *secondaryModel) IndexUpdate(deviceID protocol.DeviceID, folder string, files []protocol.FileInfo) {
+	l.Debugf("Dropping index update from %s on secondary connection", deviceID)
+}
+
+func (sm *secondaryModel) ClusterConfig(deviceID protocol.DeviceID, config protocol.ClusterConfig) {
+	l.Debugf("Dropping cluster config from %s on secondary connection", deviceID)
+}
+
+func (sm *secondaryModel) Request(deviceID protocol.DeviceID, folder, name string, blockNo int, size int32, offset int64, hash []byte, weakHash uint32, fromTemporary bool) (protocol.RequestResponse, error) {
+	return sm.model.Request(deviceID, folder, name, blockNo, size, offset, hash, weakHash, fromTemporary)
+}
+
+func (sm *secondaryModel) DownloadProgress(deviceID protocol.DeviceID, folder string, updates []protocol.FileDownloadProgressUpdate) {
+	sm.model.DownloadProgress(deviceID, folder, updates)
+}
+
+func (sm *secondaryModel) Closed(_ protocol.Connection, err error) {
+	sm.model.RemoveSecondaryConnection(sm.conn, err)
+}
+
 // serviceFunc wraps a function to create a suture.Service without stop
 // functionality.
 type serviceFunc func()
@@ -8,7 +8,10 @@ package connections
 
 import (
 	"crypto/tls"
+	"net"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/syncthing/syncthing/lib/config"
@@ -31,7 +34,25 @@ type tcpDialer struct {
 func (d *tcpDialer) Dial(id protocol.DeviceID, uri *url.URL) (internalConn, error) {
 	uri = fixupPort(uri, config.DefaultTCPPort)
 
-	conn, err := dialer.DialTimeout(uri.Scheme, uri.Host, 10*time.Second)
+	var conn net.Conn
+	var err error
+	if deviceCfg, ok := d.cfg.Device(id); ok && deviceCfg.ProxyURL != "" {
+		// This device should be reached through its own proxy rather
+		// than whatever the environment dictates.
+		proxyURL, perr := url.Parse(deviceCfg.ProxyURL)
+		if perr != nil {
+			return internalConn{}, perr
+		}
+		conn, err = dialer.DialTimeoutVia(proxyURL, uri.Scheme, uri.Host, 10*time.Second)
+	} else if d.cfg.Options().TCPHolePunching {
+		// Bind the dial socket to our listen port. When the remote does
+		// the same and both sides dial each other, the crossing SYNs
+		// traverse the NAT mappings kept warm by the listeners and the
+		// connection completes as a TCP simultaneous open.
+		conn, err = dialReusePort(uri.Scheme, uri.Host, tcpListenPort(d.cfg), 10*time.Second)
+	} else {
+		conn, err = dialer.DialTimeout(uri.Scheme, uri.Host, 10*time.Second)
+	}
 	if err != nil {
 		return internalConn{}, err
 	}
@@ -85,3 +106,20 @@ func (tcpDialerFactory) Valid(_ config.Configuration) error {
 func (tcpDialerFactory) String() string {
 	return "TCP Dialer"
 }
+
+// tcpListenPort returns the port of the first TCP listen address, which
+// is the port NATs already hold mappings for.
+func tcpListenPort(cfg *config.Wrapper) int {
+	for _, addr := range cfg.ListenAddresses() {
+		uri, err := url.Parse(addr)
+		if err != nil || !strings.HasPrefix(uri.Scheme, "tcp") {
+			continue
+		}
+		if _, port, err := net.SplitHostPort(uri.Host); err == nil {
+			if p, err := strconv.Atoi(port); err == nil && p > 0 {
+				return p
+			}
+		}
+	}
+	return config.DefaultTCPPort
+}
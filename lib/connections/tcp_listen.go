@@ -56,7 +56,18 @@ func (t *tcpListener) Serve() {
 		return
 	}
 
-	listener, err := net.ListenTCP(t.uri.Scheme, tcaddr)
+	var listener *net.TCPListener
+	if t.cfg.Options().TCPHolePunching {
+		// Mark the socket for port reuse so that outgoing dials can
+		// bind to the same port; see tcp_reuseport.go.
+		ln, lnErr := listenTCPReusePort(t.uri.Scheme, t.uri.Host)
+		if lnErr == nil {
+			listener = ln.(*net.TCPListener)
+		}
+		err = lnErr
+	} else {
+		listener, err = net.ListenTCP(t.uri.Scheme, tcaddr)
+	}
 	if err != nil {
 		t.mut.Lock()
 		t.err = err
@@ -0,0 +1,52 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package connections
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// setReusePort marks the socket so that the listener and outgoing dials
+// can share the same local port, which is what allows a TCP
+// simultaneous open to traverse the NAT mapping the listener maintains.
+func setReusePort(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		if sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); sockErr != nil {
+			return
+		}
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// dialReusePort dials with the local side bound to the given port.
+func dialReusePort(network, addr string, localPort int, timeout time.Duration) (net.Conn, error) {
+	dlr := net.Dialer{
+		Timeout:   timeout,
+		LocalAddr: &net.TCPAddr{Port: localPort},
+		Control:   setReusePort,
+	}
+	return dlr.Dial(network, addr)
+}
+
+// listenTCPReusePort listens with port reuse enabled on the socket.
+func listenTCPReusePort(network, addr string) (net.Listener, error) {
+	lc := net.ListenConfig{Control: setReusePort}
+	return lc.Listen(context.Background(), network, addr)
+}
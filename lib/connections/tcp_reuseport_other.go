@@ -0,0 +1,26 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package connections
+
+import (
+	"net"
+	"time"
+)
+
+// Port reuse is not available on this platform, so hole punching
+// degrades to ordinary dials and listens.
+
+func dialReusePort(network, addr string, _ int, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout(network, addr, timeout)
+}
+
+func listenTCPReusePort(network, addr string) (net.Listener, error) {
+	return net.Listen(network, addr)
+}
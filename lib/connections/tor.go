@@ -0,0 +1,401 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package connections
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/dialer"
+	"github.com/syncthing/syncthing/lib/nat"
+	"github.com/syncthing/syncthing/lib/protocol"
+	"github.com/syncthing/syncthing/lib/sync"
+)
+
+// The tor:// scheme connects devices through the Tor network. Listening
+// on tor://<host:port> connects to the Tor control port at that address
+// (127.0.0.1:9051 when empty) and publishes a v3 onion service pointing
+// at a local accept loop; the resulting tor://<id>.onion:<port> address
+// is advertised through discovery like any other listener address.
+// Dialing such an address goes through the local Tor SOCKS port, which
+// is 127.0.0.1:9050 unless overridden with the ST_TOR_SOCKS environment
+// variable. The onion service key is kept next to the configuration so
+// the address survives restarts.
+
+const (
+	torPriority           = 150 // worse than TCP, better than relays
+	torDefaultControlAddr = "127.0.0.1:9051"
+	torDefaultSocksAddr   = "127.0.0.1:9050"
+	onionKeyFileName      = "tor_onion.key"
+)
+
+func init() {
+	dialers["tor"] = torDialerFactory{}
+	listeners["tor"] = &torListenerFactory{}
+}
+
+func torSocksAddr() string {
+	if addr := os.Getenv("ST_TOR_SOCKS"); addr != "" {
+		return addr
+	}
+	return torDefaultSocksAddr
+}
+
+type torDialer struct {
+	cfg    *config.Wrapper
+	tlsCfg *tls.Config
+}
+
+func (d *torDialer) Dial(id protocol.DeviceID, uri *url.URL) (internalConn, error) {
+	uri = fixupPort(uri, config.DefaultTCPPort)
+
+	// The SOCKS proxy resolves the onion address; we must hand it the
+	// hostname rather than resolve it ourselves.
+	prxy, err := proxy.SOCKS5("tcp", torSocksAddr(), nil, proxy.Direct)
+	if err != nil {
+		return internalConn{}, err
+	}
+	conn, err := prxy.Dial("tcp", uri.Host)
+	if err != nil {
+		return internalConn{}, err
+	}
+
+	err = dialer.SetTCPOptions(conn)
+	if err != nil {
+		l.Debugln("Dial (BEP/tor): setting tcp options:", err)
+	}
+
+	tc := tls.Client(conn, d.tlsCfg)
+	err = tlsTimedHandshake(tc)
+	if err != nil {
+		tc.Close()
+		return internalConn{}, err
+	}
+
+	return internalConn{tc, connTypeTorClient, torPriority}, nil
+}
+
+func (d *torDialer) RedialFrequency() time.Duration {
+	return time.Duration(d.cfg.Options().ReconnectIntervalS) * time.Second
+}
+
+type torDialerFactory struct{}
+
+func (torDialerFactory) New(cfg *config.Wrapper, tlsCfg *tls.Config) genericDialer {
+	return &torDialer{
+		cfg:    cfg,
+		tlsCfg: tlsCfg,
+	}
+}
+
+func (torDialerFactory) Priority() int {
+	return torPriority
+}
+
+func (torDialerFactory) AlwaysWAN() bool {
+	return true
+}
+
+func (torDialerFactory) Valid(_ config.Configuration) error {
+	// Always valid
+	return nil
+}
+
+func (torDialerFactory) String() string {
+	return "Tor Dialer"
+}
+
+type torListener struct {
+	onAddressesChangedNotifier
+
+	uri     *url.URL
+	cfg     *config.Wrapper
+	tlsCfg  *tls.Config
+	stop    chan struct{}
+	conns   chan internalConn
+	factory listenerFactory
+
+	listener net.Listener
+	ctrl     *textproto.Conn
+	onion    *url.URL
+	err      error
+	mut      sync.RWMutex
+}
+
+func (t *torListener) Serve() {
+	t.mut.Lock()
+	t.err = nil
+	t.mut.Unlock()
+
+	// The accept loop listens on loopback only; connections arrive
+	// through the onion service the Tor daemon forwards to us.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.setErr(err)
+		l.Infoln("Listen (BEP/tor):", err)
+		return
+	}
+
+	ctrlAddr := t.uri.Host
+	if ctrlAddr == "" {
+		ctrlAddr = torDefaultControlAddr
+	}
+	ctrl, err := torControlConnect(ctrlAddr)
+	if err != nil {
+		listener.Close()
+		t.setErr(err)
+		l.Infoln("Listen (BEP/tor): control connection:", err)
+		return
+	}
+
+	keyPath := filepath.Join(filepath.Dir(t.cfg.ConfigPath()), onionKeyFileName)
+	keySpec := "NEW:ED25519-V3"
+	if bs, err := ioutil.ReadFile(keyPath); err == nil {
+		keySpec = strings.TrimSpace(string(bs))
+	}
+
+	serviceID, privKey, err := torAddOnion(ctrl, keySpec, config.DefaultTCPPort, listener.Addr().String())
+	if err != nil {
+		ctrl.Close()
+		listener.Close()
+		t.setErr(err)
+		l.Infoln("Listen (BEP/tor): publishing onion service:", err)
+		return
+	}
+	if privKey != "" {
+		if err := ioutil.WriteFile(keyPath, []byte(privKey+"\n"), 0600); err != nil {
+			l.Warnln("Listen (BEP/tor): saving onion service key:", err)
+		}
+	}
+
+	onion := &url.URL{
+		Scheme: "tor",
+		Host:   net.JoinHostPort(serviceID+".onion", fmt.Sprint(config.DefaultTCPPort)),
+	}
+
+	t.mut.Lock()
+	t.listener = listener
+	t.ctrl = ctrl
+	t.onion = onion
+	t.mut.Unlock()
+
+	l.Infof("Tor onion service established at %v", onion)
+	t.notifyAddressesChanged(t)
+
+	for {
+		conn, err := listener.Accept()
+		select {
+		case <-t.stop:
+			if err == nil {
+				conn.Close()
+			}
+			return
+		default:
+		}
+		if err != nil {
+			t.setErr(err)
+			l.Warnln("Listen (BEP/tor): Accepting connection:", err)
+			return
+		}
+
+		l.Debugln("Listen (BEP/tor): connect from", conn.RemoteAddr())
+
+		if err := dialer.SetTCPOptions(conn); err != nil {
+			l.Debugln("Listen (BEP/tor): setting tcp options:", err)
+		}
+
+		tc := tls.Server(conn, t.tlsCfg)
+		if err := tlsTimedHandshake(tc); err != nil {
+			l.Infoln("Listen (BEP/tor): TLS handshake:", err)
+			tc.Close()
+			continue
+		}
+
+		t.conns <- internalConn{tc, connTypeTorServer, torPriority}
+	}
+}
+
+func (t *torListener) Stop() {
+	close(t.stop)
+	t.mut.RLock()
+	if t.listener != nil {
+		t.listener.Close()
+	}
+	if t.ctrl != nil {
+		// Closing the control connection takes the ephemeral onion
+		// service down with it.
+		t.ctrl.Close()
+	}
+	t.mut.RUnlock()
+}
+
+func (t *torListener) URI() *url.URL {
+	return t.uri
+}
+
+func (t *torListener) WANAddresses() []*url.URL {
+	t.mut.RLock()
+	defer t.mut.RUnlock()
+	if t.onion == nil {
+		return nil
+	}
+	return []*url.URL{t.onion}
+}
+
+func (t *torListener) LANAddresses() []*url.URL {
+	// An onion service is never local.
+	return nil
+}
+
+func (t *torListener) Error() error {
+	t.mut.RLock()
+	err := t.err
+	t.mut.RUnlock()
+	return err
+}
+
+func (t *torListener) setErr(err error) {
+	t.mut.Lock()
+	t.err = err
+	t.mut.Unlock()
+}
+
+func (t *torListener) String() string {
+	return t.uri.String()
+}
+
+func (t *torListener) Factory() listenerFactory {
+	return t.factory
+}
+
+func (t *torListener) NATType() string {
+	return "unknown"
+}
+
+type torListenerFactory struct{}
+
+func (f *torListenerFactory) New(uri *url.URL, cfg *config.Wrapper, tlsCfg *tls.Config, conns chan internalConn, _ *nat.Service) genericListener {
+	return &torListener{
+		uri:     uri,
+		cfg:     cfg,
+		tlsCfg:  tlsCfg,
+		conns:   conns,
+		stop:    make(chan struct{}),
+		factory: f,
+		mut:     sync.NewRWMutex(),
+	}
+}
+
+func (torListenerFactory) Valid(_ config.Configuration) error {
+	// Always valid
+	return nil
+}
+
+// torControlConnect opens a connection to the Tor control port and
+// authenticates, using the cookie mechanism when the daemon asks for it.
+func torControlConnect(addr string) (*textproto.Conn, error) {
+	ctrl, err := textproto.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	methods, cookieFile, err := torProtocolInfo(ctrl)
+	if err != nil {
+		ctrl.Close()
+		return nil, err
+	}
+
+	auth := "AUTHENTICATE"
+	switch {
+	case strings.Contains(methods, "NULL"):
+		// No arguments needed.
+	case strings.Contains(methods, "COOKIE") && cookieFile != "":
+		cookie, err := ioutil.ReadFile(cookieFile)
+		if err != nil {
+			ctrl.Close()
+			return nil, fmt.Errorf("reading control auth cookie: %v", err)
+		}
+		auth += " " + hex.EncodeToString(cookie)
+	default:
+		ctrl.Close()
+		return nil, fmt.Errorf("no supported control authentication method in %q", methods)
+	}
+
+	if _, err := torCmd(ctrl, auth); err != nil {
+		ctrl.Close()
+		return nil, err
+	}
+	return ctrl, nil
+}
+
+// torProtocolInfo returns the announced authentication methods and
+// cookie file location.
+func torProtocolInfo(ctrl *textproto.Conn) (methods, cookieFile string, err error) {
+	msg, err := torCmd(ctrl, "PROTOCOLINFO 1")
+	if err != nil {
+		return "", "", err
+	}
+	for _, line := range strings.Split(msg, "\n") {
+		if !strings.HasPrefix(line, "AUTH ") {
+			continue
+		}
+		for _, field := range strings.Fields(line[5:]) {
+			switch {
+			case strings.HasPrefix(field, "METHODS="):
+				methods = field[len("METHODS="):]
+			case strings.HasPrefix(field, "COOKIEFILE="):
+				cookieFile = strings.Trim(field[len("COOKIEFILE="):], `"`)
+			}
+		}
+	}
+	return methods, cookieFile, nil
+}
+
+// torAddOnion publishes an onion service forwarding the given port to
+// the local address. The keySpec is either NEW:ED25519-V3 or a private
+// key from an earlier reply, in which case the previous address is kept.
+func torAddOnion(ctrl *textproto.Conn, keySpec string, port int, localAddr string) (serviceID, privKey string, err error) {
+	msg, err := torCmd(ctrl, fmt.Sprintf("ADD_ONION %s Port=%d,%s", keySpec, port, localAddr))
+	if err != nil {
+		return "", "", err
+	}
+	for _, line := range strings.Split(msg, "\n") {
+		switch {
+		case strings.HasPrefix(line, "ServiceID="):
+			serviceID = line[len("ServiceID="):]
+		case strings.HasPrefix(line, "PrivateKey="):
+			privKey = line[len("PrivateKey="):]
+		}
+	}
+	if serviceID == "" {
+		return "", "", fmt.Errorf("no service ID in ADD_ONION reply")
+	}
+	return serviceID, privKey, nil
+}
+
+func torCmd(ctrl *textproto.Conn, cmd string) (string, error) {
+	id, err := ctrl.Cmd("%s", cmd)
+	if err != nil {
+		return "", err
+	}
+	ctrl.StartResponse(id)
+	defer ctrl.EndResponse(id)
+	_, msg, err := ctrl.ReadResponse(250)
+	return msg, err
+}
@@ -0,0 +1,130 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package db
+
+import (
+	"sync/atomic"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// backend abstracts the key-value store underlying a Lowlevel, so that
+// alternate storage engines can be plugged in without touching the
+// model facing code. It is deliberately the small subset of operations
+// we actually use.
+type backend interface {
+	Get(key []byte) ([]byte, error)
+	Has(key []byte) (bool, error)
+	Put(key, val []byte) error
+	Delete(key []byte) error
+	NewPrefixIterator(prefix []byte) backendIterator
+	GetSnapshot() (backendSnapshot, error)
+	NewBatch() backendBatch
+	Write(batch backendBatch) error
+	Close() error
+}
+
+// backendIterator iterates over a key range in no particular guaranteed
+// order beyond what the underlying engine provides (leveldb: sorted).
+type backendIterator interface {
+	Next() bool
+	Key() []byte
+	Value() []byte
+	Release()
+	Error() error
+}
+
+// backendSnapshot is a read-only, consistent view of the store.
+type backendSnapshot interface {
+	Get(key []byte) ([]byte, error)
+	Has(key []byte) (bool, error)
+	NewPrefixIterator(prefix []byte) backendIterator
+	Release()
+}
+
+// backendBatch accumulates writes to be committed atomically by
+// backend.Write.
+type backendBatch interface {
+	Put(key, val []byte)
+	Delete(key []byte)
+	Len() int
+	Reset()
+}
+
+// leveldbBackend implements backend on top of a goleveldb database. It
+// is the default and, so far, only engine.
+type leveldbBackend struct {
+	ldb       *leveldb.DB
+	committed *int64 // the Lowlevel commit counter; may be nil
+}
+
+func (b *leveldbBackend) Get(key []byte) ([]byte, error) {
+	return b.ldb.Get(key, nil)
+}
+
+func (b *leveldbBackend) Has(key []byte) (bool, error) {
+	return b.ldb.Has(key, nil)
+}
+
+func (b *leveldbBackend) Put(key, val []byte) error {
+	if b.committed != nil {
+		atomic.AddInt64(b.committed, 1)
+	}
+	return b.ldb.Put(key, val, nil)
+}
+
+func (b *leveldbBackend) Delete(key []byte) error {
+	if b.committed != nil {
+		atomic.AddInt64(b.committed, 1)
+	}
+	return b.ldb.Delete(key, nil)
+}
+
+func (b *leveldbBackend) NewPrefixIterator(prefix []byte) backendIterator {
+	return b.ldb.NewIterator(util.BytesPrefix(prefix), nil)
+}
+
+func (b *leveldbBackend) GetSnapshot() (backendSnapshot, error) {
+	snap, err := b.ldb.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &leveldbSnapshot{snap}, nil
+}
+
+func (b *leveldbBackend) NewBatch() backendBatch {
+	return new(leveldb.Batch)
+}
+
+func (b *leveldbBackend) Write(batch backendBatch) error {
+	return b.ldb.Write(batch.(*leveldb.Batch), nil)
+}
+
+func (b *leveldbBackend) Close() error {
+	return b.ldb.Close()
+}
+
+type leveldbSnapshot struct {
+	snap *leveldb.Snapshot
+}
+
+func (s *leveldbSnapshot) Get(key []byte) ([]byte, error) {
+	return s.snap.Get(key, nil)
+}
+
+func (s *leveldbSnapshot) Has(key []byte) (bool, error) {
+	return s.snap.Has(key, nil)
+}
+
+func (s *leveldbSnapshot) NewPrefixIterator(prefix []byte) backendIterator {
+	return s.snap.NewIterator(util.BytesPrefix(prefix), nil)
+}
+
+func (s *leveldbSnapshot) Release() {
+	s.snap.Release()
+}
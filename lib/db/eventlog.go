@@ -0,0 +1,143 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package db
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/sync"
+)
+
+// A StoredEvent is one entry in the persistent event log. The data is
+// the event payload as it was emitted, kept as raw JSON since we only
+// filter on the metadata.
+type StoredEvent struct {
+	ID     uint64          `json:"id"`
+	Time   time.Time       `json:"time"`
+	Type   string          `json:"type"`
+	Folder string          `json:"folder,omitempty"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// An EventFilter limits the result of an event log query. Zero values
+// mean no restriction on that attribute. A positive Limit returns the
+// newest matching events only.
+type EventFilter struct {
+	Types  []string
+	Folder string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+// An EventLog is a persistent, bounded log of events, stored under
+// sequential IDs so that iteration is in chronological order. When the
+// log exceeds maxEntries the oldest entries are dropped.
+type EventLog struct {
+	db         *Lowlevel
+	mut        sync.Mutex
+	nextID     uint64
+	oldestID   uint64
+	maxEntries int
+}
+
+func NewEventLog(db *Lowlevel, maxEntries int) *EventLog {
+	l := &EventLog{
+		db:         db,
+		mut:        sync.NewMutex(),
+		nextID:     1,
+		oldestID:   1,
+		maxEntries: maxEntries,
+	}
+
+	// Pick up where a previous run left off.
+	it := db.backend.NewPrefixIterator([]byte{KeyTypeEvent})
+	defer it.Release()
+	first := true
+	for it.Next() {
+		id := binary.BigEndian.Uint64(it.Key()[1:])
+		if first {
+			l.oldestID = id
+			first = false
+		}
+		l.nextID = id + 1
+	}
+	if first {
+		l.oldestID = l.nextID
+	}
+
+	return l
+}
+
+// Append adds the event to the log, assigning it the next ID, and
+// drops the oldest entries if the log is over its size limit.
+func (l *EventLog) Append(ev StoredEvent) uint64 {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	ev.ID = l.nextID
+	l.nextID++
+	bs, err := json.Marshal(ev)
+	if err != nil {
+		panic(err)
+	}
+	l.db.backend.Put(eventKey(ev.ID), bs)
+
+	for l.nextID-l.oldestID > uint64(l.maxEntries) {
+		l.db.backend.Delete(eventKey(l.oldestID))
+		l.oldestID++
+	}
+
+	return ev.ID
+}
+
+// Events returns the logged events matching the filter, oldest first.
+func (l *EventLog) Events(filter EventFilter) []StoredEvent {
+	types := make(map[string]struct{}, len(filter.Types))
+	for _, t := range filter.Types {
+		types[t] = struct{}{}
+	}
+
+	var evs []StoredEvent
+	it := l.db.backend.NewPrefixIterator([]byte{KeyTypeEvent})
+	defer it.Release()
+	for it.Next() {
+		var ev StoredEvent
+		if err := json.Unmarshal(it.Value(), &ev); err != nil {
+			continue
+		}
+		if len(types) > 0 {
+			if _, ok := types[ev.Type]; !ok {
+				continue
+			}
+		}
+		if filter.Folder != "" && ev.Folder != filter.Folder {
+			continue
+		}
+		if !filter.Since.IsZero() && ev.Time.Before(filter.Since) {
+			continue
+		}
+		if !filter.Until.IsZero() && ev.Time.After(filter.Until) {
+			continue
+		}
+		evs = append(evs, ev)
+	}
+
+	if filter.Limit > 0 && len(evs) > filter.Limit {
+		evs = evs[len(evs)-filter.Limit:]
+	}
+	return evs
+}
+
+func eventKey(id uint64) []byte {
+	key := make([]byte, 9)
+	key[0] = KeyTypeEvent
+	binary.BigEndian.PutUint64(key[1:], id)
+	return key
+}
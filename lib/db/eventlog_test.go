@@ -0,0 +1,66 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package db
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestEventLogRetention(t *testing.T) {
+	ldb := OpenMemory()
+	log := NewEventLog(ldb, 5)
+
+	for i := 0; i < 10; i++ {
+		log.Append(StoredEvent{
+			Time: time.Now(),
+			Type: "TestEvent",
+			Data: json.RawMessage(`{}`),
+		})
+	}
+
+	evs := log.Events(EventFilter{})
+	if len(evs) != 5 {
+		t.Fatalf("expected retention to keep 5 events, got %d", len(evs))
+	}
+	if evs[0].ID != 6 || evs[4].ID != 10 {
+		t.Errorf("expected events 6 through 10 to remain, got %d through %d", evs[0].ID, evs[4].ID)
+	}
+
+	// A new log on the same database continues the sequence.
+	log = NewEventLog(ldb, 5)
+	if id := log.Append(StoredEvent{Type: "TestEvent", Data: json.RawMessage(`{}`)}); id != 11 {
+		t.Errorf("expected the sequence to continue at 11, got %d", id)
+	}
+}
+
+func TestEventLogFilter(t *testing.T) {
+	ldb := OpenMemory()
+	log := NewEventLog(ldb, 100)
+
+	t0 := time.Now().Round(time.Second)
+	log.Append(StoredEvent{Time: t0, Type: "ItemFinished", Folder: "default", Data: json.RawMessage(`{}`)})
+	log.Append(StoredEvent{Time: t0.Add(time.Minute), Type: "ItemFinished", Folder: "other", Data: json.RawMessage(`{}`)})
+	log.Append(StoredEvent{Time: t0.Add(2 * time.Minute), Type: "StateChanged", Folder: "default", Data: json.RawMessage(`{}`)})
+
+	if evs := log.Events(EventFilter{Folder: "default"}); len(evs) != 2 {
+		t.Errorf("expected 2 events for the default folder, got %d", len(evs))
+	}
+	if evs := log.Events(EventFilter{Types: []string{"StateChanged"}}); len(evs) != 1 {
+		t.Errorf("expected 1 StateChanged event, got %d", len(evs))
+	}
+	if evs := log.Events(EventFilter{Since: t0.Add(30 * time.Second)}); len(evs) != 2 {
+		t.Errorf("expected 2 events after the cutoff, got %d", len(evs))
+	}
+	if evs := log.Events(EventFilter{Until: t0.Add(30 * time.Second)}); len(evs) != 1 {
+		t.Errorf("expected 1 event before the cutoff, got %d", len(evs))
+	}
+	if evs := log.Events(EventFilter{Limit: 1}); len(evs) != 1 || evs[0].Type != "StateChanged" {
+		t.Errorf("expected the limit to keep the newest event, got %v", evs)
+	}
+}
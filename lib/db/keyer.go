@@ -34,6 +34,9 @@ const (
 	KeyTypeMiscData        = 10
 	KeyTypeSequence        = 11
 	KeyTypeNeed            = 12
+	KeyTypeEvent           = 13
+	KeyTypePartial         = 14
+	KeyTypeTransferStat    = 15
 )
 
 type keyer interface {
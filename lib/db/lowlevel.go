@@ -7,6 +7,8 @@
 package db
 
 import (
+	stderrors "errors"
+	"fmt"
 	"os"
 	"strings"
 	"sync/atomic"
@@ -22,6 +24,8 @@ const (
 	dbWriteBuffer  = 4 << 20
 )
 
+var errNoSQLite = stderrors.New("this build does not include SQLite support")
+
 // Lowlevel is the lowest level database interface. It has a very simple
 // purpose: hold the actual *leveldb.DB database, and the in-memory state
 // that belong to that database. In the same way that a single on disk
@@ -30,6 +34,7 @@ const (
 type Lowlevel struct {
 	committed int64 // atomic, must come first
 	*leveldb.DB
+	backend   backend
 	location  string
 	folderIdx *smallIndex
 	deviceIdx *smallIndex
@@ -46,6 +51,21 @@ func Open(location string) (*Lowlevel, error) {
 	return open(location, opts)
 }
 
+// OpenBackend opens a database of the named backend type at the given
+// location. Currently "leveldb" is the only engine compiled in; requesting
+// "sqlite" or anything else returns an error. The name is accepted here so
+// that the -db-backend flag has a stable meaning once more engines exist.
+func OpenBackend(backendType, location string) (*Lowlevel, error) {
+	switch backendType {
+	case "", "leveldb":
+		return Open(location)
+	case "sqlite":
+		return nil, errNoSQLite
+	default:
+		return nil, fmt.Errorf("unknown database backend %q", backendType)
+	}
+}
+
 // OpenRO attempts to open the database at the given location, read only.
 func OpenRO(location string) (*Lowlevel, error) {
 	opts := &opt.Options{
@@ -109,12 +129,14 @@ func (db *Lowlevel) Delete(key []byte, wo *opt.WriteOptions) error {
 
 // NewLowlevel wraps the given *leveldb.DB into a *lowlevel
 func NewLowlevel(db *leveldb.DB, location string) *Lowlevel {
-	return &Lowlevel{
+	ll := &Lowlevel{
 		DB:        db,
 		location:  location,
 		folderIdx: newSmallIndex(db, []byte{KeyTypeFolderIdx}),
 		deviceIdx: newSmallIndex(db, []byte{KeyTypeDeviceIdx}),
 	}
+	ll.backend = &leveldbBackend{ldb: db, committed: &ll.committed}
+	return ll
 }
 
 // A "better" version of leveldb's errors.IsCorrupted.
@@ -0,0 +1,74 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// A PartialTracker records which blocks of a partially downloaded file
+// have been verified into the temporary file, so that a restart can
+// resume where it left off instead of rehashing the whole temp file.
+// Records are keyed by folder and file name and carry a hash of the
+// block list; a record for a different version of the file is ignored.
+type PartialTracker struct {
+	db *Lowlevel
+}
+
+type partialFile struct {
+	BlocksHash []byte  `json:"blocksHash"`
+	Available  []int32 `json:"available"`
+}
+
+func NewPartialTracker(db *Lowlevel) *PartialTracker {
+	return &PartialTracker{db: db}
+}
+
+// Set records the available block indexes for the given file.
+func (t *PartialTracker) Set(folder, file string, blocksHash []byte, available []int32) {
+	bs, err := json.Marshal(partialFile{
+		BlocksHash: blocksHash,
+		Available:  available,
+	})
+	if err != nil {
+		panic(err)
+	}
+	t.db.backend.Put(partialKey(folder, file), bs)
+}
+
+// Get returns the recorded block indexes for the given file, if there
+// is a record and it matches the given block list hash.
+func (t *PartialTracker) Get(folder, file string, blocksHash []byte) ([]int32, bool) {
+	bs, err := t.db.backend.Get(partialKey(folder, file))
+	if err != nil {
+		return nil, false
+	}
+	var rec partialFile
+	if err := json.Unmarshal(bs, &rec); err != nil {
+		return nil, false
+	}
+	if !bytes.Equal(rec.BlocksHash, blocksHash) {
+		return nil, false
+	}
+	return rec.Available, true
+}
+
+// Delete removes the record for the given file. It is allowed to delete
+// a nonexistent record.
+func (t *PartialTracker) Delete(folder, file string) {
+	t.db.backend.Delete(partialKey(folder, file))
+}
+
+func partialKey(folder, file string) []byte {
+	key := make([]byte, 1+len(folder)+1+len(file))
+	key[0] = KeyTypePartial
+	copy(key[1:], folder)
+	// Folder IDs cannot contain NUL, so this is an unambiguous separator.
+	copy(key[2+len(folder):], file)
+	return key
+}
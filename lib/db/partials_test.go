@@ -0,0 +1,50 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package db
+
+import "testing"
+
+func TestPartialTracker(t *testing.T) {
+	ldb := OpenMemory()
+	tr := NewPartialTracker(ldb)
+
+	hash := []byte{1, 2, 3, 4}
+	avail := []int32{0, 1, 5}
+
+	if _, ok := tr.Get("default", "file", hash); ok {
+		t.Error("unexpected record before Set")
+	}
+
+	tr.Set("default", "file", hash, avail)
+
+	got, ok := tr.Get("default", "file", hash)
+	if !ok {
+		t.Fatal("expected a record after Set")
+	}
+	if len(got) != len(avail) {
+		t.Fatalf("got %d indexes, expected %d", len(got), len(avail))
+	}
+	for i := range avail {
+		if got[i] != avail[i] {
+			t.Errorf("index %d: got %d, expected %d", i, got[i], avail[i])
+		}
+	}
+
+	// A different block list hash means the record is for another
+	// version of the file and must not be returned.
+	if _, ok := tr.Get("default", "file", []byte{9, 9, 9, 9}); ok {
+		t.Error("record returned despite mismatched block list hash")
+	}
+
+	tr.Delete("default", "file")
+	if _, ok := tr.Get("default", "file", hash); ok {
+		t.Error("unexpected record after Delete")
+	}
+
+	// Deleting a nonexistent record must not panic.
+	tr.Delete("default", "other")
+}
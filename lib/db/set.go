@@ -232,6 +232,15 @@ func (s *FileSet) WithGlobal(fn Iterator) {
 	s.db.withGlobal([]byte(s.folder), nil, false, nativeFileIterator(fn))
 }
 
+// WithGlobalConsistent is like WithGlobal, but blocks index updates for the
+// duration of the iteration so that the caller sees a point-in-time view.
+func (s *FileSet) WithGlobalConsistent(fn Iterator) {
+	l.Debugf("%s WithGlobalConsistent()", s.folder)
+	s.updateMutex.Lock()
+	defer s.updateMutex.Unlock()
+	s.db.withGlobal([]byte(s.folder), nil, false, nativeFileIterator(fn))
+}
+
 func (s *FileSet) WithGlobalTruncated(fn Iterator) {
 	l.Debugf("%s WithGlobalTruncated()", s.folder)
 	s.db.withGlobal([]byte(s.folder), nil, true, nativeFileIterator(fn))
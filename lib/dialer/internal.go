@@ -7,6 +7,9 @@
 package dialer
 
 import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
 	"net"
 	"net/http"
 	"net/url"
@@ -32,6 +35,7 @@ func init() {
 	l.SetDebug("dialer", strings.Contains(os.Getenv("STTRACE"), "dialer") || os.Getenv("STTRACE") == "all")
 
 	proxy.RegisterDialerType("socks", socksDialerFunction)
+	proxy.RegisterDialerType("http", httpDialerFunction)
 	proxyDialer = getDialer(proxy.Direct)
 	usingProxy = proxyDialer != proxy.Direct
 
@@ -97,6 +101,78 @@ func socksDialerFunction(u *url.URL, forward proxy.Dialer) (proxy.Dialer, error)
 	return proxy.SOCKS5("tcp", u.Host, auth, forward)
 }
 
+// httpDialerFunction returns a proxy.Dialer for the "http" URL scheme,
+// dialing through the proxy using the CONNECT method. Username and
+// password in the URL are sent as basic proxy authorization.
+func httpDialerFunction(u *url.URL, forward proxy.Dialer) (proxy.Dialer, error) {
+	d := &httpConnectDialer{
+		hostport: u.Host,
+		forward:  forward,
+	}
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		d.auth = base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + pass))
+	}
+	return d, nil
+}
+
+type httpConnectDialer struct {
+	hostport string
+	auth     string // base64 of user:pass, empty for no authorization
+	forward  proxy.Dialer
+}
+
+func (d *httpConnectDialer) Dial(network, addr string) (net.Conn, error) {
+	conn, err := d.forward.Dial("tcp", d.hostport)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if d.auth != "" {
+		req.Header.Set("Proxy-Authorization", "Basic "+d.auth)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT to %s: %s", addr, resp.Status)
+	}
+
+	// The proxy should not send anything beyond the response header, but
+	// anything the reader has buffered must not be lost.
+	if br.Buffered() > 0 {
+		return bufferedConn{conn, br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn drains a bufio.Reader before reading from the underlying
+// connection.
+type bufferedConn struct {
+	net.Conn
+	br *bufio.Reader
+}
+
+func (c bufferedConn) Read(bs []byte) (int, error) {
+	return c.br.Read(bs)
+}
+
 // This is a rip off of proxy.FromEnvironment with a custom forward dialer
 func getDialer(forward proxy.Dialer) proxy.Dialer {
 	allProxy := os.Getenv("all_proxy")
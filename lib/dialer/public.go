@@ -9,10 +9,13 @@ package dialer
 import (
 	"fmt"
 	"net"
+	"net/url"
 	"time"
 
 	"golang.org/x/net/ipv4"
 	"golang.org/x/net/ipv6"
+
+	"golang.org/x/net/proxy"
 )
 
 // Dial tries dialing via proxy if a proxy is configured, and falls back to
@@ -51,6 +54,29 @@ func DialTimeout(network, addr string, timeout time.Duration) (net.Conn, error)
 	return net.DialTimeout(network, addr, timeout)
 }
 
+// DialTimeoutVia dials the address through the proxy given by URL,
+// without falling back to a direct connection. Supported schemes are
+// socks5:// and http:// (CONNECT), with optional username and password
+// in the URL.
+func DialTimeoutVia(proxyURL *url.URL, network, addr string, timeout time.Duration) (net.Conn, error) {
+	dd := &timeoutDirectDialer{
+		timeout: timeout,
+	}
+	prxy, err := proxy.FromURL(proxyURL, dd)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := prxy.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	l.Debugf("Dialing %s address %s via %s proxy - success, %s -> %s", network, addr, proxyURL.Scheme, conn.LocalAddr(), conn.RemoteAddr())
+	SetTCPOptions(conn)
+	return dialerConn{
+		conn, newDialerAddr(network, addr),
+	}, nil
+}
+
 // SetTCPOptions sets our default TCP options on a TCP connection, possibly
 // digging through dialerConn to extract the *net.TCPConn
 func SetTCPOptions(conn net.Conn) error {
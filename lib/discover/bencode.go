@@ -0,0 +1,154 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package discover
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// A minimal bencode codec, sufficient for the KRPC messages spoken by the
+// DHT client. Strings decode as []byte, integers as int64, lists as
+// []interface{} and dictionaries as map[string]interface{}.
+
+func bencode(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case string:
+		fmt.Fprintf(buf, "%d:%s", len(v), v)
+	case []byte:
+		fmt.Fprintf(buf, "%d:", len(v))
+		buf.Write(v)
+	case int:
+		fmt.Fprintf(buf, "i%de", v)
+	case int64:
+		fmt.Fprintf(buf, "i%de", v)
+	case []interface{}:
+		buf.WriteByte('l')
+		for _, item := range v {
+			if err := bencode(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('e')
+	case map[string]interface{}:
+		// Keys must be sorted, per the spec.
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('d')
+		for _, key := range keys {
+			if err := bencode(buf, key); err != nil {
+				return err
+			}
+			if err := bencode(buf, v[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('e')
+	default:
+		return fmt.Errorf("bencode: unsupported type %T", v)
+	}
+	return nil
+}
+
+func bdecode(bs []byte) (interface{}, error) {
+	v, rest, err := bdecodeNext(bs)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("bencode: trailing data")
+	}
+	return v, nil
+}
+
+func bdecodeNext(bs []byte) (interface{}, []byte, error) {
+	if len(bs) == 0 {
+		return nil, nil, errors.New("bencode: unexpected end of data")
+	}
+
+	switch {
+	case bs[0] == 'i':
+		end := bytes.IndexByte(bs, 'e')
+		if end < 0 {
+			return nil, nil, errors.New("bencode: unterminated integer")
+		}
+		n, err := strconv.ParseInt(string(bs[1:end]), 10, 64)
+		if err != nil {
+			return nil, nil, err
+		}
+		return n, bs[end+1:], nil
+
+	case bs[0] == 'l':
+		bs = bs[1:]
+		var list []interface{}
+		for {
+			if len(bs) == 0 {
+				return nil, nil, errors.New("bencode: unterminated list")
+			}
+			if bs[0] == 'e' {
+				return list, bs[1:], nil
+			}
+			var item interface{}
+			var err error
+			item, bs, err = bdecodeNext(bs)
+			if err != nil {
+				return nil, nil, err
+			}
+			list = append(list, item)
+		}
+
+	case bs[0] == 'd':
+		bs = bs[1:]
+		dict := make(map[string]interface{})
+		for {
+			if len(bs) == 0 {
+				return nil, nil, errors.New("bencode: unterminated dictionary")
+			}
+			if bs[0] == 'e' {
+				return dict, bs[1:], nil
+			}
+			var keyv, val interface{}
+			var err error
+			keyv, bs, err = bdecodeNext(bs)
+			if err != nil {
+				return nil, nil, err
+			}
+			key, ok := keyv.([]byte)
+			if !ok {
+				return nil, nil, errors.New("bencode: non-string dictionary key")
+			}
+			val, bs, err = bdecodeNext(bs)
+			if err != nil {
+				return nil, nil, err
+			}
+			dict[string(key)] = val
+		}
+
+	case bs[0] >= '0' && bs[0] <= '9':
+		sep := bytes.IndexByte(bs, ':')
+		if sep < 0 {
+			return nil, nil, errors.New("bencode: malformed string")
+		}
+		length, err := strconv.Atoi(string(bs[:sep]))
+		if err != nil {
+			return nil, nil, err
+		}
+		if length < 0 || sep+1+length > len(bs) {
+			return nil, nil, errors.New("bencode: string length out of bounds")
+		}
+		return bs[sep+1 : sep+1+length], bs[sep+1+length:], nil
+
+	default:
+		return nil, nil, fmt.Errorf("bencode: unexpected byte %q", bs[0])
+	}
+}
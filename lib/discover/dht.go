@@ -0,0 +1,496 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package discover
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/protocol"
+	"github.com/syncthing/syncthing/lib/sync"
+)
+
+// The dht:// scheme finds devices through the BitTorrent mainline DHT,
+// with no discovery servers involved. Each device announces itself under
+// the infohash SHA1(device ID), and lookups are get_peers queries for the
+// same infohash, yielding tcp://ip:port addresses. A dht:// entry with a
+// host:port uses that node for bootstrapping; dht:// alone uses the well
+// known public bootstrap nodes.
+
+const (
+	dhtQueryTimeout     = time.Second
+	dhtLookupTimeout    = 10 * time.Second
+	dhtMaxQueries       = 16  // per lookup
+	dhtLookupWidth      = 8   // nodes we announce to
+	dhtMaxNodes         = 256 // size of our node cache
+	dhtAnnounceInterval = 15 * time.Minute
+	dhtNegCacheTime     = 5 * time.Minute
+)
+
+var dhtDefaultBootstrap = []string{
+	"router.bittorrent.com:6881",
+	"dht.transmissionbt.com:6881",
+}
+
+type dhtNode struct {
+	id   []byte // 20 bytes, nil when not yet known
+	addr *net.UDPAddr
+}
+
+type dhtClient struct {
+	bootstrap []string
+	addrList  AddressLister
+	myID      protocol.DeviceID
+	hasID     bool
+	stop      chan struct{}
+
+	mut    sync.Mutex
+	conn   *net.UDPConn
+	nodeID []byte
+	nodes  []dhtNode
+	calls  map[string]chan map[string]interface{}
+	tid    uint16
+	errorHolder
+}
+
+func NewDHT(server string, cert tls.Certificate, addrList AddressLister) (FinderService, error) {
+	p, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+	if p.Scheme != "dht" {
+		return nil, errors.New("unsupported scheme " + p.Scheme)
+	}
+
+	bootstrap := dhtDefaultBootstrap
+	if p.Host != "" {
+		bootstrap = []string{p.Host}
+	}
+
+	c := &dhtClient{
+		bootstrap: bootstrap,
+		addrList:  addrList,
+		stop:      make(chan struct{}),
+		calls:     make(map[string]chan map[string]interface{}),
+		mut:       sync.NewMutex(),
+	}
+	if len(cert.Certificate) > 0 {
+		c.myID = protocol.NewDeviceID(cert.Certificate[0])
+		c.hasID = true
+		// An error until we've announced.
+		c.setError(errors.New("not announced"))
+	}
+	return c, nil
+}
+
+func (c *dhtClient) Serve() {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		c.setError(err)
+		l.Infoln("DHT discovery:", err)
+		<-c.stop
+		return
+	}
+
+	nodeID := make([]byte, 20)
+	rand.Read(nodeID)
+
+	c.mut.Lock()
+	c.conn = conn
+	c.nodeID = nodeID
+	c.mut.Unlock()
+
+	go c.readLoop(conn)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			c.announce()
+			timer.Reset(dhtAnnounceInterval)
+
+		case <-c.stop:
+			conn.Close()
+			return
+		}
+	}
+}
+
+func (c *dhtClient) Stop() {
+	close(c.stop)
+}
+
+func (c *dhtClient) String() string {
+	return "dht@" + strings.Join(c.bootstrap, ",")
+}
+
+func (c *dhtClient) Cache() map[protocol.DeviceID]CacheEntry {
+	// The dhtClient doesn't do caching
+	return nil
+}
+
+// Lookup returns the list of addresses where the given device is available
+func (c *dhtClient) Lookup(device protocol.DeviceID) ([]string, error) {
+	c.mut.Lock()
+	running := c.conn != nil
+	c.mut.Unlock()
+	if !running {
+		return nil, lookupError{
+			error:    errors.New("DHT client not running"),
+			cacheFor: time.Minute,
+		}
+	}
+
+	target := sha1.Sum(device[:])
+	peers := c.iterativeLookup(target[:], 0)
+	if len(peers) == 0 {
+		return nil, lookupError{
+			error:    errors.New("no DHT peers for device"),
+			cacheFor: dhtNegCacheTime,
+		}
+	}
+
+	addresses := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		addresses = append(addresses, "tcp://"+peer)
+	}
+	return addresses, nil
+}
+
+// announce publishes our listen port under our own infohash.
+func (c *dhtClient) announce() {
+	if !c.hasID {
+		return
+	}
+
+	port := c.announcePort()
+	if port == 0 {
+		// Nothing to announce; not an error, same as the global client
+		// with an empty address list.
+		c.setError(nil)
+		return
+	}
+
+	target := sha1.Sum(c.myID[:])
+	c.iterativeLookup(target[:], port)
+}
+
+// announcePort returns the port of the first listen address usable over
+// plain TCP, or zero.
+func (c *dhtClient) announcePort() int {
+	if c.addrList == nil {
+		return 0
+	}
+	for _, addr := range c.addrList.AllAddresses() {
+		uri, err := url.Parse(addr)
+		if err != nil || !strings.HasPrefix(uri.Scheme, "tcp") {
+			continue
+		}
+		if _, portStr, err := net.SplitHostPort(uri.Host); err == nil {
+			if port, err := strconv.Atoi(portStr); err == nil && port > 0 {
+				return port
+			}
+		}
+	}
+	return 0
+}
+
+// iterativeLookup walks the DHT towards the target, collecting peers. With
+// a nonzero announcePort it finishes by announcing that port to the
+// closest nodes that gave us a write token.
+func (c *dhtClient) iterativeLookup(target []byte, announcePort int) []string {
+	deadline := time.Now().Add(dhtLookupTimeout)
+
+	type tokenNode struct {
+		node  dhtNode
+		token []byte
+	}
+
+	c.mut.Lock()
+	candidates := append([]dhtNode{}, c.nodes...)
+	c.mut.Unlock()
+	for _, host := range c.bootstrap {
+		if addr, err := net.ResolveUDPAddr("udp4", host); err == nil {
+			candidates = append(candidates, dhtNode{addr: addr})
+		}
+	}
+
+	visited := make(map[string]bool)
+	peers := make(map[string]bool)
+	var responded []tokenNode
+
+	for queries := 0; queries < dhtMaxQueries && time.Now().Before(deadline); queries++ {
+		// Pick the closest unvisited candidate; nodes of unknown ID sort
+		// last so that we prefer walking the DHT over re-bootstrapping.
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return dhtCloser(candidates[i].id, candidates[j].id, target)
+		})
+		var next *dhtNode
+		for i := range candidates {
+			if !visited[candidates[i].addr.String()] {
+				next = &candidates[i]
+				break
+			}
+		}
+		if next == nil {
+			break
+		}
+		visited[next.addr.String()] = true
+
+		res, err := c.call(next.addr, "get_peers", map[string]interface{}{
+			"info_hash": target,
+		})
+		if err != nil {
+			continue
+		}
+
+		node := dhtNode{id: bvalue(res, "id"), addr: next.addr}
+		c.addNode(node)
+		if token := bvalue(res, "token"); token != nil {
+			responded = append(responded, tokenNode{node, token})
+		}
+
+		if values, ok := res["values"].([]interface{}); ok {
+			for _, value := range values {
+				if bs, ok := value.([]byte); ok && len(bs) == 6 {
+					peers[compactAddr(bs)] = true
+				}
+			}
+		}
+		if nodes := bvalue(res, "nodes"); nodes != nil {
+			candidates = append(candidates, parseCompactNodes(nodes)...)
+		}
+	}
+
+	if announcePort > 0 {
+		announced := 0
+		sort.SliceStable(responded, func(i, j int) bool {
+			return dhtCloser(responded[i].node.id, responded[j].node.id, target)
+		})
+		for _, tn := range responded {
+			if announced >= dhtLookupWidth {
+				break
+			}
+			_, err := c.call(tn.node.addr, "announce_peer", map[string]interface{}{
+				"info_hash":    target,
+				"port":         announcePort,
+				"token":        tn.token,
+				"implied_port": 0,
+			})
+			if err == nil {
+				announced++
+			}
+		}
+		if announced > 0 {
+			c.setError(nil)
+		} else {
+			c.setError(errors.New("announce failed; no nodes accepted it"))
+		}
+	}
+
+	list := make([]string, 0, len(peers))
+	for peer := range peers {
+		list = append(list, peer)
+	}
+	return list
+}
+
+// call does a KRPC query against the given node and returns the response
+// arguments.
+func (c *dhtClient) call(addr *net.UDPAddr, query string, args map[string]interface{}) (map[string]interface{}, error) {
+	resChan := make(chan map[string]interface{}, 1)
+
+	c.mut.Lock()
+	conn := c.conn
+	c.tid++
+	tid := string([]byte{byte(c.tid >> 8), byte(c.tid)})
+	c.calls[tid] = resChan
+	args["id"] = c.nodeID
+	c.mut.Unlock()
+
+	defer func() {
+		c.mut.Lock()
+		delete(c.calls, tid)
+		c.mut.Unlock()
+	}()
+
+	buf := new(bytes.Buffer)
+	if err := bencode(buf, map[string]interface{}{
+		"t": tid,
+		"y": "q",
+		"q": query,
+		"a": args,
+	}); err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(buf.Bytes(), addr); err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-resChan:
+		res, ok := msg["r"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("DHT error response from %v", addr)
+		}
+		return res, nil
+	case <-time.After(dhtQueryTimeout):
+		return nil, fmt.Errorf("DHT query timeout against %v", addr)
+	case <-c.stop:
+		return nil, errors.New("stopping")
+	}
+}
+
+func (c *dhtClient) readLoop(conn *net.UDPConn) {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-c.stop:
+			default:
+				l.Debugln("DHT read:", err)
+			}
+			return
+		}
+
+		v, err := bdecode(buf[:n])
+		if err != nil {
+			continue
+		}
+		msg, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		switch string(bvalue(msg, "y")) {
+		case "r", "e":
+			c.mut.Lock()
+			resChan := c.calls[string(bvalue(msg, "t"))]
+			c.mut.Unlock()
+			if resChan != nil {
+				select {
+				case resChan <- msg:
+				default:
+				}
+			}
+
+		case "q":
+			c.handleQuery(conn, addr, msg)
+		}
+	}
+}
+
+// handleQuery answers incoming queries just enough for other nodes to
+// consider us alive. We don't store announces for others.
+func (c *dhtClient) handleQuery(conn *net.UDPConn, addr *net.UDPAddr, msg map[string]interface{}) {
+	args, ok := msg["a"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if id := bvalue(args, "id"); len(id) == 20 {
+		c.addNode(dhtNode{id: id, addr: addr})
+	}
+
+	res := map[string]interface{}{"id": c.nodeID}
+	switch string(bvalue(msg, "q")) {
+	case "ping", "announce_peer":
+	case "find_node", "get_peers":
+		res["nodes"] = ""
+		res["token"] = "st"
+	default:
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	if err := bencode(buf, map[string]interface{}{
+		"t": bvalue(msg, "t"),
+		"y": "r",
+		"r": res,
+	}); err != nil {
+		return
+	}
+	conn.WriteToUDP(buf.Bytes(), addr)
+}
+
+// addNode adds the node to our cache, dropping the oldest entry when the
+// cache is full.
+func (c *dhtClient) addNode(node dhtNode) {
+	if len(node.id) != 20 {
+		return
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	for _, existing := range c.nodes {
+		if existing.addr.String() == node.addr.String() {
+			return
+		}
+	}
+	c.nodes = append(c.nodes, node)
+	if len(c.nodes) > dhtMaxNodes {
+		c.nodes = c.nodes[1:]
+	}
+}
+
+// dhtCloser returns whether id a is closer to the target than id b, by
+// XOR metric. Unknown (nil) IDs sort last.
+func dhtCloser(a, b, target []byte) bool {
+	if len(a) != 20 {
+		return false
+	}
+	if len(b) != 20 {
+		return true
+	}
+	for i := range target {
+		da, db := a[i]^target[i], b[i]^target[i]
+		if da != db {
+			return da < db
+		}
+	}
+	return false
+}
+
+// parseCompactNodes parses the 26 byte per entry compact node encoding.
+func parseCompactNodes(bs []byte) []dhtNode {
+	var nodes []dhtNode
+	for len(bs) >= 26 {
+		nodes = append(nodes, dhtNode{
+			id: append([]byte{}, bs[:20]...),
+			addr: &net.UDPAddr{
+				IP:   net.IPv4(bs[20], bs[21], bs[22], bs[23]),
+				Port: int(bs[24])<<8 | int(bs[25]),
+			},
+		})
+		bs = bs[26:]
+	}
+	return nodes
+}
+
+// compactAddr parses the 6 byte compact peer encoding.
+func compactAddr(bs []byte) string {
+	ip := net.IPv4(bs[0], bs[1], bs[2], bs[3])
+	port := int(bs[4])<<8 | int(bs[5])
+	return net.JoinHostPort(ip.String(), strconv.Itoa(port))
+}
+
+// bvalue returns the []byte value under the key, or nil.
+func bvalue(m map[string]interface{}, key string) []byte {
+	bs, _ := m[key].([]byte)
+	return bs
+}
@@ -0,0 +1,96 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package discover
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestBencodeRoundtrip(t *testing.T) {
+	msg := map[string]interface{}{
+		"t": "aa",
+		"y": "q",
+		"q": "get_peers",
+		"a": map[string]interface{}{
+			"id":        "abcdefghij0123456789",
+			"info_hash": "mnopqrstuvwxyz123456",
+			"port":      6881,
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	if err := bencode(buf, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := bdecode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, ok := v.(map[string]interface{})
+	if !ok {
+		t.Fatalf("decoded to %T, not a dictionary", v)
+	}
+	if string(bvalue(dec, "q")) != "get_peers" {
+		t.Errorf("q = %q", bvalue(dec, "q"))
+	}
+	args, ok := dec["a"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("a is %T, not a dictionary", dec["a"])
+	}
+	if port, ok := args["port"].(int64); !ok || port != 6881 {
+		t.Errorf("port = %v", args["port"])
+	}
+}
+
+func TestBencodeErrors(t *testing.T) {
+	for _, bad := range []string{"", "i42", "5:ab", "l", "d1:xe", "di1e1:xe", "i42ejunk"} {
+		if _, err := bdecode([]byte(bad)); err == nil {
+			t.Errorf("expected error decoding %q", bad)
+		}
+	}
+}
+
+func TestCompactEncodings(t *testing.T) {
+	if addr := compactAddr([]byte{192, 0, 2, 1, 0x56, 0x2e}); addr != "192.0.2.1:22062" {
+		t.Errorf("got %q", addr)
+	}
+
+	entry := append(bytes.Repeat([]byte{7}, 20), 192, 0, 2, 42, 0x1a, 0xe1)
+	nodes := parseCompactNodes(append(entry, entry[:10]...)) // trailing garbage ignored
+	if len(nodes) != 1 {
+		t.Fatalf("got %d nodes", len(nodes))
+	}
+	if got := nodes[0].addr.String(); got != "192.0.2.42:6881" {
+		t.Errorf("got %q", got)
+	}
+	if !reflect.DeepEqual(nodes[0].id, bytes.Repeat([]byte{7}, 20)) {
+		t.Errorf("bad node ID %x", nodes[0].id)
+	}
+}
+
+func TestDHTCloser(t *testing.T) {
+	target := bytes.Repeat([]byte{0}, 20)
+	near := bytes.Repeat([]byte{0}, 20)
+	near[19] = 1
+	far := bytes.Repeat([]byte{0xff}, 20)
+
+	if !dhtCloser(near, far, target) {
+		t.Error("near should be closer than far")
+	}
+	if dhtCloser(far, near, target) {
+		t.Error("far should not be closer than near")
+	}
+	if dhtCloser(nil, near, target) {
+		t.Error("unknown IDs sort last")
+	}
+	if !dhtCloser(far, nil, target) {
+		t.Error("known IDs sort before unknown ones")
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package discover
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+// The dns:// scheme reads device addresses from DNS instead of asking a
+// discovery server. For a server entry dns://example.com, looking up a
+// device queries TXT records at _syncthing.<deviceid>.example.com, each
+// record holding one address URL, and SRV records at
+// _syncthing._tcp.<deviceid>.example.com for plain TCP addresses. The
+// device ID is its usual string form, lowercased. Announcing is not
+// possible; the records are maintained by whoever runs the zone.
+
+const dnsNegCacheTime = 5 * time.Minute
+
+type dnsClient struct {
+	zone string
+	stop chan struct{}
+	errorHolder
+}
+
+func NewDNS(server string) (FinderService, error) {
+	p, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+	if p.Scheme != "dns" {
+		return nil, errors.New("unsupported scheme " + p.Scheme)
+	}
+	if p.Host == "" {
+		return nil, errors.New("missing zone in " + server)
+	}
+
+	return &dnsClient{
+		zone: p.Host,
+		stop: make(chan struct{}),
+	}, nil
+}
+
+// Lookup returns the list of addresses where the given device is available
+func (c *dnsClient) Lookup(device protocol.DeviceID) ([]string, error) {
+	name := dnsQueryName(device, c.zone)
+
+	var addresses []string
+
+	txts, txtErr := net.LookupTXT("_syncthing." + name)
+	for _, txt := range txts {
+		txt = strings.TrimSpace(txt)
+		if _, err := url.Parse(txt); err != nil {
+			l.Debugln("dnsClient.Lookup: skipping TXT record", txt, err)
+			continue
+		}
+		addresses = append(addresses, txt)
+	}
+
+	_, srvs, srvErr := net.LookupSRV("syncthing", "tcp", name)
+	for _, srv := range srvs {
+		target := strings.TrimSuffix(srv.Target, ".")
+		addresses = append(addresses, fmt.Sprintf("tcp://%s:%d", target, srv.Port))
+	}
+
+	if len(addresses) == 0 && txtErr != nil && srvErr != nil {
+		l.Debugln("dnsClient.Lookup", name, txtErr, srvErr)
+		// Resolver failures are worth caching just like discovery server
+		// failures; NXDOMAIN for unknown devices ends up here too.
+		return nil, lookupError{
+			error:    txtErr,
+			cacheFor: dnsNegCacheTime,
+		}
+	}
+
+	return addresses, nil
+}
+
+func (c *dnsClient) String() string {
+	return "dns@" + c.zone
+}
+
+func (c *dnsClient) Serve() {
+	// Lookups only; there is nothing to announce or do in the background.
+	<-c.stop
+}
+
+func (c *dnsClient) Stop() {
+	close(c.stop)
+}
+
+func (c *dnsClient) Cache() map[protocol.DeviceID]CacheEntry {
+	// The dnsClient doesn't do caching
+	return nil
+}
+
+// dnsQueryName returns the base name for the device's records in the zone.
+func dnsQueryName(device protocol.DeviceID, zone string) string {
+	return strings.ToLower(device.String()) + "." + zone
+}
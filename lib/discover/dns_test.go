@@ -0,0 +1,46 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package discover
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+func TestNewDNS(t *testing.T) {
+	if _, err := NewDNS("dns://example.com"); err != nil {
+		t.Error("dns://example.com should be accepted:", err)
+	}
+	if _, err := NewDNS("dns://"); err == nil {
+		t.Error("a zone is required")
+	}
+	if _, err := NewDNS("https://example.com"); err == nil {
+		t.Error("only the dns scheme should be accepted")
+	}
+
+	// NewGlobal should hand dns:// servers to the DNS client.
+	cl, err := NewGlobal("dns://example.com", tls.Certificate{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cl.(*dnsClient); !ok {
+		t.Errorf("expected a *dnsClient, got %T", cl)
+	}
+}
+
+func TestDNSQueryName(t *testing.T) {
+	device, err := protocol.DeviceIDFromString("AIR6LPZ-7K4PTTV-UXQSMUU-CPQ5YWH-OEDFIIQ-JUG777G-2YQXXR5-YD6AWQR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := "air6lpz-7k4pttv-uxqsmuu-cpq5ywh-oedfiiq-jug777g-2yqxxr5-yd6awqr.example.com"
+	if name := dnsQueryName(device, "example.com"); name != exp {
+		t.Errorf("got %q, expected %q", name, exp)
+	}
+}
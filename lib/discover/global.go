@@ -16,6 +16,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	stdsync "sync"
 	"time"
 
@@ -68,6 +69,15 @@ func (e lookupError) CacheFor() time.Duration {
 }
 
 func NewGlobal(server string, cert tls.Certificate, addrList AddressLister) (FinderService, error) {
+	if strings.HasPrefix(server, "dns://") {
+		// Lookups from DNS records rather than a discovery server.
+		return NewDNS(server)
+	}
+	if strings.HasPrefix(server, "dht://") {
+		// Decentralized lookups and announces, no server involved.
+		return NewDHT(server, cert, addrList)
+	}
+
 	server, opts, err := parseOptions(server)
 	if err != nil {
 		return nil, err
@@ -83,6 +83,38 @@ func NewLocal(id protocol.DeviceID, addr string, addrList AddressLister) (Finder
 	return c, nil
 }
 
+// NewLocalUnicast returns a local discovery client that sends its
+// announcements to the given list of ip:port targets instead of
+// broadcasting or multicasting them, for use where those are blocked.
+func NewLocalUnicast(id protocol.DeviceID, targets []string, addrList AddressLister) (FinderService, error) {
+	c := &localClient{
+		Supervisor: suture.New("local", suture.Spec{
+			PassThroughPanics: true,
+		}),
+		myID:            id,
+		addrList:        addrList,
+		localBcastTick:  time.NewTicker(BroadcastInterval).C,
+		forcedBcastTick: make(chan time.Time),
+		localBcastStart: time.Now(),
+		cache:           newCache(),
+		name:            "unicast local",
+	}
+
+	for _, target := range targets {
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			return nil, err
+		}
+	}
+
+	c.beacon = beacon.NewUnicast(targets)
+	c.Add(c.beacon)
+	go c.recvAnnouncements(c.beacon)
+
+	go c.sendLocalAnnouncements()
+
+	return c, nil
+}
+
 func (c *localClient) startLocalIPv4Broadcasts(localPort int) {
 	c.beacon = beacon.NewBroadcast(localPort)
 	c.Add(c.beacon)
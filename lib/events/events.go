@@ -47,6 +47,9 @@ const (
 	FolderWatchStateChanged
 	ListenAddressesChanged
 	LoginAttempt
+	RemoteDiskFull
+	FolderDeletionLimitReached
+	FolderScrubbed
 
 	AllEvents = (1 << iota) - 1
 )
@@ -113,6 +116,12 @@ func (t EventType) String() string {
 		return "LoginAttempt"
 	case FolderWatchStateChanged:
 		return "FolderWatchStateChanged"
+	case RemoteDiskFull:
+		return "RemoteDiskFull"
+	case FolderDeletionLimitReached:
+		return "FolderDeletionLimitReached"
+	case FolderScrubbed:
+		return "FolderScrubbed"
 	default:
 		return "Unknown"
 	}
@@ -192,6 +201,12 @@ func UnmarshalEventType(s string) EventType {
 		return LoginAttempt
 	case "FolderWatchStateChanged":
 		return FolderWatchStateChanged
+	case "RemoteDiskFull":
+		return RemoteDiskFull
+	case "FolderDeletionLimitReached":
+		return FolderDeletionLimitReached
+	case "FolderScrubbed":
+		return FolderScrubbed
 	default:
 		return 0
 	}
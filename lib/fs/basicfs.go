@@ -139,6 +139,18 @@ func (f *BasicFilesystem) Lstat(name string) (FileInfo, error) {
 	return fsFileInfo{fi}, err
 }
 
+func (f *BasicFilesystem) Link(oldname, newname string) error {
+	oldname, err := f.rooted(oldname)
+	if err != nil {
+		return err
+	}
+	newname, err = f.rooted(newname)
+	if err != nil {
+		return err
+	}
+	return os.Link(oldname, newname)
+}
+
 func (f *BasicFilesystem) Remove(name string) error {
 	name, err := f.rooted(name)
 	if err != nil {
@@ -0,0 +1,77 @@
+// Copyright (C) 2018 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// +build linux
+
+package fs
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+type fder interface {
+	Fd() uintptr
+}
+
+// ficlonerange is the FICLONERANGE ioctl request, _IOW(0x94, 13, struct
+// file_clone_range). The vendored x/sys doesn't have it yet.
+const ficlonerange = 0x4020940d
+
+// fileCloneRange mirrors struct file_clone_range from linux/fs.h.
+type fileCloneRange struct {
+	srcFd      int64
+	srcOffset  uint64
+	srcLength  uint64
+	destOffset uint64
+}
+
+// CopyRange copies size bytes from src at srcOffset to dst at dstOffset.
+// It first attempts an FICLONERANGE ioctl, which on Btrfs and XFS with
+// reflink shares the underlying extents outright, then copy_file_range,
+// which may do the same server side. When the kernel or filesystem can't
+// do either we fall back to plain reads and writes.
+func (f *BasicFilesystem) CopyRange(src, dst File, srcOffset, dstOffset, size int64) error {
+	srcFd, srcOK := src.(fder)
+	dstFd, dstOK := dst.(fder)
+	if !srcOK || !dstOK {
+		return copyRangeGeneric(src, dst, srcOffset, dstOffset, size)
+	}
+
+	arg := fileCloneRange{
+		srcFd:      int64(srcFd.Fd()),
+		srcOffset:  uint64(srcOffset),
+		srcLength:  uint64(size),
+		destOffset: uint64(dstOffset),
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, dstFd.Fd(), ficlonerange, uintptr(unsafe.Pointer(&arg))); errno == 0 {
+		return nil
+	}
+	// Cloning requires block aligned ranges on the same filesystem; on
+	// any failure (EINVAL, EXDEV, ENOTTY, ...) just try the next method.
+
+	for size > 0 {
+		// The kernel advances the offsets for us on success.
+		n, err := unix.CopyFileRange(int(srcFd.Fd()), &srcOffset, int(dstFd.Fd()), &dstOffset, int(size), 0)
+		if err != nil {
+			switch err {
+			case unix.ENOSYS, unix.EINVAL, unix.EXDEV, unix.EOPNOTSUPP:
+				// Old kernel, different devices, or a filesystem that
+				// doesn't support it; any progress so far is reflected in
+				// the offsets and remaining size.
+				return copyRangeGeneric(src, dst, srcOffset, dstOffset, size)
+			}
+			return err
+		}
+		if n == 0 {
+			// Reading at EOF; nothing more to copy.
+			break
+		}
+		size -= int64(n)
+	}
+	return nil
+}
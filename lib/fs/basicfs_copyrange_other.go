@@ -0,0 +1,16 @@
+// Copyright (C) 2018 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// +build !linux
+
+package fs
+
+// CopyRange copies size bytes from src at srcOffset to dst at dstOffset.
+// There is no clone syscall with range support on this platform, so it's
+// always plain reads and writes.
+func (f *BasicFilesystem) CopyRange(src, dst File, srcOffset, dstOffset, size int64) error {
+	return copyRangeGeneric(src, dst, srcOffset, dstOffset, size)
+}
@@ -0,0 +1,43 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// +build !windows
+
+package fs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Lchown changes the numeric owner and group of the named file, without
+// following symlinks.
+func (f *BasicFilesystem) Lchown(name string, uid, gid int) error {
+	name, err := f.rooted(name)
+	if err != nil {
+		return err
+	}
+	return os.Lchown(name, uid, gid)
+}
+
+// OwnerAndGroup returns the numeric owner and group of the named file,
+// without following symlinks.
+func (f *BasicFilesystem) OwnerAndGroup(name string) (int, int, error) {
+	name, err := f.rooted(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	info, err := os.Lstat(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, errors.New("unsupported stat type")
+	}
+	return int(st.Uid), int(st.Gid), nil
+}
@@ -0,0 +1,80 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// +build linux
+
+package fs
+
+import (
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// GetXattr returns the value of the given extended attribute, without
+// following symlinks.
+func (f *BasicFilesystem) GetXattr(name, attr string) ([]byte, error) {
+	name, err := f.rooted(name)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1024)
+	for {
+		sz, err := unix.Lgetxattr(name, attr, buf)
+		if err == unix.ERANGE {
+			buf = make([]byte, len(buf)*2)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:sz], nil
+	}
+}
+
+// ListXattr returns the names of all extended attributes set on the given
+// file, without following symlinks.
+func (f *BasicFilesystem) ListXattr(name string) ([]string, error) {
+	name, err := f.rooted(name)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1024)
+	var sz int
+	for {
+		sz, err = unix.Llistxattr(name, buf)
+		if err == unix.ERANGE {
+			buf = make([]byte, len(buf)*2)
+			continue
+		}
+		if err == unix.ENOTSUP || err == unix.EOPNOTSUPP {
+			// Filesystem without xattr support; same as no attributes.
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	// The buffer contains null terminated attribute names.
+	var attrs []string
+	for _, attr := range strings.Split(string(buf[:sz]), "\x00") {
+		if attr != "" {
+			attrs = append(attrs, attr)
+		}
+	}
+	return attrs, nil
+}
+
+// SetXattr sets the value of the given extended attribute, without
+// following symlinks.
+func (f *BasicFilesystem) SetXattr(name, attr string, data []byte) error {
+	name, err := f.rooted(name)
+	if err != nil {
+		return err
+	}
+	return unix.Lsetxattr(name, attr, data, 0)
+}
@@ -0,0 +1,93 @@
+// Copyright (C) 2018 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CaseLstater is implemented by filesystems that can resolve a name case
+// insensitively against the actual on-disk spelling.
+type CaseLstater interface {
+	CaseInsensitiveLstat(name string) (FileInfo, string, error)
+}
+
+// CaseInsensitiveLstat is like Lstat, but matches the name case
+// insensitively against what is actually on disk, and additionally returns
+// the real (on-disk) name. If the returned name differs from the given one
+// in casing only, a caller about to create the given name is looking at a
+// case conflict. Windows 8.3 short names never appear in directory listings,
+// so they don't register as conflicts here.
+func (f *BasicFilesystem) CaseInsensitiveLstat(name string) (FileInfo, string, error) {
+	real, err := NewCaseResolver(f).RealCase(name)
+	if err != nil {
+		return nil, "", err
+	}
+	info, err := f.Lstat(real)
+	return info, real, err
+}
+
+// CaseResolver resolves names against the on-disk casing, caching directory
+// listings for its lifetime. Use one per batch of lookups, for instance one
+// puller iteration, and throw it away afterwards.
+type CaseResolver struct {
+	fs    Filesystem
+	cache map[string][]string
+}
+
+func NewCaseResolver(fs Filesystem) *CaseResolver {
+	return &CaseResolver{
+		fs:    fs,
+		cache: make(map[string][]string),
+	}
+}
+
+// RealCase returns the on-disk spelling of the given name, preferring an
+// exact match over a case-insensitive one for each path component. It
+// returns os.ErrNotExist when no variant of the name exists.
+func (r *CaseResolver) RealCase(name string) (string, error) {
+	name = filepath.Clean(name)
+	if name == "." {
+		return name, nil
+	}
+
+	real := "."
+	for _, comp := range strings.Split(filepath.ToSlash(name), "/") {
+		names, ok := r.cache[real]
+		if !ok {
+			var err error
+			names, err = r.fs.DirNames(real)
+			if err != nil {
+				return "", err
+			}
+			r.cache[real] = names
+		}
+
+		match := ""
+		for _, n := range names {
+			if n == comp {
+				match = n
+				break
+			}
+			if match == "" && strings.EqualFold(n, comp) {
+				match = n
+			}
+		}
+		if match == "" {
+			return "", os.ErrNotExist
+		}
+
+		if real == "." {
+			real = match
+		} else {
+			real = filepath.Join(real, match)
+		}
+	}
+	return real, nil
+}
@@ -0,0 +1,88 @@
+// Copyright (C) 2018 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCaseInsensitiveLstat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syncthing-caselstat-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "Foo.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "Sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "Sub", "Bar.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := newBasicFilesystem(dir)
+
+	// Exact-case match resolves to itself; no conflict for the caller.
+	if info, real, err := fs.CaseInsensitiveLstat("Foo.txt"); err != nil {
+		t.Error(err)
+	} else if real != "Foo.txt" || info.Name() != "Foo.txt" {
+		t.Errorf("got %q, expected exact match", real)
+	}
+
+	// A genuine case collision reports the real on-disk name.
+	if _, real, err := fs.CaseInsensitiveLstat("foo.TXT"); err != nil {
+		t.Error(err)
+	} else if real != "Foo.txt" {
+		t.Errorf("got %q, expected %q", real, "Foo.txt")
+	}
+
+	// Collisions are detected in intermediate path components too.
+	if _, real, err := fs.CaseInsensitiveLstat("sub/bar.txt"); err != nil {
+		t.Error(err)
+	} else if real != filepath.Join("Sub", "Bar.txt") {
+		t.Errorf("got %q, expected %q", real, filepath.Join("Sub", "Bar.txt"))
+	}
+
+	// Nothing resembling the name exists.
+	if _, _, err := fs.CaseInsensitiveLstat("nothing.txt"); !IsNotExist(err) {
+		t.Errorf("expected not-exist error, got %v", err)
+	}
+}
+
+func TestCaseResolverCaching(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syncthing-caselstat-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "Foo.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := newBasicFilesystem(dir)
+	resolver := NewCaseResolver(fs)
+
+	if real, err := resolver.RealCase("foo.txt"); err != nil || real != "Foo.txt" {
+		t.Errorf("got %q, %v", real, err)
+	}
+
+	// The resolver works from its cached listing and doesn't see later
+	// changes, which is the intended behavior for one puller iteration.
+	if err := os.Rename(filepath.Join(dir, "Foo.txt"), filepath.Join(dir, "Quux.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if real, err := resolver.RealCase("foo.txt"); err != nil || real != "Foo.txt" {
+		t.Errorf("got %q, %v from cache", real, err)
+	}
+}
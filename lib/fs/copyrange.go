@@ -0,0 +1,33 @@
+// Copyright (C) 2018 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package fs
+
+// copyRangeGeneric copies size bytes from src at srcOffset to dst at
+// dstOffset using plain reads and writes. It's the fallback when the
+// filesystem has no smarter way to do it.
+func copyRangeGeneric(src, dst File, srcOffset, dstOffset, size int64) error {
+	buf := make([]byte, 64<<10)
+	for size > 0 {
+		chunk := int64(len(buf))
+		if chunk > size {
+			chunk = size
+		}
+		n, err := src.ReadAt(buf[:chunk], srcOffset)
+		if n > 0 {
+			if _, werr := dst.WriteAt(buf[:n], dstOffset); werr != nil {
+				return werr
+			}
+			srcOffset += int64(n)
+			dstOffset += int64(n)
+			size -= int64(n)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright (C) 2018 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package fs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyRange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syncthing-copyrange-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := make([]byte, 256<<10)
+	rand.New(rand.NewSource(42)).Read(data)
+	if err := ioutil.WriteFile(filepath.Join(dir, "src"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := newBasicFilesystem(dir)
+	src, err := fs.Open("src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	const (
+		srcOffset = 1234
+		dstOffset = 4321
+		size      = 128 << 10
+	)
+
+	// The platform implementation, which may or may not clone.
+	cloned, err := fs.Create("cloned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.CopyRange(src, cloned, srcOffset, dstOffset, size); err != nil {
+		t.Fatal(err)
+	}
+	cloned.Close()
+
+	// The plain read/write fallback, forced.
+	copied, err := fs.Create("copied")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := copyRangeGeneric(src, copied, srcOffset, dstOffset, size); err != nil {
+		t.Fatal(err)
+	}
+	copied.Close()
+
+	clonedBytes, err := ioutil.ReadFile(filepath.Join(dir, "cloned"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	copiedBytes, err := ioutil.ReadFile(filepath.Join(dir, "copied"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(clonedBytes, copiedBytes) {
+		t.Error("clone and copy fallback produced different output")
+	}
+	if len(copiedBytes) != dstOffset+size {
+		t.Fatalf("unexpected destination size %d", len(copiedBytes))
+	}
+	if !bytes.Equal(copiedBytes[dstOffset:], data[srcOffset:srcOffset+size]) {
+		t.Error("copied range differs from source data")
+	}
+}
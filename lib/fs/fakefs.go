@@ -43,18 +43,33 @@ const randomBlockShift = 14 // 128k
 // - The root path can contain URL query-style parameters that pre populate
 //   the filesystem at creation with a certain amount of random data:
 //
-//     files=n    to generate n random files (default 0)
-//     maxsize=n  to generate files up to a total of n MiB (default 0)
-//     sizeavg=n  to set the average size of random files, in bytes (default 1<<20)
-//     seed=n     to set the initial random seed (default 0)
+//     files=n      to generate n random files (default 0)
+//     maxsize=n    to generate files up to a total of n MiB (default 0)
+//     sizeavg=n    to set the average size of random files, in bytes (default 1<<20)
+//     seed=n       to set the initial random seed (default 0)
+//     content=true to retain written data instead of discarding it
+//     sizelimit=n  to limit the filesystem to n MiB, like a full disk (default 0, no limit)
+//
+// - When a size limit is set, writes that would exceed it fail with a no
+//   space error and Usage reports the remaining space; otherwise Usage is
+//   unimplemented, as for a filesystem of boundless size.
 //
 // - Two fakefs:s pointing at the same root path see the same files.
 //
+// - Errors can be injected on specific operations using InjectFakeFSError,
+//   for tests that need to exercise error paths deterministically.
+//
 type fakefs struct {
-	mut  sync.Mutex
-	root *fakeEntry
+	mut          sync.Mutex
+	root         *fakeEntry
+	injectedErrs map[string]error // operation name -> error
+	withContent  bool             // retain written data instead of discarding it
+	sizeLimit    int64            // total size limit in bytes; zero means no limit
+	usage        int64            // current total size of all files
 }
 
+var errFakeNoSpace = errors.New("no space left on device")
+
 var (
 	fakefsMut sync.Mutex
 	fakefsFs  = make(map[string]*fakefs)
@@ -90,6 +105,9 @@ func newFakeFilesystem(root string) *fakefs {
 	maxsize, _ := strconv.Atoi(params.Get("maxsize"))
 	sizeavg, _ := strconv.Atoi(params.Get("sizeavg"))
 	seed, _ := strconv.Atoi(params.Get("seed"))
+	sizelimit, _ := strconv.Atoi(params.Get("sizelimit"))
+	fs.withContent = params.Get("content") == "true"
+	fs.sizeLimit = int64(sizelimit) << 20
 	if sizeavg == 0 {
 		sizeavg = 1 << 20
 	}
@@ -126,6 +144,24 @@ func newFakeFilesystem(root string) *fakefs {
 	return fs
 }
 
+// InjectFakeFSError makes the named operation ("Create", "Rename", etc.) on
+// the fake filesystem at the given root fail with err. A nil err clears the
+// injection. This is for tests that need to exercise error paths
+// deterministically.
+func InjectFakeFSError(root, op string, err error) {
+	fs := newFakeFilesystem(root)
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+	if fs.injectedErrs == nil {
+		fs.injectedErrs = make(map[string]error)
+	}
+	if err == nil {
+		delete(fs.injectedErrs, op)
+	} else {
+		fs.injectedErrs[op] = err
+	}
+}
+
 // fakeEntry is an entry (file or directory) in the fake filesystem
 type fakeEntry struct {
 	name     string
@@ -134,6 +170,27 @@ type fakeEntry struct {
 	mode     FileMode
 	mtime    time.Time
 	children map[string]*fakeEntry
+	content  []byte // only used when the filesystem retains content
+}
+
+// totalSize returns the size of the entry including any children.
+func (e *fakeEntry) totalSize() int64 {
+	size := e.size
+	for _, child := range e.children {
+		size += child.totalSize()
+	}
+	return size
+}
+
+// requestSpaceLocked adjusts the tracked usage by diff bytes, failing when
+// a size limit is set and growing by diff would exceed it. The caller must
+// hold fs.mut.
+func (fs *fakefs) requestSpaceLocked(diff int64) error {
+	if diff > 0 && fs.sizeLimit > 0 && fs.usage+diff > fs.sizeLimit {
+		return errFakeNoSpace
+	}
+	fs.usage += diff
+	return nil
 }
 
 func (fs *fakefs) entryForName(name string) *fakeEntry {
@@ -146,6 +203,11 @@ func (fs *fakefs) entryForName(name string) *fakeEntry {
 	comps := strings.Split(name, "/")
 	entry := fs.root
 	for _, comp := range comps {
+		if comp == ".." {
+			// Like BasicFilesystem, we don't allow traversal outside the
+			// root.
+			return nil
+		}
 		var ok bool
 		entry, ok = entry.children[comp]
 		if !ok {
@@ -158,6 +220,9 @@ func (fs *fakefs) entryForName(name string) *fakeEntry {
 func (fs *fakefs) Chmod(name string, mode FileMode) error {
 	fs.mut.Lock()
 	defer fs.mut.Unlock()
+	if err := fs.injectedErrs["Chmod"]; err != nil {
+		return err
+	}
 	entry := fs.entryForName(name)
 	if entry == nil {
 		return os.ErrNotExist
@@ -169,6 +234,9 @@ func (fs *fakefs) Chmod(name string, mode FileMode) error {
 func (fs *fakefs) Chtimes(name string, atime time.Time, mtime time.Time) error {
 	fs.mut.Lock()
 	defer fs.mut.Unlock()
+	if err := fs.injectedErrs["Chtimes"]; err != nil {
+		return err
+	}
 	entry := fs.entryForName(name)
 	if entry == nil {
 		return os.ErrNotExist
@@ -181,14 +249,23 @@ func (fs *fakefs) Create(name string) (File, error) {
 	fs.mut.Lock()
 	defer fs.mut.Unlock()
 
+	if err := fs.injectedErrs["Create"]; err != nil {
+		return nil, err
+	}
+	if filepath.Base(name) == ".." {
+		return nil, os.ErrNotExist
+	}
+
 	if entry := fs.entryForName(name); entry != nil {
 		if entry.isdir {
 			return nil, os.ErrExist
 		}
+		fs.usage -= entry.size
 		entry.size = 0
 		entry.mtime = time.Now()
 		entry.mode = 0666
-		return &fakeFile{fakeEntry: entry}, nil
+		entry.content = nil
+		return &fakeFile{fakeEntry: entry, fs: fs}, nil
 	}
 
 	dir := filepath.Dir(name)
@@ -203,7 +280,7 @@ func (fs *fakefs) Create(name string) (File, error) {
 		mtime: time.Now(),
 	}
 	entry.children[base] = new
-	return &fakeFile{fakeEntry: new}, nil
+	return &fakeFile{fakeEntry: new, fs: fs}, nil
 }
 
 func (fs *fakefs) CreateSymlink(target, name string) error {
@@ -214,6 +291,10 @@ func (fs *fakefs) DirNames(name string) ([]string, error) {
 	fs.mut.Lock()
 	defer fs.mut.Unlock()
 
+	if err := fs.injectedErrs["DirNames"]; err != nil {
+		return nil, err
+	}
+
 	entry := fs.entryForName(name)
 	if entry == nil {
 		return nil, os.ErrNotExist
@@ -231,6 +312,10 @@ func (fs *fakefs) Lstat(name string) (FileInfo, error) {
 	fs.mut.Lock()
 	defer fs.mut.Unlock()
 
+	if err := fs.injectedErrs["Lstat"]; err != nil {
+		return nil, err
+	}
+
 	entry := fs.entryForName(name)
 	if entry == nil {
 		return nil, os.ErrNotExist
@@ -242,8 +327,15 @@ func (fs *fakefs) Mkdir(name string, perm FileMode) error {
 	fs.mut.Lock()
 	defer fs.mut.Unlock()
 
+	if err := fs.injectedErrs["Mkdir"]; err != nil {
+		return err
+	}
+
 	dir := filepath.Dir(name)
 	base := filepath.Base(name)
+	if base == ".." {
+		return os.ErrNotExist
+	}
 	entry := fs.entryForName(dir)
 	if entry == nil {
 		return os.ErrNotExist
@@ -263,11 +355,21 @@ func (fs *fakefs) Mkdir(name string, perm FileMode) error {
 }
 
 func (fs *fakefs) MkdirAll(name string, perm FileMode) error {
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+
+	if err := fs.injectedErrs["MkdirAll"]; err != nil {
+		return err
+	}
+
 	name = filepath.ToSlash(name)
 	name = strings.Trim(name, "/")
 	comps := strings.Split(name, "/")
 	entry := fs.root
 	for _, comp := range comps {
+		if comp == ".." {
+			return os.ErrNotExist
+		}
 		next, ok := entry.children[comp]
 
 		if !ok {
@@ -293,23 +395,38 @@ func (fs *fakefs) Open(name string) (File, error) {
 	fs.mut.Lock()
 	defer fs.mut.Unlock()
 
+	if err := fs.injectedErrs["Open"]; err != nil {
+		return nil, err
+	}
+
 	entry := fs.entryForName(name)
 	if entry == nil {
 		return nil, os.ErrNotExist
 	}
-	return &fakeFile{fakeEntry: entry}, nil
+	return &fakeFile{fakeEntry: entry, fs: fs}, nil
 }
 
 func (fs *fakefs) OpenFile(name string, flags int, mode FileMode) (File, error) {
 	fs.mut.Lock()
 	defer fs.mut.Unlock()
 
+	if err := fs.injectedErrs["OpenFile"]; err != nil {
+		return nil, err
+	}
+
 	if flags&os.O_CREATE == 0 {
-		return fs.Open(name)
+		entry := fs.entryForName(name)
+		if entry == nil {
+			return nil, os.ErrNotExist
+		}
+		return &fakeFile{fakeEntry: entry, fs: fs}, nil
 	}
 
 	dir := filepath.Dir(name)
 	base := filepath.Base(name)
+	if base == ".." {
+		return nil, os.ErrNotExist
+	}
 	entry := fs.entryForName(dir)
 	if entry == nil {
 		return nil, os.ErrNotExist
@@ -328,7 +445,7 @@ func (fs *fakefs) OpenFile(name string, flags int, mode FileMode) (File, error)
 	}
 
 	entry.children[base] = newEntry
-	return &fakeFile{fakeEntry: newEntry}, nil
+	return &fakeFile{fakeEntry: newEntry, fs: fs}, nil
 }
 
 func (fs *fakefs) ReadSymlink(name string) (string, error) {
@@ -339,6 +456,10 @@ func (fs *fakefs) Remove(name string) error {
 	fs.mut.Lock()
 	defer fs.mut.Unlock()
 
+	if err := fs.injectedErrs["Remove"]; err != nil {
+		return err
+	}
+
 	entry := fs.entryForName(name)
 	if entry == nil {
 		return os.ErrNotExist
@@ -347,6 +468,7 @@ func (fs *fakefs) Remove(name string) error {
 		return errors.New("not empty")
 	}
 
+	fs.usage -= entry.size
 	entry = fs.entryForName(filepath.Dir(name))
 	delete(entry.children, filepath.Base(name))
 	return nil
@@ -356,6 +478,10 @@ func (fs *fakefs) RemoveAll(name string) error {
 	fs.mut.Lock()
 	defer fs.mut.Unlock()
 
+	if err := fs.injectedErrs["RemoveAll"]; err != nil {
+		return err
+	}
+
 	entry := fs.entryForName(filepath.Dir(name))
 	if entry == nil {
 		return os.ErrNotExist
@@ -363,14 +489,69 @@ func (fs *fakefs) RemoveAll(name string) error {
 
 	// RemoveAll is easy when the file system uses garbage collection under
 	// the hood... We even get the correct semantics for open fd:s for free.
+	if child, ok := entry.children[filepath.Base(name)]; ok {
+		fs.usage -= child.totalSize()
+	}
 	delete(entry.children, filepath.Base(name))
 	return nil
 }
 
+func (fs *fakefs) CopyRange(src, dst File, srcOffset, dstOffset, size int64) error {
+	fs.mut.Lock()
+	err := fs.injectedErrs["CopyRange"]
+	fs.mut.Unlock()
+	if err != nil {
+		return err
+	}
+	return copyRangeGeneric(src, dst, srcOffset, dstOffset, size)
+}
+
+func (fs *fakefs) Link(oldname, newname string) error {
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+
+	if err := fs.injectedErrs["Link"]; err != nil {
+		return err
+	}
+
+	p0 := fs.entryForName(filepath.Dir(oldname))
+	if p0 == nil {
+		return os.ErrNotExist
+	}
+
+	entry := p0.children[filepath.Base(oldname)]
+	if entry == nil {
+		return os.ErrNotExist
+	}
+	if entry.isdir {
+		return os.ErrInvalid
+	}
+
+	p1 := fs.entryForName(filepath.Dir(newname))
+	if p1 == nil {
+		return os.ErrNotExist
+	}
+	if p1.children[filepath.Base(newname)] != nil {
+		return os.ErrExist
+	}
+
+	// Both names refer to the same entry, hardlink style.
+	p1.children[filepath.Base(newname)] = entry
+	return nil
+}
+
 func (fs *fakefs) Rename(oldname, newname string) error {
 	fs.mut.Lock()
 	defer fs.mut.Unlock()
 
+	if err := fs.injectedErrs["Rename"]; err != nil {
+		return err
+	}
+
+	if filepath.Base(newname) == ".." {
+		return os.ErrNotExist
+	}
+
 	p0 := fs.entryForName(filepath.Dir(oldname))
 	if p0 == nil {
 		return os.ErrNotExist
@@ -390,6 +571,9 @@ func (fs *fakefs) Rename(oldname, newname string) error {
 	if ok && dst.isdir {
 		return errors.New("is a directory")
 	}
+	if ok {
+		fs.usage -= dst.size
+	}
 
 	p1.children[filepath.Base(newname)] = entry
 	delete(p0.children, filepath.Base(oldname))
@@ -430,7 +614,15 @@ func (fs *fakefs) Roots() ([]string, error) {
 }
 
 func (fs *fakefs) Usage(name string) (Usage, error) {
-	return Usage{}, errors.New("not implemented")
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+	if fs.sizeLimit <= 0 {
+		return Usage{}, errors.New("not implemented")
+	}
+	return Usage{
+		Free:  fs.sizeLimit - fs.usage,
+		Total: fs.sizeLimit,
+	}, nil
 }
 
 func (fs *fakefs) Type() FilesystemType {
@@ -449,6 +641,7 @@ func (fs *fakefs) SameFile(fi1, fi2 FileInfo) bool {
 // opened for reading or writing, it's all good.
 type fakeFile struct {
 	*fakeEntry
+	fs       *fakefs
 	mut      sync.Mutex
 	rng      io.Reader
 	seed     int64
@@ -521,6 +714,13 @@ func (f *fakeFile) readShortAt(p []byte, offs int64) (int, error) {
 		return 0, io.EOF
 	}
 
+	if f.fs != nil && f.fs.withContent {
+		// Serve the read from the actual file contents.
+		n := copy(p, f.content[offs:])
+		f.offset = offs + int64(n)
+		return n, nil
+	}
+
 	// Lazily calculate our main seed, a simple 64 bit FNV hash our file
 	// name.
 	if f.seed == 0 {
@@ -607,6 +807,23 @@ func (f *fakeFile) WriteAt(p []byte, off int64) (int, error) {
 		return 0, errors.New("is a directory")
 	}
 
+	if f.fs != nil {
+		if diff := off + int64(len(p)) - f.size; diff > 0 {
+			f.fs.mut.Lock()
+			err := f.fs.requestSpaceLocked(diff)
+			f.fs.mut.Unlock()
+			if err != nil {
+				return 0, err
+			}
+		}
+		if f.fs.withContent {
+			if grow := off + int64(len(p)) - int64(len(f.content)); grow > 0 {
+				f.content = append(f.content, make([]byte, grow)...)
+			}
+			copy(f.content[off:], p)
+		}
+	}
+
 	f.rng = nil
 	f.offset = off + int64(len(p))
 	if f.offset > f.size {
@@ -623,6 +840,22 @@ func (f *fakeFile) Truncate(size int64) error {
 	f.mut.Lock()
 	defer f.mut.Unlock()
 
+	if f.fs != nil {
+		f.fs.mut.Lock()
+		err := f.fs.requestSpaceLocked(size - f.size)
+		f.fs.mut.Unlock()
+		if err != nil {
+			return err
+		}
+		if f.fs.withContent {
+			if grow := size - int64(len(f.content)); grow > 0 {
+				f.content = append(f.content, make([]byte, grow)...)
+			} else {
+				f.content = f.content[:size]
+			}
+		}
+	}
+
 	f.rng = nil
 	f.size = size
 	if f.offset > size {
@@ -8,6 +8,7 @@ package fs
 
 import (
 	"bytes"
+	"errors"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -152,3 +153,136 @@ func TestFakeFSRead(t *testing.T) {
 		t.Error("data mismatch")
 	}
 }
+
+func TestFakeFSTraversal(t *testing.T) {
+	// Paths that would escape the root must be rejected, like
+	// BasicFilesystem does.
+
+	fs := newFakeFilesystem("/traversal")
+	if err := fs.MkdirAll("dira/dirb", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fs.Lstat("dira/../../escaped"); err == nil {
+		t.Error("expected error on traversing Lstat")
+	}
+	if _, err := fs.Create("../escaped"); err == nil {
+		t.Error("expected error on traversing Create")
+	}
+	if err := fs.Mkdir("dira/..", 0755); err == nil {
+		t.Error("expected error on traversing Mkdir")
+	}
+	if err := fs.MkdirAll("../dirc", 0755); err == nil {
+		t.Error("expected error on traversing MkdirAll")
+	}
+	if err := fs.Rename("dira/dirb", ".."); err == nil {
+		t.Error("expected error on traversing Rename")
+	}
+}
+
+func TestFakeFSErrorInjection(t *testing.T) {
+	fs := newFakeFilesystem("/injection")
+
+	if _, err := fs.Create("untouched"); err != nil {
+		t.Fatal(err)
+	}
+
+	injected := errors.New("injected error")
+	InjectFakeFSError("/injection", "Create", injected)
+	if _, err := fs.Create("file"); err != injected {
+		t.Errorf("expected injected error, got %v", err)
+	}
+	// Other operations are unaffected.
+	if _, err := fs.Lstat("untouched"); err != nil {
+		t.Errorf("Lstat failed: %v", err)
+	}
+
+	// Clearing the injection restores normal operation.
+	InjectFakeFSError("/injection", "Create", nil)
+	if _, err := fs.Create("file"); err != nil {
+		t.Errorf("Create failed after clearing injection: %v", err)
+	}
+}
+
+func TestFakeFSContent(t *testing.T) {
+	fs := newFakeFilesystem("/content?content=true")
+
+	fd, err := fs.Create("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fd.Write([]byte("hello, world\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reads return what was actually written, not generated data.
+	buf := make([]byte, 13)
+	if _, err := fd.ReadAt(buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello, world\n" {
+		t.Errorf("unexpected content %q", buf)
+	}
+
+	// Another fd on the same file sees the same content.
+	fd2, err := fs.Open("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fd2.ReadAt(buf[:6], 7); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:6]) != "world\n" {
+		t.Errorf("unexpected content %q", buf[:6])
+	}
+}
+
+func TestFakeFSSizeLimit(t *testing.T) {
+	// One MiB of space in total.
+	fs := newFakeFilesystem("/sizelimit?sizelimit=1")
+
+	usage, err := fs.Usage(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Total != 1<<20 || usage.Free != 1<<20 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+
+	fd, err := fs.Create("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fd.Truncate(1 << 19); err != nil {
+		t.Fatal(err)
+	}
+
+	// Half the space is now used.
+	usage, err = fs.Usage(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Free != 1<<19 {
+		t.Errorf("unexpected free space %d", usage.Free)
+	}
+
+	// Growing past the limit fails, leaving the file as it was.
+	if err := fd.Truncate(2 << 20); err == nil {
+		t.Error("expected error growing past the size limit")
+	}
+	if _, err := fd.WriteAt([]byte("overflow"), 1<<20); err == nil {
+		t.Error("expected error writing past the size limit")
+	}
+
+	// Removing the file frees the space again.
+	if err := fs.Remove("file"); err != nil {
+		t.Fatal(err)
+	}
+	usage, err = fs.Usage(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Free != 1<<20 {
+		t.Errorf("unexpected free space %d", usage.Free)
+	}
+}
@@ -20,9 +20,11 @@ import (
 type Filesystem interface {
 	Chmod(name string, mode FileMode) error
 	Chtimes(name string, atime time.Time, mtime time.Time) error
+	CopyRange(src, dst File, srcOffset, dstOffset, size int64) error
 	Create(name string) (File, error)
 	CreateSymlink(target, name string) error
 	DirNames(name string) ([]string, error)
+	Link(oldname, newname string) error
 	Lstat(name string) (FileInfo, error)
 	Mkdir(name string, perm FileMode) error
 	MkdirAll(name string, perm FileMode) error
@@ -76,6 +78,22 @@ type FileInfo interface {
 	IsSymlink() bool
 }
 
+// The inodeIDer interface is implemented by FileInfos that can report a
+// stable, unique identifier for the underlying file (the inode number on
+// Unix). A zero ID means the identifier is not available.
+type inodeIDer interface {
+	InodeID() uint64
+}
+
+// InodeID returns a stable identifier for the file underlying info, or zero
+// when the filesystem doesn't provide one.
+func InodeID(info FileInfo) uint64 {
+	if i, ok := info.(inodeIDer); ok {
+		return i.InodeID()
+	}
+	return 0
+}
+
 // FileMode is similar to os.FileMode
 type FileMode uint32
 
@@ -8,6 +8,15 @@
 
 package fs
 
+import "syscall"
+
 func (e fsFileInfo) Mode() FileMode {
 	return FileMode(e.FileInfo.Mode())
 }
+
+func (e fsFileInfo) InodeID() uint64 {
+	if st, ok := e.FileInfo.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
@@ -48,3 +48,8 @@ func (e fsFileInfo) Mode() FileMode {
 	m &^= 0022
 	return FileMode(m)
 }
+
+func (e fsFileInfo) InodeID() uint64 {
+	// Windows file IDs require opening the file, which Lstat doesn't do.
+	return 0
+}
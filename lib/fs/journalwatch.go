@@ -0,0 +1,21 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package fs
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrJournalUnsupported is returned by WatchJournal on platforms or
+// filesystems without a usable change journal.
+var ErrJournalUnsupported = errors.New("filesystem change journal not supported")
+
+// journalFlushInterval is how often accumulated journal records are
+// deduplicated and flushed as events. The watch aggregator adds its own
+// delay on top, so this is kept short.
+const journalFlushInterval = time.Second
@@ -0,0 +1,166 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+//go:build linux
+// +build linux
+
+package fs
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Constants from <linux/fanotify.h>; the vendored sys package predates
+// fanotify support.
+const (
+	fanClassNotif       = 0x00000000
+	fanCloexec          = 0x00000001
+	fanNonblock         = 0x00000002
+	fanMarkAdd          = 0x00000001
+	fanMarkMount        = 0x00000010
+	fanModify           = 0x00000002
+	fanCloseWrite       = 0x00000008
+	fanEventMetadataLen = 24
+)
+
+// WatchJournal watches for changes under root using a fanotify mark on the
+// containing mount, reading the kernel's change stream instead of placing a
+// watch on every directory. This keeps up with folders of millions of files
+// where inotify runs out of watches, but requires CAP_SYS_ADMIN and only
+// reports modifications -- deletions and renames are left for the regular
+// rescan to pick up. Records are coalesced and flushed periodically.
+func WatchJournal(root string, ignore Matcher, ctx context.Context, interval time.Duration) (<-chan Event, error) {
+	if interval <= 0 {
+		interval = journalFlushInterval
+	}
+
+	evalRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, _, errno := unix.Syscall(unix.SYS_FANOTIFY_INIT, fanClassNotif|fanCloexec|fanNonblock, unix.O_RDONLY|unix.O_LARGEFILE, 0)
+	if errno != 0 {
+		if errno == unix.EPERM || errno == unix.ENOSYS {
+			return nil, ErrJournalUnsupported
+		}
+		return nil, errno
+	}
+
+	pathp, err := unix.BytePtrFromString(evalRoot)
+	if err != nil {
+		unix.Close(int(fd))
+		return nil, err
+	}
+	// The dirfd argument is ignored for absolute paths, which evalRoot is.
+	_, _, errno = unix.Syscall6(unix.SYS_FANOTIFY_MARK, fd, fanMarkAdd|fanMarkMount, fanModify|fanCloseWrite, 0, uintptr(unsafe.Pointer(pathp)), 0)
+	if errno != 0 {
+		unix.Close(int(fd))
+		if errno == unix.EPERM || errno == unix.ENOSYS || errno == unix.EINVAL {
+			return nil, ErrJournalUnsupported
+		}
+		return nil, errno
+	}
+
+	outChan := make(chan Event)
+	go journalLoop(int(fd), evalRoot, ignore, ctx, interval, outChan)
+
+	return outChan, nil
+}
+
+func journalLoop(fd int, evalRoot string, ignore Matcher, ctx context.Context, interval time.Duration, outChan chan<- Event) {
+	defer unix.Close(fd)
+
+	buf := make([]byte, 4096)
+	pending := make(map[string]struct{})
+	next := time.Now().Add(interval)
+	pollFds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+
+	for {
+		select {
+		case <-ctx.Done():
+			l.Debugln("WatchJournal:", evalRoot, "stopped")
+			return
+		default:
+		}
+
+		timeout := int(time.Until(next) / time.Millisecond)
+		if timeout < 0 {
+			timeout = 0
+		} else if timeout > 1000 {
+			// Cap the poll so we notice context cancellation.
+			timeout = 1000
+		}
+
+		n, err := unix.Poll(pollFds, timeout)
+		if err != nil && err != unix.EINTR {
+			l.Debugln("WatchJournal:", evalRoot, "poll failed:", err)
+			return
+		}
+
+		if n > 0 {
+			n, err := unix.Read(fd, buf)
+			if err != nil && err != unix.EAGAIN && err != unix.EINTR {
+				l.Debugln("WatchJournal:", evalRoot, "read failed:", err)
+				return
+			}
+			for offset := 0; offset+fanEventMetadataLen <= n; {
+				eventLen := int(binary.LittleEndian.Uint32(buf[offset:]))
+				if eventLen < fanEventMetadataLen || offset+eventLen > n {
+					break
+				}
+				evFd := int32(binary.LittleEndian.Uint32(buf[offset+16:]))
+				offset += eventLen
+				if evFd < 0 {
+					continue
+				}
+				path, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", evFd))
+				unix.Close(int(evFd))
+				if err != nil {
+					continue
+				}
+				// The mark covers the whole mount; only care about our
+				// subtree.
+				if path != evalRoot && !strings.HasPrefix(path, evalRoot+string(PathSeparator)) {
+					continue
+				}
+				rel := strings.TrimPrefix(strings.TrimPrefix(path, evalRoot), string(PathSeparator))
+				if rel == "" {
+					rel = "."
+				}
+				if ignore.ShouldIgnore(rel) {
+					continue
+				}
+				pending[rel] = struct{}{}
+			}
+		}
+
+		if time.Now().Before(next) {
+			continue
+		}
+		next = time.Now().Add(interval)
+
+		for rel := range pending {
+			select {
+			case outChan <- Event{Name: rel, Type: NonRemove}:
+				l.Debugln("WatchJournal:", evalRoot, "sending", rel)
+			case <-ctx.Done():
+				l.Debugln("WatchJournal:", evalRoot, "stopped")
+				return
+			}
+			delete(pending, rel)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+//go:build linux
+// +build linux
+
+package fs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWatchJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal-watch-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	eventChan, err := WatchJournal(dir, pollTestMatcher{}, ctx, 50*time.Millisecond)
+	if err == ErrJournalUnsupported {
+		t.Skip("fanotify not available (requires CAP_SYS_ADMIN)")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(dir+"/file1", []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case ev := <-eventChan:
+			if ev.Name == "file1" && ev.Type == NonRemove {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for journal event")
+		}
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+//go:build !linux
+// +build !linux
+
+package fs
+
+import (
+	"context"
+	"time"
+)
+
+// WatchJournal is only implemented on Linux (fanotify). On Windows the
+// native ReadDirectoryChangesW watcher already follows network shares, and
+// elsewhere there is no widely available change journal; callers fall back
+// to the regular or polling watcher.
+func WatchJournal(root string, ignore Matcher, ctx context.Context, interval time.Duration) (<-chan Event, error) {
+	return nil, ErrJournalUnsupported
+}
@@ -104,6 +104,18 @@ func (fs *logFilesystem) RemoveAll(name string) error {
 	return err
 }
 
+func (fs *logFilesystem) CopyRange(src, dst File, srcOffset, dstOffset, size int64) error {
+	err := fs.Filesystem.CopyRange(src, dst, srcOffset, dstOffset, size)
+	l.Debugln(getCaller(), fs.Type(), fs.URI(), "CopyRange", srcOffset, dstOffset, size, err)
+	return err
+}
+
+func (fs *logFilesystem) Link(oldname, newname string) error {
+	err := fs.Filesystem.Link(oldname, newname)
+	l.Debugln(getCaller(), fs.Type(), fs.URI(), "Link", oldname, newname, err)
+	return err
+}
+
 func (fs *logFilesystem) Rename(oldname, newname string) error {
 	err := fs.Filesystem.Rename(oldname, newname)
 	l.Debugln(getCaller(), fs.Type(), fs.URI(), "Rename", oldname, newname, err)
@@ -135,6 +135,10 @@ func (m mtimeFileInfo) ModTime() time.Time {
 	return m.mtime
 }
 
+func (m mtimeFileInfo) InodeID() uint64 {
+	return InodeID(m.FileInfo)
+}
+
 // The dbMtime is our database representation
 
 type dbMtime struct {
@@ -0,0 +1,33 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package fs
+
+import "path/filepath"
+
+// OwnershipFilesystem is implemented by filesystems where files carry
+// POSIX style numeric owner and group. Symlinks are not followed.
+type OwnershipFilesystem interface {
+	Lchown(name string, uid, gid int) error
+	OwnerAndGroup(name string) (uid, gid int, err error)
+}
+
+// CopyOwnershipFromParent sets the owner and group of the given name to
+// that of its parent directory, for filesystems that have the concept.
+// It's a no-op elsewhere. Chowning generally requires running as root, so
+// expect a permission error otherwise.
+func CopyOwnershipFromParent(filesystem Filesystem, name string) error {
+	ofs, ok := unwrapFilesystem(filesystem).(OwnershipFilesystem)
+	if !ok {
+		return nil
+	}
+
+	uid, gid, err := ofs.OwnerAndGroup(filepath.Dir(name))
+	if err != nil {
+		return err
+	}
+	return ofs.Lchown(name, uid, gid)
+}
@@ -0,0 +1,142 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package fs
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultPollInterval is the time between tree walks for the polling
+// watcher, when no explicit interval is configured.
+const DefaultPollInterval = 60 * time.Second
+
+// Maximum number of individual events sent per poll round. When more paths
+// than this change between two polls the events are coalesced into a single
+// event for the whole watched tree, triggering one full rescan instead of
+// many small ones.
+// Not meant to be changed, but must be changeable for tests
+var maxPollEvents = 100
+
+type pollEntry struct {
+	size    int64
+	modTime int64
+	isDir   bool
+}
+
+// WatchPoll watches for changes under name by periodically walking the tree
+// and comparing sizes and modification times, for filesystems where the
+// native watcher doesn't work (NFS, CIFS, many FUSE mounts). The initial
+// walk establishes the baseline; an error during it is returned directly.
+// Later walk errors are treated as transient and retried on the next poll.
+func WatchPoll(fs Filesystem, name string, ignore Matcher, ctx context.Context, interval time.Duration) (<-chan Event, error) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	prev, err := pollSnapshot(fs, name, ignore)
+	if err != nil {
+		return nil, err
+	}
+
+	outChan := make(chan Event)
+	go pollLoop(fs, name, ignore, ctx, interval, prev, outChan)
+
+	return outChan, nil
+}
+
+func pollLoop(fs Filesystem, name string, ignore Matcher, ctx context.Context, interval time.Duration, prev map[string]pollEntry, outChan chan<- Event) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			l.Debugln(fs.Type(), fs.URI(), "WatchPoll: Stopped")
+			return
+		}
+
+		cur, err := pollSnapshot(fs, name, ignore)
+		if err != nil {
+			// The tree may be temporarily unavailable (remote mount
+			// hiccup); keep the old baseline and try again later.
+			l.Debugln(fs.Type(), fs.URI(), "WatchPoll: Walk failed:", err)
+			timer.Reset(interval)
+			continue
+		}
+
+		evs := pollDiff(prev, cur)
+		prev = cur
+
+		if len(evs) > maxPollEvents {
+			l.Debugln(fs.Type(), fs.URI(), "WatchPoll: Coalescing", len(evs), "events")
+			evs = []Event{{Name: name, Type: Mixed}}
+		}
+
+		for _, ev := range evs {
+			select {
+			case outChan <- ev:
+				l.Debugln(fs.Type(), fs.URI(), "WatchPoll: Sending", ev.Name, ev.Type)
+			case <-ctx.Done():
+				l.Debugln(fs.Type(), fs.URI(), "WatchPoll: Stopped")
+				return
+			}
+		}
+
+		timer.Reset(interval)
+	}
+}
+
+// pollSnapshot walks the tree under name and records size, modification
+// time and type for every non-ignored entry.
+func pollSnapshot(fs Filesystem, name string, ignore Matcher) (map[string]pollEntry, error) {
+	snap := make(map[string]pollEntry)
+	err := fs.Walk(name, func(path string, info FileInfo, err error) error {
+		if err != nil {
+			if path == name {
+				return err
+			}
+			// Entries may legitimately disappear while we walk.
+			return nil
+		}
+		if path == name {
+			return nil
+		}
+		if ignore.ShouldIgnore(path) {
+			if info.IsDir() && ignore.SkipIgnoredDirs() {
+				return SkipDir
+			}
+			return nil
+		}
+		snap[path] = pollEntry{
+			size:    info.Size(),
+			modTime: info.ModTime().UnixNano(),
+			isDir:   info.IsDir(),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+func pollDiff(prev, cur map[string]pollEntry) []Event {
+	var evs []Event
+	for path, entry := range cur {
+		if old, ok := prev[path]; !ok || old != entry {
+			evs = append(evs, Event{Name: path, Type: NonRemove})
+		}
+	}
+	for path := range prev {
+		if _, ok := cur[path]; !ok {
+			evs = append(evs, Event{Name: path, Type: Remove})
+		}
+	}
+	return evs
+}
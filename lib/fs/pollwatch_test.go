@@ -0,0 +1,124 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package fs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+type pollTestMatcher struct {
+	ignore string
+}
+
+func (m pollTestMatcher) ShouldIgnore(name string) bool {
+	return m.ignore != "" && name == m.ignore
+}
+
+func (m pollTestMatcher) SkipIgnoredDirs() bool {
+	return true
+}
+
+func TestWatchPoll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "poll-watch-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testFs := NewFilesystem(FilesystemTypeBasic, dir)
+
+	if fd, err := testFs.Create("file1"); err != nil {
+		t.Fatal(err)
+	} else {
+		fd.Close()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	eventChan, err := WatchPoll(testFs, ".", pollTestMatcher{ignore: "ignored"}, ctx, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(name string, evType EventType) {
+		t.Helper()
+		timeout := time.After(10 * time.Second)
+		for {
+			select {
+			case ev := <-eventChan:
+				if ev.Name == "ignored" {
+					t.Errorf("got event for ignored file: %v", ev)
+					continue
+				}
+				if ev.Name == name && ev.Type == evType {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for %v event for %q", evType, name)
+			}
+		}
+	}
+
+	if fd, err := testFs.Create("file2"); err != nil {
+		t.Fatal(err)
+	} else {
+		fd.Write([]byte("contents"))
+		fd.Close()
+	}
+	if fd, err := testFs.Create("ignored"); err != nil {
+		t.Fatal(err)
+	} else {
+		fd.Close()
+	}
+	expect("file2", NonRemove)
+
+	if err := testFs.Remove("file1"); err != nil {
+		t.Fatal(err)
+	}
+	expect("file1", Remove)
+}
+
+func TestWatchPollMissingRoot(t *testing.T) {
+	testFs := NewFilesystem(FilesystemTypeBasic, "/nonexistent-poll-watch")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := WatchPoll(testFs, ".", pollTestMatcher{}, ctx, time.Minute); err == nil {
+		t.Error("expected an error watching a nonexistent root")
+	}
+}
+
+func TestPollDiff(t *testing.T) {
+	prev := map[string]pollEntry{
+		"same":    {size: 1, modTime: 1},
+		"changed": {size: 1, modTime: 1},
+		"removed": {size: 1, modTime: 1},
+	}
+	cur := map[string]pollEntry{
+		"same":    {size: 1, modTime: 1},
+		"changed": {size: 2, modTime: 2},
+		"added":   {size: 1, modTime: 1},
+	}
+
+	evs := pollDiff(prev, cur)
+	if len(evs) != 3 {
+		t.Fatalf("got %d events, expected 3: %v", len(evs), evs)
+	}
+	types := make(map[string]EventType, len(evs))
+	for _, ev := range evs {
+		types[ev.Name] = ev.Type
+	}
+	if types["changed"] != NonRemove || types["added"] != NonRemove || types["removed"] != Remove {
+		t.Errorf("unexpected events: %v", evs)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package fs
+
+// XattrFilesystem is implemented by filesystems that support extended
+// attributes. Symlinks are not followed.
+type XattrFilesystem interface {
+	GetXattr(name, attr string) ([]byte, error)
+	ListXattr(name string) ([]string, error)
+	SetXattr(name, attr string, data []byte) error
+}
+
+// unwrapFilesystem removes the logging, mtime and walk wrappers so that
+// optional interfaces implemented by the underlying filesystem become
+// visible again.
+func unwrapFilesystem(filesystem Filesystem) Filesystem {
+	for {
+		switch sub := filesystem.(type) {
+		case *MtimeFS:
+			filesystem = sub.Filesystem
+		case *walkFilesystem:
+			filesystem = sub.Filesystem
+		case *logFilesystem:
+			filesystem = sub.Filesystem
+		default:
+			return filesystem
+		}
+	}
+}
+
+// CopyXattrs copies all extended attributes from src to dst. It is a no-op
+// when the filesystem doesn't support extended attributes, and attributes
+// we aren't allowed to read or write (trusted.* and similar) are skipped
+// rather than failing the whole copy.
+func CopyXattrs(filesystem Filesystem, src, dst string) error {
+	xfs, ok := unwrapFilesystem(filesystem).(XattrFilesystem)
+	if !ok {
+		return nil
+	}
+
+	attrs, err := xfs.ListXattr(src)
+	if err != nil {
+		return err
+	}
+	for _, attr := range attrs {
+		data, err := xfs.GetXattr(src, attr)
+		if err != nil {
+			continue
+		}
+		if err := xfs.SetXattr(dst, attr, data); err != nil {
+			continue
+		}
+	}
+	return nil
+}
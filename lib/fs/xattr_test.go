@@ -0,0 +1,55 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// +build linux
+
+package fs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCopyXattrs(t *testing.T) {
+	td, err := ioutil.TempDir("", "xattr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+
+	fs := NewFilesystem(FilesystemTypeBasic, td)
+	for _, name := range []string{"src", "dst"} {
+		fd, err := fs.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fd.Close()
+	}
+
+	xfs, ok := unwrapFilesystem(fs).(XattrFilesystem)
+	if !ok {
+		t.Fatal("basic filesystem should implement XattrFilesystem on linux")
+	}
+
+	if err := xfs.SetXattr("src", "user.syncthing-test", []byte("attrvalue")); err != nil {
+		// tmpfs and some other filesystems don't do user xattrs.
+		t.Skip("xattrs not supported here:", err)
+	}
+
+	if err := CopyXattrs(fs, "src", "dst"); err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := xfs.GetXattr("dst", "user.syncthing-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, []byte("attrvalue")) {
+		t.Errorf("got %q, expected %q", val, "attrvalue")
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"crypto/md5"
 	"fmt"
 	"io"
+	"os/exec"
+	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -81,11 +83,14 @@ type Matcher struct {
 	lines           []string  // exact lines read from .stignore
 	patterns        []Pattern // patterns including those from included files
 	withCache       bool
+	nested          bool
+	hasExecIncludes bool
 	matches         *cache
 	curHash         string
 	stop            chan struct{}
 	changeDetector  ChangeDetector
 	skipIgnoredDirs bool
+	nestedPatterns  map[string][]Pattern // directory -> patterns from its ignore file, scoped to that directory
 	mut             sync.Mutex
 }
 
@@ -107,6 +112,16 @@ func WithChangeDetector(cd ChangeDetector) Option {
 	}
 }
 
+// WithNested makes the matcher also honour ignore files found in
+// subdirectories, git style. The patterns in such a file apply only
+// below the directory it is in. The default is to only read the top
+// level ignore file.
+func WithNested(v bool) Option {
+	return func(m *Matcher) {
+		m.nested = v
+	}
+}
+
 func New(fs fs.Filesystem, opts ...Option) *Matcher {
 	m := &Matcher{
 		fs:              fs,
@@ -130,7 +145,21 @@ func (m *Matcher) Load(file string) error {
 	m.mut.Lock()
 	defer m.mut.Unlock()
 
-	if m.changeDetector.Seen(m.fs, file) && !m.changeDetector.Changed() {
+	if m.nested {
+		// Nested ignore files are discovered lazily at match time.
+		// Forget what we found last time around, so that each load picks
+		// up files that appeared or changed since, and drop cached match
+		// results that may depend on them.
+		m.nestedPatterns = make(map[string][]Pattern)
+		if m.withCache {
+			m.matches = newCache(m.patterns)
+		}
+	}
+
+	// When an exec include provides patterns there is no file for the
+	// change detector to watch, so we re-run the parse (and thus the
+	// command) on every load.
+	if !m.hasExecIncludes && m.changeDetector.Seen(m.fs, file) && !m.changeDetector.Changed() {
 		return nil
 	}
 
@@ -159,11 +188,12 @@ func (m *Matcher) Parse(r io.Reader, file string) error {
 }
 
 func (m *Matcher) parseLocked(r io.Reader, file string) error {
-	lines, patterns, err := parseIgnoreFile(m.fs, r, file, m.changeDetector, make(map[string]struct{}))
+	lines, patterns, err := parseIgnoreFile(m.fs, r, file, m.changeDetector, make(map[string]struct{}), true)
 	// Error is saved and returned at the end. We process the patterns
 	// (possibly blank) anyway.
 
 	m.lines = lines
+	m.hasExecIncludes = hasExecInclude(lines)
 
 	newHash := hashPatterns(patterns)
 	if newHash == m.curHash {
@@ -171,7 +201,9 @@ func (m *Matcher) parseLocked(r io.Reader, file string) error {
 		return err
 	}
 
-	m.skipIgnoredDirs = true
+	// With nested ignore files we can't know up front whether some file
+	// deep down un-ignores part of an otherwise ignored directory.
+	m.skipIgnoredDirs = !m.nested
 	for _, p := range patterns {
 		if !p.result.IsIgnored() {
 			m.skipIgnoredDirs = false
@@ -196,7 +228,7 @@ func (m *Matcher) Match(file string) (result Result) {
 	m.mut.Lock()
 	defer m.mut.Unlock()
 
-	if len(m.patterns) == 0 {
+	if len(m.patterns) == 0 && !m.nested {
 		return resultNotMatched
 	}
 
@@ -213,26 +245,146 @@ func (m *Matcher) Match(file string) (result Result) {
 		}()
 	}
 
-	// Check all the patterns for a match.
 	file = filepath.ToSlash(file)
+
+	// Ignore files deeper in the tree take precedence over those closer
+	// to the root, like in git.
+	if m.nested {
+		if res, ok := m.matchNestedLocked(file); ok {
+			return res
+		}
+	}
+
+	// Check all the patterns for a match.
+	if res, ok := matchPatterns(m.patterns, file); ok {
+		return res
+	}
+
+	// Default to not matching.
+	return resultNotMatched
+}
+
+// matchNestedLocked matches the file against the ignore files in the
+// directories above it, deepest first. Each ignore file sees the path
+// relative to its own directory.
+func (m *Matcher) matchNestedLocked(file string) (Result, bool) {
+	for dir := path.Dir(file); dir != "."; dir = path.Dir(dir) {
+		patterns, ok := m.nestedPatterns[dir]
+		if !ok {
+			patterns = m.loadNestedLocked(dir)
+		}
+		if res, ok := matchPatterns(patterns, file[len(dir)+1:]); ok {
+			return res, true
+		}
+	}
+	return resultNotMatched, false
+}
+
+// loadNestedLocked reads and parses the ignore file in the given
+// directory, if there is one, and caches the result until the next
+// Load(). Unparseable files are treated the same as absent ones.
+// Include directives are not honored: nested ignore files sync between
+// devices like any other file, so they must not be able to pull in
+// arbitrary files or run commands.
+func (m *Matcher) loadNestedLocked(dir string) []Pattern {
+	var patterns []Pattern
+	file := dir + "/.stignore"
+	if fd, _, err := loadIgnoreFile(m.fs, file, m.changeDetector); err == nil {
+		_, patterns, err = parseIgnoreFile(m.fs, fd, file, m.changeDetector, make(map[string]struct{}), false)
+		fd.Close()
+		if err != nil {
+			patterns = nil
+		}
+	}
+	m.nestedPatterns[dir] = patterns
+	return patterns
+}
+
+// matchPatterns checks the file against each pattern in order and
+// returns the result of the first match, if any.
+func matchPatterns(patterns []Pattern, file string) (Result, bool) {
+	if pat, ok := firstMatchingPattern(patterns, file); ok {
+		return pat.result, true
+	}
+	return resultNotMatched, false
+}
+
+// firstMatchingPattern returns the first pattern matching the file, if any.
+func firstMatchingPattern(patterns []Pattern, file string) (Pattern, bool) {
 	var lowercaseFile string
-	for _, pattern := range m.patterns {
+	for _, pattern := range patterns {
 		if pattern.result.IsCaseFolded() {
 			if lowercaseFile == "" {
 				lowercaseFile = strings.ToLower(file)
 			}
 			if pattern.match.Match(lowercaseFile) {
-				return pattern.result
+				return pattern, true
 			}
 		} else {
 			if pattern.match.Match(file) {
-				return pattern.result
+				return pattern, true
 			}
 		}
 	}
+	return Pattern{}, false
+}
 
-	// Default to not matching.
-	return resultNotMatched
+// A MatchExplanation describes why a file is or is not ignored.
+type MatchExplanation struct {
+	IsIgnored bool   `json:"isIgnored"`
+	Pattern   string `json:"pattern,omitempty"` // the pattern that decided the result, as parsed
+	Line      int    `json:"line,omitempty"`    // 1-based line in the top level ignore file; zero when the pattern came from elsewhere
+}
+
+// Explain returns which pattern, if any, decides whether the given file is
+// ignored. The result is unaffected by and does not touch the match cache.
+func (m *Matcher) Explain(file string) MatchExplanation {
+	if file == "." {
+		return MatchExplanation{}
+	}
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	file = filepath.ToSlash(file)
+
+	if m.nested {
+		for dir := path.Dir(file); dir != "."; dir = path.Dir(dir) {
+			patterns, ok := m.nestedPatterns[dir]
+			if !ok {
+				patterns = m.loadNestedLocked(dir)
+			}
+			if pat, ok := firstMatchingPattern(patterns, file[len(dir)+1:]); ok {
+				return MatchExplanation{
+					IsIgnored: pat.result.IsIgnored(),
+					Pattern:   pat.String(),
+				}
+			}
+		}
+	}
+
+	if pat, ok := firstMatchingPattern(m.patterns, file); ok {
+		return MatchExplanation{
+			IsIgnored: pat.result.IsIgnored(),
+			Pattern:   pat.String(),
+			Line:      m.lineOfLocked(pat.String()),
+		}
+	}
+
+	return MatchExplanation{}
+}
+
+// lineOfLocked returns the 1-based line number in the loaded ignore file
+// matching the given parsed pattern, or zero when there is none. Patterns
+// from included files and variants expanded during parsing have no
+// corresponding line.
+func (m *Matcher) lineOfLocked(pattern string) int {
+	for i, line := range m.lines {
+		if strings.TrimSpace(line) == pattern {
+			return i + 1
+		}
+	}
+	return 0
 }
 
 // Lines return a list of the unprocessed lines in .stignore at last load
@@ -354,11 +506,45 @@ func loadParseIncludeFile(filesystem fs.Filesystem, file string, cd ChangeDetect
 
 	cd.Remember(filesystem, file, info.ModTime())
 
-	_, patterns, err := parseIgnoreFile(filesystem, fd, file, cd, linesSeen)
+	_, patterns, err := parseIgnoreFile(filesystem, fd, file, cd, linesSeen, true)
 	return patterns, err
 }
 
-func parseIgnoreFile(fs fs.Filesystem, fd io.Reader, currentFile string, cd ChangeDetector, linesSeen map[string]struct{}) ([]string, []Pattern, error) {
+// execIncludePatterns runs the given command and parses its standard
+// output as ignore patterns, for "#include exec:command" lines. The
+// command runs via the shell, with the folder root as working directory
+// where there is one. There is no file for the change detector to watch,
+// so the command is re-run every time the ignore file is reloaded; the
+// resulting patterns are cached as usual.
+func execIncludePatterns(filesystem fs.Filesystem, command, currentFile string, cd ChangeDetector, linesSeen map[string]struct{}) ([]Pattern, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("/bin/sh", "-c", command)
+	}
+	if filesystem.Type() == fs.FilesystemTypeBasic {
+		cmd.Dir = filesystem.URI()
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	_, patterns, err := parseIgnoreFile(filesystem, bytes.NewReader(out), currentFile, cd, linesSeen, true)
+	return patterns, err
+}
+
+// hasExecInclude returns whether any of the lines is an exec include.
+func hasExecInclude(lines []string) bool {
+	for _, line := range lines {
+		if strings.HasPrefix(line, "#include") && strings.HasPrefix(strings.TrimSpace(line[len("#include"):]), "exec:") {
+			return true
+		}
+	}
+	return false
+}
+
+func parseIgnoreFile(fs fs.Filesystem, fd io.Reader, currentFile string, cd ChangeDetector, linesSeen map[string]struct{}, allowIncludes bool) ([]string, []Pattern, error) {
 	var lines []string
 	var patterns []Pattern
 
@@ -461,17 +647,34 @@ func parseIgnoreFile(fs fs.Filesystem, fd io.Reader, currentFile string, cd Chan
 		line = filepath.ToSlash(line)
 		switch {
 		case strings.HasPrefix(line, "#include"):
+			if !allowIncludes {
+				// Nested ignore files are synced from other devices, so
+				// honoring include directives in them would let a remote
+				// device read arbitrary files or run arbitrary commands
+				// via exec includes. The directive is skipped; the other
+				// patterns in the file still apply.
+				continue
+			}
 			includeRel := strings.TrimSpace(line[len("#include "):])
-			includeFile := filepath.Join(filepath.Dir(currentFile), includeRel)
 			var includePatterns []Pattern
-			if includePatterns, err = loadParseIncludeFile(fs, includeFile, cd, linesSeen); err == nil {
-				patterns = append(patterns, includePatterns...)
+			if cmd := strings.TrimPrefix(includeRel, "exec:"); cmd != includeRel {
+				// The include names a command that prints patterns on its
+				// standard output, not a file.
+				if includePatterns, err = execIncludePatterns(fs, cmd, currentFile, cd, linesSeen); err != nil {
+					err = fmt.Errorf("failed to run include command %q: %s", cmd, err.Error())
+				}
 			} else {
-				// Wrap the error, as if the include does not exist, we get a
-				// IsNotExists(err) == true error, which we use to check
-				// existance of the .stignore file, and just end up assuming
-				// there is none, rather than a broken include.
-				err = fmt.Errorf("failed to load include file %s: %s", includeFile, err.Error())
+				includeFile := filepath.Join(filepath.Dir(currentFile), includeRel)
+				if includePatterns, err = loadParseIncludeFile(fs, includeFile, cd, linesSeen); err != nil {
+					// Wrap the error, as if the include does not exist, we get a
+					// IsNotExists(err) == true error, which we use to check
+					// existance of the .stignore file, and just end up assuming
+					// there is none, rather than a broken include.
+					err = fmt.Errorf("failed to load include file %s: %s", includeFile, err.Error())
+				}
+			}
+			if err == nil {
+				patterns = append(patterns, includePatterns...)
 			}
 		case strings.HasSuffix(line, "/**"):
 			err = addPattern(line)
@@ -1053,3 +1053,179 @@ func TestIssue5009(t *testing.T) {
 		t.Error("skipIgnoredDirs should not be true with includes")
 	}
 }
+
+func TestExecInclude(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test expects a Unix shell")
+	}
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	stignore := "#include exec:echo '*.tmp'\n/manual\n"
+
+	if err := ioutil.WriteFile(filepath.Join(dir, ".stignore"), []byte(stignore), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	pats := New(fs.NewFilesystem(fs.FilesystemTypeBasic, dir), WithCache(true))
+	if err := pats.Load(".stignore"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !pats.Match("foo.tmp").IsIgnored() {
+		t.Error("expected pattern from the command to be in effect")
+	}
+	if !pats.Match("manual").IsIgnored() {
+		t.Error("expected pattern from the file to be in effect")
+	}
+	if pats.Match("other").IsIgnored() {
+		t.Error("unexpected match")
+	}
+
+	// A failing command is an error, like a broken file include.
+	stignore = "#include exec:false\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, ".stignore"), []byte(stignore), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := pats.Load(".stignore"); err == nil {
+		t.Error("expected an error from a failing include command")
+	}
+}
+
+func TestNested(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "proj", "build"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ".stignore"), []byte("/top\n"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	stignore := "!keep.o\n*.o\n/build\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "proj", ".stignore"), []byte(stignore), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	pats := New(fs.NewFilesystem(fs.FilesystemTypeBasic, dir), WithCache(true), WithNested(true))
+	if err := pats.Load(".stignore"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		file    string
+		ignored bool
+	}{
+		{"top", true},            // from the top level file
+		{"proj/main.o", true},    // from the nested file
+		{"proj/keep.o", false},   // negated in the nested file
+		{"proj/build/out", true}, // rooted pattern, relative to the nested file
+		{"proj/main.c", false},   // not matched by anything
+		{"main.o", false},        // nested patterns don't apply outside their directory
+		{"build/out", false},     // ditto for rooted ones
+		{"other/main.o", false},  // or in sibling directories
+	}
+
+	for _, tc := range cases {
+		if pats.Match(tc.file).IsIgnored() != tc.ignored {
+			t.Errorf("Match(%q).IsIgnored() != %v", tc.file, tc.ignored)
+		}
+	}
+
+	if pats.SkipIgnoredDirs() {
+		t.Error("ignored dirs must not be skipped when nested ignores are enabled")
+	}
+
+	// A nested file that appears later is picked up on the next load.
+	if err := ioutil.WriteFile(filepath.Join(dir, "proj", "build", ".stignore"), []byte("!wanted\n"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := pats.Load(".stignore"); err != nil {
+		t.Fatal(err)
+	}
+	if pats.Match("proj/build/wanted").IsIgnored() {
+		t.Error("expected the deeper negation to win")
+	}
+}
+
+func TestNestedNoIncludes(t *testing.T) {
+	// Nested ignore files sync from other devices, so include directives
+	// in them must not be honored: a file include would read arbitrary
+	// files and an exec include would run arbitrary commands.
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "proj"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ".stignore"), []byte("/top\n"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "proj", "extra"), []byte("*.bak\n"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	canary := filepath.Join(dir, "canary")
+	stignore := "#include exec:touch " + canary + "\n#include extra\n*.o\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "proj", ".stignore"), []byte(stignore), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	pats := New(fs.NewFilesystem(fs.FilesystemTypeBasic, dir), WithNested(true))
+	if err := pats.Load(".stignore"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !pats.Match("proj/main.o").IsIgnored() {
+		t.Error("plain patterns in nested files should still apply")
+	}
+	if pats.Match("proj/main.bak").IsIgnored() {
+		t.Error("file includes in nested files must not be honored")
+	}
+	if _, err := os.Lstat(canary); !os.IsNotExist(err) {
+		t.Error("exec includes in nested files must not run")
+	}
+}
+
+func TestExplain(t *testing.T) {
+	stignore := `
+	!keepme
+	*.tmp
+	foo
+	`
+	pats := New(fs.NewFilesystem(fs.FilesystemTypeBasic, "."))
+	if err := pats.Parse(bytes.NewBufferString(stignore), ".stignore"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		file    string
+		ignored bool
+		pattern string
+		line    int
+	}{
+		{"keepme", false, "!keepme", 2},
+		{"file.tmp", true, "*.tmp", 3},
+		{"foo", true, "foo", 4},
+		{"unmatched", false, "", 0},
+	}
+
+	for _, tc := range cases {
+		exp := pats.Explain(tc.file)
+		if exp.IsIgnored != tc.ignored || exp.Pattern != tc.pattern || exp.Line != tc.line {
+			t.Errorf("Explain(%q) == %+v, expected %v %q line %d", tc.file, exp, tc.ignored, tc.pattern, tc.line)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/osutil"
+)
+
+// conflictRe matches the conflict marker inserted by moveForConflict,
+// e.g. ".sync-conflict-20060102-150405-MODIFID". Older versions did not
+// include the modifying device, so that part is optional.
+var conflictRe = regexp.MustCompile(`\.sync-conflict-\d{8}-\d{6}(-[A-Z0-9]{7})?`)
+
+// A Conflict describes a conflict copy found in a folder, with the path
+// of the file it is a copy of.
+type Conflict struct {
+	Path     string    `json:"path"`     // path of the conflict copy, relative to the folder root
+	Original string    `json:"original"` // path of the file the conflict copy belongs to
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"modTime"`
+}
+
+// Conflicts walks the folder on disk and returns the conflict copies in
+// it, so that they can be inspected and resolved without shell access to
+// the device.
+func (m *Model) Conflicts(folder string) ([]Conflict, error) {
+	ffs, err := m.conflictFolderFilesystem(folder)
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []Conflict
+	err = ffs.Walk(".", func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !info.IsRegular() || !conflictRe.MatchString(path) {
+			return nil
+		}
+		conflicts = append(conflicts, Conflict{
+			Path:     path,
+			Original: conflictRe.ReplaceAllString(path, ""),
+			Size:     info.Size(),
+			ModTime:  info.ModTime(),
+		})
+		return nil
+	})
+	return conflicts, err
+}
+
+// DeleteConflict removes the given conflict copy from disk, keeping the
+// original as it is, and rescans it so the deletion propagates.
+func (m *Model) DeleteConflict(folder, path string) error {
+	ffs, err := m.conflictFolderFilesystem(folder)
+	if err != nil {
+		return err
+	}
+	if !conflictRe.MatchString(path) {
+		return fmt.Errorf("%s is not a conflict copy", path)
+	}
+	if err := ffs.Remove(path); err != nil {
+		return err
+	}
+	return m.ScanFolderSubdirs(folder, []string{path})
+}
+
+// PromoteConflict moves the given conflict copy over the file it is a
+// copy of, making the conflict copy the synced version, and rescans both
+// so the change propagates.
+func (m *Model) PromoteConflict(folder, path string) error {
+	ffs, err := m.conflictFolderFilesystem(folder)
+	if err != nil {
+		return err
+	}
+	if !conflictRe.MatchString(path) {
+		return fmt.Errorf("%s is not a conflict copy", path)
+	}
+	original := conflictRe.ReplaceAllString(path, "")
+	if err := osutil.TryRename(ffs, path, original); err != nil {
+		return err
+	}
+	return m.ScanFolderSubdirs(folder, []string{path, original})
+}
+
+func (m *Model) conflictFolderFilesystem(folder string) (fs.Filesystem, error) {
+	m.fmut.RLock()
+	folderCfg, ok := m.folderCfgs[folder]
+	m.fmut.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("folder %s does not exist", folder)
+	}
+	return folderCfg.Filesystem(), nil
+}
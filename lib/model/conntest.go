@@ -0,0 +1,121 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+// The connection test exchanges synthetic request/response traffic with the
+// peer. Requests use a reserved name in a blank folder, which the remote
+// side serves from memory without touching any folder data.
+const (
+	connTestName     = ".stconntest"
+	connTestPings    = 3                // number of round trips behind the latency estimate
+	connTestSize     = 1 << 20          // size of the throughput sample
+	connTestInterval = 30 * time.Second // minimum time between tests against the same device
+)
+
+var (
+	errConnTestRateLimit  = errors.New("connection test rate limited")
+	errDeviceNotConnected = errors.New("device is not connected")
+)
+
+// ConnTest is the result of a connection test against a remote device.
+type ConnTest struct {
+	Latency        time.Duration `json:"latency"`
+	ThroughputMbps float64       `json:"throughputMbps"`
+	ConnectionType string        `json:"connectionType"`
+}
+
+// connTestBudget tracks synthetic data served to a device within the
+// current rate limit window.
+type connTestBudget struct {
+	windowStart time.Time
+	bytes       int
+}
+
+// TestConnection measures round trip latency and a short throughput sample
+// against the given device, without touching any real files. Tests against
+// the same device are limited to one per connTestInterval, as are the
+// responses we serve, so neither side can be abused as a traffic generator.
+func (m *Model) TestConnection(device protocol.DeviceID) (ConnTest, error) {
+	m.pmut.RLock()
+	nc, ok := m.conn[device]
+	m.pmut.RUnlock()
+	if !ok {
+		return ConnTest{}, errDeviceNotConnected
+	}
+
+	m.connTestMut.Lock()
+	if last, ok := m.lastConnTest[device]; ok && time.Since(last) < connTestInterval {
+		m.connTestMut.Unlock()
+		return ConnTest{}, errConnTestRateLimit
+	}
+	m.lastConnTest[device] = time.Now()
+	m.connTestMut.Unlock()
+
+	// Use the quickest of a few tiny round trips as the latency estimate,
+	// mimicking what ping does to filter out scheduling noise.
+	var latency time.Duration
+	for i := 0; i < connTestPings; i++ {
+		t0 := time.Now()
+		if _, _, err := nc.Request("", connTestName, 0, 0, 1, nil, 0, false, nil); err != nil {
+			return ConnTest{}, err
+		}
+		if rtt := time.Since(t0); latency == 0 || rtt < latency {
+			latency = rtt
+		}
+	}
+
+	t0 := time.Now()
+	buf, _, err := nc.Request("", connTestName, 0, 0, connTestSize, nil, 0, false, nil)
+	if err != nil {
+		return ConnTest{}, err
+	}
+	elapsed := time.Since(t0)
+
+	res := ConnTest{
+		Latency:        latency,
+		ConnectionType: nc.Type(),
+	}
+	if secs := elapsed.Seconds(); secs > 0 {
+		res.ThroughputMbps = float64(len(buf)) * 8 / secs / 1e6
+	}
+	return res, nil
+}
+
+// connTestResponse serves an incoming connection test request from memory.
+// The amount of data served per device and rate limit window is bounded so
+// that a peer cannot use us to generate unbounded traffic.
+func (m *Model) connTestResponse(deviceID protocol.DeviceID, size int) (protocol.RequestResponse, error) {
+	if size > connTestSize {
+		return nil, protocol.ErrInvalid
+	}
+
+	// Allow one full test per window: the latency pings plus the
+	// throughput sample.
+	const budget = connTestSize + connTestPings
+
+	m.connTestMut.Lock()
+	served := m.connTestServed[deviceID]
+	if now := time.Now(); now.Sub(served.windowStart) > connTestInterval {
+		served = connTestBudget{windowStart: now}
+	}
+	served.bytes += size
+	m.connTestServed[deviceID] = served
+	m.connTestMut.Unlock()
+
+	if served.bytes > budget {
+		return nil, protocol.ErrGeneric
+	}
+
+	return newRequestResponse(size), nil
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/db"
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+func TestTestConnection(t *testing.T) {
+	ldb := db.OpenMemory()
+	m := NewModel(defaultCfgWrapper, protocol.LocalDeviceID, "syncthing", "dev", ldb, nil)
+	m.ServeBackground()
+	defer m.Stop()
+
+	fc := &fakeConnection{id: device1}
+	fc.requestFn = func(folder, name string, offset int64, size int, hash []byte, fromTemporary bool) ([]byte, error) {
+		// Synthetic timing so that latency and throughput come out
+		// non-zero and finite.
+		time.Sleep(time.Millisecond)
+		return make([]byte, size), nil
+	}
+	m.AddConnection(fc, protocol.HelloResult{})
+
+	res, err := m.TestConnection(device1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Latency <= 0 {
+		t.Errorf("unexpected latency %v", res.Latency)
+	}
+	if res.ThroughputMbps <= 0 {
+		t.Errorf("unexpected throughput %v Mbps", res.ThroughputMbps)
+	}
+	if res.ConnectionType != "fake" {
+		t.Errorf("unexpected connection type %q", res.ConnectionType)
+	}
+
+	// An immediate second test against the same device is rate limited.
+	if _, err := m.TestConnection(device1); err != errConnTestRateLimit {
+		t.Errorf("expected rate limit error, got %v", err)
+	}
+
+	// Testing a device we have no connection to is an error.
+	if _, err := m.TestConnection(device2); err != errDeviceNotConnected {
+		t.Errorf("expected not connected error, got %v", err)
+	}
+}
+
+func TestConnTestResponse(t *testing.T) {
+	ldb := db.OpenMemory()
+	m := NewModel(defaultCfgWrapper, protocol.LocalDeviceID, "syncthing", "dev", ldb, nil)
+	m.ServeBackground()
+	defer m.Stop()
+
+	// The reserved name is served from memory without any folder. A full
+	// test worth of requests fits in the per-device budget.
+	for i := 0; i < connTestPings; i++ {
+		res, err := m.Request(device1, "", connTestName, 0, 1, 0, nil, 0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Close()
+	}
+	res, err := m.Request(device1, "", connTestName, 0, connTestSize, 0, nil, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Data()) != connTestSize {
+		t.Errorf("unexpected response size %d", len(res.Data()))
+	}
+	res.Close()
+
+	// Exceeding the per-device budget within the window is refused.
+	if _, err := m.Request(device1, "", connTestName, 0, connTestSize, 0, nil, 0, false); err != protocol.ErrGeneric {
+		t.Errorf("expected budget error, got %v", err)
+	}
+}
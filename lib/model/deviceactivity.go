@@ -11,6 +11,11 @@ import (
 	"github.com/syncthing/syncthing/lib/sync"
 )
 
+// meteredPenalty is added to the perceived usage of devices reached
+// over metered connections, so that they are only selected when no
+// unmetered device can serve the block.
+const meteredPenalty = 1 << 20
+
 // deviceActivity tracks the number of outstanding requests per device and can
 // answer which device is least busy. It is safe for use from multiple
 // goroutines.
@@ -32,7 +37,11 @@ func (m *deviceActivity) leastBusy(availability []Availability) (Availability, b
 	found := false
 	var selected Availability
 	for _, info := range availability {
-		if usage := m.act[info.ID]; usage < low {
+		usage := m.act[info.ID]
+		if info.Metered {
+			usage += meteredPenalty
+		}
+		if usage < low {
 			low = usage
 			selected = info
 			found = true
@@ -13,9 +13,9 @@ import (
 )
 
 func TestDeviceActivity(t *testing.T) {
-	n0 := Availability{protocol.DeviceID([32]byte{1, 2, 3, 4}), false}
-	n1 := Availability{protocol.DeviceID([32]byte{5, 6, 7, 8}), true}
-	n2 := Availability{protocol.DeviceID([32]byte{9, 10, 11, 12}), false}
+	n0 := Availability{ID: protocol.DeviceID([32]byte{1, 2, 3, 4})}
+	n1 := Availability{ID: protocol.DeviceID([32]byte{5, 6, 7, 8}), FromTemporary: true}
+	n2 := Availability{ID: protocol.DeviceID([32]byte{9, 10, 11, 12})}
 	devices := []Availability{n0, n1, n2}
 	na := newDeviceActivity()
 
@@ -58,3 +58,21 @@ func TestDeviceActivity(t *testing.T) {
 		t.Errorf("Least busy device should be n0 (%v) not %v", n0, lb)
 	}
 }
+
+func TestDeviceActivityMetered(t *testing.T) {
+	n0 := Availability{ID: protocol.DeviceID([32]byte{1, 2, 3, 4}), Metered: true}
+	n1 := Availability{ID: protocol.DeviceID([32]byte{5, 6, 7, 8})}
+	devices := []Availability{n0, n1}
+	na := newDeviceActivity()
+
+	// The unmetered device is preferred even when it is busier.
+	na.using(n1)
+	if lb, ok := na.leastBusy(devices); !ok || lb != n1 {
+		t.Errorf("Least busy device should be n1 (%v) not %v", n1, lb)
+	}
+
+	// With only metered devices on offer we use them anyway.
+	if lb, ok := na.leastBusy([]Availability{n0}); !ok || lb != n0 {
+		t.Errorf("Least busy device should be n0 (%v) not %v", n0, lb)
+	}
+}
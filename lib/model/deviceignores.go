@@ -0,0 +1,62 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/ignore"
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+// deviceIgnoreFile returns the name of the device scoped ignore file for
+// the given device, ".stignore-<short device ID>" in the folder root.
+// Files matching the patterns in it are advertised to that device as
+// invalid, so the device knows about them but will not pull them, and
+// requests from that device for them are refused. The file is a regular
+// file in the folder and replicates like any other, so the patterns can
+// be edited from any device.
+func deviceIgnoreFile(device protocol.DeviceID) string {
+	return ".stignore-" + device.Short().String()
+}
+
+// deviceIgnores returns the ignore matcher scoped to the given device for
+// a folder. The matcher is cached; loading is cheap when the underlying
+// file has not changed, and a matcher for a folder without a device
+// ignore file never matches anything.
+func (m *Model) deviceIgnores(folder string, device protocol.DeviceID) *ignore.Matcher {
+	m.fmut.Lock()
+	matcher := m.deviceIgnoresLocked(folder, device)
+	m.fmut.Unlock()
+
+	if err := matcher.Load(deviceIgnoreFile(device)); err != nil && !fs.IsNotExist(err) {
+		l.Debugf("Loading device ignores for %s / %s: %v", folder, device, err)
+	}
+	return matcher
+}
+
+// deviceIgnoresLocked returns the cached matcher, creating it if
+// necessary. The caller must hold fmut and is responsible for loading
+// the matcher.
+func (m *Model) deviceIgnoresLocked(folder string, device protocol.DeviceID) *ignore.Matcher {
+	cfg, ok := m.folderCfgs[folder]
+	matchers, haveFolder := m.folderDeviceIgnores[folder]
+	if !haveFolder {
+		matchers = make(map[protocol.DeviceID]*ignore.Matcher)
+		m.folderDeviceIgnores[folder] = matchers
+	}
+	matcher, haveMatcher := matchers[device]
+	if !haveMatcher {
+		if !ok {
+			// The folder is not started; return an empty matcher without
+			// caching it.
+			return ignore.New(nil)
+		}
+		matcher = ignore.New(cfg.Filesystem())
+		matchers[device] = matcher
+	}
+	return matcher
+}
@@ -0,0 +1,54 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/syncthing/syncthing/lib/db"
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+func TestDeviceIgnores(t *testing.T) {
+	ignoreFile := "testdata/" + deviceIgnoreFile(device1)
+	if err := ioutil.WriteFile(ignoreFile, []byte("raw\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(ignoreFile)
+
+	db := db.OpenMemory()
+	m := NewModel(defaultCfgWrapper, protocol.LocalDeviceID, "syncthing", "dev", db, nil)
+	m.AddFolder(defaultFolderConfig)
+	m.StartFolder("default")
+	m.ServeBackground()
+	defer m.Stop()
+
+	if !m.deviceIgnores("default", device1).Match("raw/img_0001.cr2").IsIgnored() {
+		t.Error("expected the file to be ignored for device1")
+	}
+	if m.deviceIgnores("default", device2).Match("raw/img_0001.cr2").IsIgnored() {
+		t.Error("expected no device ignores for device2")
+	}
+	if m.deviceIgnores("default", device1).Match("foo").IsIgnored() {
+		t.Error("unexpected match for device1")
+	}
+
+	// A device ignored entry in an incoming index is marked invalid so we
+	// never consider pulling it from that device.
+	m.Index(device1, "default", []protocol.FileInfo{
+		{Name: "raw/img_0001.cr2", Version: protocol.Vector{Counters: []protocol.Counter{{ID: 42, Value: 1}}}, Blocks: []protocol.BlockInfo{{Size: 1}}},
+	})
+	f, ok := m.CurrentGlobalFile("default", "raw/img_0001.cr2")
+	if !ok {
+		t.Fatal("expected the file to be in the index")
+	}
+	if !f.IsInvalid() {
+		t.Error("expected the device ignored entry to be invalid")
+	}
+}
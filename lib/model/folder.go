@@ -42,6 +42,7 @@ type folder struct {
 
 	scanInterval        time.Duration
 	scanTimer           *time.Timer
+	scrubTimer          *time.Timer
 	scanNow             chan rescanRequest
 	scanDelay           chan time.Duration
 	initialScanFinished chan struct{}
@@ -83,6 +84,7 @@ func newFolder(model *Model, cfg config.FolderConfiguration) folder {
 
 		scanInterval:        time.Duration(cfg.RescanIntervalS) * time.Second,
 		scanTimer:           time.NewTimer(time.Millisecond), // The first scan should be done immediately.
+		scrubTimer:          time.NewTimer(time.Minute),      // Check whether a scrub is due shortly after startup.
 		scanNow:             make(chan rescanRequest),
 		scanDelay:           make(chan time.Duration),
 		initialScanFinished: make(chan struct{}),
@@ -106,6 +108,7 @@ func (f *folder) Serve() {
 
 	defer func() {
 		f.scanTimer.Stop()
+		f.scrubTimer.Stop()
 		f.setState(FolderIdle)
 		close(f.stopped)
 	}()
@@ -168,6 +171,9 @@ func (f *folder) Serve() {
 			l.Debugln(f, "Scanning subdirectories")
 			f.scanTimerFired()
 
+		case <-f.scrubTimer.C:
+			f.scrubTimerFired()
+
 		case req := <-f.scanNow:
 			req.err <- f.scanSubdirs(req.subdirs)
 
@@ -188,6 +194,8 @@ func (f *folder) BringToFront(string) {}
 
 func (f *folder) Override(fs *db.FileSet, updateFn func([]protocol.FileInfo)) {}
 
+func (f *folder) OverrideFile(fs *db.FileSet, file string, updateFn func([]protocol.FileInfo)) {}
+
 func (f *folder) Revert(fs *db.FileSet, updateFn func([]protocol.FileInfo)) {}
 
 func (f *folder) DelayScan(next time.Duration) {
@@ -241,6 +249,29 @@ func (f *folder) Reschedule() {
 	f.scanTimer.Reset(interval)
 }
 
+// adaptScanInterval adjusts the rescan interval between RescanIntervalS and
+// RescanIntervalMaxS, when the latter is configured: the interval doubles
+// after every full scan that finds no changes, so idle folders back off, and
+// snaps back to the configured interval as soon as a scan finds activity.
+// Called from the folder routine only.
+func (f *folder) adaptScanInterval(changes int, fullScan bool) {
+	min := time.Duration(f.RescanIntervalS) * time.Second
+	max := time.Duration(f.RescanIntervalMaxS) * time.Second
+	if min == 0 || max <= min {
+		return
+	}
+
+	if changes > 0 {
+		f.scanInterval = min
+	} else if fullScan {
+		f.scanInterval *= 2
+		if f.scanInterval > max {
+			f.scanInterval = max
+		}
+	}
+	l.Debugln(f, "adapted rescan interval to", f.scanInterval)
+}
+
 func (f *folder) Delay(next time.Duration) {
 	f.scanDelay <- next
 }
@@ -278,6 +309,12 @@ func (f *folder) scanSubdirs(subDirs []string) error {
 		return err
 	}
 
+	// Limit the number of folders scanning at the same time, if so
+	// configured. This queues us up behind any other folders currently
+	// scanning.
+	release := f.model.acquireScanSlot()
+	defer release()
+
 	f.model.fmut.RLock()
 	fset := f.model.folderFiles[f.ID]
 	ignores := f.model.folderIgnores[f.ID]
@@ -338,6 +375,7 @@ func (f *folder) scanSubdirs(subDirs []string) error {
 		ProgressTickIntervalS: f.ScanProgressIntervalS,
 		UseLargeBlocks:        f.UseLargeBlocks,
 		LocalFlags:            f.localFlags,
+		InodeIndex:            newInodeIndex(f.model.db, f.folderID),
 	})
 
 	batchFn := func(fs []protocol.FileInfo) error {
@@ -375,11 +413,13 @@ func (f *folder) scanSubdirs(subDirs []string) error {
 
 	// Schedule a pull after scanning, but only if we actually detected any
 	// changes.
+	fullScan := len(subDirs) == 0
 	changes := 0
 	defer func() {
 		if changes > 0 {
 			f.SchedulePull()
 		}
+		f.adaptScanInterval(changes, fullScan)
 	}()
 
 	f.clearScanErrors(subDirs)
@@ -542,6 +582,49 @@ func (f *folder) scanTimerFired() {
 	f.Reschedule()
 }
 
+// scrubTimerFired runs a scheduled verification of the folder contents
+// against the recorded block hashes, if one is due. Called from the folder
+// routine only, so scrubbing reads the folder sequentially on a single
+// goroutine and doesn't compete with hashing or pulling.
+func (f *folder) scrubTimerFired() {
+	if f.ScrubIntervalDays <= 0 {
+		// Scrubbing is disabled; check back in case the config changes.
+		f.scrubTimer.Reset(24 * time.Hour)
+		return
+	}
+
+	interval := time.Duration(f.ScrubIntervalDays) * 24 * time.Hour
+	kv := db.NewMiscDataNamespace(f.model.db)
+	key := "scrub." + f.folderID
+
+	if last, ok := kv.Int64(key); ok {
+		if next := time.Unix(last, 0).Add(interval); time.Now().Before(next) {
+			f.scrubTimer.Reset(time.Until(next))
+			return
+		}
+	}
+
+	l.Infoln("Scrubbing", f.Description())
+	issues, err := f.model.VerifyFolder(f.folderID, false)
+	if err != nil {
+		l.Infof("Scrub of %v failed: %v", f.Description(), err)
+		f.scrubTimer.Reset(time.Hour)
+		return
+	}
+
+	kv.PutInt64(key, time.Now().Unix())
+	events.Default.Log(events.FolderScrubbed, map[string]interface{}{
+		"folder": f.folderID,
+		"issues": issues,
+	})
+	if len(issues) > 0 {
+		l.Warnf("Scrub of %v found %d corrupted files; check the FolderScrubbed event or /rest/db/verify for details", f.Description(), len(issues))
+	} else {
+		l.Infoln("Scrub of", f.Description(), "found no issues")
+	}
+	f.scrubTimer.Reset(interval)
+}
+
 func (f *folder) WatchError() error {
 	f.watchErrMut.Lock()
 	defer f.watchErrMut.Unlock()
@@ -606,7 +689,31 @@ func (f *folder) startWatchAsync(ctx context.Context, ignores *ignore.Matcher) {
 	for {
 		select {
 		case <-timer.C:
-			eventChan, err := f.Filesystem().Watch(".", ignores, ctx, f.IgnorePerms)
+			var eventChan <-chan fs.Event
+			var err error
+			if f.JournalWatcher {
+				eventChan, err = fs.WatchJournal(f.Filesystem().URI(), ignores, ctx, 0)
+				if err != nil {
+					l.Debugf("Journal watcher unavailable for folder %s, using the regular watcher: %v", f.Description(), err)
+					eventChan = nil
+				}
+			}
+			if eventChan == nil {
+				eventChan, err = f.Filesystem().Watch(".", ignores, ctx, f.IgnorePerms)
+			}
+			if err != nil {
+				// Native watching doesn't work here, as is the case on
+				// NFS, CIFS and many FUSE mounts. Fall back to periodic
+				// polling if that works.
+				interval := fs.DefaultPollInterval
+				if f.FSWatcherPollIntervalS > 0 {
+					interval = time.Duration(f.FSWatcherPollIntervalS) * time.Second
+				}
+				if pollChan, pollErr := fs.WatchPoll(f.Filesystem(), ".", ignores, ctx, interval); pollErr == nil {
+					l.Infof("Failed to start filesystem watcher for folder %s (%v); falling back to polling every %v", f.Description(), err, interval)
+					eventChan, err = pollChan, nil
+				}
+			}
 			f.watchErrMut.Lock()
 			prevErr := f.watchErr
 			f.watchErr = err
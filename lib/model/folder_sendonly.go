@@ -134,3 +134,38 @@ func (f *sendOnlyFolder) Override(fs *db.FileSet, updateFn func([]protocol.FileI
 	}
 	f.setState(FolderIdle)
 }
+
+// OverrideFile is Override for a single file. The same rules apply, but
+// only the named file is stomped back to the local state.
+func (f *sendOnlyFolder) OverrideFile(fs *db.FileSet, file string, updateFn func([]protocol.FileInfo)) {
+	need, ok := fs.GetGlobal(file)
+	if !ok {
+		return
+	}
+
+	have, haveOk := fs.Get(protocol.LocalDeviceID, file)
+	if haveOk && have.Version.Equal(need.Version) {
+		// We already agree with the global version; nothing to override.
+		return
+	}
+
+	// Don't override files that are in a bad state (ignored,
+	// unsupported, must rescan, ...).
+	if haveOk && have.IsInvalid() {
+		return
+	}
+
+	if !haveOk || have.Name != need.Name {
+		// We are missing the file
+		need.Deleted = true
+		need.Blocks = nil
+		need.Version = need.Version.Update(f.shortID)
+		need.Size = 0
+	} else {
+		// We have the file, replace with our version
+		have.Version = have.Version.Merge(need.Version).Update(f.shortID)
+		need = have
+	}
+	need.Sequence = 0
+	updateFn([]protocol.FileInfo{need})
+}
@@ -10,6 +10,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"path/filepath"
 	"runtime"
@@ -17,6 +18,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/syncthing/syncthing/lib/blockdelta"
 	"github.com/syncthing/syncthing/lib/config"
 	"github.com/syncthing/syncthing/lib/db"
 	"github.com/syncthing/syncthing/lib/events"
@@ -67,6 +69,7 @@ var (
 	errDirNotEmpty         = errors.New("directory is not empty")
 	errNotAvailable        = errors.New("no connected device has the required version of this file")
 	errModified            = errors.New("file modified but not rescanned; will try again later")
+	errCaseConflict        = errors.New("case conflict with existing item")
 )
 
 const (
@@ -85,6 +88,12 @@ const (
 	defaultPullerPendingKiB = 2 * protocol.MaxBlockSize / 1024
 
 	maxPullerIterations = 3
+
+	// When no device can currently serve a block we re-query availability
+	// a few times before giving up, as a partially complete peer may gain
+	// the block and advertise it through a temp index update meanwhile.
+	blockAvailabilityRetries = 4
+	blockAvailabilityPause   = 5 * time.Second
 )
 
 type dbUpdateJob struct {
@@ -101,6 +110,8 @@ type sendReceiveFolder struct {
 
 	queue *jobQueue
 
+	caseResolver *fs.CaseResolver // valid during one puller iteration, nil outside
+
 	pullErrors    map[string]string // path -> error string
 	pullErrorsMut sync.Mutex
 }
@@ -129,6 +140,15 @@ func newSendReceiveFolder(model *Model, cfg config.FolderConfiguration, ver vers
 		f.PullerMaxPendingKiB = blockSizeKiB
 	}
 
+	// Folders don't share a request scheduler; what biases throughput
+	// between folders competing for the same remote devices is how much
+	// data each keeps on the wire. Scale this folder's pending budget by
+	// its priority so higher priority folders win proportionally more of
+	// the link.
+	if f.PullPriority > 1 {
+		f.PullerMaxPendingKiB *= f.PullPriority
+	}
+
 	return f
 }
 
@@ -160,6 +180,37 @@ func (f *sendReceiveFolder) pull() bool {
 		return true
 	}
 
+	// Enforce the folder quota, if one is set. We stop pulling when the
+	// local folder is at or above the maximum size; what has already been
+	// pulled stays.
+	usage, _ := f.model.FolderUsage(f.folderID)
+	if err := f.CheckFolderSize(usage); err != nil {
+		f.setError(err)
+		l.Infof("Skipping pull of %v: %v", f.Description(), err)
+		return true
+	}
+
+	// Guard against mass deletions, if a limit is set. A pull that would
+	// delete more than the configured percentage of our files stops the
+	// folder with an error, until the user confirms the deletions or
+	// reverts the folder.
+	if limit := f.MaxDeleteRatio; limit > 0 {
+		deletions := neededDeletions(folderFiles)
+		have := int(f.model.LocalSize(f.folderID).Files)
+		if have > 0 && deletions*100 > have*limit && !f.model.consumeDeletionConfirmation(f.folderID) {
+			err := fmt.Errorf("pull would delete %d of %d files, more than the limit of %d%%; confirm the deletions or revert the folder to continue", deletions, have, limit)
+			f.setError(err)
+			events.Default.Log(events.FolderDeletionLimitReached, map[string]interface{}{
+				"folder":    f.folderID,
+				"deletions": deletions,
+				"files":     have,
+				"limit":     limit,
+			})
+			l.Infof("Skipping pull of %v: %v", f.Description(), err)
+			return true
+		}
+	}
+
 	curIgnoreHash := curIgnores.Hash()
 	ignoresChanged := curIgnoreHash != f.prevIgnoreHash
 
@@ -231,6 +282,16 @@ func (f *sendReceiveFolder) pullerIteration(ignores *ignore.Matcher, folderFiles
 	finisherChan := make(chan *sharedPullerState)
 	dbUpdateChan := make(chan dbUpdateJob)
 
+	// Fresh case resolution cache for this iteration. Creating both Foo
+	// and foo on a case insensitive filesystem would silently clobber one
+	// of them, and even a case sensitive mount may be exported to such a
+	// filesystem later, so the check is on by default everywhere and the
+	// caseSensitiveFS option is the opt-out.
+	if !f.CaseSensitiveFS {
+		f.caseResolver = fs.NewCaseResolver(f.fs)
+		defer func() { f.caseResolver = nil }()
+	}
+
 	pullWg := sync.NewWaitGroup()
 	copyWg := sync.NewWaitGroup()
 	doneWg := sync.NewWaitGroup()
@@ -293,12 +354,26 @@ func (f *sendReceiveFolder) pullerIteration(ignores *ignore.Matcher, folderFiles
 	return changed
 }
 
+// neededDeletions returns the number of needed items that are file
+// deletions.
+func neededDeletions(folderFiles *db.FileSet) int {
+	deletions := 0
+	folderFiles.WithNeedTruncated(protocol.LocalDeviceID, func(intf db.FileIntf) bool {
+		if intf.IsDeleted() && !intf.IsDirectory() {
+			deletions++
+		}
+		return true
+	})
+	return deletions
+}
+
 func (f *sendReceiveFolder) processNeeded(ignores *ignore.Matcher, folderFiles *db.FileSet, dbUpdateChan chan<- dbUpdateJob, copyChan chan<- copyBlocksState, finisherChan chan<- *sharedPullerState, scanChan chan<- string) (int, map[string]protocol.FileInfo, []protocol.FileInfo, error) {
 	changed := 0
 	var processDirectly []protocol.FileInfo
 	var dirDeletions []protocol.FileInfo
 	fileDeletions := map[string]protocol.FileInfo{}
 	buckets := map[string][]protocol.FileInfo{}
+	selection := f.model.GetSelection(f.folderID)
 
 	// Iterate the list of items that we need and sort them into piles.
 	// Regular files to pull goes into the file queue, everything else
@@ -325,6 +400,11 @@ func (f *sendReceiveFolder) processNeeded(ignores *ignore.Matcher, folderFiles *
 			dbUpdateChan <- dbUpdateJob{file, dbUpdateInvalidate}
 			changed++
 
+		case !file.IsDeleted() && !inSelection(selection, file.Name):
+			// Outside the current selection. We keep tracking the index
+			// but don't pull the data.
+			l.Debugln(f, "Not pulling unselected item", file.Name)
+
 		case runtime.GOOS == "windows" && fs.WindowsInvalidFilename(file.Name):
 			f.newPullError("pull", file.Name, fs.ErrInvalidFilename)
 
@@ -460,31 +540,38 @@ nextFile:
 		}
 
 		// Check our list of files to be removed for a match, in which case
-		// we can just do a rename instead.
+		// we can just do a rename instead. Candidates live anywhere in the
+		// folder; a move across directories is as good as one within.
 		key := string(fi.Blocks[0].Hash)
-		for i, candidate := range buckets[key] {
-			if protocol.BlocksEqual(candidate.Blocks, fi.Blocks) {
-				// Remove the candidate from the bucket
-				lidx := len(buckets[key]) - 1
-				buckets[key][i] = buckets[key][lidx]
-				buckets[key] = buckets[key][:lidx]
-
-				// candidate is our current state of the file, where as the
-				// desired state with the delete bit set is in the deletion
-				// map.
-				desired := fileDeletions[candidate.Name]
-				if err := f.renameFile(candidate, desired, fi, dbUpdateChan, scanChan); err != nil {
-					// Failed to rename, try to handle files as separate
-					// deletions and updates.
-					break
-				}
-
-				// Remove the pending deletion (as we performed it by renaming)
-				delete(fileDeletions, candidate.Name)
+		for i := 0; i < len(buckets[key]); i++ {
+			candidate := buckets[key][i]
+			if !protocol.BlocksEqual(candidate.Blocks, fi.Blocks) {
+				continue
+			}
 
-				f.queue.Done(fileName)
-				continue nextFile
+			// Remove the candidate from the bucket
+			lidx := len(buckets[key]) - 1
+			buckets[key][i] = buckets[key][lidx]
+			buckets[key] = buckets[key][:lidx]
+			i--
+
+			// candidate is our current state of the file, where as the
+			// desired state with the delete bit set is in the deletion
+			// map.
+			desired := fileDeletions[candidate.Name]
+			if err := f.renameFile(candidate, desired, fi, dbUpdateChan, scanChan); err != nil {
+				// This candidate couldn't be renamed (perhaps locally
+				// modified); there may be another identical one, so keep
+				// looking before we fall back to separate deletion and
+				// pull. The copier will still find the blocks locally.
+				continue
 			}
+
+			// Remove the pending deletion (as we performed it by renaming)
+			delete(fileDeletions, candidate.Name)
+
+			f.queue.Done(fileName)
+			continue nextFile
 		}
 
 		devices := folderFiles.Availability(fileName)
@@ -564,6 +651,11 @@ func (f *sendReceiveFolder) handleDir(file protocol.FileInfo, dbUpdateChan chan<
 		l.Debugf("need dir\n\t%v\n\t%v", file, curFile)
 	}
 
+	if err = f.checkCaseConflict(file.Name); err != nil {
+		f.newPullError("creating dir", file.Name, err)
+		return
+	}
+
 	info, err := f.fs.Lstat(file.Name)
 	switch {
 	// There is already something under that name, but it's a file/link.
@@ -584,10 +676,18 @@ func (f *sendReceiveFolder) handleDir(file protocol.FileInfo, dbUpdateChan chan<
 		// not MkdirAll because the parent should already exist.
 		mkdir := func(path string) error {
 			err = f.fs.Mkdir(path, mode)
-			if err != nil || f.IgnorePerms || file.NoPermissions {
+			if err != nil {
+				return err
+			}
+
+			if err := f.maybeCopyOwner(path); err != nil {
 				return err
 			}
 
+			if f.IgnorePerms || file.NoPermissions {
+				return nil
+			}
+
 			// Stat the directory so we can check its permissions.
 			info, err := f.fs.Lstat(path)
 			if err != nil {
@@ -694,6 +794,11 @@ func (f *sendReceiveFolder) handleSymlink(file protocol.FileInfo, dbUpdateChan c
 		return
 	}
 
+	if err = f.checkCaseConflict(file.Name); err != nil {
+		f.newPullError("creating symlink", file.Name, err)
+		return
+	}
+
 	if _, err = f.fs.Lstat(file.Name); err == nil {
 		// There is already something under that name. Remove it to replace
 		// with the symlink. This also handles the "change symlink type"
@@ -708,7 +813,10 @@ func (f *sendReceiveFolder) handleSymlink(file protocol.FileInfo, dbUpdateChan c
 	// We declare a function that acts on only the path name, so
 	// we can pass it to InWritableDir.
 	createLink := func(path string) error {
-		return f.fs.CreateSymlink(file.SymlinkTarget, path)
+		if err := f.fs.CreateSymlink(file.SymlinkTarget, path); err != nil {
+			return err
+		}
+		return f.maybeCopyOwner(path)
 	}
 
 	if err = osutil.InWritableDir(createLink, f.fs, file.Name); err == nil {
@@ -782,7 +890,7 @@ func (f *sendReceiveFolder) deleteFile(file protocol.FileInfo, scanChan chan<- s
 		return dbUpdateJob{}, err
 	}
 
-	if f.inConflict(cur.Version, file.Version) {
+	if f.inConflict(cur.Version, file.Version) && f.shouldKeepConflictCopy(cur, file) {
 		// There is a conflict here. Move the file to a conflict copy instead
 		// of deleting. Also merge with the version vector we had, to indicate
 		// we have resolved the conflict.
@@ -790,6 +898,15 @@ func (f *sendReceiveFolder) deleteFile(file protocol.FileInfo, scanChan chan<- s
 		err = osutil.InWritableDir(func(name string) error {
 			return f.moveForConflict(name, file.ModifiedBy.String())
 		}, f.fs, file.Name)
+	} else if f.inConflict(cur.Version, file.Version) {
+		// A conflict where the resolution policy says the remote side
+		// wins. Mark it resolved and handle the file as a plain delete.
+		file.Version = file.Version.Merge(cur.Version)
+		if f.versioner != nil && !cur.IsSymlink() {
+			err = osutil.InWritableDir(f.versioner.Archive, f.fs, file.Name)
+		} else {
+			err = osutil.InWritableDir(f.fs.Remove, f.fs, file.Name)
+		}
 	} else if f.versioner != nil && !cur.IsSymlink() {
 		err = osutil.InWritableDir(f.versioner.Archive, f.fs, file.Name)
 	} else {
@@ -970,6 +1087,16 @@ func (f *sendReceiveFolder) handleFile(file protocol.FileInfo, copyChan chan<- c
 		return
 	}
 
+	if err := f.checkCaseConflict(file.Name); err != nil {
+		f.newPullError("pulling file", file.Name, err)
+		f.queue.Done(file.Name)
+		return
+	}
+
+	if f.DeduplicateOnReceive && f.dedupeFile(file, curFile, hasCurFile, finisherChan) {
+		return
+	}
+
 	tempName := fs.TempName(file.Name)
 
 	populateOffsets(file.Blocks)
@@ -979,9 +1106,29 @@ func (f *sendReceiveFolder) handleFile(file protocol.FileInfo, copyChan chan<- c
 	reused := make([]int32, 0, len(file.Blocks))
 
 	// Check for an old temporary file which might have some blocks we could
-	// reuse.
-	tempBlocks, err := scanner.HashFile(f.ctx, f.fs, tempName, file.BlockSize(), nil, false)
-	if err == nil {
+	// reuse. If there is a persistent record of which blocks were verified
+	// into the temp file, trust it and skip rehashing; those blocks were
+	// hash checked when they were written. Otherwise fall back to hashing
+	// the temp file from scratch.
+	blocksHash := protocol.BlocksHash(file.Blocks)
+	_, tempErr := f.fs.Lstat(tempName)
+	if avail, ok := f.model.partials.Get(f.folderID, file.Name, blocksHash); ok && tempErr == nil {
+		availSet := make(map[int32]struct{}, len(avail))
+		for _, i := range avail {
+			availSet[i] = struct{}{}
+		}
+		for i, block := range file.Blocks {
+			if _, ok := availSet[int32(i)]; ok {
+				reused = append(reused, int32(i))
+			} else {
+				blocks = append(blocks, block)
+				blocksSize += int64(block.Size)
+			}
+		}
+		if len(reused) == 0 {
+			osutil.InWritableDir(f.fs.Remove, f.fs, tempName)
+		}
+	} else if tempBlocks, err := scanner.HashFile(f.ctx, f.fs, tempName, file.BlockSize(), nil, false); err == nil {
 		// Check for any reusable blocks in the temp file
 		tempCopyBlocks, _ := blockDiff(tempBlocks, file.Blocks)
 
@@ -1022,10 +1169,33 @@ func (f *sendReceiveFolder) handleFile(file protocol.FileInfo, copyChan chan<- c
 		return
 	}
 
-	// Shuffle the blocks
-	for i := range blocks {
-		j := rand.Intn(i + 1)
-		blocks[i], blocks[j] = blocks[j], blocks[i]
+	if f.PullSequential {
+		// Pull strictly in file order, so that the contiguous start of
+		// the file grows as fast as possible and a consumer can stream
+		// the file while it is still syncing. The sparse temp file
+		// already has its full size, so readers can seek as well.
+		sort.Slice(blocks, func(a, b int) bool {
+			return blocks[a].Offset < blocks[b].Offset
+		})
+	} else {
+		// Shuffle the blocks, then order them rarest first. The shuffle
+		// spreads our requests over the whole range so that different devices
+		// pulling the same file grab distinct blocks; the rarity sort on top
+		// makes us prefer blocks that fewer devices can serve. Availability
+		// only differs between blocks of a file while peers announce partial
+		// transfers via their temp indexes, which is exactly when grabbing the
+		// rare blocks first helps the cluster converge.
+		for i := range blocks {
+			j := rand.Intn(i + 1)
+			blocks[i], blocks[j] = blocks[j], blocks[i]
+		}
+		rarity := make(map[int64]int, len(blocks))
+		for _, block := range blocks {
+			rarity[block.Offset] = len(f.model.Availability(f.folderID, file, block))
+		}
+		sort.SliceStable(blocks, func(a, b int) bool {
+			return rarity[blocks[a].Offset] < rarity[blocks[b].Offset]
+		})
 	}
 
 	events.Default.Log(events.ItemStarted, map[string]string{
@@ -1053,6 +1223,8 @@ func (f *sendReceiveFolder) handleFile(file protocol.FileInfo, copyChan chan<- c
 		mut:              sync.NewRWMutex(),
 		sparse:           !f.DisableSparseFiles,
 		created:          time.Now(),
+		partials:         f.model.partials,
+		blocksHash:       blocksHash,
 	}
 
 	l.Debugf("%v need file %s; copy %d, reused %v", f, file.Name, len(blocks), len(reused))
@@ -1065,6 +1237,104 @@ func (f *sendReceiveFolder) handleFile(file protocol.FileInfo, copyChan chan<- c
 	copyChan <- cs
 }
 
+// checkCaseConflict returns an error if creating name would collide with a
+// differently-cased item already on disk, which on a case-insensitive
+// filesystem would silently clobber that item while the index keeps both
+// entries. No-op outside a puller iteration or when the resolver is not set.
+func (f *sendReceiveFolder) checkCaseConflict(name string) error {
+	if f.caseResolver == nil {
+		return nil
+	}
+	real, err := f.caseResolver.RealCase(name)
+	if err != nil || real == name {
+		// Nothing on disk by any casing, or an exact match that the normal
+		// old-file handling deals with.
+		return nil
+	}
+	return fmt.Errorf("%v: %q", errCaseConflict, real)
+}
+
+// maybeCopyOwner makes the new object inherit the owner and group of its
+// parent directory, when the folder is configured for that.
+func (f *sendReceiveFolder) maybeCopyOwner(path string) error {
+	if !f.CopyOwnershipFromParent {
+		return nil
+	}
+	return fs.CopyOwnershipFromParent(f.fs, path)
+}
+
+// dedupeFile tries to satisfy the file by hardlinking to an existing local
+// file with identical content, instead of copying or pulling the data. The
+// block map provides the content grouping: any file sharing our first block
+// is a candidate, and we verify the full block lists match. Returns true if
+// the link was created and the file handed off to the finisher.
+func (f *sendReceiveFolder) dedupeFile(file, curFile protocol.FileInfo, hasCurFile bool, finisherChan chan<- *sharedPullerState) bool {
+	if len(file.Blocks) == 0 {
+		return false
+	}
+
+	var candidate string
+	f.model.finder.Iterate([]string{f.folderID}, file.Blocks[0].Hash, func(folder, path string, index int32) bool {
+		if index != 0 || path == file.Name {
+			return false
+		}
+		cf, ok := f.model.CurrentFolderFile(f.folderID, path)
+		if !ok || cf.IsDeleted() || cf.IsInvalid() || cf.Type != protocol.FileInfoTypeFile {
+			return false
+		}
+		if !protocol.BlocksEqual(cf.Blocks, file.Blocks) {
+			return false
+		}
+		// Don't link to a file that has changed on disk since we indexed
+		// it; the content might no longer be what the block list says.
+		if info, err := f.fs.Lstat(path); err != nil || !info.IsRegular() || info.Size() != cf.Size || !info.ModTime().Equal(cf.ModTime()) {
+			return false
+		}
+		candidate = path
+		return true
+	})
+	if candidate == "" {
+		return false
+	}
+
+	tempName := fs.TempName(file.Name)
+	osutil.InWritableDir(f.fs.Remove, f.fs, tempName)
+	if err := osutil.InWritableDir(func(name string) error {
+		return f.fs.Link(candidate, name)
+	}, f.fs, tempName); err != nil {
+		// The filesystem may not support hardlinks; fall back to the
+		// normal copy/pull machinery.
+		l.Debugln(f, "dedupe: link failed:", file.Name, err)
+		return false
+	}
+
+	l.Debugln(f, "deduplicated", file.Name, "as hardlink to", candidate)
+
+	events.Default.Log(events.ItemStarted, map[string]string{
+		"folder": f.folderID,
+		"item":   file.Name,
+		"type":   "file",
+		"action": "update",
+	})
+
+	finisherChan <- &sharedPullerState{
+		file:             file,
+		fs:               f.fs,
+		folder:           f.folderID,
+		tempName:         tempName,
+		realName:         file.Name,
+		updated:          time.Now(),
+		availableUpdated: time.Now(),
+		ignorePerms:      f.IgnorePerms || file.NoPermissions,
+		hasCurFile:       hasCurFile,
+		curFile:          curFile,
+		mut:              sync.NewRWMutex(),
+		sparse:           !f.DisableSparseFiles,
+		created:          time.Now(),
+	}
+	return true
+}
+
 // blockDiff returns lists of common and missing (to transform src into tgt)
 // blocks. Both block lists must have been created with the same block size.
 func blockDiff(src, tgt []protocol.BlockInfo) ([]protocol.BlockInfo, []protocol.BlockInfo) {
@@ -1212,7 +1482,7 @@ func (f *sendReceiveFolder) copierRoutine(in <-chan copyBlocksState, pullChan ch
 			default:
 			}
 
-			if !f.DisableSparseFiles && state.reused == 0 && block.IsEmpty() {
+			if state.skipEmptyBlock() && state.reused == 0 && block.IsEmpty() {
 				// The block is a block of all zeroes, and we are not reusing
 				// a temp file, so there is no need to do anything with it.
 				// If we were reusing a temp file and had this block to copy,
@@ -1251,14 +1521,15 @@ func (f *sendReceiveFolder) copierRoutine(in <-chan copyBlocksState, pullChan ch
 
 			if !found {
 				found = f.model.finder.Iterate(folders, block.Hash, func(folder, path string, index int32) bool {
-					fs := folderFilesystems[folder]
-					fd, err := fs.Open(path)
+					ffs := folderFilesystems[folder]
+					fd, err := ffs.Open(path)
 					if err != nil {
 						return false
 					}
+					defer fd.Close()
 
-					_, err = fd.ReadAt(buf, int64(state.file.BlockSize())*int64(index))
-					fd.Close()
+					srcOffset := int64(state.file.BlockSize()) * int64(index)
+					_, err = fd.ReadAt(buf, srcOffset)
 					if err != nil {
 						return false
 					}
@@ -1268,6 +1539,21 @@ func (f *sendReceiveFolder) copierRoutine(in <-chan copyBlocksState, pullChan ch
 						return false
 					}
 
+					if folder == f.folderID {
+						// The source is on the same filesystem, so try to
+						// clone the verified range instead of rewriting it.
+						// On CoW filesystems that shares the extents
+						// instead of duplicating the data.
+						if lw, ok := dstFd.(lockedWriterAt); ok {
+							if err := lw.copyRangeFrom(ffs, fd, srcOffset, block.Offset, int64(block.Size)); err == nil {
+								if path == state.file.Name {
+									state.copiedFromOrigin()
+								}
+								return true
+							}
+						}
+					}
+
 					_, err = dstFd.WriteAt(buf, block.Offset)
 					if err != nil {
 						state.fail("dst write", err)
@@ -1304,6 +1590,33 @@ func (f *sendReceiveFolder) copierRoutine(in <-chan copyBlocksState, pullChan ch
 	}
 }
 
+// blockListHash returns a hash identifying a file's block list, used to
+// match a persistent partial-download record against the version of the
+// file we are about to pull.
+// verifyBlocksHash rehashes the assembled temporary file and compares the
+// result against the whole-file digest carried in the FileInfo.
+func (f *sendReceiveFolder) verifyBlocksHash(tempName string, file protocol.FileInfo) error {
+	fd, err := f.fs.Open(tempName)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	root := sha256.New()
+	buf := make([]byte, file.BlockSize())
+	for _, block := range file.Blocks {
+		if _, err := io.ReadFull(fd, buf[:block.Size]); err != nil {
+			return fmt.Errorf("verifying blocks hash: %v", err)
+		}
+		hash := sha256.Sum256(buf[:block.Size])
+		root.Write(hash[:])
+	}
+	if !bytes.Equal(root.Sum(nil), file.BlocksHash) {
+		return errors.New("blocks hash mismatch after assembly")
+	}
+	return nil
+}
+
 func verifyBuffer(buf []byte, block protocol.BlockInfo) error {
 	if len(buf) != int(block.Size) {
 		return fmt.Errorf("length mismatch %d != %d", len(buf), block.Size)
@@ -1352,6 +1665,20 @@ func (f *sendReceiveFolder) pullerRoutine(in <-chan pullBlockState, out chan<- *
 	wg.Wait()
 }
 
+// hasConnectedDevice returns true if we are currently connected to at
+// least one of the devices sharing this folder.
+func (f *sendReceiveFolder) hasConnectedDevice() bool {
+	for _, dev := range f.Devices {
+		if dev.DeviceID == f.model.id {
+			continue
+		}
+		if _, ok := f.model.Connection(dev.DeviceID); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func (f *sendReceiveFolder) pullBlock(state pullBlockState, out chan<- *sharedPullerState) {
 	// Get an fd to the temporary file. Technically we don't need it until
 	// after fetching the block, but if we run into an error here there is
@@ -1362,7 +1689,7 @@ func (f *sendReceiveFolder) pullBlock(state pullBlockState, out chan<- *sharedPu
 		return
 	}
 
-	if !f.DisableSparseFiles && state.reused == 0 && state.block.IsEmpty() {
+	if state.skipEmptyBlock() && state.reused == 0 && state.block.IsEmpty() {
 		// There is no need to request a block of all zeroes. Pretend we
 		// requested it and handled it correctly.
 		state.pullDone(state.block)
@@ -1372,6 +1699,22 @@ func (f *sendReceiveFolder) pullBlock(state pullBlockState, out chan<- *sharedPu
 
 	var lastError error
 	candidates := f.model.Availability(f.folderID, state.file, state.block)
+	retries := 0
+
+	// When delta transfers are enabled towards any of the candidate
+	// devices and we have an old copy of the file, hash sub-chunks of our
+	// old data for this block so the sender can respond with just the
+	// changes. The old data doubles as the source when applying the
+	// delta.
+	var deltaBase, deltaHashes []byte
+	if state.hasCurFile && !state.curFile.IsSymlink() && int(state.block.Size) >= blockdelta.ChunkSize {
+		for _, candidate := range candidates {
+			if f.model.cfg.Devices()[candidate.ID].DeltaTransfers {
+				deltaBase, deltaHashes = f.oldBlockData(state)
+				break
+			}
+		}
+	}
 	for {
 		select {
 		case <-f.ctx.Done():
@@ -1385,6 +1728,24 @@ func (f *sendReceiveFolder) pullBlock(state pullBlockState, out chan<- *sharedPu
 		// file).
 		selected, found := activity.leastBusy(candidates)
 		if !found {
+			// The sources we knew about are exhausted, but temp index
+			// updates arrive continuously from devices that are pulling
+			// the same file. Pause and re-query availability a few times
+			// before declaring the block unavailable, so that we can
+			// ride along behind a partially complete peer. If we're not
+			// connected to anyone sharing the folder there is nothing to
+			// wait for.
+			if retries < blockAvailabilityRetries && f.hasConnectedDevice() {
+				retries++
+				select {
+				case <-f.ctx.Done():
+					state.fail("folder stopped", f.ctx.Err())
+					return
+				case <-time.After(blockAvailabilityPause):
+				}
+				candidates = f.model.Availability(f.folderID, state.file, state.block)
+				continue
+			}
 			if lastError != nil {
 				state.fail("pull", lastError)
 			} else {
@@ -1398,13 +1759,25 @@ func (f *sendReceiveFolder) pullBlock(state pullBlockState, out chan<- *sharedPu
 		// Fetch the block, while marking the selected device as in use so that
 		// leastBusy can select another device when someone else asks.
 		activity.using(selected)
-		buf, lastError := f.model.requestGlobal(selected.ID, f.folderID, state.file.Name, state.block.Offset, int(state.block.Size), state.block.Hash, state.block.WeakHash, selected.FromTemporary)
+		blockNo := int(state.block.Offset / int64(state.file.BlockSize()))
+		buf, isDelta, lastError := f.model.requestGlobal(selected.ID, f.folderID, state.file.Name, blockNo, state.block.Offset, int(state.block.Size), state.block.Hash, state.block.WeakHash, selected.FromTemporary, deltaHashes)
 		activity.done(selected)
 		if lastError != nil {
 			l.Debugln("request:", f.folderID, state.file.Name, state.block.Offset, state.block.Size, "returned error:", lastError)
 			continue
 		}
 
+		if isDelta {
+			// Rebuild the block from our old data and the delta
+			// instructions. The result is verified like any other block,
+			// so a bad reconstruction just means another attempt.
+			buf, lastError = blockdelta.Apply(deltaBase, buf)
+			if lastError != nil {
+				l.Debugln("request:", f.folderID, state.file.Name, state.block.Offset, state.block.Size, "delta apply:", lastError)
+				continue
+			}
+		}
+
 		// Verify that the received block matches the desired hash, if not
 		// try pulling it from another device.
 		lastError = verifyBuffer(buf, state.block)
@@ -1425,7 +1798,37 @@ func (f *sendReceiveFolder) pullBlock(state pullBlockState, out chan<- *sharedPu
 	out <- state.sharedPullerState
 }
 
+// oldBlockData reads our old data at the block's position and returns it
+// together with its serialized sub-chunk hashes, or nils if the old file
+// doesn't cover the block.
+func (f *sendReceiveFolder) oldBlockData(state pullBlockState) ([]byte, []byte) {
+	fd, err := f.fs.Open(state.file.Name)
+	if err != nil {
+		return nil, nil
+	}
+	defer fd.Close()
+
+	buf := make([]byte, state.block.Size)
+	if _, err := fd.ReadAt(buf, state.block.Offset); err != nil {
+		return nil, nil
+	}
+	return buf, blockdelta.Hashes(buf)
+}
+
 func (f *sendReceiveFolder) performFinish(ignores *ignore.Matcher, file, curFile protocol.FileInfo, hasCurFile bool, tempName string, dbUpdateChan chan<- dbUpdateJob, scanChan chan<- string) error {
+	// If the file carries a whole-file digest, confirm the assembled result
+	// end to end before it goes into place. Each block was verified as it
+	// was written; this catches anything that went wrong between then and
+	// the complete file landing on disk.
+	if len(file.BlocksHash) > 0 && !file.IsSymlink() {
+		if err := f.verifyBlocksHash(tempName, file); err != nil {
+			// The temp file is corrupt and must not be picked up for block
+			// reuse by the next attempt.
+			f.fs.Remove(tempName)
+			return err
+		}
+	}
+
 	// Set the correct permission bits on the new file
 	if !f.IgnorePerms && !file.NoPermissions {
 		if err := f.fs.Chmod(tempName, fs.FileMode(file.Permissions&0777)); err != nil {
@@ -1437,6 +1840,14 @@ func (f *sendReceiveFolder) performFinish(ignores *ignore.Matcher, file, curFile
 		// There is an old file or directory already in place. We need to
 		// handle that.
 
+		if f.SyncXattrs && stat.IsRegular() {
+			// Carry the old file's extended attributes (Finder tags,
+			// SELinux labels, ...) over to the replacement. They are not
+			// part of the synced metadata, so without this they'd be lost
+			// on every remote update.
+			fs.CopyXattrs(f.fs, file.Name, tempName)
+		}
+
 		curMode := uint32(stat.Mode())
 
 		// Check that the file on disk is what we expect it to be according
@@ -1493,13 +1904,20 @@ func (f *sendReceiveFolder) performFinish(ignores *ignore.Matcher, file, curFile
 		case f.inConflict(curFile.Version, file.Version):
 			// The new file has been changed in conflict with the existing one. We
 			// should file it away as a conflict instead of just removing or
-			// archiving. Also merge with the version vector we had, to indicate
-			// we have resolved the conflict.
+			// archiving, unless the conflict resolution policy says the
+			// remote side wins. Also merge with the version vector we had,
+			// to indicate we have resolved the conflict.
 
 			file.Version = file.Version.Merge(curFile.Version)
-			err = osutil.InWritableDir(func(name string) error {
-				return f.moveForConflict(name, file.ModifiedBy.String())
-			}, f.fs, file.Name)
+			if f.shouldKeepConflictCopy(curFile, file) {
+				err = osutil.InWritableDir(func(name string) error {
+					return f.moveForConflict(name, file.ModifiedBy.String())
+				}, f.fs, file.Name)
+			} else if f.versioner != nil && !file.IsSymlink() {
+				err = osutil.InWritableDir(f.versioner.Archive, f.fs, file.Name)
+			} else {
+				err = osutil.InWritableDir(f.fs.Remove, f.fs, file.Name)
+			}
 			if err != nil {
 				return err
 			}
@@ -1515,6 +1933,10 @@ func (f *sendReceiveFolder) performFinish(ignores *ignore.Matcher, file, curFile
 		}
 	}
 
+	if err := f.maybeCopyOwner(tempName); err != nil {
+		return err
+	}
+
 	// Replace the original content with the new one. If it didn't work,
 	// leave the temp file in place for reuse.
 	if err := osutil.TryRename(f.fs, tempName, file.Name); err != nil {
@@ -1553,6 +1975,15 @@ func (f *sendReceiveFolder) finisherRoutine(ignores *ignore.Matcher, in <-chan *
 				blockStats["copyOriginShifted"] += state.copyOriginShifted
 				blockStats["copyElsewhere"] += state.copyTotal - state.copyOrigin
 				blockStatsMut.Unlock()
+
+				// Blocks that were reused or copied locally never crossed
+				// the network; the size is approximate as the last block
+				// may be shorter.
+				saved := int64(state.reused+state.copyTotal) * int64(state.file.BlockSize())
+				if saved > state.file.Size {
+					saved = state.file.Size
+				}
+				f.model.transferStatsRef.AddSyncedFile(f.folderID, state.file.Size, saved)
 			}
 
 			events.Default.Log(events.ItemFinished, map[string]interface{}{
@@ -1722,6 +2153,32 @@ func removeAvailability(availabilities []Availability, availability Availability
 	return availabilities
 }
 
+// shouldKeepConflictCopy returns whether the existing local file should be
+// kept as a conflict copy when it is replaced by the given remote file,
+// according to the folder's conflict resolution policy. The default
+// keep-both policy always keeps it; the other policies discard the local
+// copy when they consider the remote side the winner. Unknown policies
+// behave like keep-both, erring on the side of not losing data.
+func (f *sendReceiveFolder) shouldKeepConflictCopy(cur, replacement protocol.FileInfo) bool {
+	switch res := f.ConflictResolution; {
+	case res == "keep-newest":
+		return cur.ModTime().After(replacement.ModTime())
+	case res == "keep-largest":
+		return cur.Size > replacement.Size
+	case strings.HasPrefix(res, "prefer-device:"):
+		id, err := protocol.DeviceIDFromString(res[len("prefer-device:"):])
+		if err != nil {
+			l.Warnf("Folder %v: bad device ID in conflictResolution %q: %v", f.Description(), res, err)
+			return true
+		}
+		// Keep the local copy unless the incoming change was made by the
+		// preferred device.
+		return replacement.ModifiedBy != id.Short()
+	default:
+		return true
+	}
+}
+
 func (f *sendReceiveFolder) moveForConflict(name string, lastModBy string) error {
 	if strings.Contains(filepath.Base(name), ".sync-conflict-") {
 		l.Infoln("Conflict for", name, "which is already a conflict copy; not copying again.")
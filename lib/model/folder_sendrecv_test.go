@@ -400,6 +400,35 @@ func TestWeakHash(t *testing.T) {
 	}
 }
 
+func TestVerifyBuffer(t *testing.T) {
+	// A weak hash match must be confirmed by the strong hash before the
+	// data is reused; a colliding buffer with a different strong hash must
+	// be rejected.
+
+	data := []byte("block contents")
+	blocks, err := scanner.Blocks(context.TODO(), bytes.NewReader(data), protocol.MinBlockSize, int64(len(data)), nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 {
+		t.Fatalf("unexpected block count %d", len(blocks))
+	}
+
+	if err := verifyBuffer(data, blocks[0]); err != nil {
+		t.Error("expected match:", err)
+	}
+
+	corrupted := append([]byte{}, data...)
+	corrupted[0] ^= 0xff
+	if err := verifyBuffer(corrupted, blocks[0]); err == nil {
+		t.Error("expected mismatch for corrupted data")
+	}
+
+	if err := verifyBuffer(data[:len(data)-1], blocks[0]); err == nil {
+		t.Error("expected mismatch for truncated data")
+	}
+}
+
 // Test that updating a file removes its old blocks from the blockmap
 func TestCopierCleanup(t *testing.T) {
 	iterFn := func(folder, file string, index int32) bool {
@@ -728,3 +757,232 @@ func TestDeleteIgnorePerms(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestDedupeOnReceive checks that with DeduplicateOnReceive set, a file
+// identical to an existing local one is created as a hardlink to it instead
+// of being copied or pulled.
+func TestDedupeOnReceive(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "syncthing-dedupe-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	data := []byte("some content that exists in two identical files")
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "a"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fileBlocks, err := scanner.Blocks(context.TODO(), bytes.NewReader(data), protocol.MinBlockSize, int64(len(data)), nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := setUpModel()
+	f := setUpSendReceiveFolder(m)
+	f.DeduplicateOnReceive = true
+	f.fs = fs.NewMtimeFS(fs.NewFilesystem(fs.FilesystemTypeBasic, tmpDir), db.NewNamespacedKV(m.db, "mtime"))
+
+	info, err := f.fs.Lstat("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := protocol.FileInfo{
+		Name:        "a",
+		Size:        int64(len(data)),
+		ModifiedS:   info.ModTime().Unix(),
+		ModifiedNs:  int32(info.ModTime().Nanosecond()),
+		Permissions: 0644,
+		Blocks:      fileBlocks,
+	}
+	m.updateLocalsFromScanning("default", []protocol.FileInfo{existing})
+
+	requested := protocol.FileInfo{
+		Name:        "b",
+		Size:        int64(len(data)),
+		Permissions: 0644,
+		Blocks:      fileBlocks,
+	}
+
+	copyChan := make(chan copyBlocksState, 1)
+	finisherChan := make(chan *sharedPullerState, 1)
+	dbUpdateChan := make(chan dbUpdateJob, 1)
+
+	f.handleFile(requested, copyChan, finisherChan, dbUpdateChan)
+
+	select {
+	case <-copyChan:
+		t.Fatal("file was copied instead of deduplicated")
+	default:
+	}
+
+	// Drain the finisher so the temp link gets moved into place.
+	close(finisherChan)
+	f.finisherRoutine(ignore.New(f.fs), finisherChan, dbUpdateChan, make(chan string, 1))
+
+	f.pullErrorsMut.Lock()
+	for path, err := range f.pullErrors {
+		t.Fatalf("finisher failed: %s: %s", path, err)
+	}
+	f.pullErrorsMut.Unlock()
+
+	ai, err := os.Stat(filepath.Join(tmpDir, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bi, err := os.Stat(filepath.Join(tmpDir, "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(ai, bi) {
+		t.Error("expected a and b to be hardlinks of the same content")
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(tmpDir, "b")); err != nil || !bytes.Equal(content, data) {
+		t.Error("unexpected content in deduplicated file")
+	}
+}
+
+func TestCheckCaseConflict(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "syncthing-caseconflict-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "Existing"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := setUpModel()
+	f := setUpSendReceiveFolder(m)
+	f.fs = fs.NewFilesystem(fs.FilesystemTypeBasic, tmpDir)
+	f.caseResolver = fs.NewCaseResolver(f.fs)
+
+	if err := f.checkCaseConflict("existing"); err == nil {
+		t.Error("expected a case conflict for differently-cased name")
+	}
+	if err := f.checkCaseConflict("Existing"); err != nil {
+		t.Error("unexpected conflict for exact-case name:", err)
+	}
+	if err := f.checkCaseConflict("newfile"); err != nil {
+		t.Error("unexpected conflict for nonexistent name:", err)
+	}
+
+	// Without a resolver (outside a puller iteration) the check is a no-op.
+	f.caseResolver = nil
+	if err := f.checkCaseConflict("existing"); err != nil {
+		t.Error("expected no-op without resolver:", err)
+	}
+}
+
+func TestShouldKeepConflictCopy(t *testing.T) {
+	m := setUpModel()
+	f := setUpSendReceiveFolder(m)
+
+	// "older" is larger, "newer" was modified later and by device2.
+	older := protocol.FileInfo{Name: "file", Size: 100, ModifiedS: 100, ModifiedBy: device1.Short()}
+	newer := protocol.FileInfo{Name: "file", Size: 50, ModifiedS: 200, ModifiedBy: device2.Short()}
+
+	cases := []struct {
+		policy   string
+		cur, new protocol.FileInfo
+		keep     bool
+	}{
+		{"", older, newer, true},
+		{"keep-both", older, newer, true},
+		{"keep-newest", older, newer, false},
+		{"keep-newest", newer, older, true},
+		{"keep-largest", older, newer, true},
+		{"keep-largest", newer, older, false},
+		{"prefer-device:" + device2.String(), older, newer, false},
+		{"prefer-device:" + device1.String(), older, newer, true},
+		// Broken policies keep the conflict copy, erring on the side of
+		// not losing data.
+		{"prefer-device:notadeviceid", older, newer, true},
+		{"bogus-policy", older, newer, true},
+	}
+
+	for i, tc := range cases {
+		f.ConflictResolution = tc.policy
+		if res := f.shouldKeepConflictCopy(tc.cur, tc.new); res != tc.keep {
+			t.Errorf("case %d (%s): got %v, expected %v", i, tc.policy, res, tc.keep)
+		}
+	}
+}
+
+func TestNeededDeletions(t *testing.T) {
+	v1 := protocol.Vector{Counters: []protocol.Counter{{ID: 1, Value: 1}}}
+	v2 := protocol.Vector{Counters: []protocol.Counter{{ID: 1, Value: 2}}}
+
+	m := setUpModel(
+		protocol.FileInfo{Name: "file1", Type: protocol.FileInfoTypeFile, Version: v1, Blocks: []protocol.BlockInfo{blocks[1]}},
+		protocol.FileInfo{Name: "file2", Type: protocol.FileInfoTypeFile, Version: v1, Blocks: []protocol.BlockInfo{blocks[2]}},
+		protocol.FileInfo{Name: "file3", Type: protocol.FileInfoTypeFile, Version: v1, Blocks: []protocol.BlockInfo{blocks[3]}},
+		protocol.FileInfo{Name: "dir1", Type: protocol.FileInfoTypeDirectory, Version: v1},
+	)
+
+	m.Index(device1, "default", []protocol.FileInfo{
+		{Name: "file1", Type: protocol.FileInfoTypeFile, Version: v2, Deleted: true},
+		{Name: "file2", Type: protocol.FileInfoTypeFile, Version: v2, Deleted: true},
+		{Name: "dir1", Type: protocol.FileInfoTypeDirectory, Version: v2, Deleted: true},
+	})
+
+	m.fmut.RLock()
+	folderFiles := m.folderFiles["default"]
+	m.fmut.RUnlock()
+
+	// Directory deletions don't count towards the ratio.
+	if deletions := neededDeletions(folderFiles); deletions != 2 {
+		t.Errorf("got %d deletions, expected 2", deletions)
+	}
+
+	// Confirmations are one-shot.
+	if m.consumeDeletionConfirmation("default") {
+		t.Error("unexpected deletion confirmation")
+	}
+	if err := m.ConfirmDeletions("default"); err != nil {
+		t.Fatal(err)
+	}
+	if !m.consumeDeletionConfirmation("default") {
+		t.Error("expected a deletion confirmation")
+	}
+	if m.consumeDeletionConfirmation("default") {
+		t.Error("confirmation should have been consumed")
+	}
+
+	if err := m.ConfirmDeletions("nonexistent"); err == nil {
+		t.Error("expected an error for a nonexistent folder")
+	}
+}
+
+func TestVerifyBlocksHash(t *testing.T) {
+	m := setUpModel(protocol.FileInfo{})
+	f := setUpSendReceiveFolder(m)
+
+	data := []byte("some assembled file content")
+	tempName := fs.TempName("verifyblockshash")
+	if err := ioutil.WriteFile(filepath.Join("testdata", tempName), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filepath.Join("testdata", tempName))
+
+	fileBlocks, err := scanner.Blocks(context.TODO(), bytes.NewReader(data), protocol.MinBlockSize, int64(len(data)), nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := protocol.FileInfo{
+		Name:       "verifyblockshash",
+		Size:       int64(len(data)),
+		Blocks:     fileBlocks,
+		BlocksHash: protocol.BlocksHash(fileBlocks),
+	}
+
+	if err := f.verifyBlocksHash(tempName, file); err != nil {
+		t.Error("unexpected error:", err)
+	}
+
+	file.BlocksHash[0] ^= 0xff
+	if err := f.verifyBlocksHash(tempName, file); err == nil {
+		t.Error("expected an error for a mismatching blocks hash")
+	}
+}
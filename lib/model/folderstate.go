@@ -7,6 +7,7 @@
 package model
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/syncthing/syncthing/lib/events"
@@ -37,6 +38,32 @@ func (s folderState) String() string {
 	}
 }
 
+// folderStateFromString is the inverse of folderState.String, for states
+// requested over the API.
+func folderStateFromString(state string) (folderState, error) {
+	switch state {
+	case "idle":
+		return FolderIdle, nil
+	case "scanning":
+		return FolderScanning, nil
+	case "syncing":
+		return FolderSyncing, nil
+	case "error":
+		return FolderError, nil
+	default:
+		return 0, fmt.Errorf("unknown folder state %q", state)
+	}
+}
+
+// legalStateTransitions enumerates the transitions a folder makes by itself.
+// Forced transitions are validated against the same set.
+var legalStateTransitions = map[folderState][]folderState{
+	FolderIdle:     {FolderScanning, FolderSyncing, FolderError},
+	FolderScanning: {FolderIdle, FolderError},
+	FolderSyncing:  {FolderIdle, FolderError},
+	FolderError:    {FolderIdle, FolderScanning},
+}
+
 type stateTracker struct {
 	folderID string
 
@@ -94,6 +121,51 @@ func (s *stateTracker) getState() (current folderState, changed time.Time, err e
 	return
 }
 
+// forceState explicitly transitions the folder to the given state, for
+// recovery purposes such as clearing a stuck error state. Only transitions
+// the folder could make by itself are allowed, and the error state cannot be
+// entered this way as there is no error to go with it.
+func (s *stateTracker) forceState(newState folderState) error {
+	if newState == FolderError {
+		return fmt.Errorf("cannot force folder %s into the error state", s.folderID)
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if newState == s.current {
+		return nil
+	}
+
+	legal := false
+	for _, to := range legalStateTransitions[s.current] {
+		if to == newState {
+			legal = true
+			break
+		}
+	}
+	if !legal {
+		return fmt.Errorf("illegal state transition %s -> %s", s.current, newState)
+	}
+
+	eventData := map[string]interface{}{
+		"folder": s.folderID,
+		"to":     newState.String(),
+		"from":   s.current.String(),
+	}
+
+	if !s.changed.IsZero() {
+		eventData["duration"] = time.Since(s.changed).Seconds()
+	}
+
+	s.current = newState
+	s.err = nil
+	s.changed = time.Now()
+
+	events.Default.Log(events.StateChanged, eventData)
+	return nil
+}
+
 // setError sets the folder state to FolderError with the specified error or
 // to FolderIdle if the error is nil
 func (s *stateTracker) setError(err error) {
@@ -0,0 +1,89 @@
+// Copyright (C) 2018 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/events"
+)
+
+func TestFolderStateForce(t *testing.T) {
+	sub := events.Default.Subscribe(events.StateChanged)
+	defer events.Default.Unsubscribe(sub)
+
+	nextStateEvent := func() map[string]interface{} {
+		ev, err := sub.Poll(time.Second)
+		if err != nil {
+			t.Fatal("no state change event:", err)
+		}
+		return ev.Data.(map[string]interface{})
+	}
+
+	s := newStateTracker("default")
+
+	s.setState(FolderScanning)
+	data := nextStateEvent()
+	if state, _, _ := s.getState(); state.String() != data["to"].(string) {
+		t.Errorf("queried state %v does not match event %v", state, data["to"])
+	}
+
+	// Scanning never goes directly to syncing.
+	if err := s.forceState(FolderSyncing); err == nil {
+		t.Error("expected error forcing scanning -> syncing")
+	}
+	// There is no error to go with a forced error state.
+	if err := s.forceState(FolderError); err == nil {
+		t.Error("expected error forcing the error state")
+	}
+
+	s.setError(errors.New("something broke"))
+	nextStateEvent()
+	if state, _, err := s.getState(); state != FolderError || err == nil {
+		t.Errorf("expected error state, got %v, %v", state, err)
+	}
+
+	// A stuck error state can be forced back to idle, clearing the error.
+	if err := s.forceState(FolderIdle); err != nil {
+		t.Fatal(err)
+	}
+	data = nextStateEvent()
+	if data["from"].(string) != "error" || data["to"].(string) != "idle" {
+		t.Errorf("unexpected transition %v -> %v", data["from"], data["to"])
+	}
+	if state, _, err := s.getState(); state != FolderIdle || err != nil {
+		t.Errorf("expected clean idle state, got %v, %v", state, err)
+	}
+}
+
+func TestFolderStateModelAPI(t *testing.T) {
+	m := setUpModel()
+	m.StartFolder("default")
+	m.ServeBackground()
+	defer m.Stop()
+
+	if _, _, err := m.FolderState("nonexistent"); err == nil {
+		t.Error("expected error for unknown folder")
+	}
+	if err := m.ForceState("nonexistent", "idle"); err == nil {
+		t.Error("expected error for unknown folder")
+	}
+	if err := m.ForceState("default", "discombobulated"); err == nil {
+		t.Error("expected error for unknown state")
+	}
+
+	if err := m.ForceState("default", "scanning"); err != nil && err.Error() != "illegal state transition syncing -> scanning" {
+		t.Error(err)
+	}
+	if state, _, err := m.FolderState("default"); err != nil {
+		t.Error(err)
+	} else if state == "" {
+		t.Error("expected a state for a running folder")
+	}
+}
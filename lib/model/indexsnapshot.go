@@ -0,0 +1,142 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/syncthing/syncthing/lib/db"
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+// The index snapshot format is a magic number followed by uvarint length
+// prefixed, marshalled FileInfos. Records are written as they are iterated,
+// so snapshots of huge folders stream without buffering the whole index.
+const indexSnapshotMagic uint32 = 0x19c8fca2
+
+var errInvalidSnapshot = errors.New("invalid index snapshot")
+
+// SnapshotIndex writes a point-in-time copy of the folder's current global
+// index, with versions and block lists, to the given writer. Index updates
+// for the folder are blocked for the duration of the snapshot to keep it
+// consistent.
+func (m *Model) SnapshotIndex(folder string, w io.Writer) error {
+	m.fmut.RLock()
+	fset, ok := m.folderFiles[folder]
+	m.fmut.RUnlock()
+	if !ok {
+		return errFolderMissing
+	}
+
+	bw := bufio.NewWriter(w)
+
+	var magic [4]byte
+	binary.BigEndian.PutUint32(magic[:], indexSnapshotMagic)
+	if _, err := bw.Write(magic[:]); err != nil {
+		return err
+	}
+
+	var iterErr error
+	var sizeBuf [binary.MaxVarintLen64]byte
+	fset.WithGlobalConsistent(func(fi db.FileIntf) bool {
+		f := fi.(protocol.FileInfo)
+		bs, err := f.Marshal()
+		if err != nil {
+			iterErr = err
+			return false
+		}
+		n := binary.PutUvarint(sizeBuf[:], uint64(len(bs)))
+		if _, err := bw.Write(sizeBuf[:n]); err != nil {
+			iterErr = err
+			return false
+		}
+		if _, err := bw.Write(bs); err != nil {
+			iterErr = err
+			return false
+		}
+		return true
+	})
+	if iterErr != nil {
+		return iterErr
+	}
+
+	return bw.Flush()
+}
+
+// ReadIndexSnapshot reads a snapshot produced by SnapshotIndex, calling fn
+// for each contained FileInfo. Reading is streamed; only one record is held
+// in memory at a time.
+func ReadIndexSnapshot(r io.Reader, fn func(protocol.FileInfo) error) error {
+	br := bufio.NewReader(r)
+
+	var magic [4]byte
+	if _, err := io.ReadFull(br, magic[:]); err != nil {
+		return errInvalidSnapshot
+	}
+	if binary.BigEndian.Uint32(magic[:]) != indexSnapshotMagic {
+		return errInvalidSnapshot
+	}
+
+	var buf []byte
+	for {
+		size, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errInvalidSnapshot
+		}
+		if size > protocol.MaxMessageLen {
+			return errInvalidSnapshot
+		}
+		if uint64(cap(buf)) < size {
+			buf = make([]byte, size)
+		}
+		buf = buf[:size]
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return errInvalidSnapshot
+		}
+		var f protocol.FileInfo
+		if err := f.Unmarshal(buf); err != nil {
+			return errInvalidSnapshot
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+}
+
+// ImportIndexSnapshot reads a snapshot produced by SnapshotIndex and
+// inserts the contained files into the folder's index as local files. It is
+// intended for restoring a backed up index on the device that produced it.
+func (m *Model) ImportIndexSnapshot(folder string, r io.Reader) error {
+	m.fmut.RLock()
+	fset, ok := m.folderFiles[folder]
+	m.fmut.RUnlock()
+	if !ok {
+		return errFolderMissing
+	}
+
+	batch := make([]protocol.FileInfo, 0, maxBatchSizeFiles)
+	err := ReadIndexSnapshot(r, func(f protocol.FileInfo) error {
+		batch = append(batch, f)
+		if len(batch) == maxBatchSizeFiles {
+			fset.Update(protocol.LocalDeviceID, batch)
+			batch = batch[:0]
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		fset.Update(protocol.LocalDeviceID, batch)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+func TestIndexSnapshotRoundTrip(t *testing.T) {
+	files := []protocol.FileInfo{
+		{Name: "foo", Type: protocol.FileInfoTypeFile, Size: 0x20000, Blocks: blocks[1:2], Version: protocol.Vector{}.Update(protocol.LocalDeviceID.Short())},
+		{Name: "bar", Type: protocol.FileInfoTypeFile, Size: 0x20000, Blocks: blocks[2:3], Version: protocol.Vector{}.Update(protocol.LocalDeviceID.Short())},
+		{Name: "baz", Type: protocol.FileInfoTypeDirectory, Version: protocol.Vector{}.Update(protocol.LocalDeviceID.Short())},
+	}
+
+	m := setUpModel(files...)
+
+	var buf bytes.Buffer
+	if err := m.SnapshotIndex("default", &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The snapshot contains exactly the indexed files.
+	got := make(map[string]protocol.FileInfo)
+	if err := ReadIndexSnapshot(bytes.NewReader(buf.Bytes()), func(f protocol.FileInfo) error {
+		got[f.Name] = f
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(files) {
+		t.Fatalf("snapshot contains %d files, expected %d", len(got), len(files))
+	}
+	for _, f := range files {
+		g, ok := got[f.Name]
+		if !ok {
+			t.Errorf("%q missing from snapshot", f.Name)
+			continue
+		}
+		if !g.Version.Equal(f.Version) {
+			t.Errorf("%q version differs: %v != %v", f.Name, g.Version, f.Version)
+		}
+		if len(g.Blocks) != len(f.Blocks) {
+			t.Errorf("%q block count differs: %d != %d", f.Name, len(g.Blocks), len(f.Blocks))
+		}
+	}
+
+	// The snapshot round-trips through the import API.
+	m2 := setUpModel()
+	if err := m2.ImportIndexSnapshot("default", bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		g, ok := m2.CurrentFolderFile("default", f.Name)
+		if !ok {
+			t.Errorf("%q missing after import", f.Name)
+			continue
+		}
+		if !g.Version.Equal(f.Version) {
+			t.Errorf("%q version differs after import: %v != %v", f.Name, g.Version, f.Version)
+		}
+	}
+
+	// Unknown folders are an error.
+	if err := m.SnapshotIndex("nonexistent", ioutil.Discard); err != errFolderMissing {
+		t.Errorf("expected missing folder error, got %v", err)
+	}
+
+	// Garbage input is rejected.
+	if err := ReadIndexSnapshot(bytes.NewReader([]byte("not a snapshot")), func(protocol.FileInfo) error { return nil }); err != errInvalidSnapshot {
+		t.Errorf("expected invalid snapshot error, got %v", err)
+	}
+}
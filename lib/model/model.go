@@ -13,10 +13,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net"
+	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	stdsync "sync"
 	"time"
@@ -56,6 +60,7 @@ const (
 type service interface {
 	BringToFront(string)
 	Override(*db.FileSet, func([]protocol.FileInfo))
+	OverrideFile(*db.FileSet, string, func([]protocol.FileInfo))
 	Revert(*db.FileSet, func([]protocol.FileInfo))
 	DelayScan(d time.Duration)
 	IgnoresUpdated()            // ignore matcher was updated notification
@@ -69,6 +74,7 @@ type service interface {
 	WatchError() error
 
 	getState() (folderState, time.Time, error)
+	forceState(state folderState) error
 	setState(state folderState)
 	setError(err error)
 }
@@ -76,6 +82,7 @@ type service interface {
 type Availability struct {
 	ID            protocol.DeviceID `json:"id"`
 	FromTemporary bool              `json:"fromTemporary"`
+	Metered       bool              `json:"metered"`
 }
 
 type Model struct {
@@ -84,32 +91,47 @@ type Model struct {
 	cfg               *config.Wrapper
 	db                *db.Lowlevel
 	finder            *db.BlockFinder
+	partials          *db.PartialTracker
 	progressEmitter   *ProgressEmitter
 	id                protocol.DeviceID
 	shortID           protocol.ShortID
 	cacheIgnoredFiles bool
 	protectedFiles    []string
+	scanLimiter       *byteSemaphore // bounds concurrent folder scans; nil when unlimited
+	transferStatsRef  *stats.TransferStatisticsReference
 
 	clientName    string
 	clientVersion string
 
-	fmut               sync.RWMutex                                           // protects the below
-	folderCfgs         map[string]config.FolderConfiguration                  // folder -> cfg
-	folderFiles        map[string]*db.FileSet                                 // folder -> files
-	deviceStatRefs     map[protocol.DeviceID]*stats.DeviceStatisticsReference // deviceID -> statsRef
-	folderIgnores      map[string]*ignore.Matcher                             // folder -> matcher object
-	folderRunners      map[string]service                                     // folder -> puller or scanner
-	folderRunnerTokens map[string][]suture.ServiceToken                       // folder -> tokens for puller or scanner
-	folderStatRefs     map[string]*stats.FolderStatisticsReference            // folder -> statsRef
-	folderRestartMuts  syncMutexMap                                           // folder -> restart mutex
+	fmut                sync.RWMutex                                           // protects the below
+	folderCfgs          map[string]config.FolderConfiguration                  // folder -> cfg
+	folderFiles         map[string]*db.FileSet                                 // folder -> files
+	deviceStatRefs      map[protocol.DeviceID]*stats.DeviceStatisticsReference // deviceID -> statsRef
+	folderIgnores       map[string]*ignore.Matcher                             // folder -> matcher object
+	folderDeviceIgnores map[string]map[protocol.DeviceID]*ignore.Matcher       // folder -> device -> device scoped matcher
+	folderRunners       map[string]service                                     // folder -> puller or scanner
+	folderRunnerTokens  map[string][]suture.ServiceToken                       // folder -> tokens for puller or scanner
+	folderStatRefs      map[string]*stats.FolderStatisticsReference            // folder -> statsRef
+	confirmedDeletions  map[string]bool                                        // folder -> the next pull may exceed MaxDeleteRatio
+	folderRestartMuts   syncMutexMap                                           // folder -> restart mutex
 
 	pmut                sync.RWMutex // protects the below
 	conn                map[protocol.DeviceID]connections.Connection
+	secondaryConns      map[protocol.DeviceID][]connections.Connection // additional (multipath) connections, requests only
 	connRequestLimiters map[protocol.DeviceID]*byteSemaphore
 	closed              map[protocol.DeviceID]chan struct{}
 	helloMessages       map[protocol.DeviceID]protocol.HelloResult
 	deviceDownloads     map[protocol.DeviceID]*deviceDownloadState
-	remotePausedFolders map[protocol.DeviceID][]string // deviceID -> folders
+	remotePausedFolders map[protocol.DeviceID][]string            // deviceID -> folders
+	remoteFreeSpace     map[protocol.DeviceID]map[string]int64    // deviceID -> folder -> advertised free space in bytes
+	accountedTraffic    map[protocol.DeviceID]stats.TrafficCounts // deviceID -> traffic already folded into the persistent stats for the current connection
+
+	connTestMut    sync.Mutex                           // protects the below
+	lastConnTest   map[protocol.DeviceID]time.Time      // last outgoing connection test per device
+	connTestServed map[protocol.DeviceID]connTestBudget // synthetic test data served per device
+
+	encKeyMut sync.Mutex                         // protects the below
+	encKeys   map[string]*[protocol.KeySize]byte // derived folder encryption keys, by folder/device/password
 
 	foldersRunning int32 // for testing only
 }
@@ -125,8 +147,10 @@ var (
 	errDevicePaused      = errors.New("device is paused")
 	errDeviceIgnored     = errors.New("device is ignored")
 	ErrFolderPaused      = errors.New("folder is paused")
+	ErrRemoteDiskFull    = errors.New("remote device out of disk space")
 	errFolderNotRunning  = errors.New("folder is not running")
 	errFolderMissing     = errors.New("no such folder")
+	errNoVersioner       = errors.New("folder has no versioner")
 	errNetworkNotAllowed = errors.New("network not allowed")
 )
 
@@ -144,6 +168,7 @@ func NewModel(cfg *config.Wrapper, id protocol.DeviceID, clientName, clientVersi
 		cfg:                 cfg,
 		db:                  ldb,
 		finder:              db.NewBlockFinder(ldb),
+		partials:            db.NewPartialTracker(ldb),
 		progressEmitter:     NewProgressEmitter(cfg),
 		id:                  id,
 		shortID:             id.Short(),
@@ -155,21 +180,36 @@ func NewModel(cfg *config.Wrapper, id protocol.DeviceID, clientName, clientVersi
 		folderFiles:         make(map[string]*db.FileSet),
 		deviceStatRefs:      make(map[protocol.DeviceID]*stats.DeviceStatisticsReference),
 		folderIgnores:       make(map[string]*ignore.Matcher),
+		folderDeviceIgnores: make(map[string]map[protocol.DeviceID]*ignore.Matcher),
 		folderRunners:       make(map[string]service),
 		folderRunnerTokens:  make(map[string][]suture.ServiceToken),
 		folderStatRefs:      make(map[string]*stats.FolderStatisticsReference),
+		confirmedDeletions:  make(map[string]bool),
+		transferStatsRef:    stats.NewTransferStatisticsReference(ldb),
 		conn:                make(map[protocol.DeviceID]connections.Connection),
+		secondaryConns:      make(map[protocol.DeviceID][]connections.Connection),
 		connRequestLimiters: make(map[protocol.DeviceID]*byteSemaphore),
 		closed:              make(map[protocol.DeviceID]chan struct{}),
 		helloMessages:       make(map[protocol.DeviceID]protocol.HelloResult),
 		deviceDownloads:     make(map[protocol.DeviceID]*deviceDownloadState),
 		remotePausedFolders: make(map[protocol.DeviceID][]string),
+		remoteFreeSpace:     make(map[protocol.DeviceID]map[string]int64),
+		accountedTraffic:    make(map[protocol.DeviceID]stats.TrafficCounts),
+		lastConnTest:        make(map[protocol.DeviceID]time.Time),
+		connTestServed:      make(map[protocol.DeviceID]connTestBudget),
+		encKeys:             make(map[string]*[protocol.KeySize]byte),
 		fmut:                sync.NewRWMutex(),
 		pmut:                sync.NewRWMutex(),
+		connTestMut:         sync.NewMutex(),
+		encKeyMut:           sync.NewMutex(),
+	}
+	if max := cfg.Options().MaxConcurrentScans; max > 0 {
+		m.scanLimiter = newByteSemaphore(max)
 	}
 	if cfg.Options().ProgressUpdateIntervalS > -1 {
 		go m.progressEmitter.Serve()
 	}
+	go m.trafficAccountingLoop()
 	cfg.Subscribe(m)
 
 	return m
@@ -325,7 +365,7 @@ func (m *Model) addFolderLocked(cfg config.FolderConfiguration) {
 	folderFs := cfg.Filesystem()
 	m.folderFiles[cfg.ID] = db.NewFileSet(cfg.ID, folderFs, m.db)
 
-	ignores := ignore.New(folderFs, ignore.WithCache(m.cacheIgnoredFiles))
+	ignores := ignore.New(folderFs, ignore.WithCache(m.cacheIgnoredFiles), ignore.WithNested(cfg.NestedIgnores))
 	if err := ignores.Load(".stignore"); err != nil && !fs.IsNotExist(err) {
 		l.Warnln("Loading ignores:", err)
 	}
@@ -369,9 +409,11 @@ func (m *Model) tearDownFolderLocked(cfg config.FolderConfiguration) {
 	delete(m.folderCfgs, cfg.ID)
 	delete(m.folderFiles, cfg.ID)
 	delete(m.folderIgnores, cfg.ID)
+	delete(m.folderDeviceIgnores, cfg.ID)
 	delete(m.folderRunners, cfg.ID)
 	delete(m.folderRunnerTokens, cfg.ID)
 	delete(m.folderStatRefs, cfg.ID)
+	delete(m.confirmedDeletions, cfg.ID)
 }
 
 func (m *Model) RestartFolder(from, to config.FolderConfiguration) {
@@ -407,6 +449,41 @@ func (m *Model) RestartFolder(from, to config.FolderConfiguration) {
 	}
 }
 
+// RelocateFolder points the folder at a new root directory. If newRoot
+// does not exist the current folder directory is moved there, otherwise
+// the content is expected to have been moved there already. The folder is
+// restarted with the new path while keeping its database, so the
+// subsequent rescan verifies the content by metadata only instead of
+// rehashing everything.
+func (m *Model) RelocateFolder(folder, newRoot string) error {
+	fcfg, ok := m.cfg.Folder(folder)
+	if !ok {
+		return errFolderMissing
+	}
+
+	newFs := fs.NewFilesystem(fcfg.FilesystemType, newRoot)
+	if _, err := newFs.Stat("."); fs.IsNotExist(err) {
+		// The content hasn't been moved yet, so we move it.
+		if err := os.Rename(fcfg.Filesystem().URI(), newFs.URI()); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	fcfg.Path = newRoot
+	w, err := m.cfg.SetFolder(fcfg)
+	if err != nil {
+		return err
+	}
+	w.Wait()
+
+	// The database was kept across the restart, so this only rehashes
+	// files whose size or modification time changed in the move --
+	// normally none.
+	return m.ScanFolder(folder)
+}
+
 func (m *Model) UsageReportingStats(version int, preview bool) map[string]interface{} {
 	stats := make(map[string]interface{})
 	if version >= 3 {
@@ -594,6 +671,11 @@ func (m *Model) FolderStatistics() map[string]stats.FolderStatistics {
 	return res
 }
 
+// TransferStatistics returns the persistent transfer counters.
+func (m *Model) TransferStatistics() stats.TransferStatistics {
+	return m.transferStatsRef.GetStatistics()
+}
+
 type FolderCompletion struct {
 	CompletionPct float64
 	NeedBytes     int64
@@ -706,6 +788,17 @@ func (m *Model) LocalSize(folder string) db.Counts {
 	return db.Counts{}
 }
 
+// FolderUsage returns the current local size of the folder in bytes, as
+// counted by the scanner, and the configured maximum size. The maximum is
+// zero when the folder has no quota.
+func (m *Model) FolderUsage(folder string) (usage, max int64) {
+	usage = m.LocalSize(folder).Bytes
+	if fcfg, ok := m.cfg.Folder(folder); ok && !fcfg.MaxFolderSize.Percentage() {
+		max = int64(fcfg.MaxFolderSize.BaseValue())
+	}
+	return usage, max
+}
+
 // ReceiveOnlyChangedSize returns the number of files, deleted files and
 // total bytes for all files that have changed locally in a receieve only
 // folder.
@@ -809,6 +902,38 @@ func (m *Model) NeedFolderFiles(folder string, page, perpage int) ([]db.FileInfo
 	return progress, queued, rest
 }
 
+// LocalChangedFiles returns a paginated list of currently locally changed
+// files in a receive only folder.
+func (m *Model) LocalChangedFiles(folder string, page, perpage int) []db.FileInfoTruncated {
+	m.fmut.RLock()
+	defer m.fmut.RUnlock()
+
+	rf, ok := m.folderFiles[folder]
+	if !ok {
+		return nil
+	}
+
+	files := make([]db.FileInfoTruncated, 0, perpage)
+
+	skip := (page - 1) * perpage
+	get := perpage
+
+	rf.WithHaveTruncated(protocol.LocalDeviceID, func(f db.FileIntf) bool {
+		if f.FileLocalFlags()&protocol.FlagLocalReceiveOnly == 0 {
+			return true
+		}
+		if skip > 0 {
+			skip--
+			return true
+		}
+		files = append(files, f.(db.FileInfoTruncated))
+		get--
+		return get > 0
+	})
+
+	return files
+}
+
 // RemoteNeedFolderFiles returns paginated list of currently needed files in
 // progress, queued, and to be queued on next puller iteration, as well as the
 // total number of files currently needed.
@@ -894,10 +1019,17 @@ func (m *Model) handleIndex(deviceID protocol.DeviceID, folder string, fs []prot
 	if !update {
 		files.Drop(deviceID)
 	}
+	deviceIgnores := m.deviceIgnores(folder, deviceID)
 	for i := range fs {
 		// The local flags should never be transmitted over the wire. Make
 		// sure they look like they weren't.
 		fs[i].LocalFlags = 0
+		// Files that are ignored for this device are not expected to be
+		// announced by it. If they are anyway, mark them invalid so we
+		// will not pull them from this device.
+		if deviceIgnores.Match(fs[i].Name).IsIgnored() {
+			fs[i].RawInvalid = true
+		}
 	}
 	files.Update(deviceID, fs)
 
@@ -946,6 +1078,7 @@ func (m *Model) ClusterConfig(deviceID protocol.DeviceID, cm protocol.ClusterCon
 
 	m.fmut.Lock()
 	var paused []string
+	freeSpace := make(map[string]int64)
 	for _, folder := range cm.Folders {
 		cfg, ok := m.cfg.Folder(folder.ID)
 		if !ok || !cfg.SharedWith(deviceID) {
@@ -962,6 +1095,9 @@ func (m *Model) ClusterConfig(deviceID protocol.DeviceID, cm protocol.ClusterCon
 			l.Infof("Unexpected folder %s sent from device %q; ensure that the folder exists and that this device is selected under \"Share With\" in the folder configuration.", folder.Description(), deviceID)
 			continue
 		}
+		if folder.FreeSpace > 0 {
+			freeSpace[folder.ID] = folder.FreeSpace
+		}
 		if folder.Paused {
 			paused = append(paused, folder.ID)
 			continue
@@ -1050,11 +1186,16 @@ func (m *Model) ClusterConfig(deviceID protocol.DeviceID, cm protocol.ClusterCon
 			}
 		}
 
-		go sendIndexes(conn, folder.ID, fs, m.folderIgnores[folder.ID], startSequence, dbLocation, dropSymlinks)
+		go sendIndexes(conn, folder.ID, fs, m.folderIgnores[folder.ID], m.deviceIgnoresLocked(folder.ID, deviceID), startSequence, dbLocation, dropSymlinks)
 	}
 
 	m.pmut.Lock()
 	m.remotePausedFolders[deviceID] = paused
+	if len(freeSpace) > 0 {
+		m.remoteFreeSpace[deviceID] = freeSpace
+	} else {
+		delete(m.remoteFreeSpace, deviceID)
+	}
 	m.pmut.Unlock()
 
 	// This breaks if we send multiple CM messages during the same connection.
@@ -1119,8 +1260,11 @@ func (m *Model) handleIntroductions(introducerCfg config.DeviceConfiguration, cm
 			foldersDevices.set(device.ID, folder.ID)
 
 			if _, ok := m.cfg.Devices()[device.ID]; !ok {
-				// The device is currently unknown. Add it to the config.
-				m.introduceDevice(device, introducerCfg)
+				// The device is currently unknown. Add it to the config,
+				// unless the introducer's policy says otherwise.
+				if !m.introduceDevice(device, introducerCfg) {
+					continue
+				}
 			} else if fcfg.SharedWith(device.ID) {
 				// We already share the folder with this device, so
 				// nothing to do.
@@ -1205,14 +1349,33 @@ func (m *Model) handleDeintroductions(introducerCfg config.DeviceConfiguration,
 // AutoAcceptFolders set to true.
 func (m *Model) handleAutoAccepts(deviceCfg config.DeviceConfiguration, folder protocol.Folder) bool {
 	if cfg, ok := m.cfg.Folder(folder.ID); !ok {
-		defaultPath := m.cfg.Options().DefaultFolderPath
-		defaultPathFs := fs.NewFilesystem(fs.FilesystemTypeBasic, defaultPath)
-		for _, path := range []string{folder.Label, folder.ID} {
-			if _, err := defaultPathFs.Lstat(path); !fs.IsNotExist(err) {
+		var candidates []string
+		if tpl := deviceCfg.AutoAcceptPathTemplate; tpl != "" {
+			// The device has a path template configured; the expanded
+			// template is the only candidate location.
+			candidates = []string{expandAutoAcceptPath(tpl, deviceCfg, folder)}
+		} else {
+			defaultPath := m.cfg.Options().DefaultFolderPath
+			for _, name := range []string{folder.Label, folder.ID} {
+				candidates = append(candidates, filepath.Join(defaultPath, name))
+			}
+		}
+		reason := "path conflict"
+		for _, path := range candidates {
+			parentFs := fs.NewFilesystem(fs.FilesystemTypeBasic, filepath.Dir(path))
+			if _, err := parentFs.Lstat(filepath.Base(path)); !fs.IsNotExist(err) {
 				continue
 			}
 
-			fcfg := config.NewFolderConfiguration(m.id, folder.ID, folder.Label, fs.FilesystemTypeBasic, filepath.Join(defaultPath, path))
+			fcfg := config.NewFolderConfiguration(m.id, folder.ID, folder.Label, fs.FilesystemTypeBasic, path)
+			// The folder root doesn't exist yet, so check the free space
+			// where it would be created.
+			if usage, err := parentFs.Usage("."); err == nil {
+				if err := config.CheckFreeSpace(fcfg.MinDiskFree, usage); err != nil {
+					reason = "insufficient free space"
+					continue
+				}
+			}
 			fcfg.Devices = append(fcfg.Devices, config.FolderDeviceConfiguration{
 				DeviceID: deviceCfg.DeviceID,
 			})
@@ -1226,7 +1389,10 @@ func (m *Model) handleAutoAccepts(deviceCfg config.DeviceConfiguration, folder p
 			l.Infof("Auto-accepted %s folder %s at path %s", deviceCfg.DeviceID, folder.Description(), fcfg.Path)
 			return true
 		}
-		l.Infof("Failed to auto-accept folder %s from %s due to path conflict", folder.Description(), deviceCfg.DeviceID)
+		// The folder is left unaccepted; it ends up as a pending folder
+		// and a FolderRejected event further down in the ClusterConfig
+		// handling, which is as close to a decline as the protocol gets.
+		l.Infof("Failed to auto-accept folder %s from %s due to %s", folder.Description(), deviceCfg.DeviceID, reason)
 		return false
 	} else {
 		for _, device := range cfg.DeviceIDs() {
@@ -1245,7 +1411,58 @@ func (m *Model) handleAutoAccepts(deviceCfg config.DeviceConfiguration, folder p
 	}
 }
 
-func (m *Model) introduceDevice(device protocol.Device, introducerCfg config.DeviceConfiguration) {
+// expandAutoAcceptPath expands the %folderlabel%, %folderid%, %devicename%
+// and %deviceid% placeholders in an auto-accept path template. When the
+// folder has no label the ID is used for both, and likewise the device ID
+// stands in for a missing device name.
+func expandAutoAcceptPath(tpl string, deviceCfg config.DeviceConfiguration, folder protocol.Folder) string {
+	label := folder.Label
+	if label == "" {
+		label = folder.ID
+	}
+	name := deviceCfg.Name
+	if name == "" {
+		name = deviceCfg.DeviceID.String()
+	}
+	return strings.NewReplacer(
+		"%folderlabel%", label,
+		"%folderid%", folder.ID,
+		"%devicename%", name,
+		"%deviceid%", deviceCfg.DeviceID.String(),
+	).Replace(tpl)
+}
+
+// introduceDevice adds a device vouched for by an introducer to the config,
+// subject to the introducer's certificate name and device count policies. It
+// returns false when the device was refused.
+func (m *Model) introduceDevice(device protocol.Device, introducerCfg config.DeviceConfiguration) bool {
+	if len(introducerCfg.IntroducedCertNames) > 0 {
+		accepted := false
+		for _, name := range introducerCfg.IntroducedCertNames {
+			if name == device.CertName {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			l.Infof("Not adding device %v (vouched for by introducer %v): certificate name %q is not accepted from this introducer", device.ID, introducerCfg.DeviceID, device.CertName)
+			return false
+		}
+	}
+
+	if max := introducerCfg.MaxIntroducedDevices; max > 0 {
+		introduced := 0
+		for _, dev := range m.cfg.Devices() {
+			if dev.IntroducedBy == introducerCfg.DeviceID {
+				introduced++
+			}
+		}
+		if introduced >= max {
+			l.Infof("Not adding device %v: introducer %v has reached its limit of %d introduced devices", device.ID, introducerCfg.DeviceID, max)
+			return false
+		}
+	}
+
 	addresses := []string{"dynamic"}
 	for _, addr := range device.Addresses {
 		if addr != "dynamic" {
@@ -1271,6 +1488,7 @@ func (m *Model) introduceDevice(device protocol.Device, introducerCfg config.Dev
 	}
 
 	m.cfg.SetDevice(newDeviceCfg)
+	return true
 }
 
 // Closed is called when a connection has been closed
@@ -1281,16 +1499,31 @@ func (m *Model) Closed(conn protocol.Connection, err error) {
 	conn, ok := m.conn[device]
 	if ok {
 		m.progressEmitter.temporaryIndexUnsubscribe(conn)
+		// Fold the connection's remaining traffic into the persistent
+		// statistics before we lose track of the connection.
+		cs := conn.Statistics()
+		acc := m.accountedTraffic[device]
+		m.transferStatsRef.AddDeviceTraffic(device.String(), cs.InBytesTotal-acc.InBytes, cs.OutBytesTotal-acc.OutBytes)
 	}
+	delete(m.accountedTraffic, device)
 	delete(m.conn, device)
 	delete(m.connRequestLimiters, device)
 	delete(m.helloMessages, device)
 	delete(m.deviceDownloads, device)
 	delete(m.remotePausedFolders, device)
+	delete(m.remoteFreeSpace, device)
 	closed := m.closed[device]
 	delete(m.closed, device)
+	secondary := m.secondaryConns[device]
+	delete(m.secondaryConns, device)
 	m.pmut.Unlock()
 
+	// Take down any secondary connections along with the primary. Their
+	// close callbacks find nothing to remove, which is fine.
+	for _, sc := range secondary {
+		closeRawConn(sc)
+	}
+
 	l.Infof("Connection to %s at %s closed: %v", device, conn.Name(), err)
 	events.Default.Log(events.DeviceDisconnected, map[string]string{
 		"id":    device.String(),
@@ -1299,6 +1532,53 @@ func (m *Model) Closed(conn protocol.Connection, err error) {
 	close(closed)
 }
 
+const trafficAccountingInterval = time.Minute
+
+// trafficAccountingLoop periodically folds the traffic counters of live
+// connections into the persistent statistics and enforces the per-device
+// monthly traffic caps.
+func (m *Model) trafficAccountingLoop() {
+	t := time.NewTicker(trafficAccountingInterval)
+	defer t.Stop()
+	for range t.C {
+		m.accountTraffic()
+		m.enforceTrafficCaps()
+	}
+}
+
+// accountTraffic adds the not yet accounted part of each connection's
+// traffic counters to the persistent statistics.
+func (m *Model) accountTraffic() {
+	m.pmut.Lock()
+	for device, conn := range m.conn {
+		cs := conn.Statistics()
+		acc := m.accountedTraffic[device]
+		if in, out := cs.InBytesTotal-acc.InBytes, cs.OutBytesTotal-acc.OutBytes; in > 0 || out > 0 {
+			m.transferStatsRef.AddDeviceTraffic(device.String(), in, out)
+			m.accountedTraffic[device] = stats.TrafficCounts{InBytes: cs.InBytesTotal, OutBytes: cs.OutBytesTotal}
+		}
+	}
+	m.pmut.Unlock()
+}
+
+// enforceTrafficCaps pauses devices that have exchanged more data than
+// their configured monthly cap allows. Resuming when a new month starts is
+// up to the user.
+func (m *Model) enforceTrafficCaps() {
+	for id, dev := range m.cfg.Devices() {
+		max := dev.MaxMonthlyTraffic.BaseValue()
+		if max <= 0 || dev.MaxMonthlyTraffic.Percentage() || dev.Paused {
+			continue
+		}
+		t := m.transferStatsRef.DeviceTrafficThisMonth(id.String())
+		if float64(t.InBytes+t.OutBytes) >= max {
+			l.Infof("Pausing device %v: %d bytes exchanged this month is at or above the cap of %v", id, t.InBytes+t.OutBytes, dev.MaxMonthlyTraffic)
+			dev.Paused = true
+			m.cfg.SetDevice(dev)
+		}
+	}
+}
+
 // close will close the underlying connection for a given device
 func (m *Model) close(device protocol.DeviceID) {
 	m.pmut.Lock()
@@ -1348,11 +1628,16 @@ func (r *requestResponse) Wait() {
 
 // Request returns the specified data segment by reading it from local disk.
 // Implements the protocol.Model interface.
-func (m *Model) Request(deviceID protocol.DeviceID, folder, name string, size int32, offset int64, hash []byte, weakHash uint32, fromTemporary bool) (out protocol.RequestResponse, err error) {
-	if size < 0 || offset < 0 {
+func (m *Model) Request(deviceID protocol.DeviceID, folder, name string, blockNo int, size int32, offset int64, hash []byte, weakHash uint32, fromTemporary bool) (out protocol.RequestResponse, err error) {
+	if size < 0 || size > protocol.MaxBlockSize || offset < 0 {
 		return nil, protocol.ErrInvalid
 	}
 
+	if folder == "" && name == connTestName {
+		// A connection test; serve synthetic data from memory.
+		return m.connTestResponse(deviceID, int(size))
+	}
+
 	m.fmut.RLock()
 	folderCfg, ok := m.folderCfgs[folder]
 	folderIgnores := m.folderIgnores[folder]
@@ -1393,6 +1678,26 @@ func (m *Model) Request(deviceID protocol.DeviceID, folder, name string, size in
 		return nil, protocol.ErrNoSuchFile
 	}
 
+	if m.deviceIgnores(folder, deviceID).Match(name).IsIgnored() {
+		l.Debugf("%v REQ(in) for device ignored file: %s: %q / %q o=%d s=%d", m, deviceID, folder, name, offset, size)
+		return nil, protocol.ErrNoSuchFile
+	}
+
+	// If the device has advertised its free space for this folder and the
+	// requested file doesn't fit, decline to serve rather than waste
+	// effort on a transfer that is going to fail.
+	if free, ok := m.remoteFolderFreeSpace(deviceID, folder); ok {
+		if cf, ok := m.CurrentFolderFile(folder, name); ok && cf.Size > free {
+			l.Debugf("%v REQ(in) declined, remote disk full: %s: %q / %q o=%d s=%d", m, deviceID, folder, name, offset, size)
+			events.Default.Log(events.RemoteDiskFull, map[string]string{
+				"device": deviceID.String(),
+				"folder": folder,
+				"file":   name,
+			})
+			return nil, ErrRemoteDiskFull
+		}
+	}
+
 	folderFs := folderCfg.Filesystem()
 
 	if err := osutil.TraversesSymlink(folderFs, filepath.Dir(name)); err != nil {
@@ -1530,6 +1835,57 @@ func (m *Model) CurrentGlobalFile(folder string, file string) (protocol.FileInfo
 	return fs.GetGlobal(file)
 }
 
+// A FileHistoryEntry describes one device's announced version of a
+// file, as known to the database.
+type FileHistoryEntry struct {
+	Device     protocol.DeviceID `json:"device"`
+	Version    protocol.Vector   `json:"version"`
+	ModifiedBy string            `json:"modifiedBy"`
+	ModifiedAt time.Time         `json:"modifiedAt"`
+	Deleted    bool              `json:"deleted"`
+	Size       int64             `json:"size"`
+	Global     bool              `json:"global"`
+}
+
+// History returns what each device sharing the folder has announced
+// about the given file: version vector, modifying device and time, and
+// whether the file is deleted. The entry matching the global version is
+// marked as such. This answers questions like "which device deleted
+// this file" from the index data we already have.
+func (m *Model) History(folder, file string) ([]FileHistoryEntry, error) {
+	m.fmut.RLock()
+	fs, ok := m.folderFiles[folder]
+	m.fmut.RUnlock()
+	if !ok {
+		return nil, errFolderMissing
+	}
+
+	global, haveGlobal := fs.GetGlobal(file)
+
+	var hist []FileHistoryEntry
+	for _, devCfg := range m.cfg.Folders()[folder].Devices {
+		device := devCfg.DeviceID
+		fi, ok := fs.Get(device, file)
+		if !ok {
+			continue
+		}
+		hist = append(hist, FileHistoryEntry{
+			Device:     device,
+			Version:    fi.Version,
+			ModifiedBy: fi.ModifiedBy.String(),
+			ModifiedAt: fi.ModTime(),
+			Deleted:    fi.Deleted,
+			Size:       fi.Size,
+			Global:     haveGlobal && fi.Version.Equal(global.Version),
+		})
+	}
+
+	sort.Slice(hist, func(a, b int) bool {
+		return hist[a].ModifiedAt.After(hist[b].ModifiedAt)
+	})
+	return hist, nil
+}
+
 type cFiler struct {
 	m *Model
 	r string
@@ -1540,6 +1896,29 @@ func (cf cFiler) CurrentFile(file string) (protocol.FileInfo, bool) {
 	return cf.m.CurrentFolderFile(cf.r, file)
 }
 
+// inodeIndex remembers which name each inode was last scanned as, so the
+// scanner can recognize renamed or moved files and reuse their block lists
+// without rehashing. Implements scanner.InodeIndex.
+type inodeIndex struct {
+	kv *db.NamespacedKV
+}
+
+func newInodeIndex(ldb *db.Lowlevel, folder string) *inodeIndex {
+	return &inodeIndex{kv: db.NewNamespacedKV(ldb, "inode."+folder+".")}
+}
+
+func (i *inodeIndex) LookupInode(ino uint64) (string, bool) {
+	return i.kv.String(strconv.FormatUint(ino, 16))
+}
+
+func (i *inodeIndex) RecordInode(ino uint64, name string) {
+	key := strconv.FormatUint(ino, 16)
+	if cur, ok := i.kv.String(key); ok && cur == name {
+		return
+	}
+	i.kv.PutString(key, name)
+}
+
 // Connection returns the current connection for device, and a boolean whether a connection was found.
 func (m *Model) Connection(deviceID protocol.DeviceID) (connections.Connection, bool) {
 	m.pmut.RLock()
@@ -1551,6 +1930,37 @@ func (m *Model) Connection(deviceID protocol.DeviceID) (connections.Connection,
 	return cn, ok
 }
 
+// ConnectionCount returns the number of connections we currently have to
+// the given device, counting both the primary and any additional
+// (multipath) connections.
+func (m *Model) ConnectionCount(deviceID protocol.DeviceID) int {
+	m.pmut.RLock()
+	defer m.pmut.RUnlock()
+	count := len(m.secondaryConns[deviceID])
+	if _, ok := m.conn[deviceID]; ok {
+		count++
+	}
+	return count
+}
+
+// TestIgnores returns, for each given path, which ignore pattern decides
+// whether it is ignored in the given folder, using the folder's live
+// matcher.
+func (m *Model) TestIgnores(folder string, paths []string) ([]ignore.MatchExplanation, error) {
+	m.fmut.RLock()
+	ignores, ok := m.folderIgnores[folder]
+	m.fmut.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Folder %s does not exist", folder)
+	}
+
+	res := make([]ignore.MatchExplanation, len(paths))
+	for i, path := range paths {
+		res[i] = ignores.Explain(path)
+	}
+	return res, nil
+}
+
 func (m *Model) GetIgnores(folder string) ([]string, []string, error) {
 	m.fmut.RLock()
 	defer m.fmut.RUnlock()
@@ -1728,6 +2138,50 @@ func (m *Model) AddConnection(conn connections.Connection, hello protocol.HelloR
 	m.deviceWasSeen(deviceID)
 }
 
+// AddSecondaryConnection adds an additional (multipath) connection to an
+// already connected device. Secondary connections carry only request
+// traffic; index data is exchanged on the primary connection.
+func (m *Model) AddSecondaryConnection(conn connections.Connection, hello protocol.HelloResult) {
+	deviceID := conn.ID()
+
+	m.pmut.Lock()
+	if _, ok := m.conn[deviceID]; !ok {
+		// The primary connection went away while this one was being set
+		// up. Drop it; the dialer will start over.
+		m.pmut.Unlock()
+		closeRawConn(conn)
+		return
+	}
+	m.secondaryConns[deviceID] = append(m.secondaryConns[deviceID], conn)
+	conn.Start()
+	m.pmut.Unlock()
+
+	// The protocol requires a cluster config as the first message. The
+	// other side knows this is a secondary connection and drops it.
+	conn.ClusterConfig(protocol.ClusterConfig{})
+
+	l.Infof("Additional connection to %s at %s", deviceID, conn)
+}
+
+// RemoveSecondaryConnection drops a closed secondary connection from the
+// list. The device stays connected through its remaining connections.
+func (m *Model) RemoveSecondaryConnection(conn connections.Connection, err error) {
+	deviceID := conn.ID()
+
+	m.pmut.Lock()
+	conns := m.secondaryConns[deviceID]
+	for i := range conns {
+		if conns[i] == conn {
+			copy(conns[i:], conns[i+1:])
+			m.secondaryConns[deviceID] = conns[:len(conns)-1]
+			break
+		}
+	}
+	m.pmut.Unlock()
+
+	l.Infof("Additional connection to %s at %s closed: %v", deviceID, conn.Name(), err)
+}
+
 func (m *Model) DownloadProgress(device protocol.DeviceID, folder string, updates []protocol.FileDownloadProgressUpdate) {
 	m.fmut.RLock()
 	cfg, ok := m.folderCfgs[folder]
@@ -1749,6 +2203,16 @@ func (m *Model) DownloadProgress(device protocol.DeviceID, folder string, update
 	})
 }
 
+// remoteFolderFreeSpace returns the free space the given device has
+// advertised for a folder in its cluster config, and whether any
+// advertisement has been made.
+func (m *Model) remoteFolderFreeSpace(device protocol.DeviceID, folder string) (int64, bool) {
+	m.pmut.RLock()
+	free, ok := m.remoteFreeSpace[device][folder]
+	m.pmut.RUnlock()
+	return free, ok
+}
+
 func (m *Model) deviceStatRef(deviceID protocol.DeviceID) *stats.DeviceStatisticsReference {
 	m.fmut.Lock()
 	defer m.fmut.Unlock()
@@ -1782,7 +2246,7 @@ func (m *Model) receivedFile(folder string, file protocol.FileInfo) {
 	m.folderStatRef(folder).ReceivedFile(file.Name, file.IsDeleted())
 }
 
-func sendIndexes(conn protocol.Connection, folder string, fs *db.FileSet, ignores *ignore.Matcher, prevSequence int64, dbLocation string, dropSymlinks bool) {
+func sendIndexes(conn protocol.Connection, folder string, fs *db.FileSet, ignores, deviceIgnores *ignore.Matcher, prevSequence int64, dbLocation string, dropSymlinks bool) {
 	deviceID := conn.ID()
 	var err error
 
@@ -1790,7 +2254,7 @@ func sendIndexes(conn protocol.Connection, folder string, fs *db.FileSet, ignore
 	defer l.Debugf("Exiting sendIndexes for %s to %s at %s: %v", folder, deviceID, conn, err)
 
 	// We need to send one index, regardless of whether there is something to send or not
-	prevSequence, err = sendIndexTo(prevSequence, conn, folder, fs, ignores, dbLocation, dropSymlinks)
+	prevSequence, err = sendIndexTo(prevSequence, conn, folder, fs, ignores, deviceIgnores, dbLocation, dropSymlinks)
 
 	// Subscribe to LocalIndexUpdated (we have new information to send) and
 	// DeviceDisconnected (it might be us who disconnected, so we should
@@ -1813,7 +2277,7 @@ func sendIndexes(conn protocol.Connection, folder string, fs *db.FileSet, ignore
 			continue
 		}
 
-		prevSequence, err = sendIndexTo(prevSequence, conn, folder, fs, ignores, dbLocation, dropSymlinks)
+		prevSequence, err = sendIndexTo(prevSequence, conn, folder, fs, ignores, deviceIgnores, dbLocation, dropSymlinks)
 
 		// Wait a short amount of time before entering the next loop. If there
 		// are continuous changes happening to the local index, this gives us
@@ -1824,9 +2288,16 @@ func sendIndexes(conn protocol.Connection, folder string, fs *db.FileSet, ignore
 
 // sendIndexTo sends file infos with a sequence number higher than prevSequence and
 // returns the highest sent sequence number.
-func sendIndexTo(prevSequence int64, conn protocol.Connection, folder string, fs *db.FileSet, ignores *ignore.Matcher, dbLocation string, dropSymlinks bool) (int64, error) {
+func sendIndexTo(prevSequence int64, conn protocol.Connection, folder string, fs *db.FileSet, ignores, deviceIgnores *ignore.Matcher, dbLocation string, dropSymlinks bool) (int64, error) {
 	deviceID := conn.ID()
 	initial := prevSequence == 0
+
+	// Pick up changes to the device scoped ignore file; this is cheap
+	// when the file is unchanged.
+	if err := deviceIgnores.Load(deviceIgnoreFile(deviceID)); err != nil && !os.IsNotExist(err) {
+		l.Debugf("Loading device ignores for %s / %s: %v", folder, deviceID, err)
+	}
+
 	batch := newFileInfoBatch(nil)
 	batch.flushFn = func(fs []protocol.FileInfo) error {
 		l.Debugf("Sending indexes for %s to %s at %s: %d files (<%d bytes)", folder, deviceID, conn, len(batch.infos), batch.size)
@@ -1874,6 +2345,13 @@ func sendIndexTo(prevSequence int64, conn protocol.Connection, folder string, fs
 		}
 		f.LocalFlags = 0 // never sent externally
 
+		// Advertise files that are ignored for this particular device as
+		// invalid, so the device knows about them but will not consider
+		// us a source to pull them from.
+		if !f.RawInvalid && deviceIgnores.Match(f.Name).IsIgnored() {
+			f.RawInvalid = true
+		}
+
 		if dropSymlinks && f.IsSymlink() {
 			// Do not send index entries with symlinks to clients that can't
 			// handle it. Fixes issue #3802. Once both sides are upgraded, a
@@ -1985,18 +2463,31 @@ func (m *Model) diskChangeDetected(folderCfg config.FolderConfiguration, files [
 	}
 }
 
-func (m *Model) requestGlobal(deviceID protocol.DeviceID, folder, name string, offset int64, size int, hash []byte, weakHash uint32, fromTemporary bool) ([]byte, error) {
+func (m *Model) requestGlobal(deviceID protocol.DeviceID, folder, name string, blockNo int, offset int64, size int, hash []byte, weakHash uint32, fromTemporary bool, deltaHashes []byte) ([]byte, bool, error) {
+	if len(deltaHashes) > 0 && !m.cfg.Devices()[deviceID].DeltaTransfers {
+		// Delta transfers are negotiated per device.
+		deltaHashes = nil
+	}
+
 	m.pmut.RLock()
 	nc, ok := m.conn[deviceID]
+	if secs := m.secondaryConns[deviceID]; ok && len(secs) > 0 {
+		// Spread requests over the primary and any additional (multipath)
+		// connections. A request that fails on one connection is retried
+		// by the puller and will likely take another path.
+		if idx := rand.Intn(len(secs) + 1); idx > 0 {
+			nc = secs[idx-1]
+		}
+	}
 	m.pmut.RUnlock()
 
 	if !ok {
-		return nil, fmt.Errorf("requestGlobal: no such device: %s", deviceID)
+		return nil, false, fmt.Errorf("requestGlobal: no such device: %s", deviceID)
 	}
 
-	l.Debugf("%v REQ(out): %s: %q / %q o=%d s=%d h=%x wh=%x ft=%t", m, deviceID, folder, name, offset, size, hash, weakHash, fromTemporary)
+	l.Debugf("%v REQ(out): %s: %q / %q o=%d s=%d h=%x wh=%x ft=%t delta=%t", m, deviceID, folder, name, offset, size, hash, weakHash, fromTemporary, len(deltaHashes) > 0)
 
-	return nc.Request(folder, name, offset, size, hash, weakHash, fromTemporary)
+	return nc.Request(folder, name, blockNo, offset, size, hash, weakHash, fromTemporary, deltaHashes)
 }
 
 func (m *Model) ScanFolders() map[string]error {
@@ -2063,12 +2554,22 @@ func (m *Model) DelayScan(folder string, next time.Duration) {
 	runner.DelayScan(next)
 }
 
+// acquireScanSlot blocks until another folder scan may start, respecting
+// the maxConcurrentScans option. The returned release function must be
+// called when the scan is done.
+func (m *Model) acquireScanSlot() (release func()) {
+	if m.scanLimiter == nil {
+		return func() {}
+	}
+	m.scanLimiter.take(1)
+	return func() { m.scanLimiter.give(1) }
+}
+
 // numHashers returns the number of hasher routines to use for a given folder,
 // taking into account configuration and available CPU cores.
 func (m *Model) numHashers(folder string) int {
 	m.fmut.Lock()
 	folderCfg := m.folderCfgs[folder]
-	numFolders := len(m.folderCfgs)
 	m.fmut.Unlock()
 
 	if folderCfg.Hashers > 0 {
@@ -2083,13 +2584,10 @@ func (m *Model) numHashers(folder string) int {
 	}
 
 	// For other operating systems and architectures, lets try to get some
-	// work done... Divide the available CPU cores among the configured
-	// folders.
-	if perFolder := runtime.GOMAXPROCS(-1) / numFolders; perFolder > 0 {
-		return perFolder
-	}
-
-	return 1
+	// work done... Each folder gets enough workers to use all the cores;
+	// the scanner's shared hashing pool caps the total concurrency when
+	// several folders scan at once.
+	return runtime.GOMAXPROCS(-1)
 }
 
 // generateClusterConfig returns a ClusterConfigMessage that is correct for
@@ -2115,6 +2613,14 @@ func (m *Model) generateClusterConfig(device protocol.DeviceID) protocol.Cluster
 			Paused:             folderCfg.Paused,
 		}
 
+		// Advertise our free space so the other side can decline serving
+		// us files that cannot possibly fit.
+		if !folderCfg.Paused {
+			if usage, err := folderCfg.Filesystem().Usage("."); err == nil {
+				protocolFolder.FreeSpace = usage.Free
+			}
+		}
+
 		var fs *db.FileSet
 		if !folderCfg.Paused {
 			fs = m.folderFiles[folderCfg.ID]
@@ -2165,6 +2671,83 @@ func (m *Model) State(folder string) (string, time.Time, error) {
 	return state.String(), changed, err
 }
 
+// FolderNormalization returns the Unicode normalization form configured for
+// the given folder. It's called by the protocol layer for incoming names.
+func (m *Model) FolderNormalization(folder string) protocol.Normalization {
+	fcfg, ok := m.cfg.Folder(folder)
+	if !ok {
+		return protocol.NormalizationDefault
+	}
+	n, err := protocol.NormalizationFromString(fcfg.FilenameNormalization)
+	if err != nil {
+		l.Warnf("Folder %v: %v; using platform default", fcfg.Description(), err)
+		return protocol.NormalizationDefault
+	}
+	return n
+}
+
+// FolderEncryptionKey implements the protocol.FolderKeyProvider
+// interface. It returns the key for data exchanged with the given
+// untrusted device on the given folder, or nil when the folder is not
+// shared in encrypted mode with that device. Derived keys are cached, as
+// the key derivation is deliberately expensive.
+func (m *Model) FolderEncryptionKey(device protocol.DeviceID, folder string) *[protocol.KeySize]byte {
+	fcfg, ok := m.cfg.Folder(folder)
+	if !ok {
+		return nil
+	}
+	var password string
+	for _, dev := range fcfg.Devices {
+		if dev.DeviceID == device {
+			password = dev.EncryptionPassword
+			break
+		}
+	}
+	if password == "" {
+		return nil
+	}
+
+	cacheKey := folder + "/" + device.String() + "/" + password
+	m.encKeyMut.Lock()
+	defer m.encKeyMut.Unlock()
+	key, ok := m.encKeys[cacheKey]
+	if !ok {
+		key = protocol.KeyFromPassword(folder, password)
+		m.encKeys[cacheKey] = key
+	}
+	return key
+}
+
+// FolderState is like State, but returns an error when the folder is
+// unknown or not running rather than pretending an idle folder exists.
+func (m *Model) FolderState(folder string) (string, time.Time, error) {
+	m.fmut.RLock()
+	runner, ok := m.folderRunners[folder]
+	m.fmut.RUnlock()
+	if !ok {
+		return "", time.Time{}, errFolderMissing
+	}
+	state, changed, _ := runner.getState()
+	return state.String(), changed, nil
+}
+
+// ForceState transitions the given folder to the given state, for recovery
+// purposes such as clearing a stuck error state. The transition must be one
+// the folder could make by itself.
+func (m *Model) ForceState(folder, state string) error {
+	m.fmut.RLock()
+	runner, ok := m.folderRunners[folder]
+	m.fmut.RUnlock()
+	if !ok {
+		return errFolderMissing
+	}
+	target, err := folderStateFromString(state)
+	if err != nil {
+		return err
+	}
+	return runner.forceState(target)
+}
+
 func (m *Model) FolderErrors(folder string) ([]FileError, error) {
 	m.fmut.RLock()
 	defer m.fmut.RUnlock()
@@ -2201,6 +2784,27 @@ func (m *Model) Override(folder string) {
 	})
 }
 
+// OverrideFile is Override restricted to a single file, so a send only
+// folder can reject an individual remote change instead of stomping the
+// whole folder back to the local state.
+func (m *Model) OverrideFile(folder, file string) {
+	// Grab the runner and the file set.
+
+	m.fmut.RLock()
+	fs, fsOK := m.folderFiles[folder]
+	runner, runnerOK := m.folderRunners[folder]
+	m.fmut.RUnlock()
+	if !fsOK || !runnerOK {
+		return
+	}
+
+	// Run the override, taking updates as if they came from scanning.
+
+	runner.OverrideFile(fs, file, func(files []protocol.FileInfo) {
+		m.updateLocalsFromScanning(folder, files)
+	})
+}
+
 func (m *Model) Revert(folder string) {
 	// Grab the runner and the file set.
 
@@ -2219,6 +2823,38 @@ func (m *Model) Revert(folder string) {
 	})
 }
 
+// ConfirmDeletions allows the next pull of the given folder to proceed even
+// if it would delete more files than the folder's maximum delete ratio
+// allows. The confirmation covers a single pull.
+func (m *Model) ConfirmDeletions(folder string) error {
+	m.fmut.Lock()
+	_, ok := m.folderCfgs[folder]
+	if ok {
+		m.confirmedDeletions[folder] = true
+	}
+	runner, running := m.folderRunners[folder]
+	m.fmut.Unlock()
+
+	if !ok {
+		return fmt.Errorf("Folder %s does not exist", folder)
+	}
+	if running {
+		runner.SchedulePull()
+	}
+	return nil
+}
+
+// consumeDeletionConfirmation reports whether deletions beyond the maximum
+// delete ratio have been confirmed for the folder, and clears the
+// confirmation.
+func (m *Model) consumeDeletionConfirmation(folder string) bool {
+	m.fmut.Lock()
+	ok := m.confirmedDeletions[folder]
+	delete(m.confirmedDeletions, folder)
+	m.fmut.Unlock()
+	return ok
+}
+
 // CurrentSequence returns the change version for the given folder.
 // This is guaranteed to increment if the contents of the local folder has
 // changed.
@@ -2322,6 +2958,92 @@ func (m *Model) GlobalDirectoryTree(folder, prefix string, levels int, dirsonly
 	return output
 }
 
+// A GlobalListItem is one entry in a paginated directory listing of the
+// global tree, carrying enough metadata for a browsing GUI without the
+// file needing to exist locally.
+type GlobalListItem struct {
+	Name         string              `json:"name"`
+	Type         string              `json:"type"` // file, directory or symlink
+	Size         int64               `json:"size"`
+	ModTime      time.Time           `json:"modTime"`
+	Availability []protocol.DeviceID `json:"availability"`
+}
+
+// GlobalDirectoryListing returns the direct children of prefix in the
+// global tree, with name, size, modification time and the devices that
+// have each entry. A perpage of zero or less returns everything;
+// otherwise entries (page-1)*perpage through page*perpage-1 are
+// returned.
+func (m *Model) GlobalDirectoryListing(folder, prefix string, page, perpage int) ([]GlobalListItem, error) {
+	m.fmut.RLock()
+	files, ok := m.folderFiles[folder]
+	m.fmut.RUnlock()
+	if !ok {
+		return nil, errFolderMissing
+	}
+
+	sep := string(filepath.Separator)
+	prefix = osutil.NativeFilename(prefix)
+	if prefix != "" && !strings.HasSuffix(prefix, sep) {
+		prefix = prefix + sep
+	}
+
+	skip := 0
+	get := -1
+	if perpage > 0 {
+		skip = (page - 1) * perpage
+		get = perpage
+	}
+
+	var list []GlobalListItem
+	files.WithPrefixedGlobalTruncated(prefix, func(fi db.FileIntf) bool {
+		f := fi.(db.FileInfoTruncated)
+
+		// Don't include the prefix itself.
+		if f.IsInvalid() || f.IsDeleted() || strings.HasPrefix(prefix, f.Name) {
+			return true
+		}
+
+		// Only direct children of the prefix; deeper entries belong to
+		// a later request with a longer prefix.
+		name := strings.Replace(f.Name, prefix, "", 1)
+		if strings.Contains(name, sep) {
+			return true
+		}
+
+		if skip > 0 {
+			skip--
+			return true
+		}
+
+		typ := "file"
+		switch {
+		case f.IsSymlink():
+			typ = "symlink"
+		case f.IsDirectory():
+			typ = "directory"
+		}
+
+		list = append(list, GlobalListItem{
+			Name:         name,
+			Type:         typ,
+			Size:         f.FileSize(),
+			ModTime:      f.ModTime(),
+			Availability: files.Availability(f.Name),
+		})
+
+		if get > 0 {
+			get--
+			if get == 0 {
+				return false
+			}
+		}
+		return true
+	})
+
+	return list, nil
+}
+
 func (m *Model) GetFolderVersions(folder string) (map[string][]versioner.FileVersion, error) {
 	fcfg, ok := m.cfg.Folder(folder)
 	if !ok {
@@ -2351,20 +3073,24 @@ func (m *Model) GetFolderVersions(folder string) (map[string][]versioner.FileVer
 		path = strings.TrimPrefix(path, ".stversions"+string(fs.PathSeparator))
 
 		name, tag := versioner.UntagFilename(path)
-		// Something invalid
+		var versionTime time.Time
 		if name == "" || tag == "" {
-			return nil
+			// Untagged files in the versions folder come from the trashcan
+			// versioner, which sets the mtime to the time of archiving.
+			name = path
+			versionTime = f.ModTime().Truncate(time.Second)
+		} else {
+			versionTime, err = time.ParseInLocation(versioner.TimeFormat, tag, locationLocal)
+			if err != nil {
+				return nil
+			}
+			versionTime = versionTime.Truncate(time.Second)
 		}
 
 		name = osutil.NormalizedFilename(name)
 
-		versionTime, err := time.ParseInLocation(versioner.TimeFormat, tag, locationLocal)
-		if err != nil {
-			return nil
-		}
-
 		files[name] = append(files[name], versioner.FileVersion{
-			VersionTime: versionTime.Truncate(time.Second),
+			VersionTime: versionTime,
 			ModTime:     f.ModTime().Truncate(time.Second),
 			Size:        f.Size(),
 		})
@@ -2377,6 +3103,36 @@ func (m *Model) GetFolderVersions(folder string) (map[string][]versioner.FileVer
 	return files, nil
 }
 
+func (m *Model) GetFileVersions(folder, file string) ([]versioner.FileVersion, error) {
+	fcfg, ok := m.cfg.Folder(folder)
+	if !ok {
+		return nil, errFolderMissing
+	}
+	ver := fcfg.Versioner()
+	if ver == nil {
+		return nil, errNoVersioner
+	}
+	return ver.List(file)
+}
+
+func (m *Model) RestoreFileVersion(folder, file string, versionTime time.Time) error {
+	fcfg, ok := m.cfg.Folder(folder)
+	if !ok {
+		return errFolderMissing
+	}
+	ver := fcfg.Versioner()
+	if ver == nil {
+		return errNoVersioner
+	}
+	if err := ver.Restore(file, versionTime); err != nil {
+		return err
+	}
+	if !fcfg.FSWatcherEnabled {
+		m.ScanFolderSubdirs(folder, []string{file})
+	}
+	return nil
+}
+
 func (m *Model) RestoreFolderVersions(folder string, versions map[string]time.Time) (map[string]string, error) {
 	fcfg, ok := m.cfg.Folder(folder)
 	if !ok {
@@ -2396,7 +3152,17 @@ func (m *Model) RestoreFolderVersions(folder string, versions map[string]time.Ti
 		versionedTaggedFilename := filepath.Join(".stversions", versioner.TagFilename(file, tag))
 		// Check that the thing we've been asked to restore is actually a file
 		// and that it exists.
-		if info, err := filesystem.Lstat(versionedTaggedFilename); err != nil {
+		info, err := filesystem.Lstat(versionedTaggedFilename)
+		if err != nil {
+			// Not there under a tagged name; the trashcan versioner
+			// archives under the plain name, with the archive time as the
+			// mtime.
+			untagged := filepath.Join(".stversions", file)
+			if uinfo, uerr := filesystem.Lstat(untagged); uerr == nil && uinfo.ModTime().Truncate(time.Second).Equal(version.In(locationLocal).Truncate(time.Second)) {
+				versionedTaggedFilename, info, err = untagged, uinfo, nil
+			}
+		}
+		if err != nil {
 			errors[file] = err.Error()
 			continue
 		} else if !info.IsRegular() {
@@ -2421,6 +3187,18 @@ func (m *Model) RestoreFolderVersions(folder string, versions map[string]time.Ti
 	var err error
 	for target, source := range restore {
 		err = nil
+
+		// Archiving the current file might land on the very version we're
+		// about to restore: the trashcan versioner always archives under
+		// the plain name, and tagged versioners collide when archive and
+		// restore happen within the same second. Move the version aside
+		// first.
+		tmp := fs.TempName(source)
+		if err := osutil.TryRename(filesystem, source, tmp); err != nil {
+			errors[target] = err.Error()
+			continue
+		}
+
 		if _, serr := filesystem.Lstat(target); serr == nil {
 			if ver != nil {
 				err = osutil.InWritableDir(ver.Archive, filesystem, target)
@@ -2431,7 +3209,17 @@ func (m *Model) RestoreFolderVersions(folder string, versions map[string]time.Ti
 
 		filesystem.MkdirAll(filepath.Dir(target), 0755)
 		if err == nil {
-			err = osutil.Copy(filesystem, source, target)
+			err = osutil.Copy(filesystem, tmp, target)
+		}
+		if err == nil {
+			if _, serr := filesystem.Lstat(source); serr == nil {
+				// Archiving the replaced file reused the source name; the
+				// restored version is consumed.
+				filesystem.Remove(tmp)
+			} else {
+				// Put the archived version back where it was.
+				osutil.TryRename(filesystem, tmp, source)
+			}
 		}
 
 		if err != nil {
@@ -2475,19 +3263,38 @@ next:
 		}
 		_, ok := m.conn[device]
 		if ok {
-			availabilities = append(availabilities, Availability{ID: device, FromTemporary: false})
+			availabilities = append(availabilities, Availability{ID: device, FromTemporary: false, Metered: m.deviceIsMeteredLocked(device)})
 		}
 	}
 
 	for _, device := range cfg.Devices {
 		if m.deviceDownloads[device.DeviceID].Has(folder, file.Name, file.Version, int32(block.Offset/int64(file.BlockSize()))) {
-			availabilities = append(availabilities, Availability{ID: device.DeviceID, FromTemporary: true})
+			availabilities = append(availabilities, Availability{ID: device.DeviceID, FromTemporary: true, Metered: m.deviceIsMeteredLocked(device.DeviceID)})
 		}
 	}
 
 	return availabilities
 }
 
+// deviceIsMeteredLocked returns whether the current connection to the
+// device goes over a network the user has configured as metered. Must
+// be called with pmut held (read or write).
+func (m *Model) deviceIsMeteredLocked(device protocol.DeviceID) bool {
+	networks := m.cfg.Options().MeteredNetworks
+	if len(networks) == 0 {
+		return false
+	}
+	conn, ok := m.conn[device]
+	if !ok {
+		return false
+	}
+	addr := conn.RemoteAddr()
+	if addr == nil {
+		return false
+	}
+	return connections.IsAllowedNetwork(addr.String(), networks)
+}
+
 // BringToFront bumps the given files priority in the job queue.
 func (m *Model) BringToFront(folder, file string) {
 	m.pmut.RLock()
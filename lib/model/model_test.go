@@ -184,7 +184,7 @@ func TestRequest(t *testing.T) {
 	m.ScanFolder("default")
 
 	// Existing, shared file
-	res, err := m.Request(device1, "default", "foo", 6, 0, nil, 0, false)
+	res, err := m.Request(device1, "default", "foo", 0, 6, 0, nil, 0, false)
 	if err != nil {
 		t.Error(err)
 	}
@@ -194,31 +194,31 @@ func TestRequest(t *testing.T) {
 	}
 
 	// Existing, nonshared file
-	_, err = m.Request(device2, "default", "foo", 6, 0, nil, 0, false)
+	_, err = m.Request(device2, "default", "foo", 0, 6, 0, nil, 0, false)
 	if err == nil {
 		t.Error("Unexpected nil error on insecure file read")
 	}
 
 	// Nonexistent file
-	_, err = m.Request(device1, "default", "nonexistent", 6, 0, nil, 0, false)
+	_, err = m.Request(device1, "default", "nonexistent", 0, 6, 0, nil, 0, false)
 	if err == nil {
 		t.Error("Unexpected nil error on insecure file read")
 	}
 
 	// Shared folder, but disallowed file name
-	_, err = m.Request(device1, "default", "../walk.go", 6, 0, nil, 0, false)
+	_, err = m.Request(device1, "default", "../walk.go", 0, 6, 0, nil, 0, false)
 	if err == nil {
 		t.Error("Unexpected nil error on insecure file read")
 	}
 
 	// Negative offset
-	_, err = m.Request(device1, "default", "foo", -4, 0, nil, 0, false)
+	_, err = m.Request(device1, "default", "foo", 0, -4, 0, nil, 0, false)
 	if err == nil {
 		t.Error("Unexpected nil error on insecure file read")
 	}
 
 	// Larger block than available
-	_, err = m.Request(device1, "default", "foo", 42, 0, nil, 0, false)
+	_, err = m.Request(device1, "default", "foo", 0, 42, 0, nil, 0, false)
 	if err == nil {
 		t.Error("Unexpected nil error on insecure file read")
 	}
@@ -360,13 +360,14 @@ func (f *fakeConnection) IndexUpdate(folder string, fs []protocol.FileInfo) erro
 	return nil
 }
 
-func (f *fakeConnection) Request(folder, name string, offset int64, size int, hash []byte, weakHash uint32, fromTemporary bool) ([]byte, error) {
+func (f *fakeConnection) Request(folder, name string, blockNo int, offset int64, size int, hash []byte, weakHash uint32, fromTemporary bool, deltaHashes []byte) ([]byte, bool, error) {
 	f.mut.Lock()
 	defer f.mut.Unlock()
 	if f.requestFn != nil {
-		return f.requestFn(folder, name, offset, size, hash, fromTemporary)
+		data, err := f.requestFn(folder, name, offset, size, hash, fromTemporary)
+		return data, false, err
 	}
-	return f.fileData[name], nil
+	return f.fileData[name], false, nil
 }
 
 func (f *fakeConnection) ClusterConfig(protocol.ClusterConfig) {}
@@ -505,7 +506,7 @@ func BenchmarkRequestOut(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		data, err := m.requestGlobal(device1, "default", files[i%n].Name, 0, 32, nil, 0, false)
+		data, _, err := m.requestGlobal(device1, "default", files[i%n].Name, 0, 0, 32, nil, 0, false, nil)
 		if err != nil {
 			b.Error(err)
 		}
@@ -533,7 +534,7 @@ func BenchmarkRequestInSingleFile(b *testing.B) {
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		if _, err := m.Request(device1, "default", "request/for/a/file/in/a/couple/of/dirs/128k", 128<<10, 0, nil, 0, false); err != nil {
+		if _, err := m.Request(device1, "default", "request/for/a/file/in/a/couple/of/dirs/128k", 0, 128<<10, 0, nil, 0, false); err != nil {
 			b.Error(err)
 		}
 	}
@@ -1079,6 +1080,107 @@ func TestIntroducer(t *testing.T) {
 	}
 }
 
+func TestIntroducerCertNamePolicy(t *testing.T) {
+	wcfg, m := newState(config.Configuration{
+		Devices: []config.DeviceConfiguration{
+			{
+				DeviceID:            device1,
+				Introducer:          true,
+				IntroducedCertNames: []string{"syncthing"},
+			},
+		},
+		Folders: []config.FolderConfiguration{
+			{
+				ID:   "folder1",
+				Path: "testdata",
+				Devices: []config.FolderDeviceConfiguration{
+					{DeviceID: device1},
+				},
+			},
+		},
+	})
+	defer os.Remove(wcfg.ConfigPath())
+	m.ClusterConfig(device1, protocol.ClusterConfig{
+		Folders: []protocol.Folder{
+			{
+				ID: "folder1",
+				Devices: []protocol.Device{
+					{
+						ID:       device2,
+						CertName: "notsyncthing",
+					},
+				},
+			},
+		},
+	})
+
+	if _, ok := wcfg.Device(device2); ok {
+		t.Error("device 2 should not have been added, wrong certificate name")
+	}
+
+	m.ClusterConfig(device1, protocol.ClusterConfig{
+		Folders: []protocol.Folder{
+			{
+				ID: "folder1",
+				Devices: []protocol.Device{
+					{
+						ID:       device2,
+						CertName: "syncthing",
+					},
+				},
+			},
+		},
+	})
+
+	if _, ok := wcfg.Device(device2); !ok {
+		t.Error("device 2 should have been added, accepted certificate name")
+	}
+}
+
+func TestIntroducerDeviceLimit(t *testing.T) {
+	wcfg, m := newState(config.Configuration{
+		Devices: []config.DeviceConfiguration{
+			{
+				DeviceID:             device1,
+				Introducer:           true,
+				MaxIntroducedDevices: 1,
+			},
+			{
+				DeviceID:     device2,
+				IntroducedBy: device1,
+			},
+		},
+		Folders: []config.FolderConfiguration{
+			{
+				ID:   "folder1",
+				Path: "testdata",
+				Devices: []config.FolderDeviceConfiguration{
+					{DeviceID: device1},
+					{DeviceID: device2, IntroducedBy: device1},
+				},
+			},
+		},
+	})
+	defer os.Remove(wcfg.ConfigPath())
+
+	device3, _ := protocol.DeviceIDFromString("LGFPDIT-7SKNNJL-VJZA4FC-7QNCRKA-CE753K7-2BW5QDK-2FOZ7FR-FEP57QJ")
+	m.ClusterConfig(device1, protocol.ClusterConfig{
+		Folders: []protocol.Folder{
+			{
+				ID: "folder1",
+				Devices: []protocol.Device{
+					{ID: device2},
+					{ID: device3},
+				},
+			},
+		},
+	})
+
+	if _, ok := wcfg.Device(device3); ok {
+		t.Error("device 3 should not have been added, introducer over limit")
+	}
+}
+
 func TestIssue4897(t *testing.T) {
 	wcfg, m := newState(config.Configuration{
 		Devices: []config.DeviceConfiguration{
@@ -1487,6 +1589,73 @@ func TestAutoAcceptFallsBackToID(t *testing.T) {
 	}
 }
 
+func TestAutoAcceptPathTemplate(t *testing.T) {
+	// A configured path template overrides the default folder path.
+	tcfg := defaultAutoAcceptCfg.Copy()
+	tcfg.Devices[1].AutoAcceptPathTemplate = filepath.Join("testdata", "%folderlabel%-%folderid%")
+	wcfg, m := newState(tcfg)
+	defer os.Remove(wcfg.ConfigPath())
+	id := srand.String(8)
+	label := srand.String(8)
+	defer os.RemoveAll(filepath.Join("testdata", label+"-"+id))
+	m.ClusterConfig(device1, protocol.ClusterConfig{
+		Folders: []protocol.Folder{
+			{
+				ID:    id,
+				Label: label,
+			},
+		},
+	})
+	if fcfg, ok := wcfg.Folder(id); !ok || !fcfg.SharedWith(device1) || !strings.HasSuffix(fcfg.Path, label+"-"+id) {
+		t.Error("expected shared, or wrong path", id, label, fcfg.Path)
+	}
+}
+
+func TestAutoAcceptPathTemplateDeviceName(t *testing.T) {
+	// The template may refer to the sending device.
+	tcfg := defaultAutoAcceptCfg.Copy()
+	tcfg.Devices[1].Name = "mydevice"
+	tcfg.Devices[1].AutoAcceptPathTemplate = filepath.Join("testdata", "%devicename%", "%folderid%")
+	wcfg, m := newState(tcfg)
+	defer os.Remove(wcfg.ConfigPath())
+	id := srand.String(8)
+	defer os.RemoveAll(filepath.Join("testdata", "mydevice"))
+	m.ClusterConfig(device1, protocol.ClusterConfig{
+		Folders: []protocol.Folder{
+			{
+				ID: id,
+			},
+		},
+	})
+	if fcfg, ok := wcfg.Folder(id); !ok || !fcfg.SharedWith(device1) || !strings.HasSuffix(fcfg.Path, filepath.Join("mydevice", id)) {
+		t.Error("expected shared, or wrong path", id, fcfg.Path)
+	}
+}
+
+func TestAutoAcceptPathTemplateConflict(t *testing.T) {
+	// With a template there is only one candidate path; an existing
+	// directory there means the folder is not accepted.
+	tcfg := defaultAutoAcceptCfg.Copy()
+	tcfg.Devices[1].AutoAcceptPathTemplate = filepath.Join("testdata", "%folderlabel%")
+	wcfg, m := newState(tcfg)
+	defer os.Remove(wcfg.ConfigPath())
+	id := srand.String(8)
+	label := srand.String(8)
+	os.MkdirAll(filepath.Join("testdata", label), 0777)
+	defer os.RemoveAll(filepath.Join("testdata", label))
+	m.ClusterConfig(device1, protocol.ClusterConfig{
+		Folders: []protocol.Folder{
+			{
+				ID:    id,
+				Label: label,
+			},
+		},
+	})
+	if _, ok := wcfg.Folder(id); ok {
+		t.Error("unexpected auto accepted folder", id)
+	}
+}
+
 func TestAutoAcceptPausedWhenFolderConfigChanged(t *testing.T) {
 	// Existing folder
 	id := srand.String(8)
@@ -3362,6 +3531,10 @@ func TestVersionRestore(t *testing.T) {
 		"dir/file.txt":           3,
 		"dir/existing.txt":       1,
 		"very/very/deep/one.txt": 1,
+		// Untagged files are listed under their literal names, as the
+		// trashcan versioner archives them that way.
+		"dir/file.txt~20171210-040405": 1,
+		"dir/cat":                      1,
 	}
 
 	for name, vers := range versions {
@@ -3759,9 +3932,22 @@ func (c *alwaysChanged) Changed() bool {
 }
 
 func TestRequestLimit(t *testing.T) {
+	file := "tmpfile"
+
+	// The folder lives on a fake filesystem, which is registered under its
+	// URI so we can reach in and create the file to request.
+	ffs := fs.NewFilesystem(fs.FilesystemTypeFake, "/requestlimit")
+	fd, err := ffs.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.Truncate(2000)
+	fd.Close()
+
 	cfg := defaultCfg.Copy()
 	cfg.Devices = append(cfg.Devices, config.NewDeviceConfiguration(device2, "device2"))
 	cfg.Devices[1].MaxRequestKiB = 1
+	cfg.Folders[0] = config.NewFolderConfiguration(protocol.LocalDeviceID, "default", "default", fs.FilesystemTypeFake, "/requestlimit")
 	cfg.Folders[0].Devices = []config.FolderDeviceConfiguration{
 		{DeviceID: device1},
 		{DeviceID: device2},
@@ -3770,16 +3956,15 @@ func TestRequestLimit(t *testing.T) {
 	defer m.Stop()
 	defer os.Remove(wrapper.ConfigPath())
 
-	file := "tmpfile"
 	befReq := time.Now()
-	first, err := m.Request(device2, "default", file, 2000, 0, nil, 0, false)
+	first, err := m.Request(device2, "default", file, 0, 2000, 0, nil, 0, false)
 	if err != nil {
 		t.Fatalf("First request failed: %v", err)
 	}
 	reqDur := time.Since(befReq)
 	returned := make(chan struct{})
 	go func() {
-		second, err := m.Request(device2, "default", file, 2000, 0, nil, 0, false)
+		second, err := m.Request(device2, "default", file, 0, 2000, 0, nil, 0, false)
 		if err != nil {
 			t.Fatalf("Second request failed: %v", err)
 		}
@@ -3799,3 +3984,360 @@ func TestRequestLimit(t *testing.T) {
 		t.Fatalf("Second request did not return after first was done")
 	}
 }
+
+func TestRequestRemoteDiskFull(t *testing.T) {
+	db := db.OpenMemory()
+
+	m := NewModel(defaultCfgWrapper, protocol.LocalDeviceID, "syncthing", "dev", db, nil)
+	m.AddFolder(defaultFolderConfig)
+	m.StartFolder("default")
+	m.ServeBackground()
+	defer m.Stop()
+	m.ScanFolder("default")
+
+	m.AddConnection(&fakeConnection{id: device1}, protocol.HelloResult{})
+
+	// The device has advertised insufficient space for the file; serving
+	// is declined.
+	m.ClusterConfig(device1, protocol.ClusterConfig{
+		Folders: []protocol.Folder{{ID: "default", FreeSpace: 1}},
+	})
+	if _, err := m.Request(device1, "default", "foo", 0, 6, 0, nil, 0, false); err != ErrRemoteDiskFull {
+		t.Errorf("expected remote disk full error, got %v", err)
+	}
+
+	// With enough advertised space the request is served.
+	m.ClusterConfig(device1, protocol.ClusterConfig{
+		Folders: []protocol.Folder{{ID: "default", FreeSpace: 1 << 30}},
+	})
+	if res, err := m.Request(device1, "default", "foo", 0, 6, 0, nil, 0, false); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else {
+		res.Close()
+	}
+
+	// A cluster config without an advertisement clears it; requests are
+	// served as usual.
+	m.ClusterConfig(device1, protocol.ClusterConfig{
+		Folders: []protocol.Folder{{ID: "default"}},
+	})
+	if res, err := m.Request(device1, "default", "foo", 0, 6, 0, nil, 0, false); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else {
+		res.Close()
+	}
+}
+
+func TestMaxConcurrentScans(t *testing.T) {
+	cfg := defaultCfg.Copy()
+	cfg.Options.MaxConcurrentScans = 2
+	wcfg := createTmpWrapper(cfg)
+	defer os.Remove(wcfg.ConfigPath())
+
+	db := db.OpenMemory()
+	m := NewModel(wcfg, protocol.LocalDeviceID, "syncthing", "dev", db, nil)
+
+	// Acquire scan slots from many goroutines and track the maximum
+	// concurrency we observe.
+	var running, max, wg = int32(0), int32(0), sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := m.acquireScanSlot()
+			defer release()
+			now := atomic.AddInt32(&running, 1)
+			for {
+				cur := atomic.LoadInt32(&max)
+				if now <= cur || atomic.CompareAndSwapInt32(&max, cur, now) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&max); got > 2 {
+		t.Errorf("%d concurrent scans, expected at most 2", got)
+	}
+}
+
+func TestRelocateFolder(t *testing.T) {
+	oldRoot, err := ioutil.TempDir(tmpLocation, "relocate-old-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRoot := oldRoot + ".new"
+	defer os.RemoveAll(oldRoot)
+	defer os.RemoveAll(newRoot)
+
+	if err := ioutil.WriteFile(filepath.Join(oldRoot, "file"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fcfg := config.NewFolderConfiguration(protocol.LocalDeviceID, "reloc", "reloc", fs.FilesystemTypeBasic, oldRoot)
+	if err := fcfg.CreateMarker(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := defaultCfg.Copy()
+	cfg.Folders = []config.FolderConfiguration{fcfg}
+	wcfg := createTmpWrapper(cfg)
+	defer os.Remove(wcfg.ConfigPath())
+
+	db := db.OpenMemory()
+	m := NewModel(wcfg, protocol.LocalDeviceID, "syncthing", "dev", db, nil)
+	m.AddFolder(fcfg)
+	m.StartFolder("reloc")
+	m.ServeBackground()
+	defer m.Stop()
+	m.ScanFolder("reloc")
+
+	fi1, ok := m.CurrentFolderFile("reloc", "file")
+	if !ok {
+		t.Fatal("file missing from index after scan")
+	}
+	seq1, _ := m.CurrentSequence("reloc")
+
+	if err := m.RelocateFolder("reloc", newRoot); err != nil {
+		t.Fatal(err)
+	}
+
+	if path := wcfg.Folders()["reloc"].Path; path != newRoot {
+		t.Errorf("folder path is %q, expected %q", path, newRoot)
+	}
+
+	// The database was kept and the moved content matched by metadata, so
+	// nothing was re-indexed.
+	if seq2, _ := m.CurrentSequence("reloc"); seq2 != seq1 {
+		t.Errorf("sequence changed %d -> %d, expected no re-indexing", seq1, seq2)
+	}
+	fi2, ok := m.CurrentFolderFile("reloc", "file")
+	if !ok {
+		t.Fatal("file missing from index after relocation")
+	}
+	if !fi2.Version.Equal(fi1.Version) {
+		t.Errorf("file version changed %v -> %v", fi1.Version, fi2.Version)
+	}
+
+	// The content actually moved.
+	if _, err := os.Stat(filepath.Join(newRoot, "file")); err != nil {
+		t.Error("file not present in new root:", err)
+	}
+}
+
+func TestVersionRestoreTrashcanAndStaggered(t *testing.T) {
+	for _, versionerType := range []string{"trashcan", "staggered"} {
+		t.Run(versionerType, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			dbi := db.OpenMemory()
+
+			fcfg := config.NewFolderConfiguration(protocol.LocalDeviceID, "default", "default", fs.FilesystemTypeBasic, dir)
+			fcfg.Versioning.Type = versionerType
+			fcfg.FSWatcherEnabled = false
+			filesystem := fcfg.Filesystem()
+
+			rawConfig := config.Configuration{
+				Folders: []config.FolderConfiguration{fcfg},
+			}
+			cfg := createTmpWrapper(rawConfig)
+			defer os.Remove(cfg.ConfigPath())
+
+			m := NewModel(cfg, protocol.LocalDeviceID, "syncthing", "dev", dbi, nil)
+			m.AddFolder(fcfg)
+			m.StartFolder("default")
+			m.ServeBackground()
+			defer m.Stop()
+			m.ScanFolder("default")
+
+			writeFile := func(content string) {
+				fd, err := filesystem.Create("file.txt")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := fd.Write([]byte(content)); err != nil {
+					t.Fatal(err)
+				}
+				fd.Close()
+			}
+
+			writeFile("old content")
+			if err := fcfg.Versioner().Archive("file.txt"); err != nil {
+				t.Fatal(err)
+			}
+			writeFile("new content")
+
+			versions, err := m.GetFolderVersions("default")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(versions["file.txt"]) != 1 {
+				t.Fatalf("expected one version of file.txt, got %v", versions)
+			}
+
+			ferr, err := m.RestoreFolderVersions("default", map[string]time.Time{
+				"file.txt": versions["file.txt"][0].VersionTime,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ferr) != 0 {
+				t.Fatal("restore failed:", ferr)
+			}
+
+			fd, err := filesystem.Open("file.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := ioutil.ReadAll(fd)
+			fd.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != "old content" {
+				t.Errorf("got %q, expected the archived content back", content)
+			}
+
+			// The restore archived the replaced file, so restoring is
+			// itself reversible.
+			versions, err = m.GetFolderVersions("default")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(versions["file.txt"]) != 1 {
+				t.Errorf("expected the replaced file to be archived, got %v", versions)
+			}
+		})
+	}
+}
+
+func TestFileHistory(t *testing.T) {
+	db := db.OpenMemory()
+	m := NewModel(defaultCfgWrapper, protocol.LocalDeviceID, "syncthing", "dev", db, nil)
+	m.AddFolder(defaultFolderConfig)
+	m.StartFolder("default")
+	m.ServeBackground()
+	defer m.Stop()
+
+	m.Index(device1, "default", []protocol.FileInfo{{
+		Name:       "history-file",
+		Version:    protocol.Vector{Counters: []protocol.Counter{{ID: device1.Short(), Value: 2}}},
+		ModifiedS:  1234567890,
+		ModifiedBy: device1.Short(),
+		Deleted:    true,
+	}})
+
+	hist, err := m.History("default", "history-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hist) != 1 {
+		t.Fatalf("expected one history entry, got %d", len(hist))
+	}
+	if hist[0].Device != device1 || !hist[0].Deleted || !hist[0].Global {
+		t.Errorf("unexpected history entry: %+v", hist[0])
+	}
+	if hist[0].ModifiedBy != device1.Short().String() {
+		t.Errorf("expected the file to be modified by device1, got %s", hist[0].ModifiedBy)
+	}
+
+	if _, err := m.History("nonexistent", "history-file"); err == nil {
+		t.Error("expected an error for an unknown folder")
+	}
+}
+
+func TestGlobalDirectoryListing(t *testing.T) {
+	db := db.OpenMemory()
+	m := NewModel(defaultCfgWrapper, protocol.LocalDeviceID, "syncthing", "dev", db, nil)
+	m.AddFolder(defaultFolderConfig)
+	m.StartFolder("default")
+	m.ServeBackground()
+	defer m.Stop()
+
+	version := protocol.Vector{Counters: []protocol.Counter{{ID: device1.Short(), Value: 1}}}
+	m.Index(device1, "default", []protocol.FileInfo{
+		{Name: "aaa", Type: protocol.FileInfoTypeFile, Size: 100, Version: version},
+		{Name: "dir", Type: protocol.FileInfoTypeDirectory, Version: version},
+		{Name: filepath.Join("dir", "inner"), Type: protocol.FileInfoTypeFile, Size: 200, Version: version},
+	})
+
+	listing, err := m.GlobalDirectoryListing("default", "", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listing) != 2 || listing[0].Name != "aaa" || listing[1].Name != "dir" {
+		t.Fatalf("unexpected root listing: %+v", listing)
+	}
+	if listing[1].Type != "directory" {
+		t.Errorf("expected dir to be a directory, got %s", listing[1].Type)
+	}
+	if len(listing[0].Availability) != 1 || listing[0].Availability[0] != device1 {
+		t.Errorf("expected aaa to be available on device1, got %v", listing[0].Availability)
+	}
+
+	listing, err = m.GlobalDirectoryListing("default", "dir", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listing) != 1 || listing[0].Name != "inner" || listing[0].Size != 200 {
+		t.Fatalf("unexpected dir listing: %+v", listing)
+	}
+
+	listing, err = m.GlobalDirectoryListing("default", "", 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listing) != 1 || listing[0].Name != "dir" {
+		t.Fatalf("unexpected second page: %+v", listing)
+	}
+
+	if _, err := m.GlobalDirectoryListing("nonexistent", "", 1, 0); err == nil {
+		t.Error("expected an error for an unknown folder")
+	}
+}
+
+func TestAdaptScanInterval(t *testing.T) {
+	f := &folder{
+		FolderConfiguration: config.FolderConfiguration{
+			RescanIntervalS:    60,
+			RescanIntervalMaxS: 300,
+		},
+		scanInterval: 60 * time.Second,
+	}
+
+	// Idle full scans double the interval, up to the maximum.
+	f.adaptScanInterval(0, true)
+	if f.scanInterval != 120*time.Second {
+		t.Errorf("expected 120s, got %v", f.scanInterval)
+	}
+	f.adaptScanInterval(0, true)
+	f.adaptScanInterval(0, true)
+	if f.scanInterval != 300*time.Second {
+		t.Errorf("expected the maximum of 300s, got %v", f.scanInterval)
+	}
+
+	// Subdirectory scans without changes don't back off further.
+	f.adaptScanInterval(0, false)
+	if f.scanInterval != 300*time.Second {
+		t.Errorf("expected 300s, got %v", f.scanInterval)
+	}
+
+	// Activity snaps back to the configured interval.
+	f.adaptScanInterval(1, false)
+	if f.scanInterval != 60*time.Second {
+		t.Errorf("expected 60s, got %v", f.scanInterval)
+	}
+
+	// Without a maximum the interval stays fixed.
+	f.RescanIntervalMaxS = 0
+	f.adaptScanInterval(0, true)
+	if f.scanInterval != 60*time.Second {
+		t.Errorf("expected 60s, got %v", f.scanInterval)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/syncthing/syncthing/lib/db"
+	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+// A PullAction describes one thing the next pull iteration would do.
+type PullAction struct {
+	Action string `json:"action"` // "create", "replace", "conflict", "rename" or "delete"
+	Name   string `json:"name"`
+	Type   string `json:"type"`           // "file", "dir" or "symlink"
+	From   string `json:"from,omitempty"` // the old name, for renames
+	Size   int64  `json:"size,omitempty"`
+}
+
+// PullPreview returns the list of actions the next pull iteration would
+// take for the given folder, without performing any of them. The
+// classification mirrors what the puller does: ignored, unselected and
+// platform-unsupported items are skipped, deletions of files whose blocks
+// match an incoming file become renames, and incoming changes that conflict
+// with unsynced local changes are marked as conflicts. The preview is based
+// on the index only -- the actual pull may still diverge when the on disk
+// state doesn't match the index, for example when a rename source turns out
+// to be locally modified.
+func (m *Model) PullPreview(folder string) ([]PullAction, error) {
+	m.fmut.RLock()
+	fcfg, cfgOK := m.folderCfgs[folder]
+	files, filesOK := m.folderFiles[folder]
+	ignores, ignoresOK := m.folderIgnores[folder]
+	m.fmut.RUnlock()
+
+	if !cfgOK || !filesOK || !ignoresOK {
+		return nil, fmt.Errorf("Folder %s does not exist", folder)
+	}
+
+	selection := m.GetSelection(folder)
+
+	var actions []PullAction
+	var needFiles []protocol.FileInfo
+	var dirDeletions []protocol.FileInfo
+	fileDeletions := map[string]protocol.FileInfo{}
+	buckets := map[string][]protocol.FileInfo{}
+
+	files.WithNeed(protocol.LocalDeviceID, func(intf db.FileIntf) bool {
+		if fcfg.IgnoreDelete && intf.IsDeleted() {
+			return true
+		}
+
+		file := intf.(protocol.FileInfo)
+
+		switch {
+		case ignores.ShouldIgnore(file.Name):
+			// Would be invalidated, not pulled.
+
+		case !file.IsDeleted() && !inSelection(selection, file.Name):
+			// Outside the current selection; not pulled.
+
+		case runtime.GOOS == "windows" && fs.WindowsInvalidFilename(file.Name):
+			// Would fail with an error, not be pulled.
+
+		case file.IsDeleted():
+			if file.IsDirectory() {
+				dirDeletions = append(dirDeletions, file)
+			} else {
+				fileDeletions[file.Name] = file
+				df, ok := m.CurrentFolderFile(folder, file.Name)
+				if ok && !df.IsDeleted() && !df.IsSymlink() && !df.IsDirectory() && !df.IsInvalid() && len(df.Blocks) > 0 {
+					key := string(df.Blocks[0].Hash)
+					buckets[key] = append(buckets[key], df)
+				}
+			}
+
+		case file.Type == protocol.FileInfoTypeFile:
+			// Decided below, after we know all the deletions that renames
+			// can be matched against.
+			needFiles = append(needFiles, file)
+
+		case runtime.GOOS == "windows" && file.IsSymlink():
+			// Would be invalidated, not pulled.
+
+		default:
+			// Directories and symlinks.
+			action := "create"
+			if _, ok := m.CurrentFolderFile(folder, file.Name); ok {
+				action = "replace"
+			}
+			actions = append(actions, PullAction{
+				Action: action,
+				Name:   file.Name,
+				Type:   itemType(file),
+			})
+		}
+
+		return true
+	})
+
+	renamed := map[string]bool{}
+
+nextFile:
+	for _, file := range needFiles {
+		// Check the deletions for a file with matching blocks, which the
+		// puller would handle as a rename.
+		if len(file.Blocks) > 0 {
+			key := string(file.Blocks[0].Hash)
+			for i, candidate := range buckets[key] {
+				if !protocol.BlocksEqual(candidate.Blocks, file.Blocks) {
+					continue
+				}
+				lidx := len(buckets[key]) - 1
+				buckets[key][i] = buckets[key][lidx]
+				buckets[key] = buckets[key][:lidx]
+				renamed[candidate.Name] = true
+				actions = append(actions, PullAction{
+					Action: "rename",
+					Name:   file.Name,
+					Type:   "file",
+					From:   candidate.Name,
+					Size:   file.Size,
+				})
+				continue nextFile
+			}
+		}
+
+		action := "create"
+		if cur, ok := m.CurrentFolderFile(folder, file.Name); ok && !cur.IsDeleted() {
+			if cur.Version.Concurrent(file.Version) || file.Version.Counter(m.shortID) > cur.Version.Counter(m.shortID) {
+				action = "conflict"
+			} else {
+				action = "replace"
+			}
+		}
+		actions = append(actions, PullAction{
+			Action: action,
+			Name:   file.Name,
+			Type:   "file",
+			Size:   file.Size,
+		})
+	}
+
+	for name, file := range fileDeletions {
+		if renamed[name] {
+			continue
+		}
+		actions = append(actions, PullAction{
+			Action: "delete",
+			Name:   name,
+			Type:   itemType(file),
+		})
+	}
+	for _, file := range dirDeletions {
+		actions = append(actions, PullAction{
+			Action: "delete",
+			Name:   file.Name,
+			Type:   "dir",
+		})
+	}
+
+	return actions, nil
+}
+
+func itemType(file protocol.FileInfo) string {
+	switch {
+	case file.IsSymlink():
+		return "symlink"
+	case file.IsDirectory():
+		return "dir"
+	default:
+		return "file"
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"testing"
+
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+func TestPullPreview(t *testing.T) {
+	v1 := protocol.Vector{Counters: []protocol.Counter{{ID: 1, Value: 1}}}
+	v2 := protocol.Vector{Counters: []protocol.Counter{{ID: 1, Value: 2}}}
+
+	m := setUpModel(
+		protocol.FileInfo{Name: "dir1", Type: protocol.FileInfoTypeDirectory, Version: v1},
+		protocol.FileInfo{Name: "changed", Type: protocol.FileInfoTypeFile, Version: v1, Blocks: []protocol.BlockInfo{blocks[1]}},
+		protocol.FileInfo{Name: "oldname", Type: protocol.FileInfoTypeFile, Version: v1, Blocks: []protocol.BlockInfo{blocks[2]}},
+		protocol.FileInfo{Name: "gone", Type: protocol.FileInfoTypeFile, Version: v1, Blocks: []protocol.BlockInfo{blocks[3]}},
+	)
+
+	m.Index(device1, "default", []protocol.FileInfo{
+		{Name: "dir1", Type: protocol.FileInfoTypeDirectory, Version: v2, Deleted: true},
+		{Name: "changed", Type: protocol.FileInfoTypeFile, Version: v2, Blocks: []protocol.BlockInfo{blocks[4]}},
+		{Name: "oldname", Type: protocol.FileInfoTypeFile, Version: v2, Deleted: true},
+		{Name: "newname", Type: protocol.FileInfoTypeFile, Version: v1, Blocks: []protocol.BlockInfo{blocks[2]}},
+		{Name: "gone", Type: protocol.FileInfoTypeFile, Version: v2, Deleted: true},
+		{Name: "brandnew", Type: protocol.FileInfoTypeFile, Version: v1, Blocks: []protocol.BlockInfo{blocks[5]}},
+	})
+
+	actions, err := m.PullPreview("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byName := make(map[string]PullAction, len(actions))
+	for _, action := range actions {
+		byName[action.Name] = action
+	}
+	if len(byName) != len(actions) {
+		t.Fatalf("duplicate actions: %v", actions)
+	}
+
+	if a := byName["brandnew"]; a.Action != "create" || a.Type != "file" {
+		t.Errorf("unexpected action for brandnew: %+v", a)
+	}
+	if a := byName["changed"]; a.Action != "replace" || a.Type != "file" {
+		t.Errorf("unexpected action for changed: %+v", a)
+	}
+	if a := byName["newname"]; a.Action != "rename" || a.From != "oldname" {
+		t.Errorf("unexpected action for newname: %+v", a)
+	}
+	if a, ok := byName["oldname"]; ok {
+		t.Errorf("unexpected action for rename source oldname: %+v", a)
+	}
+	if a := byName["gone"]; a.Action != "delete" || a.Type != "file" {
+		t.Errorf("unexpected action for gone: %+v", a)
+	}
+	if a := byName["dir1"]; a.Action != "delete" || a.Type != "dir" {
+		t.Errorf("unexpected action for dir1: %+v", a)
+	}
+
+	if _, err := m.PullPreview("nonexistent"); err == nil {
+		t.Error("expected an error for a nonexistent folder")
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/syncthing/syncthing/lib/db"
+)
+
+// A selection limits what we pull for a folder, without touching the
+// ignore patterns. The index is tracked and exchanged as usual; items
+// outside the selection just aren't fetched. Selections are stored in the
+// database as newline separated path prefixes, keyed by folder ID.
+
+func selectionKey(folder string) string {
+	return "selection." + folder
+}
+
+// GetSelection returns the list of selected path prefixes for the given
+// folder. An empty list means everything is selected.
+func (m *Model) GetSelection(folder string) []string {
+	kv := db.NewMiscDataNamespace(m.db)
+	val, ok := kv.String(selectionKey(folder))
+	if !ok || val == "" {
+		return nil
+	}
+	return strings.Split(val, "\n")
+}
+
+// SetSelection limits pulling for the given folder to items under the
+// given path prefixes. An empty list of prefixes removes the limitation.
+func (m *Model) SetSelection(folder string, prefixes []string) error {
+	if _, ok := m.cfg.Folders()[folder]; !ok {
+		return fmt.Errorf("folder %s does not exist", folder)
+	}
+
+	cleaned := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		prefix = strings.Trim(prefix, "/")
+		if prefix != "" {
+			cleaned = append(cleaned, prefix)
+		}
+	}
+
+	kv := db.NewMiscDataNamespace(m.db)
+	kv.PutString(selectionKey(folder), strings.Join(cleaned, "\n"))
+
+	m.fmut.RLock()
+	runner, ok := m.folderRunners[folder]
+	m.fmut.RUnlock()
+	if ok {
+		// Newly selected items may need pulling.
+		runner.SchedulePull()
+	}
+	return nil
+}
+
+// inSelection returns whether the given name is covered by the selection.
+// Everything is covered by the empty selection. Ancestors of selected
+// prefixes are covered too, so that the directories leading up to a
+// selected subtree get created.
+func inSelection(prefixes []string, name string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if name == prefix || strings.HasPrefix(name, prefix+"/") || strings.HasPrefix(prefix, name+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import "testing"
+
+func TestInSelection(t *testing.T) {
+	cases := []struct {
+		prefixes []string
+		name     string
+		expected bool
+	}{
+		// Empty selection covers everything
+		{nil, "foo/bar", true},
+		// Exact match and children
+		{[]string{"photos/2019"}, "photos/2019", true},
+		{[]string{"photos/2019"}, "photos/2019/img.jpg", true},
+		// Ancestors of a selected prefix, so the path can be created
+		{[]string{"photos/2019"}, "photos", true},
+		// Siblings and lookalike prefixes are not covered
+		{[]string{"photos/2019"}, "photos/2018", false},
+		{[]string{"photos/2019"}, "photos/20190101.jpg", false},
+		{[]string{"photos/2019"}, "documents", false},
+		// Any one of multiple prefixes suffices
+		{[]string{"documents", "photos/2019"}, "documents/cv.txt", true},
+	}
+
+	for i, tc := range cases {
+		if res := inSelection(tc.prefixes, tc.name); res != tc.expected {
+			t.Errorf("case %d: inSelection(%v, %q) => %v, expected %v", i, tc.prefixes, tc.name, res, tc.expected)
+		}
+	}
+}
@@ -7,16 +7,22 @@
 package model
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"path/filepath"
 	"time"
 
+	"github.com/syncthing/syncthing/lib/db"
 	"github.com/syncthing/syncthing/lib/fs"
 	"github.com/syncthing/syncthing/lib/protocol"
 	"github.com/syncthing/syncthing/lib/sync"
 )
 
+// partialPersistInterval is how many verified blocks we accumulate
+// between writes of the partial-download record to the database.
+const partialPersistInterval = 64
+
 // A sharedPullerState is kept for each file that is being synced and is kept
 // updated along the way.
 type sharedPullerState struct {
@@ -32,6 +38,8 @@ type sharedPullerState struct {
 	curFile     protocol.FileInfo // The file as it exists now in our database
 	sparse      bool
 	created     time.Time
+	partials    *db.PartialTracker // Persistent partial-download records; may be nil
+	blocksHash  []byte             // Identifies the block list of the file being pulled
 
 	// Mutable, must be locked for access
 	err               error        // The first error we hit
@@ -44,6 +52,7 @@ type sharedPullerState struct {
 	pullNeeded        int          // Number of block pulls still pending
 	updated           time.Time    // Time when any of the counters above were last updated
 	closed            bool         // True if the file has been finalClosed.
+	preallocated      bool         // True if the temp file was successfully preallocated to its final size
 	available         []int32      // Indexes of the blocks that are available in the temporary file
 	availableUpdated  time.Time    // Time when list of available blocks was last updated
 	mut               sync.RWMutex // Protects the above
@@ -60,6 +69,7 @@ type pullerProgress struct {
 	Pulling                 int   `json:"pulling"`
 	BytesDone               int64 `json:"bytesDone"`
 	BytesTotal              int64 `json:"bytesTotal"`
+	BytesContiguous         int64 `json:"bytesContiguous"` // Length of the complete prefix of the file; what a streaming consumer can safely read.
 }
 
 // A lockedWriterAt synchronizes WriteAt calls with an external mutex.
@@ -75,6 +85,18 @@ func (w lockedWriterAt) WriteAt(p []byte, off int64) (n int, err error) {
 	return w.wr.WriteAt(p, off)
 }
 
+// copyRangeFrom fills the range at dstOffset from src using the
+// filesystem's CopyRange, holding the same lock as WriteAt.
+func (w lockedWriterAt) copyRangeFrom(ffs fs.Filesystem, src fs.File, srcOffset, dstOffset, size int64) error {
+	fd, ok := w.wr.(fs.File)
+	if !ok {
+		return errors.New("destination is not a file")
+	}
+	(*w.mut).Lock()
+	defer (*w.mut).Unlock()
+	return ffs.CopyRange(src, fd, srcOffset, dstOffset, size)
+}
+
 // tempFile returns the fd for the temporary file, reusing an open fd
 // or creating the file as necessary.
 func (s *sharedPullerState) tempFile() (io.WriterAt, error) {
@@ -157,7 +179,9 @@ func (s *sharedPullerState) tempFile() (io.WriterAt, error) {
 	if s.sparse && !s.file.IsSymlink() {
 		// Truncate sets the size of the file. This creates a sparse file or a
 		// space reservation, depending on the underlying filesystem.
-		if err := fd.Truncate(s.file.Size); err != nil {
+		if err := fd.Truncate(s.file.Size); err == nil {
+			s.preallocated = true
+		} else {
 			// The truncate call failed. That can happen in some cases when
 			// space reservation isn't possible or over some network
 			// filesystems... This generally doesn't matter.
@@ -213,12 +237,25 @@ func (s *sharedPullerState) failed() error {
 	return err
 }
 
+// skipEmptyBlock returns true if an all-zero block need not be written to
+// the temporary file because preallocation already left a hole or zeroed
+// reservation at its offset. When the filesystem couldn't preallocate the
+// file to its final size we must write even the zero blocks, so that a file
+// that is sparse at the source still gets correct, dense content here.
+func (s *sharedPullerState) skipEmptyBlock() bool {
+	s.mut.RLock()
+	ok := s.sparse && s.preallocated
+	s.mut.RUnlock()
+	return ok
+}
+
 func (s *sharedPullerState) copyDone(block protocol.BlockInfo) {
 	s.mut.Lock()
 	s.copyNeeded--
 	s.updated = time.Now()
 	s.available = append(s.available, int32(block.Offset/int64(s.file.BlockSize())))
 	s.availableUpdated = time.Now()
+	s.persistAvailableLocked(false)
 	l.Debugln("sharedPullerState", s.folder, s.file.Name, "copyNeeded ->", s.copyNeeded)
 	s.mut.Unlock()
 }
@@ -255,6 +292,7 @@ func (s *sharedPullerState) pullDone(block protocol.BlockInfo) {
 	s.updated = time.Now()
 	s.available = append(s.available, int32(block.Offset/int64(s.file.BlockSize())))
 	s.availableUpdated = time.Now()
+	s.persistAvailableLocked(false)
 	l.Debugln("sharedPullerState", s.folder, s.file.Name, "pullNeeded done ->", s.pullNeeded)
 	s.mut.Unlock()
 }
@@ -298,9 +336,35 @@ func (s *sharedPullerState) finalClose() (bool, error) {
 	// leaving it around for potentially quite a while.
 	s.fs.Unhide(s.tempName)
 
+	if s.partials != nil {
+		if s.err == nil {
+			// Complete; the temp file is about to be renamed into place
+			// and the partial-download record is no longer relevant.
+			s.partials.Delete(s.folder, s.realName)
+		} else {
+			// Failed or interrupted; remember what we have so the next
+			// attempt resumes without rehashing the temp file.
+			s.partials.Set(s.folder, s.realName, s.blocksHash, s.available)
+		}
+	}
+
 	return true, s.err
 }
 
+// persistAvailableLocked writes the available block list to the
+// persistent partial-download record. To keep the overhead down for
+// large files this normally happens every partialPersistInterval
+// blocks; the final state is written unconditionally at close time.
+func (s *sharedPullerState) persistAvailableLocked(force bool) {
+	if s.partials == nil {
+		return
+	}
+	if !force && len(s.available)%partialPersistInterval != 0 {
+		return
+	}
+	s.partials.Set(s.folder, s.realName, s.blocksHash, s.available)
+}
+
 // Progress returns the momentarily progress for the puller
 func (s *sharedPullerState) Progress() *pullerProgress {
 	s.mut.RLock()
@@ -316,7 +380,30 @@ func (s *sharedPullerState) Progress() *pullerProgress {
 		Pulling:             s.pullNeeded,
 		BytesTotal:          blocksToSize(s.file.BlockSize(), total),
 		BytesDone:           blocksToSize(s.file.BlockSize(), done),
+		BytesContiguous:     s.contiguousBytesLocked(),
+	}
+}
+
+// contiguousBytesLocked returns the exact length of the complete prefix
+// of the file, based on which blocks are available in the temporary
+// file. Must be called with the lock held.
+func (s *sharedPullerState) contiguousBytesLocked() int64 {
+	have := make(map[int32]struct{}, len(s.available))
+	for _, i := range s.available {
+		have[i] = struct{}{}
+	}
+	var contig int64
+	for {
+		if _, ok := have[int32(contig)]; !ok {
+			break
+		}
+		contig++
+	}
+	bytes := contig * int64(s.file.BlockSize())
+	if bytes > s.file.Size {
+		bytes = s.file.Size
 	}
+	return bytes
 }
 
 // Updated returns the time when any of the progress related counters was last updated.
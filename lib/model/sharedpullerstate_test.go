@@ -7,10 +7,12 @@
 package model
 
 import (
+	"errors"
 	"os"
 	"testing"
 
 	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/protocol"
 	"github.com/syncthing/syncthing/lib/sync"
 )
 
@@ -40,3 +42,113 @@ func TestReadOnlyDir(t *testing.T) {
 	s.fail("Test done", nil)
 	s.finalClose()
 }
+
+// failTruncateFilesystem wraps a filesystem so that Truncate on opened
+// files always fails, mimicking a filesystem without hole or preallocation
+// support.
+type failTruncateFilesystem struct {
+	fs.Filesystem
+}
+
+type failTruncateFile struct {
+	fs.File
+}
+
+func (failTruncateFile) Truncate(int64) error {
+	return errors.New("truncate not supported")
+}
+
+func (f failTruncateFilesystem) OpenFile(name string, flags int, mode fs.FileMode) (fs.File, error) {
+	fd, err := f.Filesystem.OpenFile(name, flags, mode)
+	if err != nil {
+		return nil, err
+	}
+	return failTruncateFile{fd}, nil
+}
+
+func TestEmptyBlockSkipping(t *testing.T) {
+	basic := fs.NewFilesystem(fs.FilesystemTypeBasic, "testdata")
+
+	// When preallocation works the empty blocks may be skipped, leaving
+	// holes for a sparse target.
+	s := sharedPullerState{
+		fs:       basic,
+		tempName: ".temp_sparse",
+		file:     protocol.FileInfo{Size: 1024},
+		sparse:   true,
+		mut:      sync.NewRWMutex(),
+	}
+	defer basic.Remove(s.tempName)
+	if _, err := s.tempFile(); err != nil {
+		t.Fatal(err)
+	}
+	if !s.skipEmptyBlock() {
+		t.Error("expected empty blocks to be skippable when preallocation works")
+	}
+	s.fail("Test done", nil)
+	s.finalClose()
+
+	// When the filesystem can't preallocate, a sparse source must still be
+	// materialized with dense content, so the empty blocks must be written.
+	s = sharedPullerState{
+		fs:       failTruncateFilesystem{basic},
+		tempName: ".temp_dense",
+		file:     protocol.FileInfo{Size: 1024},
+		sparse:   true,
+		mut:      sync.NewRWMutex(),
+	}
+	defer basic.Remove(s.tempName)
+	if _, err := s.tempFile(); err != nil {
+		t.Fatal(err)
+	}
+	if s.skipEmptyBlock() {
+		t.Error("expected empty blocks to be written when preallocation fails")
+	}
+	s.fail("Test done", nil)
+	s.finalClose()
+
+	// With sparse files disabled the empty blocks are always written,
+	// densifying a file that is sparse at the source.
+	s = sharedPullerState{
+		fs:       basic,
+		tempName: ".temp_nosparse",
+		file:     protocol.FileInfo{Size: 1024},
+		mut:      sync.NewRWMutex(),
+	}
+	defer basic.Remove(s.tempName)
+	if _, err := s.tempFile(); err != nil {
+		t.Fatal(err)
+	}
+	if s.skipEmptyBlock() {
+		t.Error("expected empty blocks to be written when sparse files are disabled")
+	}
+	s.fail("Test done", nil)
+	s.finalClose()
+}
+
+func TestContiguousBytes(t *testing.T) {
+	blockSize := int64(protocol.MinBlockSize)
+	s := sharedPullerState{
+		file: protocol.FileInfo{
+			Size:         10*blockSize - 100,
+			RawBlockSize: int32(blockSize),
+		},
+		mut: sync.NewRWMutex(),
+	}
+
+	if p := s.Progress(); p.BytesContiguous != 0 {
+		t.Errorf("expected no contiguous bytes yet, got %d", p.BytesContiguous)
+	}
+
+	// Blocks 0, 1 and 3 available: the contiguous prefix is two blocks.
+	s.available = []int32{3, 0, 1}
+	if p := s.Progress(); p.BytesContiguous != 2*blockSize {
+		t.Errorf("expected %d contiguous bytes, got %d", 2*blockSize, p.BytesContiguous)
+	}
+
+	// All blocks available: capped at the file size.
+	s.available = []int32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	if p := s.Progress(); p.BytesContiguous != s.file.Size {
+		t.Errorf("expected the whole file to be contiguous, got %d", p.BytesContiguous)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/syncthing/syncthing/lib/db"
+	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/protocol"
+	"github.com/syncthing/syncthing/lib/scanner"
+)
+
+// A VerifyIssue describes one file whose content on disk doesn't match the
+// block list in the index.
+type VerifyIssue struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// VerifyFolder rehashes all local files in the folder and compares them
+// against the index, catching silent corruption (bitrot, truncation) that
+// otherwise only surfaces when a peer requests a bad block. When repair is
+// set, mismatching files are invalidated and rescanned, so the next pull
+// fetches good content from peers while still reusing whatever local blocks
+// are intact.
+func (m *Model) VerifyFolder(folder string, repair bool) ([]VerifyIssue, error) {
+	m.fmut.RLock()
+	fcfg, cfgOK := m.folderCfgs[folder]
+	fset, filesOK := m.folderFiles[folder]
+	m.fmut.RUnlock()
+	if !cfgOK || !filesOK {
+		return nil, fmt.Errorf("Folder %s does not exist", folder)
+	}
+
+	ffs := fcfg.Filesystem()
+
+	var issues []VerifyIssue
+	var bad []protocol.FileInfo
+	fset.WithHave(protocol.LocalDeviceID, func(intf db.FileIntf) bool {
+		file := intf.(protocol.FileInfo)
+		if file.IsDeleted() || file.IsInvalid() || file.IsSymlink() || file.IsDirectory() {
+			return true
+		}
+		if err := verifyFile(ffs, file); err != nil {
+			l.Debugln(m, "verify:", folder, file.Name, err)
+			issues = append(issues, VerifyIssue{Name: file.Name, Error: err.Error()})
+			bad = append(bad, file)
+		}
+		return true
+	})
+
+	if repair && len(bad) > 0 {
+		// The same dance as recheckFile: mark the files as in need of a
+		// rescan, update the index, and rescan them. They come out of that
+		// invalid, so the cluster ignores our copies and the next pull
+		// replaces the bad content.
+		names := make([]string, len(bad))
+		for i := range bad {
+			bad[i].SetMustRescan(m.shortID)
+			names[i] = bad[i].Name
+		}
+		m.updateLocalsFromScanning(folder, bad)
+		if err := m.ScanFolderSubdirs(folder, names); err != nil {
+			return issues, err
+		}
+	}
+
+	return issues, nil
+}
+
+// verifyFile rehashes the file and compares each block against the index
+// entry, also checking for truncated or overlong content.
+func verifyFile(ffs fs.Filesystem, file protocol.FileInfo) error {
+	fd, err := ffs.Open(file.Name)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	buf := make([]byte, file.BlockSize())
+	for i, block := range file.Blocks {
+		n, err := io.ReadFull(fd, buf[:block.Size])
+		if err != nil {
+			return fmt.Errorf("block %d: %v", i, err)
+		}
+		if !scanner.Validate(buf[:n], block.Hash, 0) {
+			return fmt.Errorf("block %d: hash mismatch", i)
+		}
+	}
+
+	if n, _ := fd.Read(buf[:1]); n != 0 {
+		return fmt.Errorf("file is longer than the %d bytes in the index", file.Size)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyFolder(t *testing.T) {
+	m, _, tmpDir, w := setupModelWithConnection()
+	defer m.Stop()
+	defer os.RemoveAll(tmpDir)
+	defer os.Remove(w.ConfigPath())
+
+	good := filepath.Join(tmpDir, "good")
+	bad := filepath.Join(tmpDir, "bad")
+	if err := ioutil.WriteFile(good, []byte("good content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(bad, []byte("original content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ScanFolder("default"); err != nil {
+		t.Fatal(err)
+	}
+
+	issues, err := m.VerifyFolder("default", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 0 {
+		t.Fatalf("expected no issues, got %v", issues)
+	}
+
+	// Corrupt the file behind the scanner's back, keeping size and
+	// modification time.
+	info, err := os.Stat(bad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(bad, []byte("tampered content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(bad, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	issues, err = m.VerifyFolder("default", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 1 || issues[0].Name != "bad" {
+		t.Fatalf("expected one issue for \"bad\", got %v", issues)
+	}
+
+	if _, err := m.VerifyFolder("nonexistent", false); err == nil {
+		t.Error("expected an error for a nonexistent folder")
+	}
+}
@@ -0,0 +1,374 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package pairing implements a PIN-based exchange of device IDs over the
+// local network, so that adding a device doesn't require copying the full
+// ID around. The hosting device generates a PIN and listens; the joining
+// device broadcasts its ephemeral public key, and host and joiner agree
+// on a session key using ECDH. Both then prove knowledge of the PIN with
+// an HMAC under a key derived from the PIN and the shared secret.
+//
+// A passive listener never sees anything that can be checked against a
+// PIN guess. This is not a full PAKE, though: anyone who actively sends
+// a request of their own holds the ECDH secret for that exchange and
+// can search the host's response for the PIN offline. The host
+// therefore answers only a single request per exchange and gives up on
+// an incorrect confirmation, limiting what an attacker gets out of one
+// hosting session, and callers must treat the PIN as single-use and
+// keep the window short.
+package pairing
+
+import (
+	"crypto/ecdh"
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/protocol"
+	"github.com/syncthing/syncthing/lib/rand"
+)
+
+const (
+	// Port is the UDP port used for pairing exchanges.
+	Port = 21028
+
+	magic = uint32(0x50A17D0B)
+
+	msgTypeRequest  = 1 // joiner's ephemeral public key, broadcast
+	msgTypeResponse = 2 // host's key, device ID and folder offer, with proof
+	msgTypeConfirm  = 3 // joiner's device ID, with proof
+
+	pubKeySize = 65 // uncompressed P-256 point
+
+	announceInterval = 2 * time.Second
+	readTimeout      = time.Second
+)
+
+// A Result describes the device found on the other end of a pairing
+// exchange.
+type Result struct {
+	Device      protocol.DeviceID `json:"device"`
+	FolderID    string            `json:"folderID,omitempty"`
+	FolderLabel string            `json:"folderLabel,omitempty"`
+	Address     string            `json:"address"`
+}
+
+// GeneratePIN returns a new pairing PIN in the form "123-456-789".
+func GeneratePIN() string {
+	digits := make([]byte, 9)
+	for i := range digits {
+		digits[i] = byte('0' + rand.Intn(10))
+	}
+	return fmt.Sprintf("%s-%s-%s", digits[0:3], digits[3:6], digits[6:9])
+}
+
+// Host waits for a pairing request, answers it with our device ID and the
+// optional folder offer, and returns the joining device once it has proven
+// knowledge of the PIN. It gives up when the timeout expires.
+func Host(pin string, myID protocol.DeviceID, folderID, folderLabel string, timeout time.Duration) (Result, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: Port})
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+	return hostOn(conn, pin, myID, folderID, folderLabel, timeout)
+}
+
+// Join broadcasts pairing requests and returns the hosting device from the
+// first answer that proves knowledge of the PIN. It gives up when the
+// timeout expires.
+func Join(pin string, myID protocol.DeviceID, timeout time.Duration) (Result, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+	dst := &net.UDPAddr{IP: net.IPv4bcast, Port: Port}
+	return joinOn(conn, dst, pin, myID, timeout)
+}
+
+func hostOn(conn *net.UDPConn, pin string, myID protocol.DeviceID, folderID, folderLabel string, timeout time.Duration) (Result, error) {
+	key := pinKey(pin)
+	deadline := time.Now().Add(timeout)
+	buf := make([]byte, 1500)
+
+	// We answer a single request per exchange: every response handed out
+	// is material for an offline PIN search, so additional requests are
+	// ignored. The joiner retransmits its request when our response was
+	// lost, so the same response is resent to the same address.
+	var pendingAddr string
+	var sess, resp []byte
+
+	for time.Now().Before(deadline) {
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if err, ok := err.(net.Error); ok && err.Timeout() {
+				continue
+			}
+			return Result{}, err
+		}
+
+		msg := buf[:n]
+		switch msgType(msg) {
+		case msgTypeRequest:
+			if pendingAddr != "" {
+				if src.String() == pendingAddr {
+					if _, err := conn.WriteToUDP(resp, src); err != nil {
+						return Result{}, err
+					}
+				} else {
+					l.Debugln("pairing: ignoring request from", src, "exchange in progress")
+				}
+				continue
+			}
+			joinerPub, err := parseRequest(msg)
+			if err != nil {
+				l.Debugln("pairing: rejecting request from", src, err)
+				continue
+			}
+			priv, err := ecdh.P256().GenerateKey(cryptorand.Reader)
+			if err != nil {
+				return Result{}, err
+			}
+			sess, err = sessionKey(key, priv, joinerPub)
+			if err != nil {
+				l.Debugln("pairing: rejecting request from", src, err)
+				continue
+			}
+			resp = buildResponse(sess, priv.PublicKey().Bytes(), myID, folderID, folderLabel)
+			if _, err := conn.WriteToUDP(resp, src); err != nil {
+				return Result{}, err
+			}
+			pendingAddr = src.String()
+
+		case msgTypeConfirm:
+			if pendingAddr == "" || src.String() != pendingAddr {
+				l.Debugln("pairing: rejecting confirmation from", src, "no session")
+				continue
+			}
+			device, err := parseConfirm(msg, sess)
+			if err != nil {
+				// One incorrect confirmation ends the exchange, so the
+				// PIN gets at most one online guess per hosting session.
+				return Result{}, errors.New("pairing failed: incorrect PIN")
+			}
+			return Result{
+				Device:  device,
+				Address: src.String(),
+			}, nil
+
+		default:
+			l.Debugln("pairing: rejecting message from", src, "unexpected message type")
+		}
+	}
+
+	return Result{}, errors.New("pairing timed out")
+}
+
+func joinOn(conn *net.UDPConn, dst *net.UDPAddr, pin string, myID protocol.DeviceID, timeout time.Duration) (Result, error) {
+	key := pinKey(pin)
+	deadline := time.Now().Add(timeout)
+
+	priv, err := ecdh.P256().GenerateKey(cryptorand.Reader)
+	if err != nil {
+		return Result{}, err
+	}
+	req := buildRequest(priv.PublicKey().Bytes())
+	buf := make([]byte, 1500)
+
+	var lastSend time.Time
+	for time.Now().Before(deadline) {
+		if time.Since(lastSend) >= announceInterval {
+			if _, err := conn.WriteToUDP(req, dst); err != nil {
+				return Result{}, err
+			}
+			lastSend = time.Now()
+		}
+
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if err, ok := err.(net.Error); ok && err.Timeout() {
+				continue
+			}
+			return Result{}, err
+		}
+
+		device, folderID, folderLabel, sess, err := parseResponse(buf[:n], key, priv)
+		if err != nil {
+			l.Debugln("pairing: rejecting response from", src, err)
+			continue
+		}
+		if device == myID {
+			continue
+		}
+
+		if _, err := conn.WriteToUDP(buildConfirm(sess, myID), src); err != nil {
+			return Result{}, err
+		}
+
+		return Result{
+			Device:      device,
+			FolderID:    folderID,
+			FolderLabel: folderLabel,
+			Address:     src.String(),
+		}, nil
+	}
+
+	return Result{}, errors.New("pairing timed out")
+}
+
+func pinKey(pin string) []byte {
+	sum := sha256.Sum256([]byte("syncthing-pairing:" + pin))
+	return sum[:]
+}
+
+// sessionKey derives the key authenticating the rest of the exchange from
+// the PIN and the ECDH agreement between our private key and the peer's
+// public key. Without the ECDH secret the key cannot be recomputed from
+// captured traffic; only an active participant in the exchange can test
+// PIN guesses against it.
+func sessionKey(pinKey []byte, priv *ecdh.PrivateKey, peerPub []byte) ([]byte, error) {
+	pub, err := ecdh.P256().NewPublicKey(peerPub)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, pinKey)
+	mac.Write(shared)
+	return mac.Sum(nil), nil
+}
+
+func msgType(msg []byte) byte {
+	if len(msg) < 5 || binary.BigEndian.Uint32(msg) != magic {
+		return 0
+	}
+	return msg[4]
+}
+
+// buildRequest encodes the joiner's ephemeral public key. It carries no
+// PIN material at all; the joiner proves PIN knowledge in the later
+// confirmation, after the key agreement.
+func buildRequest(pub []byte) []byte {
+	msg := make([]byte, 4, 4+1+pubKeySize)
+	binary.BigEndian.PutUint32(msg, magic)
+	msg = append(msg, msgTypeRequest)
+	return append(msg, pub...)
+}
+
+func parseRequest(msg []byte) ([]byte, error) {
+	if len(msg) != 4+1+pubKeySize {
+		return nil, errors.New("malformed request")
+	}
+	if msgType(msg) != msgTypeRequest {
+		return nil, errors.New("unexpected message type")
+	}
+	return msg[5:], nil
+}
+
+// buildResponse encodes the host's ephemeral public key, device ID and
+// folder offer, followed by an HMAC under the session key over all of it.
+func buildResponse(sess, pub []byte, device protocol.DeviceID, folderID, folderLabel string) []byte {
+	msg := make([]byte, 4, 256)
+	binary.BigEndian.PutUint32(msg, magic)
+	msg = append(msg, msgTypeResponse)
+	msg = append(msg, pub...)
+	msg = append(msg, device[:]...)
+	msg = appendString(msg, folderID)
+	msg = appendString(msg, folderLabel)
+
+	mac := hmac.New(sha256.New, sess)
+	mac.Write(msg)
+	return mac.Sum(msg)
+}
+
+func parseResponse(msg, pinKey []byte, priv *ecdh.PrivateKey) (device protocol.DeviceID, folderID, folderLabel string, sess []byte, err error) {
+	if len(msg) < 4+1+pubKeySize+32+2+2+sha256.Size {
+		return device, "", "", nil, errors.New("short message")
+	}
+	if msgType(msg) != msgTypeResponse {
+		return device, "", "", nil, errors.New("unexpected message type")
+	}
+
+	if sess, err = sessionKey(pinKey, priv, msg[5:5+pubKeySize]); err != nil {
+		return device, "", "", nil, err
+	}
+
+	body, sum := msg[:len(msg)-sha256.Size], msg[len(msg)-sha256.Size:]
+	mac := hmac.New(sha256.New, sess)
+	mac.Write(body)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return device, "", "", nil, errors.New("incorrect PIN or corrupt message")
+	}
+
+	copy(device[:], body[5+pubKeySize:])
+	rest := body[5+pubKeySize+32:]
+	if folderID, rest, err = readString(rest); err != nil {
+		return device, "", "", nil, err
+	}
+	if folderLabel, _, err = readString(rest); err != nil {
+		return device, "", "", nil, err
+	}
+	return device, folderID, folderLabel, sess, nil
+}
+
+// buildConfirm encodes the joiner's device ID, followed by an HMAC under
+// the session key over all of it. A valid confirmation proves to the host
+// that the joiner knows both the PIN and the ECDH secret.
+func buildConfirm(sess []byte, device protocol.DeviceID) []byte {
+	msg := make([]byte, 4, 4+1+32+sha256.Size)
+	binary.BigEndian.PutUint32(msg, magic)
+	msg = append(msg, msgTypeConfirm)
+	msg = append(msg, device[:]...)
+
+	mac := hmac.New(sha256.New, sess)
+	mac.Write(msg)
+	return mac.Sum(msg)
+}
+
+func parseConfirm(msg, sess []byte) (device protocol.DeviceID, err error) {
+	if len(msg) != 4+1+32+sha256.Size {
+		return device, errors.New("malformed confirmation")
+	}
+	if msgType(msg) != msgTypeConfirm {
+		return device, errors.New("unexpected message type")
+	}
+
+	body, sum := msg[:len(msg)-sha256.Size], msg[len(msg)-sha256.Size:]
+	mac := hmac.New(sha256.New, sess)
+	mac.Write(body)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return device, errors.New("incorrect PIN or corrupt message")
+	}
+
+	copy(device[:], body[5:])
+	return device, nil
+}
+
+func appendString(msg []byte, s string) []byte {
+	msg = append(msg, byte(len(s)>>8), byte(len(s)))
+	return append(msg, s...)
+}
+
+func readString(bs []byte) (string, []byte, error) {
+	if len(bs) < 2 {
+		return "", nil, errors.New("truncated string")
+	}
+	length := int(bs[0])<<8 | int(bs[1])
+	if len(bs) < 2+length {
+		return "", nil, errors.New("truncated string")
+	}
+	return string(bs[2 : 2+length]), bs[2+length:], nil
+}
@@ -0,0 +1,184 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package pairing
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	cryptorand "crypto/rand"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+var (
+	hostID, _ = protocol.DeviceIDFromString("AIR6LPZ-7K4PTTV-UXQSMUU-CPQ5YWH-OEDFIIQ-JUG777G-2YQXXR5-YD6AWQR")
+	joinID, _ = protocol.DeviceIDFromString("GYRZZQB-IRNPV4Z-T7TC52W-EQYJ3TT-FDQW6MW-DFLMU42-SSSU6EM-FBK2VAY")
+)
+
+func TestGeneratePIN(t *testing.T) {
+	exp := regexp.MustCompile(`^\d{3}-\d{3}-\d{3}$`)
+	for i := 0; i < 10; i++ {
+		if pin := GeneratePIN(); !exp.MatchString(pin) {
+			t.Errorf("unexpected PIN format %q", pin)
+		}
+	}
+}
+
+func TestPairingExchange(t *testing.T) {
+	hostConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hostConn.Close()
+	joinConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer joinConn.Close()
+
+	pin := GeneratePIN()
+
+	hostRes := make(chan Result, 1)
+	go func() {
+		res, err := hostOn(hostConn, pin, hostID, "default", "Default Folder", 10*time.Second)
+		if err != nil {
+			t.Error(err)
+		}
+		hostRes <- res
+	}()
+
+	res, err := joinOn(joinConn, hostConn.LocalAddr().(*net.UDPAddr), pin, joinID, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Device != hostID {
+		t.Errorf("joiner got device %v, expected %v", res.Device, hostID)
+	}
+	if res.FolderID != "default" || res.FolderLabel != "Default Folder" {
+		t.Errorf("joiner got folder offer %q/%q", res.FolderID, res.FolderLabel)
+	}
+
+	hres := <-hostRes
+	if hres.Device != joinID {
+		t.Errorf("host got device %v, expected %v", hres.Device, joinID)
+	}
+}
+
+func TestPairingRejectsWrongPIN(t *testing.T) {
+	joinPriv, err := ecdh.P256().GenerateKey(cryptorand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostPriv, err := ecdh.P256().GenerateKey(cryptorand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := pinKey("111-111-111")
+	sess, err := sessionKey(key, hostPriv, joinPriv.PublicKey().Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := buildResponse(sess, hostPriv.PublicKey().Bytes(), hostID, "default", "Default Folder")
+
+	if _, _, _, _, err := parseResponse(resp, key, joinPriv); err != nil {
+		t.Error("response with correct PIN should verify:", err)
+	}
+	if _, _, _, _, err := parseResponse(resp, pinKey("222-222-222"), joinPriv); err == nil {
+		t.Error("response with wrong PIN should not verify")
+	}
+	resp[5+pubKeySize]++ // tamper with the device ID
+	if _, _, _, _, err := parseResponse(resp, key, joinPriv); err == nil {
+		t.Error("tampered response should not verify")
+	}
+
+	confirm := buildConfirm(sess, joinID)
+	if device, err := parseConfirm(confirm, sess); err != nil || device != joinID {
+		t.Error("confirmation under the session key should verify:", err)
+	}
+	if _, err := parseConfirm(confirm, pinKey("222-222-222")); err == nil {
+		t.Error("confirmation under another key should not verify")
+	}
+	confirm[5]++ // tamper with the device ID
+	if _, err := parseConfirm(confirm, sess); err == nil {
+		t.Error("tampered confirmation should not verify")
+	}
+}
+
+func TestPairingHostOneGuess(t *testing.T) {
+	hostConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hostConn.Close()
+	joinConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer joinConn.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := hostOn(hostConn, "111-111-111", hostID, "", "", 10*time.Second)
+		errc <- err
+	}()
+
+	priv, err := ecdh.P256().GenerateKey(cryptorand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := joinConn.WriteToUDP(buildRequest(priv.PublicKey().Bytes()), hostConn.LocalAddr().(*net.UDPAddr)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1500)
+	joinConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, src, err := joinConn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgType(buf[:n]) != msgTypeResponse {
+		t.Fatalf("unexpected message type %d", msgType(buf[:n]))
+	}
+
+	// A confirmation under the wrong PIN must end the exchange with an
+	// error instead of leaving the host open for further guesses.
+	wrongSess, err := sessionKey(pinKey("222-222-222"), priv, buf[5:5+pubKeySize])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := joinConn.WriteToUDP(buildConfirm(wrongSess, joinID), src); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err == nil {
+		t.Error("host should give up after an incorrect confirmation")
+	}
+}
+
+func TestPairingRequestCarriesNoPINMaterial(t *testing.T) {
+	// The broadcast request must contain only the ephemeral public key,
+	// so a passive listener has nothing to test PIN guesses against.
+	priv, err := ecdh.P256().GenerateKey(cryptorand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := buildRequest(priv.PublicKey().Bytes())
+	if len(req) != 4+1+pubKeySize {
+		t.Errorf("request is %d bytes, expected %d", len(req), 4+1+pubKeySize)
+	}
+	pub, err := parseRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pub, priv.PublicKey().Bytes()) {
+		t.Error("request should carry the public key verbatim")
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package pmp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/jackpal/gateway"
+	"github.com/syncthing/syncthing/lib/nat"
+	"github.com/syncthing/syncthing/lib/sync"
+)
+
+// PCP (RFC 6887) is the successor to NAT-PMP, spoken by Apple and other
+// modern routers. We implement the MAP opcode, which is all we need for
+// port mappings; lease renewal is driven by the nat service calling
+// AddPortMapping again before the lifetime runs out.
+
+const (
+	pcpVersion    = 2
+	pcpPort       = 5351
+	pcpOpAnnounce = 0
+	pcpOpMap      = 1
+
+	pcpResultSuccess            = 0
+	pcpResultUnsuppVersion      = 1
+	pcpHeaderLen                = 24
+	pcpMapLen                   = 36
+	pcpProtoTCP            byte = 6
+	pcpProtoUDP            byte = 17
+)
+
+func init() {
+	nat.Register(DiscoverPCP)
+}
+
+// DiscoverPCP probes the default gateway for PCP support and returns it
+// as a mapping device if it answers.
+func DiscoverPCP(renewal, timeout time.Duration) []nat.Device {
+	ip, err := gateway.DiscoverGateway()
+	if err != nil {
+		l.Debugln("Failed to discover gateway", err)
+		return nil
+	}
+	if ip == nil || ip.IsUnspecified() {
+		return nil
+	}
+
+	l.Debugln("Testing gateway at", ip, "for PCP support")
+
+	var localIP net.IP
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(ip.String(), fmt.Sprint(pcpPort)), timeout)
+	if err != nil {
+		l.Debugln("Failed to dial gateway", err)
+		return nil
+	}
+	conn.Close()
+	if localIPAddress, _, err := net.SplitHostPort(conn.LocalAddr().String()); err == nil {
+		localIP = net.ParseIP(localIPAddress)
+	} else {
+		l.Debugln("Failed to lookup local IP", err)
+		return nil
+	}
+
+	dev := &pcpWrapper{
+		renewal:   renewal,
+		timeout:   timeout,
+		localIP:   localIP,
+		gatewayIP: ip,
+		mut:       sync.NewMutex(),
+	}
+
+	// An ANNOUNCE request doubles as a capability probe; a router
+	// without PCP either stays silent or answers with the wrong version.
+	if err := dev.announce(); err != nil {
+		l.Debugln("Gateway does not speak PCP:", err)
+		return nil
+	}
+
+	return []nat.Device{dev}
+}
+
+type pcpWrapper struct {
+	renewal   time.Duration
+	timeout   time.Duration
+	localIP   net.IP
+	gatewayIP net.IP
+
+	mut        sync.Mutex
+	externalIP net.IP // learned from the last MAP response
+}
+
+func (w *pcpWrapper) ID() string {
+	return fmt.Sprintf("PCP@%s", w.gatewayIP.String())
+}
+
+func (w *pcpWrapper) GetLocalIPAddress() net.IP {
+	return w.localIP
+}
+
+func (w *pcpWrapper) AddPortMapping(protocol nat.Protocol, internalPort, externalPort int, description string, duration time.Duration) (int, error) {
+	// A zero lifetime deletes the mapping in PCP; substitute the renewal
+	// interval so the lease lasts between the nat service's calls.
+	if duration == 0 {
+		duration = w.renewal
+	}
+
+	var proto byte
+	switch protocol {
+	case nat.TCP:
+		proto = pcpProtoTCP
+	case nat.UDP:
+		proto = pcpProtoUDP
+	default:
+		return 0, fmt.Errorf("unsupported protocol %v", protocol)
+	}
+
+	req := make([]byte, pcpHeaderLen+pcpMapLen)
+	req[0] = pcpVersion
+	req[1] = pcpOpMap
+	binary.BigEndian.PutUint32(req[4:], uint32(duration/time.Second))
+	copy(req[8:24], w.localIP.To16())
+	if _, err := rand.Read(req[24:36]); err != nil {
+		return 0, err
+	}
+	req[36] = proto
+	binary.BigEndian.PutUint16(req[40:], uint16(internalPort))
+	binary.BigEndian.PutUint16(req[42:], uint16(externalPort))
+	// Suggested external address all zeroes: no preference.
+
+	resp, err := w.transact(req, pcpHeaderLen+pcpMapLen)
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(resp[24:36], req[24:36]) {
+		return 0, fmt.Errorf("PCP MAP nonce mismatch")
+	}
+
+	mappedPort := int(binary.BigEndian.Uint16(resp[42:]))
+	externalIP := net.IP(resp[44:60])
+
+	w.mut.Lock()
+	w.externalIP = externalIP
+	w.mut.Unlock()
+
+	return mappedPort, nil
+}
+
+func (w *pcpWrapper) GetExternalIPAddress() (net.IP, error) {
+	// PCP has no dedicated external address query; the address comes
+	// with every MAP response instead.
+	w.mut.Lock()
+	ip := w.externalIP
+	w.mut.Unlock()
+	if ip == nil {
+		return net.IPv4zero, nil
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4, nil
+	}
+	return ip, nil
+}
+
+func (w *pcpWrapper) announce() error {
+	req := make([]byte, pcpHeaderLen)
+	req[0] = pcpVersion
+	req[1] = pcpOpAnnounce
+	copy(req[8:24], w.localIP.To16())
+	_, err := w.transact(req, pcpHeaderLen)
+	return err
+}
+
+// transact sends the request and returns the matching response, checking
+// version, opcode and result code.
+func (w *pcpWrapper) transact(req []byte, respLen int) ([]byte, error) {
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(w.gatewayIP.String(), fmt.Sprint(pcpPort)), w.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(w.timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	resp := make([]byte, 1100) // maximum PCP message size
+	n, err := conn.Read(resp)
+	if err != nil {
+		return nil, err
+	}
+	if n < respLen {
+		return nil, fmt.Errorf("short PCP response (%d bytes)", n)
+	}
+	if resp[0] != pcpVersion {
+		return nil, fmt.Errorf("unsupported PCP version %d in response", resp[0])
+	}
+	if resp[1] != req[1]|0x80 {
+		return nil, fmt.Errorf("unexpected PCP opcode %#x in response", resp[1])
+	}
+	if resp[3] != pcpResultSuccess {
+		return nil, fmt.Errorf("PCP error result %d", resp[3])
+	}
+	return resp[:n], nil
+}
@@ -248,6 +248,7 @@ type Folder struct {
 	IgnoreDelete       bool     `protobuf:"varint,5,opt,name=ignore_delete,json=ignoreDelete,proto3" json:"ignore_delete,omitempty"`
 	DisableTempIndexes bool     `protobuf:"varint,6,opt,name=disable_temp_indexes,json=disableTempIndexes,proto3" json:"disable_temp_indexes,omitempty"`
 	Paused             bool     `protobuf:"varint,7,opt,name=paused,proto3" json:"paused,omitempty"`
+	FreeSpace          int64    `protobuf:"varint,8,opt,name=free_space,json=freeSpace,proto3" json:"free_space,omitempty"`
 	Devices            []Device `protobuf:"bytes,16,rep,name=devices" json:"devices"`
 }
 
@@ -309,6 +310,10 @@ type FileInfo struct {
 	RawBlockSize  int32        `protobuf:"varint,13,opt,name=block_size,json=blockSize,proto3" json:"block_size,omitempty"`
 	Blocks        []BlockInfo  `protobuf:"bytes,16,rep,name=Blocks" json:"Blocks"`
 	SymlinkTarget string       `protobuf:"bytes,17,opt,name=symlink_target,json=symlinkTarget,proto3" json:"symlink_target,omitempty"`
+	// An SHA-256 digest over the concatenated block hashes, identifying
+	// the file content as a whole. Optional; peers that don't set it are
+	// trusted on the per-block hashes alone.
+	BlocksHash []byte `protobuf:"bytes,18,opt,name=blocks_hash,json=blocksHash,proto3" json:"blocks_hash,omitempty"`
 	// The local_flags fields stores flags that are relevant to the local
 	// host only. It is not part of the protocol, doesn't get sent or
 	// received (we make sure to zero it), nonetheless we need it on our
@@ -359,6 +364,14 @@ type Request struct {
 	Hash          []byte `protobuf:"bytes,6,opt,name=hash,proto3" json:"hash,omitempty"`
 	FromTemporary bool   `protobuf:"varint,7,opt,name=from_temporary,json=fromTemporary,proto3" json:"from_temporary,omitempty"`
 	WeakHash      uint32 `protobuf:"varint,8,opt,name=weak_hash,json=weakHash,proto3" json:"weak_hash,omitempty"`
+	// Serialized sub-chunk hashes of the requester's old copy of the
+	// block, as produced by the blockdelta package. When set, the sender
+	// may respond with a delta instead of the full data.
+	DeltaHashes []byte `protobuf:"bytes,9,opt,name=delta_hashes,json=deltaHashes,proto3" json:"delta_hashes,omitempty"`
+	// The index of the requested block within the file, so that receivers
+	// that transform block data (such as encrypted folders) can translate
+	// offsets without knowing the file's block size.
+	BlockNo int32 `protobuf:"varint,10,opt,name=block_no,json=blockNo,proto3" json:"block_no,omitempty"`
 }
 
 func (m *Request) Reset()                    { *m = Request{} }
@@ -370,6 +383,9 @@ type Response struct {
 	ID   int32     `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
 	Data []byte    `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
 	Code ErrorCode `protobuf:"varint,3,opt,name=code,proto3,enum=protocol.ErrorCode" json:"code,omitempty"`
+	// Data is a blockdelta encoding against the requester's old block
+	// rather than the full block content.
+	Delta bool `protobuf:"varint,4,opt,name=delta,proto3" json:"delta,omitempty"`
 }
 
 func (m *Response) Reset()                    { *m = Response{} }
@@ -612,6 +628,11 @@ func (m *Folder) MarshalTo(dAtA []byte) (int, error) {
 		}
 		i++
 	}
+	if m.FreeSpace != 0 {
+		dAtA[i] = 0x40
+		i++
+		i = encodeVarintBep(dAtA, i, uint64(m.FreeSpace))
+	}
 	if len(m.Devices) > 0 {
 		for _, msg := range m.Devices {
 			dAtA[i] = 0x82
@@ -910,6 +931,14 @@ func (m *FileInfo) MarshalTo(dAtA []byte) (int, error) {
 		i = encodeVarintBep(dAtA, i, uint64(len(m.SymlinkTarget)))
 		i += copy(dAtA[i:], m.SymlinkTarget)
 	}
+	if len(m.BlocksHash) > 0 {
+		dAtA[i] = 0x92
+		i++
+		dAtA[i] = 0x1
+		i++
+		i = encodeVarintBep(dAtA, i, uint64(len(m.BlocksHash)))
+		i += copy(dAtA[i:], m.BlocksHash)
+	}
 	if m.LocalFlags != 0 {
 		dAtA[i] = 0xc0
 		i++
@@ -1080,6 +1109,17 @@ func (m *Request) MarshalTo(dAtA []byte) (int, error) {
 		i++
 		i = encodeVarintBep(dAtA, i, uint64(m.WeakHash))
 	}
+	if len(m.DeltaHashes) > 0 {
+		dAtA[i] = 0x4a
+		i++
+		i = encodeVarintBep(dAtA, i, uint64(len(m.DeltaHashes)))
+		i += copy(dAtA[i:], m.DeltaHashes)
+	}
+	if m.BlockNo != 0 {
+		dAtA[i] = 0x50
+		i++
+		i = encodeVarintBep(dAtA, i, uint64(m.BlockNo))
+	}
 	return i, nil
 }
 
@@ -1114,6 +1154,16 @@ func (m *Response) MarshalTo(dAtA []byte) (int, error) {
 		i++
 		i = encodeVarintBep(dAtA, i, uint64(m.Code))
 	}
+	if m.Delta {
+		dAtA[i] = 0x20
+		i++
+		if m.Delta {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i++
+	}
 	return i, nil
 }
 
@@ -1334,6 +1384,9 @@ func (m *Folder) ProtoSize() (n int) {
 	if m.Paused {
 		n += 2
 	}
+	if m.FreeSpace != 0 {
+		n += 1 + sovBep(uint64(m.FreeSpace))
+	}
 	if len(m.Devices) > 0 {
 		for _, e := range m.Devices {
 			l = e.ProtoSize()
@@ -1464,6 +1517,10 @@ func (m *FileInfo) ProtoSize() (n int) {
 	if l > 0 {
 		n += 2 + l + sovBep(uint64(l))
 	}
+	l = len(m.BlocksHash)
+	if l > 0 {
+		n += 2 + l + sovBep(uint64(l))
+	}
 	if m.LocalFlags != 0 {
 		n += 2 + sovBep(uint64(m.LocalFlags))
 	}
@@ -1543,6 +1600,13 @@ func (m *Request) ProtoSize() (n int) {
 	if m.WeakHash != 0 {
 		n += 1 + sovBep(uint64(m.WeakHash))
 	}
+	l = len(m.DeltaHashes)
+	if l > 0 {
+		n += 1 + l + sovBep(uint64(l))
+	}
+	if m.BlockNo != 0 {
+		n += 1 + sovBep(uint64(m.BlockNo))
+	}
 	return n
 }
 
@@ -1559,6 +1623,9 @@ func (m *Response) ProtoSize() (n int) {
 	if m.Code != 0 {
 		n += 1 + sovBep(uint64(m.Code))
 	}
+	if m.Delta {
+		n += 2
+	}
 	return n
 }
 
@@ -2120,6 +2187,25 @@ func (m *Folder) Unmarshal(dAtA []byte) error {
 				}
 			}
 			m.Paused = bool(v != 0)
+		case 8:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field FreeSpace", wireType)
+			}
+			m.FreeSpace = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.FreeSpace |= (int64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		case 16:
 			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field Devices", wireType)
@@ -3016,6 +3102,37 @@ func (m *FileInfo) Unmarshal(dAtA []byte) error {
 			}
 			m.SymlinkTarget = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 18:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field BlocksHash", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthBep
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.BlocksHash = append(m.BlocksHash[:0], dAtA[iNdEx:postIndex]...)
+			if m.BlocksHash == nil {
+				m.BlocksHash = []byte{}
+			}
+			iNdEx = postIndex
 		case 1000:
 			if wireType != 0 {
 				return fmt.Errorf("proto: wrong wireType = %d for field LocalFlags", wireType)
@@ -3577,6 +3694,56 @@ func (m *Request) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 9:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DeltaHashes", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthBep
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.DeltaHashes = append(m.DeltaHashes[:0], dAtA[iNdEx:postIndex]...)
+			if m.DeltaHashes == nil {
+				m.DeltaHashes = []byte{}
+			}
+			iNdEx = postIndex
+		case 10:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field BlockNo", wireType)
+			}
+			m.BlockNo = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.BlockNo |= (int32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipBep(dAtA[iNdEx:])
@@ -3696,6 +3863,26 @@ func (m *Response) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Delta", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBep
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Delta = bool(v != 0)
 		default:
 			iNdEx = preIndex
 			skippy, err := skipBep(dAtA[iNdEx:])
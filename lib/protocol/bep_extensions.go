@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/syncthing/syncthing/lib/rand"
+	"github.com/syncthing/syncthing/lib/sha256"
 )
 
 const (
@@ -97,9 +98,14 @@ func (f FileInfo) FileSize() int64 {
 }
 
 func (f FileInfo) BlockSize() int {
-	if f.RawBlockSize == 0 {
+	if f.RawBlockSize < MinBlockSize {
+		// The field is unset, or the remote is talking nonsense. Clamp to
+		// the minimum so downstream size calculations stay sane.
 		return MinBlockSize
 	}
+	if f.RawBlockSize > MaxBlockSize {
+		return MaxBlockSize
+	}
 	return int(f.RawBlockSize)
 }
 
@@ -240,10 +246,22 @@ func BlocksEqual(a, b []BlockInfo) bool {
 	return true
 }
 
+// BlocksHash returns the whole-file digest for the given block list: an
+// SHA-256 over the concatenated block hashes. A matching digest confirms
+// the content of the entire file, not just the individual blocks.
+func BlocksHash(bs []BlockInfo) []byte {
+	h := sha256.New()
+	for _, b := range bs {
+		h.Write(b.Hash)
+	}
+	return h.Sum(nil)
+}
+
 func (f *FileInfo) SetMustRescan(by ShortID) {
 	f.LocalFlags = FlagLocalMustRescan
 	f.ModifiedBy = by
 	f.Blocks = nil
+	f.BlocksHash = nil
 	f.Sequence = 0
 }
 
@@ -251,6 +269,7 @@ func (f *FileInfo) SetIgnored(by ShortID) {
 	f.LocalFlags = FlagLocalIgnored
 	f.ModifiedBy = by
 	f.Blocks = nil
+	f.BlocksHash = nil
 	f.Sequence = 0
 }
 
@@ -258,6 +277,7 @@ func (f *FileInfo) SetUnsupported(by ShortID) {
 	f.LocalFlags = FlagLocalUnsupported
 	f.ModifiedBy = by
 	f.Blocks = nil
+	f.BlocksHash = nil
 	f.Sequence = 0
 }
 
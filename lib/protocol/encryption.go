@@ -0,0 +1,422 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package protocol
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/salsa20"
+)
+
+// This file implements "untrusted device" encryption. Folders can be
+// shared with a device in encrypted mode, where the untrusted device
+// stores only ciphertext blocks under opaque names, yet still takes part
+// in block exchange. File names are encrypted per path component with a
+// deterministic nonce so that the same name always encrypts to the same
+// string. File data is sealed per block with a fresh random nonce and an
+// authentication tag, both carried with the ciphertext, so that writing
+// new content to a block never reuses a keystream and tampered blocks
+// are rejected on decryption. Each encrypted block is blockOverhead
+// bytes larger than its plaintext; the sizes and offsets announced to
+// the untrusted device account for this. Block hashes announced to the
+// untrusted device are keyed HMACs of the plaintext hashes; the
+// untrusted device cannot verify data, while trusted devices verify the
+// plaintext hash after decryption as usual.
+
+const (
+	// KeySize is the size of a folder encryption key, in bytes.
+	KeySize = 32
+
+	keyIterations = 4096 // PBKDF2 iterations for folder keys
+	nameNonceSize = 8    // nonce prefix on each encrypted name component
+	nonceSize     = 24   // XSalsa20 nonce size
+	blockMACSize  = 32   // HMAC-SHA256 tag on each encrypted block
+
+	// blockOverhead is the number of bytes added to each block by
+	// sealBlock: the random nonce in front and the MAC at the end.
+	blockOverhead = nonceSize + blockMACSize
+)
+
+var (
+	errDecryptName  = errors.New("cannot decrypt name")
+	errDecryptBlock = errors.New("cannot decrypt block")
+)
+
+// FolderKeyProvider is implemented by models that know the encryption
+// keys for folders shared with untrusted devices. A nil key means the
+// folder is not encrypted towards that device.
+type FolderKeyProvider interface {
+	FolderEncryptionKey(device DeviceID, folder string) *[KeySize]byte
+}
+
+// KeyFromPassword derives a folder encryption key from the folder ID and
+// password. The folder ID acts as salt, so the same password on two
+// folders results in different keys.
+func KeyFromPassword(folder, password string) *[KeySize]byte {
+	var key [KeySize]byte
+	bs := pbkdf2.Key([]byte(password), []byte("syncthing"+folder), keyIterations, KeySize, sha256.New)
+	copy(key[:], bs)
+	return &key
+}
+
+// fileKey returns the key used for the data blocks of the named file.
+func fileKey(name string, folderKey *[KeySize]byte) *[KeySize]byte {
+	mac := hmac.New(sha256.New, folderKey[:])
+	mac.Write([]byte(name))
+	var key [KeySize]byte
+	copy(key[:], mac.Sum(nil))
+	return &key
+}
+
+// blockMACKey returns the authentication key for blocks of a file,
+// derived from but distinct from the cipher key.
+func blockMACKey(key *[KeySize]byte) *[KeySize]byte {
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte("mac"))
+	var macKey [KeySize]byte
+	copy(macKey[:], mac.Sum(nil))
+	return &macKey
+}
+
+// sealBlock encrypts a plaintext block under a fresh random nonce and
+// authenticates it. The result is the nonce, the ciphertext and the MAC
+// concatenated, blockOverhead bytes longer than the plaintext. A fresh
+// nonce on every call means writing new content to a block never reuses
+// a keystream.
+func sealBlock(plain []byte, key *[KeySize]byte) ([]byte, error) {
+	out := make([]byte, nonceSize+len(plain)+blockMACSize)
+	if _, err := rand.Read(out[:nonceSize]); err != nil {
+		return nil, err
+	}
+	salsa20.XORKeyStream(out[nonceSize:nonceSize+len(plain)], plain, out[:nonceSize], (*[32]byte)(key))
+	mac := hmac.New(sha256.New, blockMACKey(key)[:])
+	mac.Write(out[:nonceSize+len(plain)])
+	mac.Sum(out[:nonceSize+len(plain)])
+	return out, nil
+}
+
+// openBlock verifies and decrypts a block produced by sealBlock,
+// returning the plaintext. Truncated or tampered blocks are rejected.
+func openBlock(bs []byte, key *[KeySize]byte) ([]byte, error) {
+	if len(bs) < blockOverhead {
+		return nil, errDecryptBlock
+	}
+	data, tag := bs[:len(bs)-blockMACSize], bs[len(bs)-blockMACSize:]
+	mac := hmac.New(sha256.New, blockMACKey(key)[:])
+	mac.Write(data)
+	if !hmac.Equal(mac.Sum(nil), tag) {
+		return nil, errDecryptBlock
+	}
+	plain := make([]byte, len(data)-nonceSize)
+	salsa20.XORKeyStream(plain, data[nonceSize:], data[:nonceSize], (*[32]byte)(key))
+	return plain, nil
+}
+
+// encryptedBlockHash returns the keyed hash announced to untrusted
+// devices in place of the plaintext block hash.
+func encryptedBlockHash(hash []byte, folderKey *[KeySize]byte) []byte {
+	mac := hmac.New(sha256.New, folderKey[:])
+	mac.Write(hash)
+	return mac.Sum(nil)
+}
+
+// encryptName encrypts each path component of the given slash separated
+// name. Encryption is deterministic: the same component always encrypts
+// to the same string, so the untrusted device sees a stable directory
+// structure without learning any names.
+func encryptName(name string, key *[KeySize]byte) string {
+	comps := strings.Split(name, "/")
+	for i, comp := range comps {
+		comps[i] = encryptNameComponent(comp, key)
+	}
+	return strings.Join(comps, "/")
+}
+
+// decryptName decrypts a name produced by encryptName.
+func decryptName(name string, key *[KeySize]byte) (string, error) {
+	comps := strings.Split(name, "/")
+	for i, comp := range comps {
+		dec, err := decryptNameComponent(comp, key)
+		if err != nil {
+			return "", err
+		}
+		comps[i] = dec
+	}
+	return strings.Join(comps, "/"), nil
+}
+
+func encryptNameComponent(comp string, key *[KeySize]byte) string {
+	// The nonce is derived from the component itself, truncated and
+	// carried in front of the ciphertext so that decryption can recover
+	// it. Different components get different keystreams, while the same
+	// component always encrypts identically.
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte(comp))
+	var nonce [nonceSize]byte
+	copy(nonce[:], mac.Sum(nil)[:nameNonceSize])
+
+	bs := make([]byte, nameNonceSize+len(comp))
+	copy(bs, nonce[:nameNonceSize])
+	salsa20.XORKeyStream(bs[nameNonceSize:], []byte(comp), nonce[:], (*[32]byte)(key))
+	return strings.TrimRight(base32.HexEncoding.EncodeToString(bs), "=")
+}
+
+func decryptNameComponent(comp string, key *[KeySize]byte) (string, error) {
+	if pad := len(comp) % 8; pad != 0 {
+		comp += strings.Repeat("=", 8-pad)
+	}
+	bs, err := base32.HexEncoding.DecodeString(comp)
+	if err != nil {
+		return "", errDecryptName
+	}
+	if len(bs) < nameNonceSize {
+		return "", errDecryptName
+	}
+	var nonce [nonceSize]byte
+	copy(nonce[:], bs[:nameNonceSize])
+	out := make([]byte, len(bs)-nameNonceSize)
+	salsa20.XORKeyStream(out, bs[nameNonceSize:], nonce[:], (*[32]byte)(key))
+	return string(out), nil
+}
+
+// encryptFileInfo returns the file as announced to an untrusted device:
+// encrypted name and symlink target, keyed block hashes and no weak
+// hashes. Each block grows by blockOverhead bytes for the nonce and MAC
+// added by sealBlock, so block sizes, offsets and the file size are
+// adjusted accordingly. The whole file digest describes the plaintext
+// and is dropped.
+func encryptFileInfo(fi FileInfo, key *[KeySize]byte) FileInfo {
+	enc := fi
+	enc.Name = encryptName(fi.Name, key)
+	if fi.SymlinkTarget != "" {
+		enc.SymlinkTarget = encryptNameComponent(fi.SymlinkTarget, key)
+	}
+	if len(fi.Blocks) > 0 {
+		blocks := make([]BlockInfo, len(fi.Blocks))
+		for i, b := range fi.Blocks {
+			blocks[i] = BlockInfo{
+				Offset: b.Offset + int64(i)*blockOverhead,
+				Size:   b.Size + blockOverhead,
+				Hash:   encryptedBlockHash(b.Hash, key),
+			}
+		}
+		enc.Blocks = blocks
+		enc.Size = fi.Size + int64(len(fi.Blocks))*blockOverhead
+		if fi.RawBlockSize > 0 {
+			enc.RawBlockSize = fi.RawBlockSize + blockOverhead
+		}
+		enc.BlocksHash = nil
+	}
+	return enc
+}
+
+// decryptFileInfo reverses the name encryption done by encryptFileInfo
+// and restores the plaintext block sizes and offsets. Block hashes are
+// keyed HMACs and cannot be reversed; they are passed through as is.
+func decryptFileInfo(fi FileInfo, key *[KeySize]byte) (FileInfo, error) {
+	dec := fi
+	name, err := decryptName(fi.Name, key)
+	if err != nil {
+		return fi, err
+	}
+	dec.Name = name
+	if fi.SymlinkTarget != "" {
+		target, err := decryptNameComponent(fi.SymlinkTarget, key)
+		if err != nil {
+			return fi, err
+		}
+		dec.SymlinkTarget = target
+	}
+	if len(fi.Blocks) > 0 {
+		blocks := make([]BlockInfo, len(fi.Blocks))
+		for i, b := range fi.Blocks {
+			blocks[i] = BlockInfo{
+				Offset: b.Offset - int64(i)*blockOverhead,
+				Size:   b.Size - blockOverhead,
+				Hash:   b.Hash,
+			}
+		}
+		dec.Blocks = blocks
+		dec.Size = fi.Size - int64(len(fi.Blocks))*blockOverhead
+		if fi.RawBlockSize > blockOverhead {
+			dec.RawBlockSize = fi.RawBlockSize - blockOverhead
+		}
+	}
+	return dec, nil
+}
+
+// encryptedModel wraps a Model, transparently handling messages arriving
+// from an untrusted device: index entries have their names decrypted,
+// and served request data is encrypted before it goes back out.
+type encryptedModel struct {
+	Model
+	keyFor func(folder string) *[KeySize]byte
+}
+
+func newEncryptedModel(m Model, deviceID DeviceID, kp FolderKeyProvider) encryptedModel {
+	return encryptedModel{
+		Model: m,
+		keyFor: func(folder string) *[KeySize]byte {
+			return kp.FolderEncryptionKey(deviceID, folder)
+		},
+	}
+}
+
+func (m encryptedModel) Index(deviceID DeviceID, folder string, files []FileInfo) {
+	if key := m.keyFor(folder); key != nil {
+		files = decryptFileInfos(files, key)
+	}
+	m.Model.Index(deviceID, folder, files)
+}
+
+func (m encryptedModel) IndexUpdate(deviceID DeviceID, folder string, files []FileInfo) {
+	if key := m.keyFor(folder); key != nil {
+		files = decryptFileInfos(files, key)
+	}
+	m.Model.IndexUpdate(deviceID, folder, files)
+}
+
+func (m encryptedModel) Request(deviceID DeviceID, folder, name string, blockNo int, size int32, offset int64, hash []byte, weakHash uint32, fromTemporary bool) (RequestResponse, error) {
+	key := m.keyFor(folder)
+	if key == nil {
+		return m.Model.Request(deviceID, folder, name, blockNo, size, offset, hash, weakHash, fromTemporary)
+	}
+
+	plainName, err := decryptName(name, key)
+	if err != nil {
+		return nil, ErrNoSuchFile
+	}
+
+	// The untrusted device requests the block as announced to it, with
+	// the per block overhead included in the size and the offsets of the
+	// preceding blocks. Translate back to the plaintext dimensions.
+	plainSize := size - blockOverhead
+	plainOffset := offset - int64(blockNo)*blockOverhead
+	if blockNo < 0 || plainSize < 0 || plainOffset < 0 {
+		return nil, ErrInvalid
+	}
+
+	// The hash sent by the untrusted device is keyed and doesn't match
+	// the plaintext, so we don't pass it on for validation.
+	res, err := m.Model.Request(deviceID, folder, plainName, blockNo, plainSize, plainOffset, nil, 0, fromTemporary)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := sealBlock(res.Data(), fileKey(plainName, key))
+	if err != nil {
+		res.Close()
+		return nil, err
+	}
+	return encryptedRequestResponse{RequestResponse: res, data: enc}, nil
+}
+
+// encryptedRequestResponse carries the sealed block data while keeping
+// the lifecycle (Close, Wait) of the underlying response, so the
+// plaintext buffer is returned to its pool as usual.
+type encryptedRequestResponse struct {
+	RequestResponse
+	data []byte
+}
+
+func (r encryptedRequestResponse) Data() []byte {
+	return r.data
+}
+
+func (m encryptedModel) DownloadProgress(deviceID DeviceID, folder string, updates []FileDownloadProgressUpdate) {
+	if m.keyFor(folder) != nil {
+		// Progress updates from an untrusted device refer to encrypted
+		// names; there is nothing useful we can do with them.
+		return
+	}
+	m.Model.DownloadProgress(deviceID, folder, updates)
+}
+
+func decryptFileInfos(files []FileInfo, key *[KeySize]byte) []FileInfo {
+	out := make([]FileInfo, 0, len(files))
+	for _, fi := range files {
+		dec, err := decryptFileInfo(fi, key)
+		if err != nil {
+			l.Debugf("dropping index entry with undecryptable name %q: %v", fi.Name, err)
+			continue
+		}
+		out = append(out, dec)
+	}
+	return out
+}
+
+// encryptedConnection wraps a Connection to an untrusted device,
+// encrypting outgoing index entries and decrypting request responses for
+// the configured folders. Folders without a key pass through untouched.
+type encryptedConnection struct {
+	Connection
+	keys map[string]*[KeySize]byte
+}
+
+// NewEncryptedConnection wraps the given connection such that the
+// folders present in keys are sent and requested in encrypted form.
+func NewEncryptedConnection(keys map[string]*[KeySize]byte, conn Connection) Connection {
+	return encryptedConnection{Connection: conn, keys: keys}
+}
+
+func (c encryptedConnection) Index(folder string, files []FileInfo) error {
+	if key := c.keys[folder]; key != nil {
+		files = encryptFileInfos(files, key)
+	}
+	return c.Connection.Index(folder, files)
+}
+
+func (c encryptedConnection) IndexUpdate(folder string, files []FileInfo) error {
+	if key := c.keys[folder]; key != nil {
+		files = encryptFileInfos(files, key)
+	}
+	return c.Connection.IndexUpdate(folder, files)
+}
+
+func (c encryptedConnection) Request(folder string, name string, blockNo int, offset int64, size int, hash []byte, weakHash uint32, fromTemporary bool, deltaHashes []byte) ([]byte, bool, error) {
+	key := c.keys[folder]
+	if key == nil {
+		return c.Connection.Request(folder, name, blockNo, offset, size, hash, weakHash, fromTemporary, deltaHashes)
+	}
+
+	// The untrusted device stores sealed blocks, each blockOverhead bytes
+	// larger than its plaintext, so the ciphertext block sits at the
+	// plaintext offset shifted by the overhead of the preceding blocks.
+	// Delta hashes describe our plaintext and are meaningless against the
+	// peer's ciphertext, so they are not passed on.
+	cipherOffset := offset + int64(blockNo)*blockOverhead
+	bs, _, err := c.Connection.Request(folder, encryptName(name, key), blockNo, cipherOffset, size+blockOverhead, nil, 0, fromTemporary, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	plain, err := openBlock(bs, fileKey(name, key))
+	if err != nil {
+		return nil, false, err
+	}
+	return plain, false, nil
+}
+
+func (c encryptedConnection) DownloadProgress(folder string, updates []FileDownloadProgressUpdate) {
+	if c.keys[folder] != nil {
+		// Don't leak plaintext names to the untrusted side.
+		return
+	}
+	c.Connection.DownloadProgress(folder, updates)
+}
+
+func encryptFileInfos(files []FileInfo, key *[KeySize]byte) []FileInfo {
+	out := make([]FileInfo, len(files))
+	for i, fi := range files {
+		out[i] = encryptFileInfo(fi, key)
+	}
+	return out
+}
@@ -0,0 +1,149 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package protocol
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestKeyFromPassword(t *testing.T) {
+	k0 := KeyFromPassword("folder", "password")
+	k1 := KeyFromPassword("folder", "password")
+	if *k0 != *k1 {
+		t.Error("key derivation should be deterministic")
+	}
+	if *KeyFromPassword("folder", "other") == *k0 {
+		t.Error("different passwords should give different keys")
+	}
+	if *KeyFromPassword("other", "password") == *k0 {
+		t.Error("different folders should give different keys")
+	}
+}
+
+func TestEncryptName(t *testing.T) {
+	key := KeyFromPassword("folder", "password")
+
+	name := "dir with spaces/räksmörgås.txt"
+	enc := encryptName(name, key)
+
+	if strings.Contains(enc, "räksmörgås") {
+		t.Error("name should not be visible in ciphertext")
+	}
+	if strings.Count(enc, "/") != 1 {
+		t.Error("directory structure should be preserved")
+	}
+	if enc != encryptName(name, key) {
+		t.Error("name encryption should be deterministic")
+	}
+
+	dec, err := decryptName(enc, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec != name {
+		t.Errorf("got %q, expected %q", dec, name)
+	}
+
+	if _, err := decryptName("notbase32/&", key); err == nil {
+		t.Error("expected error on undecryptable name")
+	}
+}
+
+func TestSealOpenBlock(t *testing.T) {
+	key := KeyFromPassword("folder", "password")
+	fk := fileKey("file", key)
+
+	plain := []byte("some plaintext block data")
+
+	enc, err := sealBlock(plain, fk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(enc) != len(plain)+blockOverhead {
+		t.Errorf("sealed block is %d bytes, expected %d", len(enc), len(plain)+blockOverhead)
+	}
+	if bytes.Contains(enc, plain) {
+		t.Error("plaintext should not be visible in ciphertext")
+	}
+
+	other, err := sealBlock(plain, fk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(other, enc) {
+		t.Error("sealing twice should give different ciphertext")
+	}
+
+	dec, err := openBlock(enc, fk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dec, plain) {
+		t.Error("decryption should recover the plaintext")
+	}
+
+	enc[nonceSize] ^= 0xff
+	if _, err := openBlock(enc, fk); err == nil {
+		t.Error("expected error on tampered ciphertext")
+	}
+	if _, err := openBlock(enc[:blockOverhead-1], fk); err == nil {
+		t.Error("expected error on truncated ciphertext")
+	}
+}
+
+func TestEncryptFileInfo(t *testing.T) {
+	key := KeyFromPassword("folder", "password")
+
+	fi := FileInfo{
+		Name: "dir/file",
+		Size: 45,
+		Blocks: []BlockInfo{
+			{Offset: 0, Size: 20, Hash: []byte("block0hash"), WeakHash: 1234},
+			{Offset: 20, Size: 25, Hash: []byte("block1hash"), WeakHash: 5678},
+		},
+	}
+
+	enc := encryptFileInfo(fi, key)
+	if enc.Name == fi.Name {
+		t.Error("name should be encrypted")
+	}
+	if enc.Size != fi.Size+int64(len(fi.Blocks))*blockOverhead {
+		t.Error("size should grow by the per block overhead")
+	}
+	for i, b := range enc.Blocks {
+		if bytes.Equal(b.Hash, fi.Blocks[i].Hash) {
+			t.Error("block hash should be keyed")
+		}
+		if b.WeakHash != 0 {
+			t.Error("weak hash should not be disclosed")
+		}
+		if b.Size != fi.Blocks[i].Size+blockOverhead {
+			t.Error("block size should grow by the overhead")
+		}
+		if b.Offset != fi.Blocks[i].Offset+int64(i)*blockOverhead {
+			t.Error("block offset should shift by the preceding overhead")
+		}
+	}
+
+	dec, err := decryptFileInfo(enc, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec.Name != fi.Name {
+		t.Errorf("got %q, expected %q", dec.Name, fi.Name)
+	}
+	if dec.Size != fi.Size {
+		t.Error("size should be restored")
+	}
+	for i, b := range dec.Blocks {
+		if b.Offset != fi.Blocks[i].Offset || b.Size != fi.Blocks[i].Size {
+			t.Error("block offsets and sizes should be restored")
+		}
+	}
+}
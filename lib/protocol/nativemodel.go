@@ -0,0 +1,113 @@
+// Copyright (C) 2014 The Protocol Authors.
+
+package protocol
+
+import (
+	"fmt"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalization is the Unicode normalization form applied to file names in
+// incoming index updates and requests.
+type Normalization int
+
+const (
+	NormalizationDefault Normalization = iota // the platform preference
+	NormalizationNone
+	NormalizationNFC
+	NormalizationNFD
+)
+
+// NormalizationFromString parses a normalization form name as used in the
+// configuration. The empty string means the platform default.
+func NormalizationFromString(s string) (Normalization, error) {
+	switch s {
+	case "", "default":
+		return NormalizationDefault, nil
+	case "none":
+		return NormalizationNone, nil
+	case "nfc":
+		return NormalizationNFC, nil
+	case "nfd":
+		return NormalizationNFD, nil
+	default:
+		return NormalizationDefault, fmt.Errorf("unknown normalization form %q", s)
+	}
+}
+
+func (n Normalization) normalize(s string) string {
+	switch n {
+	case NormalizationNFC:
+		return norm.NFC.String(s)
+	case NormalizationNFD:
+		return norm.NFD.String(s)
+	default:
+		return s
+	}
+}
+
+// folderNormalizer is an optional interface for receivers that want
+// per-folder control over the normalization applied to incoming names.
+// Receivers not implementing it get the platform default everywhere.
+type folderNormalizer interface {
+	FolderNormalization(folder string) Normalization
+}
+
+// nativeModel converts incoming names from the wire format to the native
+// one: it fixes up path separators as needed for the platform and applies
+// the configured Unicode normalization form.
+type nativeModel struct {
+	Model
+	normFor func(folder string) Normalization
+}
+
+func newNativeModel(m Model) nativeModel {
+	nm := nativeModel{Model: m}
+	if fn, ok := m.(folderNormalizer); ok {
+		nm.normFor = fn.FolderNormalization
+	}
+	return nm
+}
+
+func (m nativeModel) normalization(folder string) Normalization {
+	n := NormalizationDefault
+	if m.normFor != nil {
+		n = m.normFor(folder)
+	}
+	if n == NormalizationDefault {
+		n = platformNormalization
+	}
+	return n
+}
+
+func (m nativeModel) Index(deviceID DeviceID, folder string, files []FileInfo) {
+	files = fixupFiles(files)
+	if n := m.normalization(folder); n != NormalizationNone {
+		for i := range files {
+			files[i].Name = n.normalize(files[i].Name)
+		}
+	}
+	m.Model.Index(deviceID, folder, files)
+}
+
+func (m nativeModel) IndexUpdate(deviceID DeviceID, folder string, files []FileInfo) {
+	files = fixupFiles(files)
+	if n := m.normalization(folder); n != NormalizationNone {
+		for i := range files {
+			files[i].Name = n.normalize(files[i].Name)
+		}
+	}
+	m.Model.IndexUpdate(deviceID, folder, files)
+}
+
+func (m nativeModel) Request(deviceID DeviceID, folder, name string, blockNo int, size int32, offset int64, hash []byte, weakHash uint32, fromTemporary bool) (RequestResponse, error) {
+	name, err := fixupName(name)
+	if err != nil {
+		return nil, err
+	}
+	if n := m.normalization(folder); n != NormalizationNone {
+		name = n.normalize(name)
+	}
+	return m.Model.Request(deviceID, folder, name, blockNo, size, offset, hash, weakHash, fromTemporary)
+}
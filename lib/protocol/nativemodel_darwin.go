@@ -4,29 +4,14 @@
 
 package protocol
 
-// Darwin uses NFD normalization
+// Darwin uses NFD normalization and slashes, like the wire format.
 
-import "golang.org/x/text/unicode/norm"
+const platformNormalization = NormalizationNFD
 
-type nativeModel struct {
-	Model
+func fixupFiles(files []FileInfo) []FileInfo {
+	return files
 }
 
-func (m nativeModel) Index(deviceID DeviceID, folder string, files []FileInfo) {
-	for i := range files {
-		files[i].Name = norm.NFD.String(files[i].Name)
-	}
-	m.Model.Index(deviceID, folder, files)
-}
-
-func (m nativeModel) IndexUpdate(deviceID DeviceID, folder string, files []FileInfo) {
-	for i := range files {
-		files[i].Name = norm.NFD.String(files[i].Name)
-	}
-	m.Model.IndexUpdate(deviceID, folder, files)
-}
-
-func (m nativeModel) Request(deviceID DeviceID, folder, name string, size int32, offset int64, hash []byte, weakHash uint32, fromTemporary bool) (RequestResponse, error) {
-	name = norm.NFD.String(name)
-	return m.Model.Request(deviceID, folder, name, size, offset, hash, weakHash, fromTemporary)
+func fixupName(name string) (string, error) {
+	return name, nil
 }
@@ -0,0 +1,100 @@
+// Copyright (C) 2014 The Protocol Authors.
+
+package protocol
+
+import (
+	"testing"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+type recordingModel struct {
+	Model
+	indexed   []string
+	requested []string
+}
+
+func (m *recordingModel) Index(deviceID DeviceID, folder string, files []FileInfo) {
+	for _, f := range files {
+		m.indexed = append(m.indexed, f.Name)
+	}
+}
+
+func (m *recordingModel) IndexUpdate(deviceID DeviceID, folder string, files []FileInfo) {
+	m.Index(deviceID, folder, files)
+}
+
+func (m *recordingModel) Request(deviceID DeviceID, folder, name string, blockNo int, size int32, offset int64, hash []byte, weakHash uint32, fromTemporary bool) (RequestResponse, error) {
+	m.requested = append(m.requested, name)
+	return nil, nil
+}
+
+func TestNativeModelNormalization(t *testing.T) {
+	nfcName := norm.NFC.String("räksmörgås")
+	nfdName := norm.NFD.String(nfcName)
+	if nfcName == nfdName {
+		t.Fatal("test name does not exercise normalization")
+	}
+
+	cases := []struct {
+		mode Normalization
+		in   string
+		want string
+	}{
+		{NormalizationNone, nfdName, nfdName},
+		{NormalizationNone, nfcName, nfcName},
+		{NormalizationNFC, nfdName, nfcName},
+		{NormalizationNFD, nfcName, nfdName},
+	}
+
+	for _, tc := range cases {
+		rec := &recordingModel{}
+		m := nativeModel{Model: rec, normFor: func(string) Normalization { return tc.mode }}
+
+		m.Index(LocalDeviceID, "default", []FileInfo{{Name: tc.in}})
+		m.IndexUpdate(LocalDeviceID, "default", []FileInfo{{Name: tc.in}})
+		m.Request(LocalDeviceID, "default", tc.in, 0, 0, 0, nil, 0, false)
+
+		for _, got := range rec.indexed {
+			if got != tc.want {
+				t.Errorf("mode %v: indexed %q, want %q", tc.mode, got, tc.want)
+			}
+		}
+		for _, got := range rec.requested {
+			if got != tc.want {
+				t.Errorf("mode %v: requested %q, want %q", tc.mode, got, tc.want)
+			}
+		}
+	}
+}
+
+func TestNativeModelNormalizationRoundTrip(t *testing.T) {
+	// An NFC-only folder receiving an NFD spelling must end up with the
+	// same name as when it receives the NFC spelling, so the entry doesn't
+	// ping-pong as a change between differently normalizing devices.
+	nfcName := norm.NFC.String("räksmörgås")
+	nfdName := norm.NFD.String(nfcName)
+
+	rec := &recordingModel{}
+	m := nativeModel{Model: rec, normFor: func(string) Normalization { return NormalizationNFC }}
+
+	m.Index(LocalDeviceID, "default", []FileInfo{{Name: nfdName}})
+	m.Index(LocalDeviceID, "default", []FileInfo{{Name: nfcName}})
+
+	if len(rec.indexed) != 2 || rec.indexed[0] != rec.indexed[1] {
+		t.Errorf("NFC and NFD spellings indexed differently: %q", rec.indexed)
+	}
+	if rec.indexed[0] != nfcName {
+		t.Errorf("indexed %q, want %q", rec.indexed[0], nfcName)
+	}
+}
+
+func TestNewNativeModelDetectsNormalizer(t *testing.T) {
+	m := newNativeModel(&recordingModel{})
+	if m.normFor != nil {
+		t.Error("recordingModel should not be a folderNormalizer")
+	}
+	if n := m.normalization("default"); n != platformNormalization {
+		t.Errorf("got %v, want platform default %v", n, platformNormalization)
+	}
+}
@@ -6,6 +6,12 @@ package protocol
 
 // Normal Unixes uses NFC and slashes, which is the wire format.
 
-type nativeModel struct {
-	Model
+const platformNormalization = NormalizationNone
+
+func fixupFiles(files []FileInfo) []FileInfo {
+	return files
+}
+
+func fixupName(name string) (string, error) {
+	return name, nil
 }
@@ -4,35 +4,21 @@
 
 package protocol
 
-// Windows uses backslashes as file separator
+// Windows uses backslashes as file separator and no normalization.
 
 import (
 	"path/filepath"
 	"strings"
 )
 
-type nativeModel struct {
-	Model
-}
-
-func (m nativeModel) Index(deviceID DeviceID, folder string, files []FileInfo) {
-	files = fixupFiles(files)
-	m.Model.Index(deviceID, folder, files)
-}
+const platformNormalization = NormalizationNone
 
-func (m nativeModel) IndexUpdate(deviceID DeviceID, folder string, files []FileInfo) {
-	files = fixupFiles(files)
-	m.Model.IndexUpdate(deviceID, folder, files)
-}
-
-func (m nativeModel) Request(deviceID DeviceID, folder, name string, size int32, offset int64, hash []byte, weakHash uint32, fromTemporary bool) (RequestResponse, error) {
+func fixupName(name string) (string, error) {
 	if strings.Contains(name, `\`) {
 		l.Warnf("Dropping request for %s, contains invalid path separator", name)
-		return nil, ErrNoSuchFile
+		return "", ErrNoSuchFile
 	}
-
-	name = filepath.FromSlash(name)
-	return m.Model.Request(deviceID, folder, name, size, offset, hash, weakHash, fromTemporary)
+	return filepath.FromSlash(name), nil
 }
 
 func fixupFiles(files []FileInfo) []FileInfo {
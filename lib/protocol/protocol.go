@@ -14,6 +14,8 @@ import (
 	"time"
 
 	lz4 "github.com/bkaradzic/go-lz4"
+
+	"github.com/syncthing/syncthing/lib/blockdelta"
 )
 
 const (
@@ -126,7 +128,7 @@ type Model interface {
 	// An index update was received from the peer device
 	IndexUpdate(deviceID DeviceID, folder string, files []FileInfo)
 	// A request was made by the peer device
-	Request(deviceID DeviceID, folder, name string, size int32, offset int64, hash []byte, weakHash uint32, fromTemporary bool) (RequestResponse, error)
+	Request(deviceID DeviceID, folder, name string, blockNo int, size int32, offset int64, hash []byte, weakHash uint32, fromTemporary bool) (RequestResponse, error)
 	// A cluster configuration message was received
 	ClusterConfig(deviceID DeviceID, config ClusterConfig)
 	// The peer device closed the connection
@@ -147,7 +149,7 @@ type Connection interface {
 	Name() string
 	Index(folder string, files []FileInfo) error
 	IndexUpdate(folder string, files []FileInfo) error
-	Request(folder string, name string, offset int64, size int, hash []byte, weakHash uint32, fromTemporary bool) ([]byte, error)
+	Request(folder string, name string, blockNo int, offset int64, size int, hash []byte, weakHash uint32, fromTemporary bool, deltaHashes []byte) ([]byte, bool, error)
 	ClusterConfig(config ClusterConfig)
 	DownloadProgress(folder string, updates []FileDownloadProgressUpdate)
 	Statistics() Statistics
@@ -177,8 +179,9 @@ type rawConnection struct {
 }
 
 type asyncResult struct {
-	val []byte
-	err error
+	val   []byte
+	delta bool
+	err   error
 }
 
 type message interface {
@@ -206,10 +209,18 @@ func NewConnection(deviceID DeviceID, reader io.Reader, writer io.Writer, receiv
 	cr := &countingReader{Reader: reader}
 	cw := &countingWriter{Writer: writer}
 
+	var model Model = newNativeModel(receiver)
+	if kp, ok := receiver.(FolderKeyProvider); ok {
+		// The receiver knows about folders encrypted towards untrusted
+		// devices; handle decryption of names and encryption of served
+		// data transparently.
+		model = newEncryptedModel(model, deviceID, kp)
+	}
+
 	c := rawConnection{
 		id:          deviceID,
 		name:        name,
-		receiver:    nativeModel{receiver},
+		receiver:    model,
 		cr:          cr,
 		cw:          cw,
 		awaiting:    make(map[int32]chan asyncResult),
@@ -271,7 +282,10 @@ func (c *rawConnection) IndexUpdate(folder string, idx []FileInfo) error {
 }
 
 // Request returns the bytes for the specified block after fetching them from the connected peer.
-func (c *rawConnection) Request(folder string, name string, offset int64, size int, hash []byte, weakHash uint32, fromTemporary bool) ([]byte, error) {
+// Request returns the requested data, or a blockdelta encoding of it
+// against the old block described by deltaHashes when the second return
+// value is true.
+func (c *rawConnection) Request(folder string, name string, blockNo int, offset int64, size int, hash []byte, weakHash uint32, fromTemporary bool, deltaHashes []byte) ([]byte, bool, error) {
 	c.nextIDMut.Lock()
 	id := c.nextID
 	c.nextID++
@@ -294,16 +308,18 @@ func (c *rawConnection) Request(folder string, name string, offset int64, size i
 		Hash:          hash,
 		WeakHash:      weakHash,
 		FromTemporary: fromTemporary,
+		DeltaHashes:   deltaHashes,
+		BlockNo:       int32(blockNo),
 	}, nil)
 	if !ok {
-		return nil, ErrClosed
+		return nil, false, ErrClosed
 	}
 
 	res, ok := <-rc
 	if !ok {
-		return nil, ErrClosed
+		return nil, false, ErrClosed
 	}
-	return res.val, res.err
+	return res.val, res.delta, res.err
 }
 
 // ClusterConfig send the cluster configuration message to the peer and returns any error
@@ -587,7 +603,7 @@ func checkFilename(name string) error {
 }
 
 func (c *rawConnection) handleRequest(req Request) {
-	res, err := c.receiver.Request(c.id, req.Folder, req.Name, req.Size, req.Offset, req.Hash, req.WeakHash, req.FromTemporary)
+	res, err := c.receiver.Request(c.id, req.Folder, req.Name, int(req.BlockNo), req.Size, req.Offset, req.Hash, req.WeakHash, req.FromTemporary)
 	if err != nil {
 		c.send(&Response{
 			ID:   req.ID,
@@ -595,11 +611,23 @@ func (c *rawConnection) handleRequest(req Request) {
 		}, nil)
 		return
 	}
+	data := res.Data()
+	delta := false
+	if len(req.DeltaHashes) > 0 {
+		// The requester has an old copy of this block and sent us its
+		// sub-chunk hashes; send a delta instead of the full data if
+		// that pays off.
+		if d := blockdelta.Encode(data, req.DeltaHashes); d != nil {
+			data = d
+			delta = true
+		}
+	}
 	done := make(chan struct{})
 	c.send(&Response{
-		ID:   req.ID,
-		Data: res.Data(),
-		Code: errorToCode(nil),
+		ID:    req.ID,
+		Data:  data,
+		Code:  errorToCode(nil),
+		Delta: delta,
 	}, done)
 	<-done
 	res.Close()
@@ -609,7 +637,7 @@ func (c *rawConnection) handleResponse(resp Response) {
 	c.awaitingMut.Lock()
 	if rc := c.awaiting[resp.ID]; rc != nil {
 		delete(c.awaiting, resp.ID)
-		rc <- asyncResult{resp.Data, codeToError(resp.Code)}
+		rc <- asyncResult{resp.Data, resp.Delta, codeToError(resp.Code)}
 		close(rc)
 	}
 	c.awaitingMut.Unlock()
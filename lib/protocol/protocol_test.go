@@ -14,6 +14,7 @@ import (
 	"testing"
 	"testing/quick"
 
+	"github.com/syncthing/syncthing/lib/blockdelta"
 	"github.com/syncthing/syncthing/lib/rand"
 )
 
@@ -42,6 +43,62 @@ func TestPing(t *testing.T) {
 	}
 }
 
+func TestRequestDelta(t *testing.T) {
+	m0 := newTestModel()
+	m1 := newTestModel()
+
+	// The remote's data is our old data with a small change.
+	old := make([]byte, 64<<10)
+	if _, err := io.ReadFull(rand.Reader, old); err != nil {
+		t.Fatal(err)
+	}
+	m1.data = make([]byte, len(old))
+	copy(m1.data, old)
+	copy(m1.data[32<<10:], []byte("a small change"))
+
+	ar, aw := io.Pipe()
+	br, bw := io.Pipe()
+
+	c0 := NewConnection(c0ID, ar, bw, m0, "name", CompressAlways).(wireFormatConnection).Connection.(*rawConnection)
+	c0.Start()
+	c1 := NewConnection(c1ID, br, aw, m1, "name", CompressAlways)
+	c1.Start()
+	c0.ClusterConfig(ClusterConfig{})
+	c1.ClusterConfig(ClusterConfig{})
+
+	// A request without delta hashes returns the full data.
+	data, delta, err := c0.Request("default", "file", 0, 0, len(m1.data), nil, 0, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delta {
+		t.Error("expected full data for a request without delta hashes")
+	}
+	if !bytes.Equal(data, m1.data) {
+		t.Error("full data mismatch")
+	}
+
+	// A request with delta hashes of our old data returns a delta that
+	// rebuilds the remote's data.
+	data, delta, err = c0.Request("default", "file", 0, 0, len(m1.data), nil, 0, false, blockdelta.Hashes(old))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !delta {
+		t.Fatal("expected a delta response for mostly unchanged data")
+	}
+	if len(data) >= len(m1.data) {
+		t.Errorf("delta not smaller than the data: %d >= %d", len(data), len(m1.data))
+	}
+	res, err := blockdelta.Apply(old, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, m1.data) {
+		t.Error("applied delta does not match the remote's data")
+	}
+}
+
 func TestClose(t *testing.T) {
 	m0 := newTestModel()
 	m1 := newTestModel()
@@ -72,7 +129,7 @@ func TestClose(t *testing.T) {
 	c0.Index("default", nil)
 	c0.Index("default", nil)
 
-	if _, err := c0.Request("default", "foo", 0, 0, nil, 0, false); err == nil {
+	if _, _, err := c0.Request("default", "foo", 0, 0, 0, nil, 0, false, nil); err == nil {
 		t.Error("Request should return an error")
 	}
 }
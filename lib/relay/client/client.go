@@ -26,11 +26,21 @@ type RelayClient interface {
 	Stop()
 	Error() error
 	Latency() time.Duration
+	Metrics() Metrics
 	String() string
 	Invitations() chan protocol.SessionInvitation
 	URI() *url.URL
 }
 
+// Metrics describes the state of a relay client; for a dynamic client it
+// covers the whole pool, for a static client just the one relay.
+type Metrics struct {
+	CurrentRelay   string                   `json:"currentRelay"`
+	CurrentLatency time.Duration            `json:"currentLatency"`
+	RelayLatency   map[string]time.Duration `json:"relayLatency"`
+	Switches       int                      `json:"switches"`
+}
+
 func NewClient(uri *url.URL, certs []tls.Certificate, invitations chan protocol.SessionInvitation, timeout time.Duration) (RelayClient, error) {
 	factory, ok := supportedSchemes[uri.Scheme]
 	if !ok {
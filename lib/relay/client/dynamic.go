@@ -24,12 +24,23 @@ type dynamicClient struct {
 	closeInvitationsOnFinish bool
 	timeout                  time.Duration
 
-	mut    sync.RWMutex
-	err    error
-	client RelayClient
-	stop   chan struct{}
+	mut          sync.RWMutex
+	err          error
+	client       RelayClient
+	stop         chan struct{}
+	relayLatency map[string]time.Duration
+	migrateTo    string
+	switches     int
 }
 
+const (
+	// How often we re-measure the latency to the relays in the pool while
+	// connected, and how much better a candidate has to be before we
+	// abandon a working relay for it.
+	evalInterval        = 5 * time.Minute
+	evalSwitchThreshold = 50 * time.Millisecond
+)
+
 func newDynamicClient(uri *url.URL, certs []tls.Certificate, invitations chan protocol.SessionInvitation, timeout time.Duration) RelayClient {
 	closeInvitationsOnFinish := false
 	if invitations == nil {
@@ -87,37 +98,112 @@ func (c *dynamicClient) Serve() {
 		addrs = append(addrs, ruri.String())
 	}
 
-	for _, addr := range relayAddressesOrder(addrs) {
-		select {
-		case <-c.stop:
-			l.Debugln(c, "stopping")
-			c.setError(nil)
-			return
-		default:
-			ruri, err := url.Parse(addr)
-			if err != nil {
-				l.Debugln(c, "skipping relay", addr, err)
-				continue
-			}
-			client, err := NewClient(ruri, c.certs, c.invitations, c.timeout)
-			if err != nil {
-				continue
+	for {
+		latencies := measureLatencies(addrs)
+		c.mut.Lock()
+		c.relayLatency = latencies
+		c.migrateTo = ""
+		c.mut.Unlock()
+
+		for _, addr := range relayAddressesOrder(addrs, latencies) {
+			select {
+			case <-c.stop:
+				l.Debugln(c, "stopping")
+				c.setError(nil)
+				return
+			default:
+				ruri, err := url.Parse(addr)
+				if err != nil {
+					l.Debugln(c, "skipping relay", addr, err)
+					continue
+				}
+				client, err := NewClient(ruri, c.certs, c.invitations, c.timeout)
+				if err != nil {
+					continue
+				}
+				c.mut.Lock()
+				c.client = client
+				c.mut.Unlock()
+
+				done := make(chan struct{})
+				go c.evaluate(addr, addrs, done)
+				c.client.Serve()
+				close(done)
+
+				c.mut.Lock()
+				c.client = nil
+				c.mut.Unlock()
 			}
-			c.mut.Lock()
-			c.client = client
-			c.mut.Unlock()
 
-			c.client.Serve()
+			c.mut.RLock()
+			migrate := c.migrateTo != ""
+			c.mut.RUnlock()
+			if migrate {
+				// The evaluation loop found a better relay and
+				// disconnected us; start over with fresh measurements so
+				// the ordering reflects it.
+				break
+			}
+		}
 
-			c.mut.Lock()
-			c.client = nil
-			c.mut.Unlock()
+		c.mut.RLock()
+		migrate := c.migrateTo != ""
+		c.mut.RUnlock()
+		if !migrate {
+			break
 		}
 	}
 	l.Debugln(c, "could not find a connectable relay")
 	c.setError(fmt.Errorf("could not find a connectable relay"))
 }
 
+// evaluate periodically re-measures the latency to every relay in the pool
+// while we are connected, and disconnects from the current relay when a
+// clearly better one is available. Serve picks up from there and
+// reconnects in the new order.
+func (c *dynamicClient) evaluate(current string, addrs []string, done chan struct{}) {
+	ticker := time.NewTicker(evalInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+
+		latencies := measureLatencies(addrs)
+		c.mut.Lock()
+		c.relayLatency = latencies
+		client := c.client
+		c.mut.Unlock()
+
+		best, bestLatency := "", time.Hour
+		for addr, latency := range latencies {
+			if latency < bestLatency {
+				best, bestLatency = addr, latency
+			}
+		}
+		if best == "" || best == current {
+			continue
+		}
+		if currentLatency, ok := latencies[current]; ok && bestLatency+evalSwitchThreshold >= currentLatency {
+			continue
+		}
+
+		l.Infof("Switching to relay %s (%v) from %s", best, bestLatency, current)
+		c.mut.Lock()
+		c.migrateTo = best
+		c.switches++
+		c.mut.Unlock()
+		if client != nil {
+			client.Stop()
+		}
+		return
+	}
+}
+
 func (c *dynamicClient) Stop() {
 	c.mut.RLock()
 	defer c.mut.RUnlock()
@@ -146,6 +232,25 @@ func (c *dynamicClient) Latency() time.Duration {
 	return c.client.Latency()
 }
 
+func (c *dynamicClient) Metrics() Metrics {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	m := Metrics{
+		RelayLatency: make(map[string]time.Duration, len(c.relayLatency)),
+		Switches:     c.switches,
+	}
+	for addr, latency := range c.relayLatency {
+		m.RelayLatency[addr] = latency
+	}
+	if c.client != nil {
+		if uri := c.client.URI(); uri != nil {
+			m.CurrentRelay = uri.String()
+		}
+		m.CurrentLatency = c.client.Latency()
+	}
+	return m
+}
+
 func (c *dynamicClient) String() string {
 	return fmt.Sprintf("DynamicClient:%p:%s@%s", c, c.URI(), c.pooladdr)
 }
@@ -189,18 +294,32 @@ type dynamicAnnouncement struct {
 	}
 }
 
-// relayAddressesOrder checks the latency to each relay, rounds latency down to
-// the closest 50ms, and puts them in buckets of 50ms latency ranges. Then
-// shuffles each bucket, and returns all addresses starting with the ones from
-// the lowest latency bucket, ending with the highest latency buceket.
-func relayAddressesOrder(input []string) []string {
-	buckets := make(map[int][]string)
-
+// measureLatencies checks the latency to each relay, using an hour to mean
+// unreachable.
+func measureLatencies(input []string) map[string]time.Duration {
+	latencies := make(map[string]time.Duration, len(input))
 	for _, relay := range input {
 		latency, err := osutil.GetLatencyForURL(relay)
 		if err != nil {
 			latency = time.Hour
 		}
+		latencies[relay] = latency
+	}
+	return latencies
+}
+
+// relayAddressesOrder rounds the measured latency down to the closest 50ms,
+// and puts the relays in buckets of 50ms latency ranges. Then shuffles each
+// bucket, and returns all addresses starting with the ones from the lowest
+// latency bucket, ending with the highest latency buceket.
+func relayAddressesOrder(input []string, latencies map[string]time.Duration) []string {
+	buckets := make(map[int][]string)
+
+	for _, relay := range input {
+		latency, ok := latencies[relay]
+		if !ok {
+			latency = time.Hour
+		}
 
 		id := int(latency/time.Millisecond) / 50
 
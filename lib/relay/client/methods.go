@@ -36,7 +36,8 @@ func GetInvitationFromRelay(uri *url.URL, id syncthingprotocol.DeviceID, certs [
 	defer conn.Close()
 
 	request := protocol.ConnectRequest{
-		ID: id[:],
+		ID:    id[:],
+		Token: uri.Query().Get("token"),
 	}
 
 	if err := protocol.WriteMessage(conn, request); err != nil {
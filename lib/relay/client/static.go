@@ -197,6 +197,18 @@ func (c *staticClient) Latency() time.Duration {
 	return lat
 }
 
+func (c *staticClient) Metrics() Metrics {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return Metrics{
+		CurrentRelay:   c.uri.String(),
+		CurrentLatency: c.latency,
+		RelayLatency: map[string]time.Duration{
+			c.uri.String(): c.latency,
+		},
+	}
+}
+
 func (c *staticClient) String() string {
 	return fmt.Sprintf("StaticClient:%p@%s", c, c.URI())
 }
@@ -275,7 +287,9 @@ func (c *staticClient) Error() error {
 }
 
 func (c *staticClient) join() error {
-	if err := protocol.WriteMessage(c.conn, protocol.JoinRelayRequest{}); err != nil {
+	// An empty token is fine on relays that don't require authentication.
+	token := c.uri.Query().Get("token")
+	if err := protocol.WriteMessage(c.conn, protocol.JoinRelayRequest{Token: token}); err != nil {
 		return err
 	}
 
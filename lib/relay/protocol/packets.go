@@ -31,9 +31,15 @@ type header struct {
 
 type Ping struct{}
 type Pong struct{}
-type JoinRelayRequest struct{}
 type RelayFull struct{}
 
+// The Token is used on relays that require authentication and is empty
+// otherwise. Clients predating the field send a zero length message, which
+// unmarshals to an empty token.
+type JoinRelayRequest struct {
+	Token string // max:512
+}
+
 type JoinSessionRequest struct {
 	Key []byte // max:32
 }
@@ -44,7 +50,8 @@ type Response struct {
 }
 
 type ConnectRequest struct {
-	ID []byte // max:32
+	ID    []byte // max:32
+	Token string // max:512
 }
 
 type SessionInvitation struct {
@@ -137,70 +137,90 @@ func (o *Pong) UnmarshalXDRFrom(u *xdr.Unmarshaller) error {
 
 /*
 
-JoinRelayRequest Structure:
+RelayFull Structure:
 (contains no fields)
 
 
-struct JoinRelayRequest {
+struct RelayFull {
 }
 
 */
 
-func (o JoinRelayRequest) XDRSize() int {
+func (o RelayFull) XDRSize() int {
 	return 0
 }
-func (o JoinRelayRequest) MarshalXDR() ([]byte, error) {
+func (o RelayFull) MarshalXDR() ([]byte, error) {
 	return nil, nil
 }
 
-func (o JoinRelayRequest) MustMarshalXDR() []byte {
+func (o RelayFull) MustMarshalXDR() []byte {
 	return nil
 }
 
-func (o JoinRelayRequest) MarshalXDRInto(m *xdr.Marshaller) error {
+func (o RelayFull) MarshalXDRInto(m *xdr.Marshaller) error {
 	return nil
 }
 
-func (o *JoinRelayRequest) UnmarshalXDR(bs []byte) error {
+func (o *RelayFull) UnmarshalXDR(bs []byte) error {
 	return nil
 }
 
-func (o *JoinRelayRequest) UnmarshalXDRFrom(u *xdr.Unmarshaller) error {
+func (o *RelayFull) UnmarshalXDRFrom(u *xdr.Unmarshaller) error {
 	return nil
 }
 
 /*
 
-RelayFull Structure:
-(contains no fields)
+JoinRelayRequest Structure:
+
+ 0                   1                   2                   3
+ 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
++-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+/                                                               /
+\                 Token (length + padded data)                  \
+/                                                               /
++-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 
 
-struct RelayFull {
+struct JoinRelayRequest {
+	string Token<512>;
 }
 
 */
 
-func (o RelayFull) XDRSize() int {
-	return 0
-}
-func (o RelayFull) MarshalXDR() ([]byte, error) {
-	return nil, nil
+func (o JoinRelayRequest) XDRSize() int {
+	return 4 + len(o.Token) + xdr.Padding(len(o.Token))
 }
 
-func (o RelayFull) MustMarshalXDR() []byte {
-	return nil
+func (o JoinRelayRequest) MarshalXDR() ([]byte, error) {
+	buf := make([]byte, o.XDRSize())
+	m := &xdr.Marshaller{Data: buf}
+	return buf, o.MarshalXDRInto(m)
 }
 
-func (o RelayFull) MarshalXDRInto(m *xdr.Marshaller) error {
-	return nil
+func (o JoinRelayRequest) MustMarshalXDR() []byte {
+	bs, err := o.MarshalXDR()
+	if err != nil {
+		panic(err)
+	}
+	return bs
 }
 
-func (o *RelayFull) UnmarshalXDR(bs []byte) error {
-	return nil
+func (o JoinRelayRequest) MarshalXDRInto(m *xdr.Marshaller) error {
+	if l := len(o.Token); l > 512 {
+		return xdr.ElementSizeExceeded("Token", l, 512)
+	}
+	m.MarshalString(o.Token)
+	return m.Error
 }
 
-func (o *RelayFull) UnmarshalXDRFrom(u *xdr.Unmarshaller) error {
-	return nil
+func (o *JoinRelayRequest) UnmarshalXDR(bs []byte) error {
+	u := &xdr.Unmarshaller{Data: bs}
+	return o.UnmarshalXDRFrom(u)
+}
+func (o *JoinRelayRequest) UnmarshalXDRFrom(u *xdr.Unmarshaller) error {
+	o.Token = u.UnmarshalStringMax(512)
+	return u.Error
 }
 
 /*
@@ -325,16 +345,22 @@ ConnectRequest Structure:
 \                   ID (length + padded data)                   \
 /                                                               /
 +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+/                                                               /
+\                 Token (length + padded data)                  \
+/                                                               /
++-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 
 
 struct ConnectRequest {
 	opaque ID<32>;
+	string Token<512>;
 }
 
 */
 
 func (o ConnectRequest) XDRSize() int {
-	return 4 + len(o.ID) + xdr.Padding(len(o.ID))
+	return 4 + len(o.ID) + xdr.Padding(len(o.ID)) +
+		4 + len(o.Token) + xdr.Padding(len(o.Token))
 }
 
 func (o ConnectRequest) MarshalXDR() ([]byte, error) {
@@ -356,6 +382,10 @@ func (o ConnectRequest) MarshalXDRInto(m *xdr.Marshaller) error {
 		return xdr.ElementSizeExceeded("ID", l, 32)
 	}
 	m.MarshalBytes(o.ID)
+	if l := len(o.Token); l > 512 {
+		return xdr.ElementSizeExceeded("Token", l, 512)
+	}
+	m.MarshalString(o.Token)
 	return m.Error
 }
 
@@ -365,6 +395,7 @@ func (o *ConnectRequest) UnmarshalXDR(bs []byte) error {
 }
 func (o *ConnectRequest) UnmarshalXDRFrom(u *xdr.Unmarshaller) error {
 	o.ID = u.UnmarshalBytesMax(32)
+	o.Token = u.UnmarshalStringMax(512)
 	return u.Error
 }
 
@@ -16,6 +16,7 @@ var (
 	ResponseSuccess           = Response{0, "success"}
 	ResponseNotFound          = Response{1, "not found"}
 	ResponseAlreadyConnected  = Response{2, "already connected"}
+	ResponsePermissionDenied  = Response{3, "permission denied"}
 	ResponseInternalError     = Response{99, "internal error"}
 	ResponseUnexpectedMessage = Response{100, "unexpected message"}
 )
@@ -104,6 +105,10 @@ func ReadMessage(r io.Reader) (interface{}, error) {
 		return msg, err
 	case messageTypeJoinRelayRequest:
 		var msg JoinRelayRequest
+		if len(buf) == 0 {
+			// Token-less request from an old client.
+			return msg, nil
+		}
 		err := msg.UnmarshalXDR(buf)
 		return msg, err
 	case messageTypeJoinSessionRequest:
@@ -117,6 +122,10 @@ func ReadMessage(r io.Reader) (interface{}, error) {
 	case messageTypeConnectRequest:
 		var msg ConnectRequest
 		err := msg.UnmarshalXDR(buf)
+		if err == io.ErrUnexpectedEOF && len(msg.ID) > 0 {
+			// Token-less request from an old client.
+			err = nil
+		}
 		return msg, err
 	case messageTypeSessionInvitation:
 		var msg SessionInvitation
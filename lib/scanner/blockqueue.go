@@ -9,12 +9,20 @@ package scanner
 import (
 	"context"
 	"errors"
+	"runtime"
 
 	"github.com/syncthing/syncthing/lib/fs"
 	"github.com/syncthing/syncthing/lib/protocol"
 	"github.com/syncthing/syncthing/lib/sync"
 )
 
+// hashSlots limits the number of files being hashed concurrently across
+// all folders. Each folder gets its own workers sized by its hashers
+// setting, but the CPU bound work itself draws from this shared pool. A
+// single scanning folder can thus use every core, while concurrent scans
+// interleave per file instead of being held to a static per-folder share.
+var hashSlots = make(chan struct{}, runtime.GOMAXPROCS(-1))
+
 // HashFile hashes the files and returns a list of blocks representing the file.
 func HashFile(ctx context.Context, fs fs.Filesystem, path string, blockSize int, counter Counter, useWeakHashes bool) ([]protocol.BlockInfo, error) {
 	fd, err := fs.Open(path)
@@ -104,13 +112,20 @@ func (ph *parallelHasher) hashFiles(ctx context.Context) {
 				panic("Bug. Asked to hash a directory or a deleted file.")
 			}
 
+			select {
+			case hashSlots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
 			blocks, err := HashFile(ctx, ph.fs, f.Name, f.BlockSize(), ph.counter, true)
+			<-hashSlots
 			if err != nil {
 				l.Debugln("hash error:", f.Name, err)
 				continue
 			}
 
 			f.Blocks = blocks
+			f.BlocksHash = protocol.BlocksHash(blocks)
 
 			// The size we saw when initially deciding to hash the file
 			// might not have been the size it actually had when we hashed
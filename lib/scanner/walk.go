@@ -56,6 +56,9 @@ type Config struct {
 	UseLargeBlocks bool
 	// Local flags to set on scanned files
 	LocalFlags uint32
+	// If InodeIndex is not nil, it is used to recognize renamed files by
+	// inode and reuse their block lists without rehashing.
+	InodeIndex InodeIndex
 }
 
 type CurrentFiler interface {
@@ -63,6 +66,13 @@ type CurrentFiler interface {
 	CurrentFile(name string) (protocol.FileInfo, bool)
 }
 
+type InodeIndex interface {
+	// LookupInode returns the name the inode was last scanned as.
+	LookupInode(ino uint64) (string, bool)
+	// RecordInode remembers the name for the inode.
+	RecordInode(ino uint64, name string)
+}
+
 type ScanResult struct {
 	File protocol.FileInfo
 	Err  error
@@ -316,15 +326,22 @@ func (w *walker) handleItem(ctx context.Context, path string, toHashChan chan<-
 		err = w.walkDir(ctx, path, info, finishedChan)
 
 	case info.IsRegular():
-		err = w.walkRegular(ctx, path, info, toHashChan)
+		err = w.walkRegular(ctx, path, info, toHashChan, finishedChan)
 	}
 
 	return err
 }
 
-func (w *walker) walkRegular(ctx context.Context, relPath string, info fs.FileInfo, toHashChan chan<- protocol.FileInfo) error {
+func (w *walker) walkRegular(ctx context.Context, relPath string, info fs.FileInfo, toHashChan chan<- protocol.FileInfo, finishedChan chan<- ScanResult) error {
 	curFile, hasCurFile := w.CurrentFiler.CurrentFile(relPath)
 
+	var ino uint64
+	if w.InodeIndex != nil {
+		if ino = fs.InodeID(info); ino != 0 {
+			defer w.InodeIndex.RecordInode(ino, relPath)
+		}
+	}
+
 	blockSize := protocol.MinBlockSize
 
 	if w.UseLargeBlocks {
@@ -365,6 +382,27 @@ func (w *walker) walkRegular(ctx context.Context, relPath string, info fs.FileIn
 		l.Debugln("rescan:", curFile, info.ModTime().Unix(), info.Mode()&fs.ModePerm)
 	}
 
+	if !hasCurFile && ino != 0 {
+		if prevName, ok := w.InodeIndex.LookupInode(ino); ok && prevName != relPath {
+			if prev, ok := w.CurrentFiler.CurrentFile(prevName); ok && prev.Type == protocol.FileInfoTypeFile && !prev.IsDeleted() && !prev.IsInvalid() &&
+				prev.Size == f.Size && prev.ModifiedS == f.ModifiedS && prev.ModifiedNs == f.ModifiedNs && len(prev.Blocks) > 0 {
+				// Same inode, size and modification time as a file we have
+				// already hashed under another name: a local rename or
+				// move. Reuse the block list instead of rehashing.
+				l.Debugln("reusing blocks of", prevName, "for renamed file", relPath)
+				f.Blocks = prev.Blocks
+				f.BlocksHash = prev.BlocksHash
+				f.RawBlockSize = prev.RawBlockSize
+				select {
+				case finishedChan <- ScanResult{File: f}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				return nil
+			}
+		}
+	}
+
 	l.Debugln("to hash:", relPath, f)
 
 	select {
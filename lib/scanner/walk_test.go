@@ -776,3 +776,79 @@ func (fcf fakeCurrentFiler) CurrentFile(name string) (protocol.FileInfo, bool) {
 	f, ok := fcf[name]
 	return f, ok
 }
+
+func TestInodeRenameReusesBlocks(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "syncthing-inode-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	testFs := fs.NewFilesystem(fs.FilesystemTypeBasic, tmp)
+
+	fd, err := testFs.Create("newname")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.Write([]byte("hello"))
+	fd.Close()
+
+	info, err := testFs.Lstat("newname")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ino := fs.InodeID(info)
+	if ino == 0 {
+		t.Skip("no inode IDs on this filesystem")
+	}
+
+	// A fake block list proves reuse: hashing would produce the real one.
+	marker := []protocol.BlockInfo{{Size: int32(info.Size()), Hash: []byte("marker")}}
+	prev := protocol.FileInfo{
+		Name:       "oldname",
+		Type:       protocol.FileInfoTypeFile,
+		Size:       info.Size(),
+		ModifiedS:  info.ModTime().Unix(),
+		ModifiedNs: int32(info.ModTime().Nanosecond()),
+		Blocks:     marker,
+		Version:    protocol.Vector{}.Update(1),
+	}
+	index := fakeInodeIndex{ino: "oldname"}
+
+	fchan := Walk(context.TODO(), Config{
+		Filesystem:    testFs,
+		AutoNormalize: true,
+		Hashers:       2,
+		CurrentFiler:  fakeCurrentFiler{"oldname": prev},
+		InodeIndex:    index,
+		ShortID:       protocol.LocalDeviceID.Short(),
+	})
+
+	var files []protocol.FileInfo
+	for f := range fchan {
+		if f.Err != nil {
+			t.Errorf("Error while scanning %v: %v", f.Err, f.Path)
+		}
+		files = append(files, f.File)
+	}
+
+	if len(files) != 1 || files[0].Name != "newname" {
+		t.Fatalf("Expected 1 file \"newname\", got %v", files)
+	}
+	if len(files[0].Blocks) != 1 || !bytes.Equal(files[0].Blocks[0].Hash, []byte("marker")) {
+		t.Errorf("Expected the old block list to be reused, got %v", files[0].Blocks)
+	}
+	if name := index[ino]; name != "newname" {
+		t.Errorf("Expected the inode index to be updated, got %q", name)
+	}
+}
+
+type fakeInodeIndex map[uint64]string
+
+func (f fakeInodeIndex) LookupInode(ino uint64) (string, bool) {
+	name, ok := f[ino]
+	return name, ok
+}
+
+func (f fakeInodeIndex) RecordInode(ino uint64, name string) {
+	f[ino] = name
+}
@@ -0,0 +1,177 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package stats
+
+import (
+	"strings"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/db"
+	"github.com/syncthing/syncthing/lib/sync"
+)
+
+// TransferCounts are the counters kept per folder, per day and in total.
+type TransferCounts struct {
+	SyncedFiles int64 `json:"syncedFiles"`
+	SyncedBytes int64 `json:"syncedBytes"`
+	ReusedBytes int64 `json:"reusedBytes"` // bytes we did not need to request over the network
+}
+
+// TrafficCounts are the counters kept per device.
+type TrafficCounts struct {
+	InBytes  int64 `json:"inBytes"`
+	OutBytes int64 `json:"outBytes"`
+}
+
+type TransferStatistics struct {
+	TransferCounts
+	Folders map[string]TransferCounts `json:"folders"`
+	Devices map[string]TrafficCounts  `json:"devices"`
+	Days    map[string]TransferCounts `json:"days"`
+}
+
+// TransferStatisticsReference keeps persistent transfer counters in the
+// database, so that they survive restarts, unlike the in-memory session
+// statistics. Counters are kept in total, per folder, per device and per
+// day.
+type TransferStatisticsReference struct {
+	ns  *db.NamespacedKV
+	mut sync.Mutex
+}
+
+func NewTransferStatisticsReference(ldb *db.Lowlevel) *TransferStatisticsReference {
+	return &TransferStatisticsReference{
+		ns:  db.NewTransferStatisticsNamespace(ldb),
+		mut: sync.NewMutex(),
+	}
+}
+
+// AddSyncedFile accounts a file of the given size synced into the folder,
+// of which reused bytes were satisfied from local blocks rather than
+// requested over the network.
+func (s *TransferStatisticsReference) AddSyncedFile(folder string, bytes, reused int64) {
+	l.Debugln("stats.TransferStatisticsReference.AddSyncedFile:", folder, bytes, reused)
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	day := time.Now().Format("2006-01-02")
+	s.add("total:syncedFiles", 1)
+	s.add("total:syncedBytes", bytes)
+	s.add("total:reusedBytes", reused)
+	s.add("folder:"+folder+":syncedFiles", 1)
+	s.add("folder:"+folder+":syncedBytes", bytes)
+	s.add("folder:"+folder+":reusedBytes", reused)
+	s.add("day:"+day+":syncedFiles", 1)
+	s.add("day:"+day+":syncedBytes", bytes)
+	s.add("day:"+day+":reusedBytes", reused)
+}
+
+// AddDeviceTraffic accounts bytes received from and sent to the device.
+func (s *TransferStatisticsReference) AddDeviceTraffic(device string, in, out int64) {
+	l.Debugln("stats.TransferStatisticsReference.AddDeviceTraffic:", device, in, out)
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	month := time.Now().Format("2006-01")
+	s.add("device:"+device+":inBytes", in)
+	s.add("device:"+device+":outBytes", out)
+	s.add("month:"+month+":"+device+":inBytes", in)
+	s.add("month:"+month+":"+device+":outBytes", out)
+}
+
+// DeviceTrafficThisMonth returns the traffic accounted for the device
+// during the current calendar month.
+func (s *TransferStatisticsReference) DeviceTrafficThisMonth(device string) TrafficCounts {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	month := time.Now().Format("2006-01")
+	var t TrafficCounts
+	t.InBytes, _ = s.ns.Int64("month:" + month + ":" + device + ":inBytes")
+	t.OutBytes, _ = s.ns.Int64("month:" + month + ":" + device + ":outBytes")
+	return t
+}
+
+func (s *TransferStatisticsReference) GetStatistics() TransferStatistics {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	res := TransferStatistics{
+		Folders: make(map[string]TransferCounts),
+		Devices: make(map[string]TrafficCounts),
+		Days:    make(map[string]TransferCounts),
+	}
+	res.SyncedFiles, _ = s.ns.Int64("total:syncedFiles")
+	res.SyncedBytes, _ = s.ns.Int64("total:syncedBytes")
+	res.ReusedBytes, _ = s.ns.Int64("total:reusedBytes")
+
+	for _, key := range s.ns.PrefixedKeys("folder:") {
+		name, counter, ok := splitCounterKey(strings.TrimPrefix(key, "folder:"))
+		if !ok {
+			continue
+		}
+		val, _ := s.ns.Int64(key)
+		counts := res.Folders[name]
+		setTransferCount(&counts, counter, val)
+		res.Folders[name] = counts
+	}
+
+	for _, key := range s.ns.PrefixedKeys("day:") {
+		name, counter, ok := splitCounterKey(strings.TrimPrefix(key, "day:"))
+		if !ok {
+			continue
+		}
+		val, _ := s.ns.Int64(key)
+		counts := res.Days[name]
+		setTransferCount(&counts, counter, val)
+		res.Days[name] = counts
+	}
+
+	for _, key := range s.ns.PrefixedKeys("device:") {
+		name, counter, ok := splitCounterKey(strings.TrimPrefix(key, "device:"))
+		if !ok {
+			continue
+		}
+		val, _ := s.ns.Int64(key)
+		counts := res.Devices[name]
+		switch counter {
+		case "inBytes":
+			counts.InBytes = val
+		case "outBytes":
+			counts.OutBytes = val
+		}
+		res.Devices[name] = counts
+	}
+
+	return res
+}
+
+func (s *TransferStatisticsReference) add(key string, val int64) {
+	if val == 0 {
+		return
+	}
+	cur, _ := s.ns.Int64(key)
+	s.ns.PutInt64(key, cur+val)
+}
+
+// splitCounterKey splits "name:counter" at the last colon, as folder IDs
+// may themselves contain colons.
+func splitCounterKey(key string) (name, counter string, ok bool) {
+	idx := strings.LastIndex(key, ":")
+	if idx < 0 {
+		return "", "", false
+	}
+	return key[:idx], key[idx+1:], true
+}
+
+func setTransferCount(counts *TransferCounts, counter string, val int64) {
+	switch counter {
+	case "syncedFiles":
+		counts.SyncedFiles = val
+	case "syncedBytes":
+		counts.SyncedBytes = val
+	case "reusedBytes":
+		counts.ReusedBytes = val
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/db"
+)
+
+func TestTransferStatistics(t *testing.T) {
+	ldb := db.OpenMemory()
+	s := NewTransferStatisticsReference(ldb)
+
+	s.AddSyncedFile("default", 1000, 200)
+	s.AddSyncedFile("default", 500, 0)
+	s.AddSyncedFile("other", 250, 250)
+	s.AddDeviceTraffic("device1", 100, 50)
+	s.AddDeviceTraffic("device1", 10, 5)
+
+	res := s.GetStatistics()
+
+	if res.SyncedFiles != 3 || res.SyncedBytes != 1750 || res.ReusedBytes != 450 {
+		t.Errorf("unexpected totals: %+v", res.TransferCounts)
+	}
+	if c := res.Folders["default"]; c.SyncedFiles != 2 || c.SyncedBytes != 1500 || c.ReusedBytes != 200 {
+		t.Errorf("unexpected folder counts: %+v", c)
+	}
+	if c := res.Devices["device1"]; c.InBytes != 110 || c.OutBytes != 55 {
+		t.Errorf("unexpected device counts: %+v", c)
+	}
+
+	day := time.Now().Format("2006-01-02")
+	if c, ok := res.Days[day]; !ok || c.SyncedFiles != 3 || c.SyncedBytes != 1750 {
+		t.Errorf("unexpected day counts: %+v", c)
+	}
+
+	if c := s.DeviceTrafficThisMonth("device1"); c.InBytes != 110 || c.OutBytes != 55 {
+		t.Errorf("unexpected monthly device counts: %+v", c)
+	}
+	if c := s.DeviceTrafficThisMonth("device2"); c.InBytes != 0 || c.OutBytes != 0 {
+		t.Errorf("unexpected monthly device counts: %+v", c)
+	}
+}
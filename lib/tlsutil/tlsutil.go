@@ -92,6 +92,54 @@ func SecureDefault() *tls.Config {
 	}
 }
 
+// The TLS cipher suite and protocol version names accepted in the
+// configuration, mapped to their constants.
+var (
+	suiteNames = map[string]uint16{
+		"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":   tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384": tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305":    tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+		"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305":  tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+		"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+		"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
+	}
+
+	versionNames = map[string]uint16{
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+)
+
+// ConfigureSuites applies the given cipher suite names and minimum protocol
+// version to the TLS configuration. Empty values leave the secure defaults
+// in place. Unknown suite names or versions older than our default minimum
+// are an error, rather than a silent fallback to something weaker.
+func ConfigureSuites(cfg *tls.Config, suites []string, minVersion string) error {
+	if minVersion != "" {
+		ver, ok := versionNames[minVersion]
+		if !ok {
+			return fmt.Errorf("unsupported TLS minimum version %q", minVersion)
+		}
+		cfg.MinVersion = ver
+	}
+
+	if len(suites) > 0 {
+		cs := make([]uint16, 0, len(suites))
+		for _, name := range suites {
+			id, ok := suiteNames[name]
+			if !ok {
+				return fmt.Errorf("unknown TLS cipher suite %q", name)
+			}
+			cs = append(cs, id)
+		}
+		cfg.CipherSuites = cs
+	}
+
+	return nil
+}
+
 // NewCertificate generates and returns a new TLS certificate.
 func NewCertificate(certFile, keyFile, commonName string) (tls.Certificate, error) {
 	priv, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
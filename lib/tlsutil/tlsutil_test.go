@@ -13,7 +13,10 @@ import (
 	"bytes"
 	"crypto/tls"
 	"io"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -156,3 +159,81 @@ func (f *fakeConn) RemoteAddr() net.Addr             { return nil }
 func (f *fakeConn) SetDeadline(time.Time) error      { return nil }
 func (f *fakeConn) SetReadDeadline(time.Time) error  { return nil }
 func (f *fakeConn) SetWriteDeadline(time.Time) error { return nil }
+
+func TestConfigureSuites(t *testing.T) {
+	// Valid suite names and versions are applied.
+	cfg := SecureDefault()
+	err := ConfigureSuites(cfg, []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"}, "1.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MinVersion != tls.VersionTLS13 {
+		t.Errorf("unexpected min version %x", cfg.MinVersion)
+	}
+	if len(cfg.CipherSuites) != 1 || cfg.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384 {
+		t.Errorf("unexpected cipher suites %v", cfg.CipherSuites)
+	}
+
+	// Unknown names are an error, not a silent fallback.
+	if err := ConfigureSuites(SecureDefault(), []string{"TLS_BOGUS_SUITE"}, ""); err == nil {
+		t.Error("expected error for unknown cipher suite")
+	}
+	if err := ConfigureSuites(SecureDefault(), nil, "1.1"); err == nil {
+		t.Error("expected error for weak TLS version")
+	}
+
+	// Empty values leave the defaults in place.
+	cfg = SecureDefault()
+	if err := ConfigureSuites(cfg, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("unexpected min version %x", cfg.MinVersion)
+	}
+}
+
+func TestConfiguredMinVersionHonored(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlsutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cert, err := NewCertificate(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), "tlsutil-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handshake := func(clientMin string) error {
+		serverCfg := SecureDefault()
+		serverCfg.Certificates = []tls.Certificate{cert}
+		serverCfg.MaxVersion = tls.VersionTLS12
+
+		clientCfg := SecureDefault()
+		clientCfg.InsecureSkipVerify = true
+		if err := ConfigureSuites(clientCfg, nil, clientMin); err != nil {
+			return err
+		}
+
+		c1, c2 := net.Pipe()
+		defer c1.Close()
+		defer c2.Close()
+
+		done := make(chan error, 1)
+		go func() {
+			done <- tls.Server(c1, serverCfg).Handshake()
+		}()
+		err := tls.Client(c2, clientCfg).Handshake()
+		<-done
+		return err
+	}
+
+	// A client requiring TLS 1.3 must refuse a TLS 1.2-only server.
+	if err := handshake("1.3"); err == nil {
+		t.Error("expected handshake failure with 1.3-only client against 1.2-only server")
+	}
+	// With the default minimum the handshake succeeds.
+	if err := handshake(""); err != nil {
+		t.Errorf("unexpected handshake failure: %v", err)
+	}
+}
@@ -0,0 +1,349 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package versioner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/osutil"
+)
+
+func init() {
+	// Register the constructor for this type of versioner with the name "blocks"
+	Factories["blocks"] = NewBlocks
+}
+
+// The blocks versioner stores versions as content addressed blocks plus a
+// manifest per version, so blocks that are identical between versions (or
+// between files) are stored only once. Large files that change a little
+// between versions then cost roughly the changed part per version instead
+// of a full copy. The layout under .stversions is
+//
+//	blocks/ab/abcdef...      block contents, named by their SHA-256 hash
+//	manifests/dir/file~tag   JSON manifest listing the blocks of a version
+//
+// Blocks no longer referenced by any manifest are removed when old
+// versions are cleaned out.
+type Blocks struct {
+	keep int
+	fs   fs.Filesystem
+}
+
+// blocksManifest describes one archived version.
+type blocksManifest struct {
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"modTime"`
+	BlockSize int       `json:"blockSize"`
+	Blocks    []string  `json:"blocks"`
+}
+
+const blocksBlockSize = 128 << 10
+
+var (
+	blocksDir    = filepath.Join(".stversions", "blocks")
+	manifestsDir = filepath.Join(".stversions", "manifests")
+)
+
+func NewBlocks(folderID string, fs fs.Filesystem, params map[string]string) Versioner {
+	keep, err := strconv.Atoi(params["keep"])
+	if err != nil {
+		keep = 5 // A reasonable default
+	}
+
+	s := Blocks{
+		keep: keep,
+		fs:   fs,
+	}
+
+	l.Debugf("instantiated %#v", s)
+	return s
+}
+
+// Archive stores the named file as content addressed blocks and a
+// manifest, then removes it. If this function returns nil, the named
+// file does not exist any more (has been archived).
+func (v Blocks) Archive(filePath string) error {
+	info, err := v.fs.Lstat(filePath)
+	if fs.IsNotExist(err) {
+		l.Debugln("not archiving nonexistent file", filePath)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.IsSymlink() {
+		panic("bug: attempting to version a symlink")
+	}
+
+	if _, err := v.fs.Stat(".stversions"); fs.IsNotExist(err) {
+		l.Debugln("creating versions dir .stversions")
+		v.fs.Mkdir(".stversions", 0755)
+		v.fs.Hide(".stversions")
+	}
+
+	l.Debugln("archiving", filePath)
+
+	hashes, err := v.storeBlocks(filePath)
+	if err != nil {
+		return err
+	}
+
+	manifest := blocksManifest{
+		Size:      info.Size(),
+		ModTime:   info.ModTime().Truncate(time.Second),
+		BlockSize: blocksBlockSize,
+		Blocks:    hashes,
+	}
+
+	file := filepath.Base(filePath)
+	dir := filepath.Join(manifestsDir, filepath.Dir(filePath))
+	if err := v.fs.MkdirAll(dir, 0755); err != nil && !fs.IsExist(err) {
+		return err
+	}
+
+	tag := info.ModTime().Format(TimeFormat)
+	manifestName := filepath.Join(dir, TagFilename(file, tag))
+	if err := v.writeManifest(manifestName, manifest); err != nil {
+		return err
+	}
+
+	if err := v.fs.Remove(filePath); err != nil {
+		return err
+	}
+
+	// Clean out old versions and then blocks that no version refers to
+	// any more.
+	pattern := filepath.Join(dir, TagFilename(file, TimeGlob))
+	versions, err := v.fs.Glob(pattern)
+	if err != nil {
+		l.Warnln("globbing:", err, "for", pattern)
+		return nil
+	}
+	if len(versions) > v.keep {
+		for _, toRemove := range versions[:len(versions)-v.keep] {
+			l.Debugln("cleaning out", toRemove)
+			if err := v.fs.Remove(toRemove); err != nil {
+				l.Warnln("removing old version:", err)
+			}
+		}
+		if err := v.removeUnreferencedBlocks(); err != nil {
+			l.Warnln("cleaning out blocks:", err)
+		}
+	}
+
+	return nil
+}
+
+// storeBlocks splits the file into blocks, stores those that are not
+// already present, and returns the list of block hashes.
+func (v Blocks) storeBlocks(filePath string) ([]string, error) {
+	fd, err := v.fs.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	var hashes []string
+	buf := make([]byte, blocksBlockSize)
+	for {
+		n, err := io.ReadFull(fd, buf)
+		if err == io.EOF {
+			break
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(buf[:n])
+		hash := hex.EncodeToString(sum[:])
+		if err := v.storeBlock(hash, buf[:n]); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+
+		if n < blocksBlockSize {
+			break
+		}
+	}
+	return hashes, nil
+}
+
+func (v Blocks) storeBlock(hash string, data []byte) error {
+	name := v.blockPath(hash)
+	if _, err := v.fs.Lstat(name); err == nil {
+		// The block is already present; this is the whole point.
+		return nil
+	}
+	if err := v.fs.MkdirAll(filepath.Dir(name), 0755); err != nil && !fs.IsExist(err) {
+		return err
+	}
+
+	fd, err := osutil.CreateAtomicFilesystem(v.fs, name)
+	if err != nil {
+		return err
+	}
+	if _, err := fd.Write(data); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+func (v Blocks) blockPath(hash string) string {
+	return filepath.Join(blocksDir, hash[:2], hash)
+}
+
+func (v Blocks) writeManifest(name string, manifest blocksManifest) error {
+	fd, err := osutil.CreateAtomicFilesystem(v.fs, name)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(fd).Encode(manifest); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+func (v Blocks) readManifest(name string) (blocksManifest, error) {
+	var manifest blocksManifest
+	fd, err := v.fs.Open(name)
+	if err != nil {
+		return manifest, err
+	}
+	defer fd.Close()
+	err = json.NewDecoder(fd).Decode(&manifest)
+	return manifest, err
+}
+
+// removeUnreferencedBlocks walks the manifests, collects the set of
+// referenced block hashes and removes stored blocks outside that set.
+func (v Blocks) removeUnreferencedBlocks() error {
+	referenced := make(map[string]struct{})
+	err := v.fs.Walk(manifestsDir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil || !info.IsRegular() {
+			return nil
+		}
+		manifest, err := v.readManifest(path)
+		if err != nil {
+			return err
+		}
+		for _, hash := range manifest.Blocks {
+			referenced[hash] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return v.fs.Walk(blocksDir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil || !info.IsRegular() {
+			return nil
+		}
+		if _, ok := referenced[info.Name()]; !ok {
+			l.Debugln("cleaning out block", info.Name())
+			if err := v.fs.Remove(path); err != nil {
+				l.Warnln("removing block:", err)
+			}
+		}
+		return nil
+	})
+}
+
+// List returns the archived versions of the named file, oldest first.
+func (v Blocks) List(path string) ([]FileVersion, error) {
+	path = osutil.NativeFilename(path)
+	dir, file := filepath.Dir(path), filepath.Base(path)
+
+	manifests, err := v.fs.Glob(filepath.Join(manifestsDir, dir, TagFilename(file, TimeGlob)))
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []FileVersion
+	for _, name := range manifests {
+		tag := ExtractTag(name)
+		versionTime, err := time.ParseInLocation(TimeFormat, tag, time.Local)
+		if err != nil {
+			continue
+		}
+		manifest, err := v.readManifest(name)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, FileVersion{
+			VersionTime: versionTime,
+			ModTime:     manifest.ModTime.Truncate(time.Second),
+			Size:        manifest.Size,
+		})
+	}
+	sort.Slice(versions, func(a, b int) bool {
+		return versions[a].VersionTime.Before(versions[b].VersionTime)
+	})
+	return versions, nil
+}
+
+// Restore reassembles the archived version from the given time out of
+// its blocks, archiving the current file first.
+func (v Blocks) Restore(path string, versionTime time.Time) error {
+	path = osutil.NativeFilename(path)
+	tag := versionTime.In(time.Local).Truncate(time.Second).Format(TimeFormat)
+	manifestName := filepath.Join(manifestsDir, TagFilename(path, tag))
+
+	manifest, err := v.readManifest(manifestName)
+	if err != nil {
+		return err
+	}
+
+	if info, err := v.fs.Lstat(path); err == nil && !info.IsRegular() {
+		return errors.New("cannot replace a non-file")
+	} else if err != nil && !fs.IsNotExist(err) {
+		return err
+	}
+
+	// Reassemble next to the target so the final rename is atomic.
+	v.fs.MkdirAll(filepath.Dir(path), 0755)
+	tmp := fs.TempName(path)
+	fd, err := v.fs.Create(tmp)
+	if err != nil {
+		return err
+	}
+	for _, hash := range manifest.Blocks {
+		block, err := v.fs.Open(v.blockPath(hash))
+		if err != nil {
+			fd.Close()
+			return err
+		}
+		_, err = io.Copy(fd, block)
+		block.Close()
+		if err != nil {
+			fd.Close()
+			return err
+		}
+	}
+	if err := fd.Close(); err != nil {
+		return err
+	}
+	v.fs.Chtimes(tmp, manifest.ModTime, manifest.ModTime)
+
+	if _, err := v.fs.Lstat(path); err == nil {
+		if err := osutil.InWritableDir(v.Archive, v.fs, path); err != nil {
+			v.fs.Remove(tmp)
+			return err
+		}
+	}
+
+	return osutil.TryRename(v.fs, tmp, path)
+}
@@ -0,0 +1,99 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package versioner
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/fs"
+)
+
+func TestBlocksVersioner(t *testing.T) {
+	os.RemoveAll("testdata")
+	defer os.RemoveAll("testdata")
+	os.MkdirAll("testdata", 0777)
+
+	filesystem := fs.NewFilesystem(fs.FilesystemTypeBasic, "testdata")
+	versioner := NewBlocks("default", filesystem, map[string]string{"keep": "2"})
+
+	// Two versions that share their first two blocks and differ in the
+	// third.
+	shared := bytes.Repeat([]byte("a"), 2*blocksBlockSize)
+	v1 := append(append([]byte{}, shared...), []byte("version one")...)
+	v2 := append(append([]byte{}, shared...), []byte("version two!")...)
+
+	writeArchive := func(data []byte, age time.Duration) {
+		if err := ioutil.WriteFile("testdata/file", data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		// Distinct mtimes, as the version tag comes from the mtime.
+		mtime := time.Now().Add(-age)
+		if err := os.Chtimes("testdata/file", mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		if err := versioner.Archive("file"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeArchive(v1, time.Minute)
+	writeArchive(v2, 0)
+
+	if _, err := os.Lstat("testdata/file"); !os.IsNotExist(err) {
+		t.Error("expected the archived file to be gone")
+	}
+
+	// Four distinct blocks in total: the shared one (twice in each
+	// version, stored once) and one tail per version.
+	blocks := 0
+	filepath.Walk("testdata/.stversions/blocks", func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			blocks++
+		}
+		return nil
+	})
+	if blocks != 3 {
+		t.Errorf("expected 3 stored blocks, got %d", blocks)
+	}
+
+	versions, err := versioner.List("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("expected two versions, got %d", len(versions))
+	}
+	if versions[0].Size != int64(len(v1)) || versions[1].Size != int64(len(v2)) {
+		t.Errorf("unexpected sizes %d, %d", versions[0].Size, versions[1].Size)
+	}
+
+	if err := versioner.Restore("file", versions[0].VersionTime); err != nil {
+		t.Fatal(err)
+	}
+	bs, err := ioutil.ReadFile("testdata/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bs, v1) {
+		t.Error("expected the first version to be restored")
+	}
+
+	// Restoring archived the current state; keep=2 then drops the oldest
+	// manifest and garbage collects its tail block.
+	writeArchive(v2, 0)
+	writeArchive(v2, 0)
+	if versions, err := versioner.List("file"); err != nil {
+		t.Fatal(err)
+	} else if len(versions) != 2 {
+		t.Errorf("expected two versions after cleanout, got %d", len(versions))
+	}
+}
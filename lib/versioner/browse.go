@@ -0,0 +1,132 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package versioner
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/osutil"
+	"github.com/syncthing/syncthing/lib/util"
+)
+
+// ErrRestorationNotSupported is returned by versioners that cannot
+// restore archived versions, such as the external one.
+var ErrRestorationNotSupported = errors.New("version restoration not supported with the current versioner")
+
+// listVersions returns the archived versions of the given file found
+// under versionsDir in the filesystem, oldest first. Both tagged
+// (file~20060102-150405.ext and the old style file.ext~20060102-150405)
+// and untagged archive names are considered; untagged copies, as left
+// by the trashcan versioner, use the archive mtime as version time.
+func listVersions(filesystem fs.Filesystem, versionsDir, path string) ([]FileVersion, error) {
+	path = osutil.NativeFilename(path)
+	dir, file := filepath.Dir(path), filepath.Base(path)
+
+	candidates, err := filesystem.Glob(filepath.Join(versionsDir, dir, TagFilename(file, TimeGlob)))
+	if err != nil {
+		return nil, err
+	}
+	if old, err := filesystem.Glob(filepath.Join(versionsDir, dir, file+"~"+TimeGlob)); err == nil {
+		candidates = append(candidates, old...)
+	}
+	candidates = append(candidates, filepath.Join(versionsDir, path))
+	// For a file without extension the two tagged patterns are the same.
+	candidates = util.UniqueStrings(candidates)
+
+	var versions []FileVersion
+	for _, candidate := range candidates {
+		info, err := filesystem.Lstat(candidate)
+		if err != nil || !info.IsRegular() {
+			continue
+		}
+		versionTime := info.ModTime().Truncate(time.Second)
+		if tag := ExtractTag(candidate); tag != "" {
+			versionTime, err = time.ParseInLocation(TimeFormat, tag, time.Local)
+			if err != nil {
+				continue
+			}
+		}
+		versions = append(versions, FileVersion{
+			VersionTime: versionTime,
+			ModTime:     info.ModTime().Truncate(time.Second),
+			Size:        info.Size(),
+		})
+	}
+
+	sort.Slice(versions, func(a, b int) bool {
+		return versions[a].VersionTime.Before(versions[b].VersionTime)
+	})
+	return versions, nil
+}
+
+// restoreVersion replaces the current file with the archived version
+// from the given time, found under versionsDir in the filesystem. The
+// replaced file, if any, is handed to the archive function first.
+func restoreVersion(filesystem fs.Filesystem, versionsDir, path string, versionTime time.Time, archive func(string) error) error {
+	path = osutil.NativeFilename(path)
+	versionTime = versionTime.In(time.Local).Truncate(time.Second)
+	tag := versionTime.Format(TimeFormat)
+	source := filepath.Join(versionsDir, TagFilename(path, tag))
+
+	info, err := filesystem.Lstat(source)
+	if fs.IsNotExist(err) {
+		// Not there under a tagged name; the trashcan versioner archives
+		// under the plain name, with the archive time as the mtime.
+		untagged := filepath.Join(versionsDir, path)
+		if uinfo, uerr := filesystem.Lstat(untagged); uerr == nil && uinfo.ModTime().Truncate(time.Second).Equal(versionTime) {
+			source, info, err = untagged, uinfo, nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsRegular() {
+		return errors.New("not a file")
+	}
+
+	// The target location of where we are supposed to restore must either
+	// not exist, or be an actual file.
+	if info, err := filesystem.Lstat(path); err == nil && !info.IsRegular() {
+		return errors.New("cannot replace a non-file")
+	} else if err != nil && !fs.IsNotExist(err) {
+		return err
+	}
+
+	// Archiving the current file might land on the very version we're
+	// about to restore: the trashcan versioner always archives under the
+	// plain name, and tagged versioners collide when archive and restore
+	// happen within the same second. Move the version aside first.
+	tmp := fs.TempName(source)
+	if err := osutil.TryRename(filesystem, source, tmp); err != nil {
+		return err
+	}
+
+	if _, serr := filesystem.Lstat(path); serr == nil {
+		err = osutil.InWritableDir(archive, filesystem, path)
+	}
+
+	filesystem.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = osutil.Copy(filesystem, tmp, path)
+	}
+	if err == nil {
+		if _, serr := filesystem.Lstat(source); serr == nil {
+			// Archiving the replaced file reused the source name; the
+			// restored version is consumed.
+			filesystem.Remove(tmp)
+		} else {
+			// Put the archived version back where it was.
+			osutil.TryRename(filesystem, tmp, source)
+		}
+	}
+
+	return err
+}
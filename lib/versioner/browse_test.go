@@ -0,0 +1,112 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package versioner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/fs"
+)
+
+func TestSimpleListRestore(t *testing.T) {
+	os.RemoveAll("testdata")
+	defer os.RemoveAll("testdata")
+
+	file := filepath.Join("dir", "file")
+	os.MkdirAll(filepath.Join("testdata", "dir"), 0777)
+	if err := ioutil.WriteFile(filepath.Join("testdata", file), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	filesystem := fs.NewFilesystem(fs.FilesystemTypeBasic, "testdata")
+	versioner := NewSimple("default", filesystem, map[string]string{"keep": "5"})
+
+	if err := versioner.Archive(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join("testdata", file), []byte("newer"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := versioner.List(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 {
+		t.Fatalf("expected one version, got %d", len(versions))
+	}
+	if versions[0].Size != 3 {
+		t.Errorf("unexpected size %d", versions[0].Size)
+	}
+
+	if err := versioner.Restore(file, versions[0].VersionTime); err != nil {
+		t.Fatal(err)
+	}
+	if bs, err := ioutil.ReadFile(filepath.Join("testdata", file)); err != nil {
+		t.Fatal(err)
+	} else if string(bs) != "old" {
+		t.Errorf("expected the old content to be restored, got %q", bs)
+	}
+
+	// The replaced file was archived in turn.
+	if versions, err := versioner.List(file); err != nil {
+		t.Fatal(err)
+	} else {
+		var found bool
+		for _, v := range versions {
+			if v.Size == 5 {
+				found = true
+			}
+		}
+		if !found {
+			t.Error("expected the replaced file to have been archived")
+		}
+	}
+}
+
+func TestTrashcanListRestore(t *testing.T) {
+	os.RemoveAll("testdata")
+	defer os.RemoveAll("testdata")
+
+	os.MkdirAll("testdata", 0777)
+	if err := ioutil.WriteFile(filepath.Join("testdata", "file"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	filesystem := fs.NewFilesystem(fs.FilesystemTypeBasic, "testdata")
+	versioner := NewTrashcan("default", filesystem, nil)
+
+	if err := versioner.Archive("file"); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := versioner.List("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 {
+		t.Fatalf("expected one version, got %d", len(versions))
+	}
+
+	if err := versioner.Restore("file", versions[0].VersionTime); err != nil {
+		t.Fatal(err)
+	}
+	if bs, err := ioutil.ReadFile(filepath.Join("testdata", "file")); err != nil {
+		t.Fatal(err)
+	} else if string(bs) != "old" {
+		t.Errorf("expected the old content to be restored, got %q", bs)
+	}
+
+	// Restoring at a time we have no version for is an error.
+	if err := versioner.Restore("file", time.Unix(0, 0)); err == nil {
+		t.Error("expected an error restoring a nonexistent version")
+	}
+}
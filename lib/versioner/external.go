@@ -12,6 +12,7 @@ import (
 	"os/exec"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/syncthing/syncthing/lib/fs"
 
@@ -103,3 +104,14 @@ func (v External) Archive(filePath string) error {
 	}
 	return errors.New("Versioner: file was not removed by external script")
 }
+
+// List returns nothing; the external command consumed the archived
+// files and we don't know where they ended up.
+func (v External) List(path string) ([]FileVersion, error) {
+	return nil, nil
+}
+
+// Restore is not possible with an external command doing the archiving.
+func (v External) Restore(path string, versionTime time.Time) error {
+	return ErrRestorationNotSupported
+}
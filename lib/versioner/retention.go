@@ -0,0 +1,190 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package versioner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/fs"
+)
+
+// A retentionRule says that versions younger than maxAge are thinned to
+// at most one per interval; a zero interval keeps them all. Versions
+// older than the maxAge of the last rule are removed.
+type retentionRule struct {
+	maxAge   time.Duration
+	interval time.Duration
+}
+
+// parseRetentionRules parses a retention specification of the form
+// "24h:all,168h:1h,2160h:24h", meaning keep everything from the last
+// day, one version per hour for a week, one per day for ninety days,
+// and nothing older. Rules must be given youngest first.
+func parseRetentionRules(spec string) ([]retentionRule, error) {
+	var rules []retentionRule
+	for _, field := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(field), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid retention rule %q", field)
+		}
+		maxAge, err := time.ParseDuration(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		var interval time.Duration
+		if parts[1] != "all" {
+			if interval, err = time.ParseDuration(parts[1]); err != nil {
+				return nil, err
+			}
+		}
+		if len(rules) > 0 && maxAge <= rules[len(rules)-1].maxAge {
+			return nil, fmt.Errorf("retention rule %q out of order; rules go youngest first", field)
+		}
+		rules = append(rules, retentionRule{maxAge: maxAge, interval: interval})
+	}
+	return rules, nil
+}
+
+// A retentionCleaner periodically thins a filesystem based version
+// archive according to a set of retention rules. It implements the
+// suture service interface so versioners can delegate their background
+// cleaning to it. With no rules it just waits to be stopped.
+type retentionCleaner struct {
+	fs    fs.Filesystem
+	dir   string
+	rules []retentionRule
+	stop  chan struct{}
+}
+
+func newRetentionCleaner(fs fs.Filesystem, dir string, rules []retentionRule) *retentionCleaner {
+	return &retentionCleaner{
+		fs:    fs,
+		dir:   dir,
+		rules: rules,
+		stop:  make(chan struct{}),
+	}
+}
+
+func (c *retentionCleaner) Serve() {
+	if len(c.rules) == 0 {
+		<-c.stop
+		return
+	}
+
+	// Do the first cleanup one minute after startup, then hourly.
+	timer := time.NewTimer(time.Minute)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+
+		case <-timer.C:
+			if err := c.clean(); err != nil {
+				l.Infoln("Cleaning version archive:", err)
+			}
+			timer.Reset(time.Hour)
+		}
+	}
+}
+
+func (c *retentionCleaner) Stop() {
+	close(c.stop)
+}
+
+func (c *retentionCleaner) clean() error {
+	if _, err := c.fs.Lstat(c.dir); fs.IsNotExist(err) {
+		return nil
+	}
+
+	type storedVersion struct {
+		path string
+		time time.Time
+	}
+
+	byName := make(map[string][]storedVersion)
+	dirTracker := make(emptyDirTracker)
+
+	walkFn := func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() && !info.IsSymlink() {
+			dirTracker.addDir(path)
+			return nil
+		}
+		if !info.IsRegular() {
+			return nil
+		}
+
+		// Tagged files carry their version time in the name; untagged
+		// ones, as left by the trashcan versioner, in the mtime.
+		versionTime := info.ModTime()
+		name, tag := UntagFilename(path)
+		if name == "" {
+			name = path
+		} else if t, err := time.ParseInLocation(TimeFormat, tag, time.Local); err == nil {
+			versionTime = t
+		}
+
+		byName[name] = append(byName[name], storedVersion{path, versionTime})
+		return nil
+	}
+
+	if err := c.fs.Walk(c.dir, walkFn); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, versions := range byName {
+		sort.Slice(versions, func(a, b int) bool {
+			return versions[a].time.Before(versions[b].time)
+		})
+
+		type slot struct {
+			rule int
+			nr   int64
+		}
+		seen := make(map[slot]struct{})
+
+	next:
+		for _, version := range versions {
+			age := now.Sub(version.time)
+			for i, rule := range c.rules {
+				if age > rule.maxAge {
+					continue
+				}
+				if rule.interval > 0 {
+					s := slot{rule: i, nr: version.time.UnixNano() / int64(rule.interval)}
+					if _, ok := seen[s]; ok {
+						// There is already a version in this slot.
+						break
+					}
+					seen[s] = struct{}{}
+				}
+				// Keep this file, and remember it so we don't
+				// unnecessarily try to remove its directory.
+				dirTracker.addFile(version.path)
+				continue next
+			}
+
+			// Older than the last rule allows, or crowding its slot.
+			l.Debugln("Cleaner: deleting version", version.path)
+			if err := c.fs.Remove(version.path); err != nil {
+				l.Warnf("Versioner: can't remove %q: %v", version.path, err)
+			}
+		}
+	}
+
+	dirTracker.deleteEmptyDirs(c.fs)
+	return nil
+}
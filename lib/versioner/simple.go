@@ -9,6 +9,7 @@ package versioner
 import (
 	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/syncthing/syncthing/lib/fs"
 	"github.com/syncthing/syncthing/lib/osutil"
@@ -21,8 +22,9 @@ func init() {
 }
 
 type Simple struct {
-	keep int
-	fs   fs.Filesystem
+	keep    int
+	fs      fs.Filesystem
+	cleaner *retentionCleaner
 }
 
 func NewSimple(folderID string, fs fs.Filesystem, params map[string]string) Versioner {
@@ -31,15 +33,32 @@ func NewSimple(folderID string, fs fs.Filesystem, params map[string]string) Vers
 		keep = 5 // A reasonable default
 	}
 
+	var rules []retentionRule
+	if spec := params["retention"]; spec != "" {
+		if rules, err = parseRetentionRules(spec); err != nil {
+			l.Warnln("Invalid retention rules:", err)
+			rules = nil
+		}
+	}
+
 	s := Simple{
-		keep: keep,
-		fs:   fs,
+		keep:    keep,
+		fs:      fs,
+		cleaner: newRetentionCleaner(fs, ".stversions", rules),
 	}
 
 	l.Debugf("instantiated %#v", s)
 	return s
 }
 
+func (v Simple) Serve() {
+	v.cleaner.Serve()
+}
+
+func (v Simple) Stop() {
+	v.cleaner.Stop()
+}
+
 // Archive moves the named file away to a version archive. If this function
 // returns nil, the named file does not exist any more (has been archived).
 func (v Simple) Archive(filePath string) error {
@@ -117,3 +136,14 @@ func (v Simple) Archive(filePath string) error {
 
 	return nil
 }
+
+// List returns the archived versions of the named file, oldest first.
+func (v Simple) List(path string) ([]FileVersion, error) {
+	return listVersions(v.fs, ".stversions", path)
+}
+
+// Restore replaces the current file with the archived version from the
+// given time, archiving the replaced file first.
+func (v Simple) Restore(path string, versionTime time.Time) error {
+	return restoreVersion(v.fs, ".stversions", path, versionTime, v.Archive)
+}
@@ -31,7 +31,7 @@ type Staggered struct {
 	cleanInterval int64
 	folderFs      fs.Filesystem
 	versionsFs    fs.Filesystem
-	interval      [4]Interval
+	interval      []Interval
 	mutex         sync.Mutex
 
 	stop          chan struct{}
@@ -59,18 +59,31 @@ func NewStaggered(folderID string, folderFs fs.Filesystem, params map[string]str
 	}
 	l.Debugln("%s folder using %s (%s) staggered versioner dir", folderID, versionsFs.URI(), versionsFs.Type())
 
+	intervals := []Interval{
+		{30, 3600},       // first hour -> 30 sec between versions
+		{3600, 86400},    // next day -> 1 h between versions
+		{86400, 592000},  // next 30 days -> 1 day between versions
+		{604800, maxAge}, // next year -> 1 week between versions
+	}
+	if spec := params["retention"]; spec != "" {
+		// Explicit retention rules replace the built-in intervals.
+		if rules, err := parseRetentionRules(spec); err != nil {
+			l.Warnln("Invalid retention rules:", err)
+		} else {
+			intervals = intervals[:0]
+			for _, rule := range rules {
+				intervals = append(intervals, Interval{int64(rule.interval.Seconds()), int64(rule.maxAge.Seconds())})
+			}
+		}
+	}
+
 	s := &Staggered{
 		cleanInterval: cleanInterval,
 		folderFs:      folderFs,
 		versionsFs:    versionsFs,
-		interval: [4]Interval{
-			{30, 3600},       // first hour -> 30 sec between versions
-			{3600, 86400},    // next day -> 1 h between versions
-			{86400, 592000},  // next 30 days -> 1 day between versions
-			{604800, maxAge}, // next year -> 1 week between versions
-		},
-		mutex: sync.NewMutex(),
-		stop:  make(chan struct{}),
+		interval:      intervals,
+		mutex:         sync.NewMutex(),
+		stop:          make(chan struct{}),
 	}
 
 	l.Debugf("instantiated %#v", s)
@@ -295,3 +308,24 @@ func (v *Staggered) Archive(filePath string) error {
 
 	return nil
 }
+
+// List returns the archived versions of the named file, oldest first.
+func (v *Staggered) List(path string) ([]FileVersion, error) {
+	return listVersions(v.versionsFs, ".", path)
+}
+
+// Restore replaces the current file with the archived version from the
+// given time, archiving the replaced file first. It requires the
+// versions directory to be located inside the folder, which is the
+// default; moving files between two filesystems is not supported.
+func (v *Staggered) Restore(path string, versionTime time.Time) error {
+	uri := v.versionsFs.URI()
+	if !fs.IsParent(uri, v.folderFs.URI()) {
+		return ErrRestorationNotSupported
+	}
+	rel, err := filepath.Rel(v.folderFs.URI(), uri)
+	if err != nil {
+		return ErrRestorationNotSupported
+	}
+	return restoreVersion(v.folderFs, rel, path, versionTime, v.Archive)
+}
@@ -24,17 +24,28 @@ func init() {
 type Trashcan struct {
 	fs           fs.Filesystem
 	cleanoutDays int
-	stop         chan struct{}
+	cleaner      *retentionCleaner
 }
 
 func NewTrashcan(folderID string, fs fs.Filesystem, params map[string]string) Versioner {
 	cleanoutDays, _ := strconv.Atoi(params["cleanoutDays"])
 	// On error we default to 0, "do not clean out the trash can"
 
+	var rules []retentionRule
+	if spec := params["retention"]; spec != "" {
+		var err error
+		if rules, err = parseRetentionRules(spec); err != nil {
+			l.Warnln("Invalid retention rules:", err)
+			rules = nil
+		}
+	} else if cleanoutDays > 0 {
+		rules = []retentionRule{{maxAge: time.Duration(cleanoutDays) * 24 * time.Hour}}
+	}
+
 	s := &Trashcan{
 		fs:           fs,
 		cleanoutDays: cleanoutDays,
-		stop:         make(chan struct{}),
+		cleaner:      newRetentionCleaner(fs, ".stversions", rules),
 	}
 
 	l.Debugf("instantiated %#v", s)
@@ -92,31 +103,11 @@ func (t *Trashcan) Archive(filePath string) error {
 func (t *Trashcan) Serve() {
 	l.Debugln(t, "starting")
 	defer l.Debugln(t, "stopping")
-
-	// Do the first cleanup one minute after startup.
-	timer := time.NewTimer(time.Minute)
-	defer timer.Stop()
-
-	for {
-		select {
-		case <-t.stop:
-			return
-
-		case <-timer.C:
-			if t.cleanoutDays > 0 {
-				if err := t.cleanoutArchive(); err != nil {
-					l.Infoln("Cleaning trashcan:", err)
-				}
-			}
-
-			// Cleanups once a day should be enough.
-			timer.Reset(24 * time.Hour)
-		}
-	}
+	t.cleaner.Serve()
 }
 
 func (t *Trashcan) Stop() {
-	close(t.stop)
+	t.cleaner.Stop()
 }
 
 func (t *Trashcan) String() string {
@@ -124,40 +115,16 @@ func (t *Trashcan) String() string {
 }
 
 func (t *Trashcan) cleanoutArchive() error {
-	versionsDir := ".stversions"
-	if _, err := t.fs.Lstat(versionsDir); fs.IsNotExist(err) {
-		return nil
-	}
-
-	cutoff := time.Now().Add(time.Duration(-24*t.cleanoutDays) * time.Hour)
-	dirTracker := make(emptyDirTracker)
-
-	walkFn := func(path string, info fs.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if info.IsDir() && !info.IsSymlink() {
-			dirTracker.addDir(path)
-			return nil
-		}
-
-		if info.ModTime().Before(cutoff) {
-			// The file is too old; remove it.
-			t.fs.Remove(path)
-		} else {
-			// Keep this file, and remember it so we don't unnecessarily try
-			// to remove this directory.
-			dirTracker.addFile(path)
-		}
-		return nil
-	}
-
-	if err := t.fs.Walk(versionsDir, walkFn); err != nil {
-		return err
-	}
+	return t.cleaner.clean()
+}
 
-	dirTracker.deleteEmptyDirs(t.fs)
+// List returns the archived versions of the named file, oldest first.
+func (t *Trashcan) List(path string) ([]FileVersion, error) {
+	return listVersions(t.fs, ".stversions", path)
+}
 
-	return nil
+// Restore replaces the current file with the archived version from the
+// given time, archiving the replaced file first.
+func (t *Trashcan) Restore(path string, versionTime time.Time) error {
+	return restoreVersion(t.fs, ".stversions", path, versionTime, t.Archive)
 }
@@ -15,7 +15,19 @@ import (
 )
 
 type Versioner interface {
+	// Archive moves the named file away to a version archive. If this
+	// method returns nil, the named file does not exist any more (has
+	// been archived).
 	Archive(filePath string) error
+
+	// List returns the archived versions of the named file, oldest
+	// first.
+	List(path string) ([]FileVersion, error)
+
+	// Restore replaces the current file with the archived version from
+	// the given time, archiving the replaced file first. Versioners
+	// that cannot restore return ErrRestorationNotSupported.
+	Restore(path string, versionTime time.Time) error
 }
 
 type FileVersion struct {
@@ -0,0 +1,277 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package versioner
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/osutil"
+)
+
+func init() {
+	// Register the constructor for this type of versioner with the name "webdav"
+	Factories["webdav"] = NewWebDAV
+}
+
+// The WebDAV versioner uploads displaced versions to a WebDAV server
+// instead of keeping them in .stversions, turning the archive into an
+// off-machine backup. Versions are stored under the configured URL with
+// the usual folder structure and file~tag naming, so several folders can
+// share a server as long as they use different URLs.
+type WebDAV struct {
+	base     *url.URL
+	username string
+	password string
+	client   *http.Client
+	fs       fs.Filesystem
+}
+
+func NewWebDAV(folderID string, filesystem fs.Filesystem, params map[string]string) Versioner {
+	base, err := url.Parse(strings.TrimRight(params["url"], "/"))
+	if err != nil {
+		l.Warnln("Invalid WebDAV versioner URL:", err)
+		base = &url.URL{}
+	}
+
+	s := &WebDAV{
+		base:     base,
+		username: params["username"],
+		password: params["password"],
+		client:   &http.Client{},
+		fs:       filesystem,
+	}
+
+	l.Debugf("instantiated %#v", s)
+	return s
+}
+
+// Archive uploads the named file to the WebDAV server and then removes
+// it. If this function returns nil, the named file does not exist any
+// more (has been archived).
+func (v *WebDAV) Archive(filePath string) error {
+	info, err := v.fs.Lstat(filePath)
+	if fs.IsNotExist(err) {
+		l.Debugln("not archiving nonexistent file", filePath)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.IsSymlink() {
+		panic("bug: attempting to version a symlink")
+	}
+
+	l.Debugln("archiving", filePath)
+
+	tagged := TagFilename(filePath, info.ModTime().Format(TimeFormat))
+	if err := v.mkColls(path.Dir(filepath.ToSlash(tagged))); err != nil {
+		return err
+	}
+
+	fd, err := v.fs.Open(filePath)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("PUT", v.urlFor(filepath.ToSlash(tagged)), fd)
+	if err != nil {
+		fd.Close()
+		return err
+	}
+	req.ContentLength = info.Size()
+	if err := v.do(req); err != nil {
+		fd.Close()
+		return err
+	}
+	fd.Close()
+
+	return v.fs.Remove(filePath)
+}
+
+// List returns the archived versions of the named file, oldest first,
+// by asking the server for the containing collection.
+func (v *WebDAV) List(filePath string) ([]FileVersion, error) {
+	filePath = filepath.ToSlash(osutil.NativeFilename(filePath))
+	dir, file := path.Dir(filePath), path.Base(filePath)
+
+	req, err := http.NewRequest("PROPFIND", v.urlFor(dir)+"/", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Depth", "1")
+
+	resp, err := v.roundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("webdav: %s: %s", req.URL, resp.Status)
+	}
+
+	var status davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+
+	var versions []FileVersion
+	for _, dresp := range status.Responses {
+		base := path.Base(dresp.Href)
+		if unescaped, err := url.PathUnescape(base); err == nil {
+			base = unescaped
+		}
+		name, tag := UntagFilename(base)
+		if name != file || tag == "" {
+			continue
+		}
+		versionTime, err := time.ParseInLocation(TimeFormat, tag, time.Local)
+		if err != nil {
+			continue
+		}
+		modTime := versionTime
+		if t, err := http.ParseTime(dresp.Prop.Modified); err == nil {
+			modTime = t.Local().Truncate(time.Second)
+		}
+		versions = append(versions, FileVersion{
+			VersionTime: versionTime,
+			ModTime:     modTime,
+			Size:        dresp.Prop.Length,
+		})
+	}
+
+	sort.Slice(versions, func(a, b int) bool {
+		return versions[a].VersionTime.Before(versions[b].VersionTime)
+	})
+	return versions, nil
+}
+
+// Restore downloads the archived version from the given time, archiving
+// the current file first.
+func (v *WebDAV) Restore(filePath string, versionTime time.Time) error {
+	filePath = osutil.NativeFilename(filePath)
+	tag := versionTime.In(time.Local).Truncate(time.Second).Format(TimeFormat)
+	tagged := filepath.ToSlash(TagFilename(filePath, tag))
+
+	req, err := http.NewRequest("GET", v.urlFor(tagged), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.roundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webdav: %s: %s", req.URL, resp.Status)
+	}
+
+	// Download next to the target so the final rename is atomic.
+	v.fs.MkdirAll(filepath.Dir(filePath), 0755)
+	tmp := fs.TempName(filePath)
+	fd, err := v.fs.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(fd, resp.Body); err != nil {
+		fd.Close()
+		v.fs.Remove(tmp)
+		return err
+	}
+	if err := fd.Close(); err != nil {
+		return err
+	}
+	v.fs.Chtimes(tmp, versionTime, versionTime)
+
+	if _, err := v.fs.Lstat(filePath); err == nil {
+		if err := osutil.InWritableDir(v.Archive, v.fs, filePath); err != nil {
+			v.fs.Remove(tmp)
+			return err
+		}
+	}
+
+	return osutil.TryRename(v.fs, tmp, filePath)
+}
+
+// urlFor returns the server URL for the given slash separated path,
+// escaping each segment.
+func (v *WebDAV) urlFor(p string) string {
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return v.base.String() + "/" + strings.Join(segments, "/")
+}
+
+// mkColls creates the collections leading up to the given directory,
+// ignoring errors for those that already exist.
+func (v *WebDAV) mkColls(dir string) error {
+	if dir == "." || dir == "/" {
+		return nil
+	}
+	var p string
+	for _, segment := range strings.Split(strings.Trim(dir, "/"), "/") {
+		p = path.Join(p, segment)
+		req, err := http.NewRequest("MKCOL", v.urlFor(p)+"/", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := v.roundTrip(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		// 405 means the collection already exists.
+		if resp.StatusCode != http.StatusMethodNotAllowed && (resp.StatusCode < 200 || resp.StatusCode >= 300) {
+			return fmt.Errorf("webdav: %s: %s", req.URL, resp.Status)
+		}
+	}
+	return nil
+}
+
+func (v *WebDAV) roundTrip(req *http.Request) (*http.Response, error) {
+	if v.username != "" {
+		req.SetBasicAuth(v.username, v.password)
+	}
+	return v.client.Do(req)
+}
+
+func (v *WebDAV) do(req *http.Request) error {
+	resp, err := v.roundTrip(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webdav: %s: %s", req.URL, resp.Status)
+	}
+	return nil
+}
+
+type davMultistatus struct {
+	Responses []davResponse `xml:"response"`
+}
+
+type davResponse struct {
+	Href string  `xml:"href"`
+	Prop davProp `xml:"propstat>prop"`
+}
+
+type davProp struct {
+	Length   int64  `xml:"getcontentlength"`
+	Modified string `xml:"getlastmodified"`
+}
@@ -0,0 +1,113 @@
+// Copyright (C) 2019 The Syncthing Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package versioner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/fs"
+)
+
+// fakeDAVServer is the bare minimum of WebDAV for the versioner: PUT,
+// MKCOL, GET and a flat PROPFIND.
+type fakeDAVServer struct {
+	files map[string][]byte
+}
+
+func (s *fakeDAVServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	switch r.Method {
+	case "PUT":
+		bs, _ := ioutil.ReadAll(r.Body)
+		s.files[name] = bs
+		w.WriteHeader(http.StatusCreated)
+	case "MKCOL":
+		w.WriteHeader(http.StatusCreated)
+	case "GET":
+		bs, ok := s.files[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(bs)
+	case "PROPFIND":
+		dir := strings.Trim(name, "/")
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprintf(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:">`)
+		for file, bs := range s.files {
+			if path.Dir(file) != dir && !(dir == "" && path.Dir(file) == ".") {
+				continue
+			}
+			fmt.Fprintf(w, `<d:response><d:href>/%s</d:href><d:propstat><d:prop><d:getcontentlength>%d</d:getcontentlength></d:prop></d:propstat></d:response>`, file, len(bs))
+		}
+		fmt.Fprintf(w, `</d:multistatus>`)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestWebDAVArchiveListRestore(t *testing.T) {
+	os.RemoveAll("testdata")
+	defer os.RemoveAll("testdata")
+	os.MkdirAll(filepath.Join("testdata", "dir"), 0777)
+
+	server := &fakeDAVServer{files: make(map[string][]byte)}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	file := filepath.Join("dir", "file.txt")
+	if err := ioutil.WriteFile(filepath.Join("testdata", file), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	filesystem := fs.NewFilesystem(fs.FilesystemTypeBasic, "testdata")
+	versioner := NewWebDAV("default", filesystem, map[string]string{"url": ts.URL})
+
+	if err := versioner.Archive(file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join("testdata", file)); !os.IsNotExist(err) {
+		t.Error("expected the archived file to be gone locally")
+	}
+	if len(server.files) != 1 {
+		t.Fatalf("expected one file on the server, got %d", len(server.files))
+	}
+
+	versions, err := versioner.List(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 {
+		t.Fatalf("expected one version, got %d", len(versions))
+	}
+	if versions[0].Size != 3 {
+		t.Errorf("unexpected size %d", versions[0].Size)
+	}
+
+	if err := versioner.Restore(file, versions[0].VersionTime); err != nil {
+		t.Fatal(err)
+	}
+	if bs, err := ioutil.ReadFile(filepath.Join("testdata", file)); err != nil {
+		t.Fatal(err)
+	} else if string(bs) != "old" {
+		t.Errorf("expected the old content to be restored, got %q", bs)
+	}
+
+	// Restoring a version that isn't on the server is an error.
+	if err := versioner.Restore(file, time.Unix(86400, 0)); err == nil {
+		t.Error("expected an error restoring a nonexistent version")
+	}
+}